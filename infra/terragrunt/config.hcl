@@ -1,11 +1,24 @@
 locals {
-  # Dynamically load the configuration JSON file from the environment variable
-  default_env_config_json_path = "${get_repo_root()}/infra/.infractl-cache/test.json"
-  env_config_json_path = get_env("INFRACTL_CONFIG_JSON_PATH", local.default_env_config_json_path)
+  # Transport contract with infractl (see tools/infractl/internal/cfg/transmitter.go):
+  # - The path to the compiled configuration is handed over through INFRACTL_CONFIG_FILE_PATH. There's
+  #   deliberately no fallback, so a missing variable fails loudly instead of reading a stale file.
+  # - The compiled configuration carries a schema_version, which must match the version supported here.
+  # - The compiled configuration holds no secrets: sensitive values are ${INFRACTL_*} placeholders. infractl
+  #   passes the values of the providers a component uses to its terragrunt process through those variables.
+  # - The compiled configuration is scoped to the components of the run: it only holds the providers they use,
+  #   and the secret groups those providers read.
+  supported_schema_version = 2
+  env_config_json_path = get_env("INFRACTL_CONFIG_FILE_PATH")
+
+  # Matches a sealed value placeholder, capturing the variable that delivers the value
+  secret_placeholder_pattern = "^\\$\\{(INFRACTL_[A-Z0-9_]+)\\}$"
 
   # Ensure the file exists and is readable
   config_file = jsondecode(file(local.env_config_json_path))
 
+  # Fails the run (tonumber cannot convert the message) when the schema version is not the supported one
+  schema_version = local.config_file.schema_version == local.supported_schema_version ? local.config_file.schema_version : tonumber("unsupported infractl configuration schema_version ${local.config_file.schema_version}, expected ${local.supported_schema_version}")
+
 # Top-level configurations matching YAML/JSON structure
   config = {
     version     = local.config_file.config.version
@@ -44,7 +57,14 @@ locals {
   # Providers Configuration
   providers = {
     for name, provider in local.config_file.providers : name => {
-      config = provider.config
+      # Placeholders of the providers the component doesn't use are not delivered, and resolve to ""
+      config = {
+        for key, value in provider.config : key => (
+          can(regex(local.secret_placeholder_pattern, value))
+          ? get_env(regex(local.secret_placeholder_pattern, value)[0], "")
+          : value
+        )
+      }
       version_constraint = {
         source = provider.version_constraint.source
         required_version = provider.version_constraint.required_version
@@ -62,7 +62,7 @@ func CreateFileInInfraCacheDir(filename, filecontent string) (string, error) {
 	}
 
 	destinationFilePath := filepath.Join(cacheDir, filename)
-	fileCreatedInCacheDir, fileCreatedErr := utils.CreateFileWithContentIdempotent(destinationFilePath, filecontent)
+	fileCreatedInCacheDir, fileCreatedErr := utils.CreateFileWithContentIdempotent(destinationFilePath, filecontent, TransportFileMode)
 
 	if fileCreatedErr != nil {
 		return "", fmt.Errorf("failed to create file in cache directory: %w", fileCreatedErr)
@@ -7,9 +7,11 @@
 	EnvsDirectory = "_ENVS"
 	InfraDir      = "infra"
 	TerragruntDir = "terragrunt"
+	TerraformDir  = "terraform"
 	CacheDir      = ".infractl-cache"
 	// Defaults
 	EnvCfgBaseFilenameDefault = "base.yaml"
+	EnvCfgBaseNameDefault     = "base"
 	// Cache and Temporal
 	TempDirPrefix = ".temp-"
 )
@@ -0,0 +1,161 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtendsKey is the key, at the top of an environment configuration file, listing the environments it inherits
+// from, e.g.: extends: [base, eu-region, prod-common]
+const ExtendsKey = "extends"
+
+// EnvLayer is an environment configuration file in an inheritance chain.
+type EnvLayer struct {
+	// Name is the name of the environment, e.g. 'prod' for _ENVS/prod.yaml
+	Name string
+	// Path is the absolute path to the environment configuration file.
+	Path string
+	// Document is the raw content of the file, as read by ReadEnvConfigDocument.
+	Document map[string]interface{}
+}
+
+// EnvDocumentLoader loads the raw configuration document of an environment, given its name.
+type EnvDocumentLoader func(envName string) (path string, document map[string]interface{}, err error)
+
+// ResolveInheritanceChain resolves the environments a target environment inherits from, following their
+// 'extends' keys, into the order they must be merged in.
+//
+// An environment that doesn't declare 'extends' inherits from the base environment (except the base
+// environment itself). Parents are merged in the order they're declared, so later ones override earlier ones,
+// and every environment is merged once, right after all of its own parents, even if several environments of
+// the chain extend it (e.g. 'eu-region' and 'prod-common' both extending 'base').
+//
+// Parameters:
+//   - targetEnv: The name of the target environment.
+//   - load: The function loading the raw document of an environment by name.
+//
+// Returns:
+//   - The environments to merge, from the most generic one to the target environment.
+//   - An error if an environment cannot be loaded, declares an invalid 'extends', or the chain has a cycle.
+func ResolveInheritanceChain(targetEnv string, load EnvDocumentLoader) ([]EnvLayer, error) {
+	var chain []EnvLayer
+	resolved := map[string]bool{}
+	var visiting []string
+
+	var visit func(envName, extendedBy string) error
+	visit = func(envName, extendedBy string) error {
+		if resolved[envName] {
+			return nil
+		}
+
+		for i, name := range visiting {
+			if name == envName {
+				cycle := append(append([]string{}, visiting[i:]...), envName)
+				return fmt.Errorf("environment inheritance cycle detected: %s", strings.Join(cycle, " -> "))
+			}
+		}
+
+		path, document, err := load(envName)
+		if err != nil {
+			if extendedBy != "" {
+				return fmt.Errorf("failed to load environment '%s', extended by '%s': %w", envName, extendedBy, err)
+			}
+			return fmt.Errorf("failed to load environment '%s': %w", envName, err)
+		}
+
+		parents, err := extendsOf(envName, path, document)
+		if err != nil {
+			return err
+		}
+
+		visiting = append(visiting, envName)
+		for _, parent := range parents {
+			if err := visit(parent, envName); err != nil {
+				return err
+			}
+		}
+		visiting = visiting[:len(visiting)-1]
+
+		resolved[envName] = true
+		chain = append(chain, EnvLayer{Name: envName, Path: path, Document: document})
+
+		return nil
+	}
+
+	if err := visit(targetEnv, ""); err != nil {
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+// MergeInheritanceChain deep merges the environments of an inheritance chain, in order, with MergeConfigs.
+//
+// Parameters:
+//   - chain: The environments to merge, as returned by ResolveInheritanceChain.
+//
+// Returns:
+//   - The merged raw document, without the 'extends' key.
+//   - An error naming the environment whose merge failed.
+func MergeInheritanceChain(chain []EnvLayer) (map[string]interface{}, error) {
+	merged := map[string]interface{}{}
+
+	for _, layer := range chain {
+		document := make(map[string]interface{}, len(layer.Document))
+		for key, value := range layer.Document {
+			if key != ExtendsKey {
+				document[key] = value
+			}
+		}
+
+		var err error
+		merged, err = MergeConfigs(merged, document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge environment '%s' (%s): %w", layer.Name, layer.Path, err)
+		}
+	}
+
+	return merged, nil
+}
+
+// extendsOf returns the environments an environment extends, defaulting to the base environment.
+func extendsOf(envName, path string, document map[string]interface{}) ([]string, error) {
+	raw, declared := document[ExtendsKey]
+	if !declared || raw == nil {
+		if envName == EnvCfgBaseNameDefault {
+			return nil, nil
+		}
+		return []string{EnvCfgBaseNameDefault}, nil
+	}
+
+	var parents []string
+	switch value := raw.(type) {
+	case string:
+		parents = []string{value}
+	case []interface{}:
+		for _, element := range value {
+			parent, ok := element.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid '%s' in environment '%s' (%s): expected a list of environment names, got %v", ExtendsKey, envName, path, element)
+			}
+			parents = append(parents, parent)
+		}
+	default:
+		return nil, fmt.Errorf("invalid '%s' in environment '%s' (%s): expected a list of environment names, got %v", ExtendsKey, envName, path, raw)
+	}
+
+	seen := map[string]bool{}
+	for i, parent := range parents {
+		parent = strings.TrimSpace(parent)
+		parents[i] = parent
+		if parent == "" {
+			return nil, fmt.Errorf("invalid '%s' in environment '%s' (%s): environment names cannot be empty", ExtendsKey, envName, path)
+		}
+		if seen[parent] {
+			return nil, fmt.Errorf("invalid '%s' in environment '%s' (%s): '%s' is listed more than once", ExtendsKey, envName, path, parent)
+		}
+		seen[parent] = true
+	}
+
+	return parents, nil
+}
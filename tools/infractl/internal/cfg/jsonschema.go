@@ -0,0 +1,443 @@
+package cfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// JSONSchemaDialect is the JSON Schema dialect of the generated schema.
+	JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+	// EnvConfigSchemaID is the identifier of the environment configuration schema.
+	EnvConfigSchemaID = "https://github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/env-config.schema.json"
+
+	// mergeDirectiveDef is the name of the definition describing a '$patch' merge directive.
+	mergeDirectiveDef = "MergeDirective"
+)
+
+// JSONSchema is a JSON Schema document, or one of its subschemas. Only the keywords the environment
+// configuration schema uses are modelled.
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	ID          string `json:"$id,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	// AdditionalProperties is either a boolean, or the *JSONSchema of the properties not listed in Properties.
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+// GenerateEnvConfigSchema generates the JSON Schema of an environment configuration file (_ENVS/<env>.yaml)
+// from EnvConfig and its nested structs. Every struct becomes a definition that rejects unknown keys; maps
+// accept any key; the elements of lists of structs (stacks, layers, components) require a 'name', since they
+// merge by name. The 'extends' key and the '$patch' merge directives are part of the schema.
+//
+// Keys are not required at the top level, because an environment file only holds what it overrides; the
+// required fields of the merged configuration (e.g. config.version) are checked when it's compiled.
+//
+// Returns:
+//   - The JSON Schema of an environment configuration file.
+func GenerateEnvConfigSchema() *JSONSchema {
+	defs := map[string]*JSONSchema{
+		mergeDirectiveDef: {
+			Type:        "object",
+			Description: "Merge directive: '$patch: delete' removes the inherited element, '$patch: replace' takes this element as-is. As a list element, '- $patch: replace' replaces the whole inherited list.",
+			Properties: map[string]*JSONSchema{
+				MergeDirectiveKey: {Type: "string", Enum: []string{MergeDirectiveDelete, MergeDirectiveReplace}},
+			},
+			Required:             []string{MergeDirectiveKey},
+			AdditionalProperties: false,
+		},
+	}
+
+	root := schemaForType(reflect.TypeOf(EnvConfig{}), defs)
+	rootDef := defs[root.Ref[len("#/$defs/"):]]
+	rootDef.Properties[ExtendsKey] = &JSONSchema{
+		Description: "Environments this environment inherits from, merged in order before it. Defaults to 'base'.",
+		AnyOf: []*JSONSchema{
+			{Type: "string"},
+			{Type: "array", Items: &JSONSchema{Type: "string"}},
+		},
+	}
+
+	return &JSONSchema{
+		Schema:      JSONSchemaDialect,
+		ID:          EnvConfigSchemaID,
+		Title:       "infractl environment configuration",
+		Description: "An infractl environment configuration file (infra/terragrunt/_ENVS/<env>.yaml), deep merged over the environments it extends.",
+		Ref:         root.Ref,
+		Defs:        defs,
+	}
+}
+
+// ExportEnvConfigSchema renders the environment configuration schema as indented JSON.
+func ExportEnvConfigSchema() (string, error) {
+	content, err := json.MarshalIndent(GenerateEnvConfigSchema(), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling the environment configuration schema to JSON: %w", err)
+	}
+
+	return string(content) + "\n", nil
+}
+
+// schemaForType generates the schema of a Go type, registering the structs it uses as definitions.
+func schemaForType(t reflect.Type, defs map[string]*JSONSchema) *JSONSchema {
+	switch t.Kind() {
+	case reflect.Struct:
+		name := t.Name()
+		if _, exists := defs[name]; !exists {
+			def := &JSONSchema{
+				Type:                 "object",
+				Title:                name,
+				Properties:           map[string]*JSONSchema{},
+				AdditionalProperties: false,
+			}
+			// Registered before its fields, so recursive types resolve to the same definition.
+			defs[name] = def
+
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+				if key == "" || key == "-" {
+					continue
+				}
+				def.Properties[key] = schemaForType(field.Type, defs)
+			}
+			def.Properties[MergeDirectiveKey] = &JSONSchema{Type: "string", Enum: []string{MergeDirectiveDelete, MergeDirectiveReplace}}
+		}
+
+		return &JSONSchema{Ref: "#/$defs/" + name}
+
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaForType(t.Elem(), defs)}
+
+	case reflect.Slice:
+		items := schemaForType(t.Elem(), defs)
+		if t.Elem().Kind() == reflect.Struct {
+			// Lists of structs merge by name, so their elements must be named.
+			def := defs[t.Elem().Name()]
+			if _, named := def.Properties[mergeIdentityKey]; named {
+				def.Required = []string{mergeIdentityKey}
+			}
+			items = &JSONSchema{AnyOf: []*JSONSchema{items, {Ref: "#/$defs/" + mergeDirectiveDef}}}
+		}
+		return &JSONSchema{Type: "array", Items: items}
+
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+
+	default:
+		// interface{} and anything else accept any value.
+		return &JSONSchema{}
+	}
+}
+
+// SchemaViolation is a value of an environment configuration file that doesn't match the schema.
+type SchemaViolation struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+// String renders the violation as <file>:<line>:<column>: <path>: <message>
+func (v SchemaViolation) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", v.File, v.Line, v.Column, displayPath(v.Path), v.Message)
+}
+
+// SchemaValidationError lists every schema violation of an environment configuration file.
+type SchemaValidationError struct {
+	File       string
+	Violations []SchemaViolation
+}
+
+func (e *SchemaValidationError) Error() string {
+	lines := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		lines = append(lines, "  - "+violation.String())
+	}
+
+	return fmt.Sprintf("environment configuration file %s does not match the schema (run 'infractl schema export' to get it):\n%s",
+		e.File, strings.Join(lines, "\n"))
+}
+
+// ValidateEnvConfigNode validates a parsed environment configuration file against the schema.
+//
+// Parameters:
+//   - file: The path to the file, used in the violations.
+//   - root: The parsed file, as a YAML document node.
+//
+// Returns:
+//   - A *SchemaValidationError listing every violation, or nil if the file matches the schema.
+func ValidateEnvConfigNode(file string, root *yaml.Node) error {
+	if root == nil || len(root.Content) == 0 {
+		return nil
+	}
+
+	schema := GenerateEnvConfigSchema()
+	validator := &schemaValidator{file: file, defs: schema.Defs}
+	validator.validate(root.Content[0], schema, "")
+
+	if len(validator.violations) == 0 {
+		return nil
+	}
+
+	return &SchemaValidationError{File: file, Violations: validator.violations}
+}
+
+type schemaValidator struct {
+	file       string
+	defs       map[string]*JSONSchema
+	violations []SchemaViolation
+}
+
+func (v *schemaValidator) report(node *yaml.Node, path, format string, args ...interface{}) {
+	v.violations = append(v.violations, SchemaViolation{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *schemaValidator) resolve(schema *JSONSchema) *JSONSchema {
+	for schema.Ref != "" {
+		schema = v.defs[strings.TrimPrefix(schema.Ref, "#/$defs/")]
+	}
+	return schema
+}
+
+func (v *schemaValidator) validate(node *yaml.Node, schema *JSONSchema, path string) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	schema = v.resolve(schema)
+
+	// A null value leaves the inherited value untouched; it's not a value to validate.
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	// A mapping holding only a merge directive deletes or replaces the inherited value, whatever its type.
+	if isDirectiveNode(node) {
+		schema = v.defs[mergeDirectiveDef]
+	}
+
+	if len(schema.AnyOf) > 0 {
+		v.validateAnyOf(node, schema, path)
+		return
+	}
+
+	if schema.Type != "" && !nodeMatchesType(node, schema.Type) {
+		v.report(node, path, "expected %s, got %s", schema.Type, nodeTypeName(node))
+		return
+	}
+
+	if len(schema.Enum) > 0 && !containsString(schema.Enum, node.Value) {
+		v.report(node, path, "'%s' is not one of: %s", node.Value, strings.Join(schema.Enum, ", "))
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		v.validateMapping(node, schema, path)
+
+	case yaml.SequenceNode:
+		if schema.Items == nil {
+			return
+		}
+		named := true
+		for _, element := range node.Content {
+			if !isDirectiveNode(element) && nodeName(element) == "" {
+				named = false
+			}
+		}
+		index := 0
+		for _, element := range node.Content {
+			if isDirectiveNode(element) {
+				v.validate(element, schema.Items, path)
+				continue
+			}
+			elementPath := fmt.Sprintf("%s[%d]", path, index)
+			if named {
+				elementPath = namedPath(path, nodeName(element))
+			}
+			v.validate(element, schema.Items, elementPath)
+			index++
+		}
+	}
+}
+
+func (v *schemaValidator) validateMapping(node *yaml.Node, schema *JSONSchema, path string) {
+	seen := map[string]bool{}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+
+		// YAML merge keys inline another mapping, whose keys are validated as if they were written here.
+		if key.Value == "<<" {
+			v.validate(value, &JSONSchema{Type: "object", Properties: schema.Properties, AdditionalProperties: schema.AdditionalProperties}, path)
+			continue
+		}
+
+		seen[key.Value] = true
+		keyPath := joinPath(path, key.Value)
+
+		if propertySchema, ok := schema.Properties[key.Value]; ok {
+			v.validate(value, propertySchema, keyPath)
+			continue
+		}
+
+		switch additional := schema.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				v.report(key, keyPath, "unknown key '%s'%s", key.Value, suggestKey(key.Value, schema.Properties))
+			}
+		case *JSONSchema:
+			v.validate(value, additional, keyPath)
+		}
+	}
+
+	for _, required := range schema.Required {
+		if !seen[required] {
+			v.report(node, path, "missing required key '%s'", required)
+		}
+	}
+}
+
+// validateAnyOf validates a node against the first subschema of an anyOf matching its type, so the
+// violations reported are the ones of the value the author most likely meant.
+func (v *schemaValidator) validateAnyOf(node *yaml.Node, schema *JSONSchema, path string) {
+	var expected []string
+	for _, candidate := range schema.AnyOf {
+		resolved := v.resolve(candidate)
+		if resolved.Type == "" || nodeMatchesType(node, resolved.Type) {
+			v.validate(node, candidate, path)
+			return
+		}
+		expected = append(expected, resolved.Type)
+	}
+
+	v.report(node, path, "expected %s, got %s", strings.Join(expected, " or "), nodeTypeName(node))
+}
+
+// nodeMatchesType reports whether a YAML node holds a value of the given JSON Schema type.
+func nodeMatchesType(node *yaml.Node, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		return node.Kind == yaml.MappingNode
+	case "array":
+		return node.Kind == yaml.SequenceNode
+	case "string":
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!str"
+	case "boolean":
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!bool"
+	case "integer":
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!int"
+	case "number":
+		return node.Kind == yaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float")
+	default:
+		return true
+	}
+}
+
+// nodeTypeName names the JSON Schema type of the value a YAML node holds.
+func nodeTypeName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+
+	switch node.Tag {
+	case "!!str":
+		return fmt.Sprintf("string '%s'", node.Value)
+	case "!!bool":
+		return fmt.Sprintf("boolean %s", node.Value)
+	case "!!int":
+		return fmt.Sprintf("integer %s", node.Value)
+	case "!!float":
+		return fmt.Sprintf("number %s", node.Value)
+	default:
+		return node.Tag
+	}
+}
+
+// suggestKey suggests the closest known key for an unknown one, e.g. version_constraint for version_constraints,
+// or lists the known keys when none is close.
+func suggestKey(key string, properties map[string]*JSONSchema) string {
+	var known []string
+	best, bestDistance := "", 3
+
+	for _, candidate := range SortedValuePaths(properties) {
+		if candidate == MergeDirectiveKey {
+			continue
+		}
+		known = append(known, candidate)
+		if distance := editDistance(key, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	if best != "" {
+		return fmt.Sprintf(", did you mean '%s'?", best)
+	}
+
+	return fmt.Sprintf(", expected one of: %s", strings.Join(known, ", "))
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
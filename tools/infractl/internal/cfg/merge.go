@@ -0,0 +1,325 @@
+package cfg
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// MergeDirectiveKey is the key, in a mapping or in an element of a named list, that holds a merge directive.
+	MergeDirectiveKey = "$patch"
+	// MergeDirectiveDelete removes the key, or the named list element, from the configuration being merged into.
+	MergeDirectiveDelete = "delete"
+	// MergeDirectiveReplace replaces the mapping, the named list element, or the whole list (when it's an element
+	// of its own, e.g.: - $patch: replace) instead of merging it.
+	MergeDirectiveReplace = "replace"
+
+	// mergeIdentityKey is the key that identifies the elements of lists merged by name, such as stacks, layers
+	// and components.
+	mergeIdentityKey = "name"
+)
+
+// MergeConfigs deep merges two raw environment configuration documents, where the target overrides the base.
+//
+// The merge is structural:
+//   - Mappings merge key by key, recursively (e.g. providers, secrets, tags, inputs).
+//   - Lists whose elements are all mappings with a 'name' (stacks, layers, components) merge element by element,
+//     matched by name. Base elements keep their order, and new target elements are appended.
+//   - Any other list, and every scalar, is replaced by the target value.
+//   - A null target value (e.g. a key with only comments below it) leaves the base value untouched.
+//
+// The behaviour can be overridden with the '$patch' directive:
+//   - '$patch: delete' in a mapping or a named list element removes it from the result.
+//   - '$patch: replace' in a mapping or a named list element replaces it instead of merging it.
+//   - A '- $patch: replace' element in a list replaces the whole list with the other elements.
+//
+// Parameters:
+//   - base: The base configuration document. If nil, the target is returned (without directives).
+//   - target: The target configuration document. If nil, the base is returned (without directives).
+//
+// Returns:
+//   - A new document with the merged configuration; the inputs are not mutated.
+//   - An error if a directive is invalid, naming the path where it was found.
+func MergeConfigs(base, target map[string]interface{}) (map[string]interface{}, error) {
+	merged, err := mergeValues(base, target, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if merged == nil {
+		return map[string]interface{}{}, nil
+	}
+
+	return merged.(map[string]interface{}), nil
+}
+
+// mergeValues merges an override value into a base value, at the given path.
+func mergeValues(base, override interface{}, path string) (interface{}, error) {
+	if override == nil {
+		return stripDirectives(base, path)
+	}
+
+	switch overrideValue := override.(type) {
+	case map[string]interface{}:
+		directive, err := mergeDirective(overrideValue, path)
+		if err != nil {
+			return nil, err
+		}
+
+		baseMap, isMap := base.(map[string]interface{})
+		if directive == MergeDirectiveReplace || !isMap {
+			return stripDirectives(overrideValue, path)
+		}
+
+		return mergeMaps(baseMap, overrideValue, path)
+
+	case []interface{}:
+		elements, replace, err := listDirective(overrideValue, path)
+		if err != nil {
+			return nil, err
+		}
+
+		baseList, isList := base.([]interface{})
+		if replace || !isList || !isNamedList(baseList) || !isNamedList(elements) {
+			return stripDirectives(elements, path)
+		}
+
+		return mergeNamedLists(baseList, elements, path)
+
+	default:
+		return override, nil
+	}
+}
+
+// mergeMaps merges the keys of an override mapping into a base mapping.
+func mergeMaps(base, override map[string]interface{}, path string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(base)+len(override))
+
+	for key, value := range base {
+		stripped, err := stripDirectives(value, joinPath(path, key))
+		if err != nil {
+			return nil, err
+		}
+		merged[key] = stripped
+	}
+
+	for _, key := range sortedMapKeys(override) {
+		if key == MergeDirectiveKey {
+			continue
+		}
+
+		keyPath := joinPath(path, key)
+		value := override[key]
+
+		if isDeleteDirective(value) {
+			delete(merged, key)
+			continue
+		}
+
+		mergedValue, err := mergeValues(base[key], value, keyPath)
+		if err != nil {
+			return nil, err
+		}
+
+		merged[key] = mergedValue
+	}
+
+	return merged, nil
+}
+
+// mergeNamedLists merges the elements of two lists of named mappings, matching them by name.
+func mergeNamedLists(base, override []interface{}, path string) ([]interface{}, error) {
+	var merged []interface{}
+	positions := map[string]int{}
+	deleted := map[string]bool{}
+
+	for _, element := range base {
+		name := elementName(element)
+		positions[name] = len(merged)
+		stripped, err := stripDirectives(element, namedPath(path, name))
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, stripped)
+	}
+
+	for _, element := range override {
+		name := elementName(element)
+		elementPath := namedPath(path, name)
+
+		if isDeleteDirective(element) {
+			deleted[name] = true
+			continue
+		}
+
+		position, exists := positions[name]
+		if !exists {
+			stripped, err := stripDirectives(element, elementPath)
+			if err != nil {
+				return nil, err
+			}
+			positions[name] = len(merged)
+			merged = append(merged, stripped)
+			continue
+		}
+
+		mergedElement, err := mergeValues(merged[position], element, elementPath)
+		if err != nil {
+			return nil, err
+		}
+		merged[position] = mergedElement
+	}
+
+	result := make([]interface{}, 0, len(merged))
+	for _, element := range merged {
+		if !deleted[elementName(element)] {
+			result = append(result, element)
+		}
+	}
+
+	return result, nil
+}
+
+// mergeDirective returns the directive of a mapping, if any, validating it.
+func mergeDirective(value map[string]interface{}, path string) (string, error) {
+	raw, ok := value[MergeDirectiveKey]
+	if !ok {
+		return "", nil
+	}
+
+	directive, _ := raw.(string)
+	switch directive {
+	case MergeDirectiveDelete, MergeDirectiveReplace:
+		return directive, nil
+	default:
+		return "", fmt.Errorf("invalid merge directive '%s: %v' at '%s', expected '%s' or '%s'", MergeDirectiveKey, raw, displayPath(path), MergeDirectiveDelete, MergeDirectiveReplace)
+	}
+}
+
+// listDirective finds a '- $patch: replace' element in a list, and returns the other elements.
+func listDirective(list []interface{}, path string) ([]interface{}, bool, error) {
+	var elements []interface{}
+	replace := false
+
+	for _, element := range list {
+		elementMap, ok := element.(map[string]interface{})
+		if ok && len(elementMap) == 1 {
+			if _, hasDirective := elementMap[MergeDirectiveKey]; hasDirective {
+				directive, err := mergeDirective(elementMap, path)
+				if err != nil {
+					return nil, false, err
+				}
+				if directive != MergeDirectiveReplace {
+					return nil, false, fmt.Errorf("invalid merge directive for the list at '%s': only '- %s: %s' is supported", displayPath(path), MergeDirectiveKey, MergeDirectiveReplace)
+				}
+				replace = true
+				continue
+			}
+		}
+		elements = append(elements, element)
+	}
+
+	return elements, replace, nil
+}
+
+// stripDirectives returns a copy of a value without merge directives. Elements marked for deletion are
+// dropped, since there's nothing to delete them from.
+func stripDirectives(value interface{}, path string) (interface{}, error) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if _, err := mergeDirective(typed, path); err != nil {
+			return nil, err
+		}
+
+		stripped := make(map[string]interface{}, len(typed))
+		for key, nested := range typed {
+			if key == MergeDirectiveKey || isDeleteDirective(nested) {
+				continue
+			}
+			strippedNested, err := stripDirectives(nested, joinPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+			stripped[key] = strippedNested
+		}
+		return stripped, nil
+
+	case []interface{}:
+		elements, _, err := listDirective(typed, path)
+		if err != nil {
+			return nil, err
+		}
+
+		stripped := make([]interface{}, 0, len(elements))
+		for i, element := range elements {
+			if isDeleteDirective(element) {
+				continue
+			}
+			strippedElement, err := stripDirectives(element, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			stripped = append(stripped, strippedElement)
+		}
+		return stripped, nil
+
+	default:
+		return value, nil
+	}
+}
+
+func isDeleteDirective(value interface{}) bool {
+	valueMap, ok := value.(map[string]interface{})
+	return ok && valueMap[MergeDirectiveKey] == MergeDirectiveDelete
+}
+
+// isNamedList reports whether a list has elements, and every one of them is a mapping with a name. Empty lists
+// aren't named lists, so an empty list in the target (e.g. stacks: []) replaces the base list.
+func isNamedList(list []interface{}) bool {
+	if len(list) == 0 {
+		return false
+	}
+
+	for _, element := range list {
+		if elementName(element) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func elementName(element interface{}) string {
+	elementMap, ok := element.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := elementMap[mergeIdentityKey].(string)
+	return name
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func namedPath(path, name string) string {
+	return fmt.Sprintf("%s[%s]", path, name)
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "<root>"
+	}
+	return path
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
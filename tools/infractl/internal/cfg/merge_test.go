@@ -0,0 +1,256 @@
+package cfg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parseTestDocument(t *testing.T, content string) map[string]interface{} {
+	t.Helper()
+
+	if content == "" {
+		return nil
+	}
+
+	var document map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		t.Fatalf("parsing the document: %v\n%s", err, content)
+	}
+
+	return document
+}
+
+func TestMergeConfigs(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		target  string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "mappings merge key by key",
+			base: `
+providers:
+  aws:
+    config: {region: us-east-1, profile: base}
+    version_constraint: {source: hashicorp/aws, required_version: "5.0.0"}
+product: {name: seko-saas, version: "0.0.1"}
+`,
+			target: `
+providers:
+  aws:
+    config: {region: eu-west-1}
+  random:
+    config: {}
+product: {name: ref-arch}
+`,
+			want: `
+providers:
+  aws:
+    config: {region: eu-west-1, profile: base}
+    version_constraint: {source: hashicorp/aws, required_version: "5.0.0"}
+  random:
+    config: {}
+product: {name: ref-arch, version: "0.0.1"}
+`,
+		},
+		{
+			name:   "null target values keep the base",
+			base:   "secrets: {aws: {access_key_id: a}}\nproduct: {name: base}\n",
+			target: "secrets:\nproduct: {name: null}\n",
+			want:   "secrets: {aws: {access_key_id: a}}\nproduct: {name: base}\n",
+		},
+		{
+			name:   "scalars and mappings replace each other",
+			base:   "a: {b: 1}\nc: 2\n",
+			target: "a: scalar\nc: {d: 3}\n",
+			want:   "a: scalar\nc: {d: 3}\n",
+		},
+		{
+			name: "named lists merge by name, appending new elements",
+			base: `
+stacks:
+  - name: stack-datastore
+    tags: {base_tag: base}
+    layers:
+      - name: db
+        components:
+          - {name: id-generator, providers: [random], tags: {a: base}}
+          - {name: name-generator, providers: [random]}
+  - name: stack-network
+`,
+			target: `
+stacks:
+  - name: stack-datastore
+    tags: {purpose: demo}
+    layers:
+      - name: db
+        components:
+          - {name: aws-dynamodb-table, providers: [aws]}
+          - {name: id-generator, tags: {b: target}}
+      - name: cache
+`,
+			want: `
+stacks:
+  - name: stack-datastore
+    tags: {base_tag: base, purpose: demo}
+    layers:
+      - name: db
+        components:
+          - {name: id-generator, providers: [random], tags: {a: base, b: target}}
+          - {name: name-generator, providers: [random]}
+          - {name: aws-dynamodb-table, providers: [aws]}
+      - name: cache
+  - name: stack-network
+`,
+		},
+		{
+			name:   "other lists are replaced",
+			base:   "stacks: [{name: s, layers: [{name: l, components: [{name: c, providers: [aws, random]}]}]}]\nlist: [1, 2, 3]\n",
+			target: "stacks: [{name: s, layers: [{name: l, components: [{name: c, providers: [random]}]}]}]\nlist: [4]\n",
+			want:   "stacks: [{name: s, layers: [{name: l, components: [{name: c, providers: [random]}]}]}]\nlist: [4]\n",
+		},
+		{
+			name:   "lists not all named are replaced",
+			base:   "items: [{name: a, x: 1}, {name: b}]\n",
+			target: "items: [{name: a, y: 2}, {unnamed: true}]\n",
+			want:   "items: [{name: a, y: 2}, {unnamed: true}]\n",
+		},
+		{
+			name:   "empty lists replace named lists",
+			base:   "stacks: [{name: a, layers: [{name: db}]}]\n",
+			target: "stacks: [{name: a, layers: []}]\n",
+			want:   "stacks: [{name: a, layers: []}]\n",
+		},
+		{
+			name:   "named lists replace empty lists",
+			base:   "stacks: []\n",
+			target: "stacks: [{name: a}, {name: b, $patch: delete}]\n",
+			want:   "stacks: [{name: a}]\n",
+		},
+		{
+			name:   "$patch: delete removes a key",
+			base:   "providers: {aws: {config: {region: us-east-1}}, random: {config: {}}}\nsecrets: {aws: {access_key_id: a, secret_access_key: b}}\n",
+			target: "providers: {aws: {$patch: delete}}\nsecrets: {aws: {secret_access_key: {$patch: delete}}}\n",
+			want:   "providers: {random: {config: {}}}\nsecrets: {aws: {access_key_id: a}}\n",
+		},
+		{
+			name:   "$patch: delete of a key the base doesn't have",
+			base:   "providers: {random: {config: {}}}\n",
+			target: "providers: {aws: {$patch: delete}}\n",
+			want:   "providers: {random: {config: {}}}\n",
+		},
+		{
+			name:   "$patch: delete removes a named element",
+			base:   "stacks: [{name: a}, {name: b, layers: [{name: db}, {name: cache}]}]\n",
+			target: "stacks: [{name: a, $patch: delete}, {name: b, layers: [{name: cache, $patch: delete}]}]\n",
+			want:   "stacks: [{name: b, layers: [{name: db}]}]\n",
+		},
+		{
+			name:   "$patch: replace takes a mapping as-is",
+			base:   "providers: {aws: {config: {region: us-east-1, profile: base}, version_constraint: {source: hashicorp/aws}}}\n",
+			target: "providers: {aws: {$patch: replace, config: {region: eu-west-1}}}\n",
+			want:   "providers: {aws: {config: {region: eu-west-1}}}\n",
+		},
+		{
+			name:   "$patch: replace takes a named element as-is",
+			base:   "stacks: [{name: a, tags: {x: '1'}, layers: [{name: db}]}, {name: b}]\n",
+			target: "stacks: [{name: a, $patch: replace, tags: {y: '2'}}]\n",
+			want:   "stacks: [{name: a, tags: {y: '2'}}, {name: b}]\n",
+		},
+		{
+			name:   "- $patch: replace replaces the whole list",
+			base:   "stacks: [{name: a}, {name: b, tags: {x: '1'}}]\n",
+			target: "stacks: [{$patch: replace}, {name: b}, {name: c}]\n",
+			want:   "stacks: [{name: b}, {name: c}]\n",
+		},
+		{
+			name:   "directives of new values are stripped",
+			base:   "stacks: [{name: a}]\n",
+			target: "stacks: [{name: b, $patch: replace, tags: {x: {$patch: delete}}}]\nproviders: {aws: {$patch: replace, config: {region: eu-west-1, old: {$patch: delete}}}}\n",
+			want:   "stacks: [{name: a}, {name: b, tags: {}}]\nproviders: {aws: {config: {region: eu-west-1}}}\n",
+		},
+		{
+			name:   "no base",
+			target: "product: {name: ref-arch, $patch: replace}\n",
+			want:   "product: {name: ref-arch}\n",
+		},
+		{
+			name: "no target",
+			base: "product: {name: ref-arch}\n",
+			want: "product: {name: ref-arch}\n",
+		},
+		{
+			name:    "unknown directive",
+			base:    "providers: {aws: {config: {}}}\n",
+			target:  "providers: {aws: {$patch: merge}}\n",
+			wantErr: "invalid merge directive '$patch: merge' at 'providers.aws'",
+		},
+		{
+			name:    "unknown directive in a named element",
+			base:    "stacks: [{name: a, layers: [{name: db}]}]\n",
+			target:  "stacks: [{name: a, layers: [{name: db, $patch: keep}]}]\n",
+			wantErr: "at 'stacks[a].layers[db]'",
+		},
+		{
+			name:    "unknown directive in a new list",
+			base:    "stacks: [{name: a}]\n",
+			target:  "stacks: [{name: a, layers: [{name: db, $patch: keep}]}]\n",
+			wantErr: "at 'stacks[a].layers[0]'",
+		},
+		{
+			name:    "delete directive as a list element",
+			base:    "stacks: [{name: a}]\n",
+			target:  "stacks: [{$patch: delete}, {name: b}]\n",
+			wantErr: "invalid merge directive for the list at 'stacks'",
+		},
+		{
+			name:    "unknown directive in the base",
+			base:    "product: {name: a, $patch: nope}\n",
+			target:  "config: {}\n",
+			wantErr: "at 'product'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeConfigs(parseTestDocument(t, tt.base), parseTestDocument(t, tt.target))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MergeConfigs() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeConfigs() unexpected error: %v", err)
+			}
+
+			if want := parseTestDocument(t, tt.want); !reflect.DeepEqual(merged, want) {
+				got, _ := yaml.Marshal(merged)
+				wanted, _ := yaml.Marshal(want)
+				t.Errorf("MergeConfigs() =\n%s\nwant\n%s", got, wanted)
+			}
+		})
+	}
+}
+
+func TestMergeConfigsDoesNotMutateItsInputs(t *testing.T) {
+	const base = "stacks: [{name: a, tags: {x: '1'}}, {name: b}]\nproviders: {aws: {config: {region: us-east-1}}}\n"
+	const target = "stacks: [{name: a, tags: {y: '2'}}, {name: b, $patch: delete}]\nproviders: {aws: {config: {$patch: replace, profile: p}}}\n"
+
+	baseDocument, targetDocument := parseTestDocument(t, base), parseTestDocument(t, target)
+	if _, err := MergeConfigs(baseDocument, targetDocument); err != nil {
+		t.Fatalf("MergeConfigs() unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(baseDocument, parseTestDocument(t, base)) {
+		t.Errorf("MergeConfigs() mutated the base: %v", baseDocument)
+	}
+	if !reflect.DeepEqual(targetDocument, parseTestDocument(t, target)) {
+		t.Errorf("MergeConfigs() mutated the target: %v", targetDocument)
+	}
+}
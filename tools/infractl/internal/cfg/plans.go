@@ -0,0 +1,142 @@
+package cfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	// PlansDir is the directory, inside the infra cache directory, where saved plans are stored.
+	PlansDir = "plans"
+	// PlanBinaryFilename is the name of the binary plan produced by 'terraform plan -out'.
+	PlanBinaryFilename = "plan.tfplan"
+	// PlanConfigFilename is the name of the compiled environment configuration the plan was made with.
+	PlanConfigFilename = "config-compiled.json"
+	// PlanManifestFilename is the name of the manifest that describes a saved plan.
+	PlanManifestFilename = "manifest.json"
+	// PlanLogFilename is the name of the output of the plan, with sensitive values masked.
+	PlanLogFilename = "plan.log"
+)
+
+// PlanManifest describes a saved plan, and the state of the repository it was made against.
+// It's what allows infractl to guarantee that the plan being applied is exactly the plan that was reviewed.
+type PlanManifest struct {
+	ID               string `json:"id"`
+	CreatedAt        string `json:"created_at"`
+	BaseEnv          string `json:"base_env"`
+	TargetEnv        string `json:"target_env"`
+	StackName        string `json:"stack"`
+	LayerName        string `json:"layer"`
+	ComponentName    string `json:"component"`
+	PlanFilePath     string `json:"plan_file_path"`
+	ConfigFilePath   string `json:"config_file_path"`
+	LogFilePath      string `json:"log_file_path,omitempty"`
+	ConfigHash       string `json:"config_hash"`
+	ComponentDirHash string `json:"component_dir_hash"`
+	GitSHA           string `json:"git_sha"`
+}
+
+// GeneratePlanID creates a new unique identifier for a saved plan.
+func GeneratePlanID() (string, error) {
+	planID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate UUID for the plan identifier: %w", err)
+	}
+
+	return planID.String(), nil
+}
+
+// GetPlanDirPathAbsolute returns the absolute path of the directory holding the artifacts of a saved plan,
+// expected: infra/.infractl-cache/plans/<plan-id>. The identifier must be a UUID as generated by GeneratePlanID,
+// so it cannot point outside the plans directory.
+func GetPlanDirPathAbsolute(planID string) (string, error) {
+	if planID == "" {
+		return "", fmt.Errorf("plan identifier cannot be empty")
+	}
+
+	if parsed, err := uuid.Parse(planID); err != nil || parsed.String() != planID {
+		return "", fmt.Errorf("invalid plan identifier '%s': expected a UUID, as printed by 'plan --save-plan'", planID)
+	}
+
+	cacheDir, err := GetInfraCacheDirPathAbsolute()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the plan directory path: %w", err)
+	}
+
+	return filepath.Join(cacheDir, PlansDir, planID), nil
+}
+
+// CreatePlanDir creates (idempotently) the directory holding the artifacts of a saved plan.
+//
+// Returns:
+//   - The absolute path to the plan directory
+//   - An error if the path cannot be resolved or the directory cannot be created
+func CreatePlanDir(planID string) (string, error) {
+	planDir, err := GetPlanDirPathAbsolute(planID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := utils.CreateDirIdempotent(planDir); err != nil {
+		return "", fmt.Errorf("failed to create plan directory: %w", err)
+	}
+
+	return planDir, nil
+}
+
+// WritePlanManifest stores the manifest of a saved plan in its plan directory.
+func WritePlanManifest(manifest *PlanManifest) (string, error) {
+	if manifest == nil {
+		return "", fmt.Errorf("plan manifest cannot be nil")
+	}
+
+	planDir, err := CreatePlanDir(manifest.ID)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the manifest of plan %s: %w", manifest.ID, err)
+	}
+
+	manifestPath := filepath.Join(planDir, PlanManifestFilename)
+	if err := os.WriteFile(manifestPath, content, TransportFileMode); err != nil {
+		return "", fmt.Errorf("failed to write the manifest of plan %s: %w", manifest.ID, err)
+	}
+
+	return manifestPath, nil
+}
+
+// ReadPlanManifest loads the manifest of a previously saved plan.
+//
+// Returns:
+//   - The plan manifest
+//   - An error if the plan does not exist, or its manifest cannot be read or parsed
+func ReadPlanManifest(planID string) (*PlanManifest, error) {
+	planDir, err := GetPlanDirPathAbsolute(planID)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestPath := filepath.Join(planDir, PlanManifestFilename)
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("plan '%s' not found: no manifest at %s", planID, manifestPath)
+		}
+		return nil, fmt.Errorf("failed to read the manifest of plan %s: %w", planID, err)
+	}
+
+	var manifest PlanManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest of plan %s: %w", planID, err)
+	}
+
+	return &manifest, nil
+}
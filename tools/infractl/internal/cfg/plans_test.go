@@ -0,0 +1,44 @@
+package cfg
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetPlanDirPathAbsolute(t *testing.T) {
+	planID, err := GeneratePlanID()
+	if err != nil {
+		t.Fatalf("GeneratePlanID() unexpected error: %v", err)
+	}
+
+	planDir, err := GetPlanDirPathAbsolute(planID)
+	if err != nil {
+		t.Fatalf("GetPlanDirPathAbsolute() unexpected error: %v", err)
+	}
+	if want := filepath.Join(PlansDir, planID); !strings.HasSuffix(planDir, string(filepath.Separator)+want) {
+		t.Errorf("GetPlanDirPathAbsolute() = %s, want it to end with %s", planDir, want)
+	}
+
+	tests := []struct {
+		name    string
+		planID  string
+		wantErr string
+	}{
+		{name: "empty", planID: "", wantErr: "plan identifier cannot be empty"},
+		{name: "parent directory", planID: "../../etc", wantErr: "invalid plan identifier '../../etc'"},
+		{name: "path separator", planID: planID + "/../other", wantErr: "invalid plan identifier"},
+		{name: "absolute path", planID: "/tmp", wantErr: "invalid plan identifier"},
+		{name: "braced UUID", planID: "{" + planID + "}", wantErr: "invalid plan identifier"},
+		{name: "UUID URN", planID: "urn:uuid:" + planID, wantErr: "invalid plan identifier"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetPlanDirPathAbsolute(tt.planID)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("GetPlanDirPathAbsolute(%q) error = %v, want it to contain %q", tt.planID, err, tt.wantErr)
+			}
+		})
+	}
+}
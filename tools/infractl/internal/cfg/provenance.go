@@ -0,0 +1,208 @@
+package cfg
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Values of a configuration are addressed by paths such as 'providers.aws.config.region': mapping keys are
+// joined by dots, elements of named lists (stacks, layers, components) are addressed by name, e.g.
+// 'stacks[stack-datastore].layers[db]', and the elements of any other list by index, e.g. 'providers[0]'.
+
+// ValueLocation is where a value is set in an environment configuration file.
+type ValueLocation struct {
+	// Env is the name of the environment the file belongs to, e.g. 'base'
+	Env    string `json:"env"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// String renders the location as <file>:<line>:<column>
+func (l ValueLocation) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
+// LocateDocumentValues reads an environment configuration file and indexes the location of every value it sets,
+// by path. Values set to null, merge directives, the 'extends' key and the 'sops' block of encrypted files are
+// left out, since they set no value.
+//
+// Parameters:
+//   - env: The name of the environment the file belongs to.
+//   - path: The path to the environment configuration file.
+//
+// Returns:
+//   - The location of every value set in the file (scalars, and empty mappings or lists), by path.
+//   - An error if the file cannot be read or parsed.
+func LocateDocumentValues(env, path string) (map[string]ValueLocation, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading environment configuration file %s: %w", path, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, fmt.Errorf("parsing environment configuration file %s: %w", path, err)
+	}
+
+	locations := map[string]ValueLocation{}
+	if len(root.Content) == 0 {
+		return locations, nil
+	}
+
+	var walk func(node *yaml.Node, valuePath string)
+	walk = func(node *yaml.Node, valuePath string) {
+		if node.Kind == yaml.AliasNode && node.Alias != nil {
+			node = node.Alias
+		}
+
+		location := ValueLocation{Env: env, File: path, Line: node.Line, Column: node.Column}
+
+		switch node.Kind {
+		case yaml.MappingNode:
+			if len(node.Content) == 0 && valuePath != "" {
+				locations[valuePath] = location
+			}
+
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				switch {
+				case key.Value == "<<":
+					walk(value, valuePath)
+				case key.Value == MergeDirectiveKey, valuePath == "" && (key.Value == ExtendsKey || key.Value == SopsMetadataKey):
+					continue
+				default:
+					walk(value, joinPath(valuePath, key.Value))
+				}
+			}
+
+		case yaml.SequenceNode:
+			if len(node.Content) == 0 {
+				locations[valuePath] = location
+			}
+
+			// A '- $patch: replace' element is a directive, not an element of the list.
+			var elements []*yaml.Node
+			named := true
+			for _, element := range node.Content {
+				if isDirectiveNode(element) {
+					continue
+				}
+				elements = append(elements, element)
+				if nodeName(element) == "" {
+					named = false
+				}
+			}
+
+			for i, element := range elements {
+				if named {
+					walk(element, namedPath(valuePath, nodeName(element)))
+				} else {
+					walk(element, fmt.Sprintf("%s[%d]", valuePath, i))
+				}
+			}
+
+		case yaml.ScalarNode:
+			if node.Tag != "!!null" {
+				locations[valuePath] = location
+			}
+		}
+	}
+
+	walk(root.Content[0], "")
+
+	return locations, nil
+}
+
+// LeafValues flattens a configuration document, such as a raw document or a compiled configuration marshalled
+// to JSON and back, into its leaf values by path. Leaves are scalars, and empty mappings or lists.
+//
+// Parameters:
+//   - document: The configuration document.
+//
+// Returns:
+//   - The leaf values of the document, by path.
+func LeafValues(document interface{}) map[string]interface{} {
+	leaves := map[string]interface{}{}
+
+	var walk func(value interface{}, valuePath string)
+	walk = func(value interface{}, valuePath string) {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			if len(typed) == 0 && valuePath != "" {
+				leaves[valuePath] = typed
+			}
+			for key, nested := range typed {
+				walk(nested, joinPath(valuePath, key))
+			}
+
+		case []interface{}:
+			if len(typed) == 0 {
+				leaves[valuePath] = typed
+			}
+			named := isNamedList(typed)
+			for i, element := range typed {
+				if named {
+					walk(element, namedPath(valuePath, elementName(element)))
+				} else {
+					walk(element, fmt.Sprintf("%s[%d]", valuePath, i))
+				}
+			}
+
+		default:
+			leaves[valuePath] = typed
+		}
+	}
+
+	walk(document, "")
+
+	return leaves
+}
+
+// SortedValuePaths returns the paths of a set of values, sorted.
+func SortedValuePaths[V any](values map[string]V) []string {
+	paths := make([]string, 0, len(values))
+	for valuePath := range values {
+		paths = append(paths, valuePath)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// IsValuePathUnder reports whether a value path is the given path, or nested under it.
+func IsValuePathUnder(valuePath, parent string) bool {
+	if parent == "" || valuePath == parent {
+		return true
+	}
+
+	return strings.HasPrefix(valuePath, parent+".") || strings.HasPrefix(valuePath, parent+"[")
+}
+
+// isDirectiveNode reports whether a node is a mapping holding only a merge directive.
+func isDirectiveNode(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode && len(node.Content) == 2 && node.Content[0].Value == MergeDirectiveKey
+}
+
+// nodeName returns the 'name' of a mapping node, if any.
+func nodeName(node *yaml.Node) string {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == mergeIdentityKey && node.Content[i+1].Kind == yaml.ScalarNode {
+			return node.Content[i+1].Value
+		}
+	}
+
+	return ""
+}
@@ -3,7 +3,7 @@
 import (
 	"fmt"
 	"os"
-	"reflect"
+	"strings"
 	"time"
 
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
@@ -12,14 +12,24 @@
 
 // ConfigurationError represents detailed configuration parsing errors
 type ConfigurationError struct {
-	Stage        string
-	FieldPath    string
-	ActualValue  interface{}
-	ExpectedType string
-	Reason       string
+	Stage        string      `json:"stage"`
+	FieldPath    string      `json:"field_path,omitempty"`
+	ActualValue  interface{} `json:"actual_value,omitempty"`
+	ExpectedType string      `json:"expected_type,omitempty"`
+	Reason       string      `json:"reason"`
+	// Source is where the value is set, in the environment configuration file that won the merge, when known.
+	Source *ValueLocation `json:"source,omitempty"`
 }
 
 func (e *ConfigurationError) Error() string {
+	if e.ExpectedType == "" {
+		location := ""
+		if e.Source != nil {
+			location = e.Source.String() + ": "
+		}
+		return fmt.Sprintf("Configuration Error in %s: %sField '%s': %s", e.Stage, location, e.FieldPath, e.Reason)
+	}
+
 	return fmt.Sprintf(
 		"Configuration Error in %s: Field '%s' conversion failed. "+
 			"Expected %s, got %T with value %v. %s",
@@ -62,25 +72,117 @@ func transformRootConfig(rawConfig map[string]interface{}) (RootConfig, *Configu
 
 // GetInfraEnvConfigFromFile reads and parses a YAML configuration file
 func GetInfraEnvConfigFromFile(path string) (*EnvConfig, error) {
+	document, err := ReadEnvConfigDocument(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return EnvConfigFromDocument(document)
+}
+
+// ReadEnvConfigDocument reads a YAML configuration file as a raw document, without converting it into an
+// EnvConfig. Raw documents keep the merge directives and tell unset keys apart from empty ones, so they're
+// what MergeConfigs works on. Encrypted files are decrypted first (see ReadEnvConfigNode).
+//
+// Parameters:
+//   - path: The path to the YAML environment configuration file.
+//
+// Returns:
+//   - The raw document, an empty one if the file holds no mapping.
+//   - An error if the file is not a non-empty YAML file, cannot be parsed or decrypted, or doesn't match the
+//     environment configuration schema (a *SchemaValidationError, listing the file, line and path of every violation).
+func ReadEnvConfigDocument(path string) (map[string]interface{}, error) {
+	root, _, err := ReadEnvConfigNode(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the file against the environment configuration schema, so unknown keys and values of the
+	// wrong type are reported instead of silently dropped when the document is converted into an EnvConfig.
+	if err := ValidateEnvConfigNode(path, root); err != nil {
+		return nil, err
+	}
+
+	document := map[string]interface{}{}
+	if err := root.Decode(&document); err != nil {
+		return nil, fmt.Errorf("unmarshalling raw environment configuration %s: %w", path, err)
+	}
+
+	return document, nil
+}
+
+// ReadEnvConfigNode reads and parses a YAML configuration file. Files encrypted with sops (an <env>.enc.yaml
+// file, or any file with a 'sops' block) are decrypted in-process, with the age identities of the age key file.
+//
+// Parameters:
+//   - path: The path to the YAML environment configuration file.
+//
+// Returns:
+//   - The parsed, decrypted file, as a YAML document node.
+//   - The sops metadata of the file, or nil if it's not encrypted.
+//   - An error if the file is not a non-empty YAML file, cannot be parsed, cannot be decrypted, or is named
+//     <env>.enc.yaml but is not encrypted.
+func ReadEnvConfigNode(path string) (*yaml.Node, *SopsMetadata, error) {
 	// Validate that the file is a YAML file
 	if err := utils.IsYAMLFile(path); err != nil {
-		return nil, fmt.Errorf("environment configuration file is not a YAML file: %w", err)
+		return nil, nil, fmt.Errorf("environment configuration file is not a YAML file: %w", err)
 	}
 
 	// Check that the file is not empty
 	if err := utils.FileHasContent(path); err != nil {
-		return nil, fmt.Errorf("environment configuration file is empty: %w", err)
+		return nil, nil, fmt.Errorf("environment configuration file is empty: %w", err)
 	}
 
 	// Read the entire file contents
 	cfgFile, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("reading environment configuration file: %w", err)
+		return nil, nil, fmt.Errorf("reading environment configuration file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(cfgFile, &root); err != nil {
+		return nil, nil, fmt.Errorf("unmarshalling raw environment configuration %s: %w", path, err)
+	}
+
+	if !IsSopsEncryptedNode(&root) {
+		// A file named as encrypted but committed in clear text would leak what it was meant to protect
+		if strings.HasSuffix(path, EncryptedEnvFileExtension) {
+			return nil, nil, fmt.Errorf("environment configuration file %s is not encrypted: it has no '%s' block. "+
+				"Encrypt it with 'infractl env edit'", path, SopsMetadataKey)
+		}
+		return &root, nil, nil
+	}
+
+	identities, err := LoadAgeIdentities()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt environment configuration file %s: %w", path, err)
+	}
+
+	metadata, err := DecryptSopsNode(path, &root, identities)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot decrypt environment configuration file: %w", err)
+	}
+
+	return &root, metadata, nil
+}
+
+// EnvConfigFromDocument converts a raw configuration document, such as the result of MergeConfigs, into an EnvConfig.
+//
+// Parameters:
+//   - document: The raw configuration document.
+//
+// Returns:
+//   - A pointer to the EnvConfig built from the document.
+//   - An error if a section cannot be converted, or a required field is missing.
+func EnvConfigFromDocument(document map[string]interface{}) (*EnvConfig, error) {
+	content, err := yaml.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling raw environment configuration: %w", err)
 	}
 
 	// Unmarshal into RawEnvConfig first
 	var rawCfg RawEnvConfig
-	if err := yaml.Unmarshal(cfgFile, &rawCfg); err != nil {
+	if err := yaml.Unmarshal(content, &rawCfg); err != nil {
 		return nil, fmt.Errorf("unmarshalling raw environment configuration: %w", err)
 	}
 
@@ -129,74 +231,3 @@ func GetInfraEnvConfigFromFile(path string) (*EnvConfig, error) {
 
 	return envConfig, nil
 }
-
-// MergeConfigs merges two EnvConfig structs with target overriding base
-// MergeConfigs merges two EnvConfig structs, where the target configuration
-// overrides the base configuration. This function is useful for combining
-// configurations from different sources, ensuring that the most specific
-// settings take precedence over the more general ones.
-//
-// Parameters:
-//   - base: A pointer to the base EnvConfig struct. If this is nil, the
-//     function will return the target configuration.
-//   - target: A pointer to the target EnvConfig struct. If this is nil,
-//     the function will return the base configuration.
-//
-// Returns:
-//   - A pointer to a new EnvConfig struct that contains the merged
-//     configurations. If both base and target are nil, the function will
-//     return nil.
-//   - An error if any issues occur during the merging process.
-//
-// Best Practices:
-//   - Ensure that both base and target configurations are properly
-//     initialized before calling this function to avoid unexpected behavior.
-func MergeConfigs(base, target *EnvConfig) (*EnvConfig, error) {
-	if base == nil {
-		return target, nil
-	}
-	if target == nil {
-		return base, nil
-	}
-
-	// Create a deep copy of the base configuration to avoid mutating the original
-	merged := &EnvConfig{}
-	*merged = *base
-
-	// Merge Config (RootConfig) if the target's Config is not empty
-	if !reflect.DeepEqual(target.Config, RootConfig{}) {
-		merged.Config = target.Config
-	}
-
-	// Merge Git configuration if the target's Git is not empty
-	if !reflect.DeepEqual(target.Git, Git{}) {
-		merged.Git = target.Git
-	}
-
-	// Merge Product configuration if the target's Product is not empty
-	if !reflect.DeepEqual(target.Product, Product{}) {
-		merged.Product = target.Product
-	}
-
-	// Merge IAC configuration if the target's IAC is not empty
-	if !reflect.DeepEqual(target.IAC, IaC{}) {
-		merged.IAC = target.IAC
-	}
-
-	// Merge Providers if the target's Providers slice is not empty
-	if len(target.Providers) > 0 {
-		merged.Providers = target.Providers
-	}
-
-	// Merge Secrets if the target's Secrets slice is not empty
-	if len(target.Secrets) > 0 {
-		merged.Secrets = target.Secrets
-	}
-
-	// Merge Stacks if the target's Stacks slice is not empty
-	if len(target.Stacks) > 0 {
-		merged.Stacks = target.Stacks
-	}
-
-	return merged, nil
-}
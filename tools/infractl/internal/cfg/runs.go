@@ -0,0 +1,117 @@
+package cfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
+	"github.com/google/uuid"
+)
+
+// RunsDir is the directory, inside the infra cache directory, where the state of multi-component runs is stored.
+const RunsDir = "runs"
+
+// RunNodeState is the outcome of a single component in a multi-component run.
+type RunNodeState struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RunState records the progress of a stack or layer wide run executed in dependency order.
+// It's persisted after every component completes, so a failed or interrupted run can be resumed,
+// running only the components that did not succeed.
+type RunState struct {
+	ID         string                  `json:"id"`
+	Command    string                  `json:"command"`
+	CreatedAt  string                  `json:"created_at"`
+	UpdatedAt  string                  `json:"updated_at"`
+	StackName  string                  `json:"stack"`
+	LayerName  string                  `json:"layer"`
+	Order      []string                `json:"order"`
+	Components map[string]RunNodeState `json:"components"`
+}
+
+// GenerateRunID creates a new unique identifier for a multi-component run.
+func GenerateRunID() (string, error) {
+	runID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate UUID for the run identifier: %w", err)
+	}
+
+	return runID.String(), nil
+}
+
+// GetRunStateFilePathAbsolute returns the absolute path of the state file of a run,
+// expected: infra/.infractl-cache/runs/<run-id>.json
+func GetRunStateFilePathAbsolute(runID string) (string, error) {
+	if runID == "" {
+		return "", fmt.Errorf("run identifier cannot be empty")
+	}
+
+	cacheDir, err := GetInfraCacheDirPathAbsolute()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the run state file path: %w", err)
+	}
+
+	return filepath.Join(cacheDir, RunsDir, runID+".json"), nil
+}
+
+// WriteRunState persists the state of a run, replacing any previous state of the same run.
+func WriteRunState(state *RunState) (string, error) {
+	if state == nil {
+		return "", fmt.Errorf("run state cannot be nil")
+	}
+
+	statePath, err := GetRunStateFilePathAbsolute(state.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := utils.CreateDirIdempotent(filepath.Dir(statePath)); err != nil {
+		return "", fmt.Errorf("failed to create runs directory: %w", err)
+	}
+
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the state of run %s: %w", state.ID, err)
+	}
+
+	if err := os.WriteFile(statePath, content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write the state of run %s: %w", state.ID, err)
+	}
+
+	return statePath, nil
+}
+
+// ReadRunState loads the state of a previous run.
+//
+// Returns:
+//   - The run state
+//   - An error if the run does not exist, or its state cannot be read or parsed
+func ReadRunState(runID string) (*RunState, error) {
+	statePath, err := GetRunStateFilePathAbsolute(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("run '%s' not found: no state at %s", runID, statePath)
+		}
+		return nil, fmt.Errorf("failed to read the state of run %s: %w", runID, err)
+	}
+
+	var state RunState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse the state of run %s: %w", runID, err)
+	}
+
+	if state.Components == nil {
+		state.Components = map[string]RunNodeState{}
+	}
+
+	return &state, nil
+}
@@ -48,6 +48,20 @@ type IaC struct {
 type ProviderConfig struct {
 	Config            map[string]interface{} `yaml:"config" json:"config"`
 	VersionConstraint VersionConstraint      `yaml:"version_constraint" json:"version_constraint"`
+	// SensitiveKeys marks config keys whose values are secrets, even if they don't read the secrets section:
+	// they're kept out of the compiled configuration and masked in the output.
+	SensitiveKeys []string `yaml:"sensitive_keys,omitempty" json:"sensitive_keys,omitempty"`
+}
+
+// IsSensitiveKey reports whether a config key is marked sensitive.
+func (p ProviderConfig) IsSensitiveKey(key string) bool {
+	for _, sensitiveKey := range p.SensitiveKeys {
+		if sensitiveKey == key {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Providers represents a dynamic map of provider configurations
@@ -0,0 +1,208 @@
+package cfg
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// SecretEnvVarPrefix prefixes the variables that deliver the values of the secrets section.
+	SecretEnvVarPrefix = "INFRACTL_SECRET_"
+	// ProviderSecretEnvVarPrefix prefixes the variables that deliver the sensitive provider configuration values.
+	ProviderSecretEnvVarPrefix = "INFRACTL_PROVIDER_"
+)
+
+// envVarNameUnsafeChars matches what cannot be part of an environment variable name.
+var envVarNameUnsafeChars = regexp.MustCompile(`[^A-Z0-9_]+`)
+
+// SealedValue is a sensitive value of the compiled configuration, replaced by a placeholder in the document
+// handed over to Terragrunt, and delivered through the environment of the terragrunt process instead.
+type SealedValue struct {
+	// Path is the path of the value, e.g. providers.aws.config.access_key_id
+	Path string
+	// EnvVar is the variable the value is delivered through, e.g. INFRACTL_PROVIDER_AWS_ACCESS_KEY_ID
+	EnvVar string
+	// Value is the resolved value.
+	Value string
+}
+
+// SealedEnvConfig is a compiled configuration without its sensitive values: every value of the secrets section,
+// and the sensitive provider configuration values, are replaced by a ${<EnvVar>} placeholder.
+type SealedEnvConfig struct {
+	// Config is the sealed copy of the compiled configuration, safe to write to disk.
+	Config *EnvConfig
+	// Values are the sealed values, sorted by path.
+	Values []SealedValue
+	// ProviderSecretGroups maps the providers to the secret groups their configuration reads, which the
+	// components using them are given access to (see Scoped).
+	ProviderSecretGroups map[string][]string
+	// SensitiveEnvVars are the environment variables the secrets section and the provider configurations read,
+	// directly or through the secrets they reference, sorted. They're not passed down to terragrunt, unless
+	// listed in INFRACTL_INHERIT_ENV.
+	SensitiveEnvVars []string
+}
+
+// SecretPlaceholder returns the placeholder of a sealed value, which references the variable delivering it.
+func SecretPlaceholder(envVar string) string {
+	return "${" + envVar + "}"
+}
+
+// SealEnvConfig copies a compiled configuration, replacing its sensitive values by placeholders.
+//
+// Parameters:
+//   - compiled: The compiled configuration, with every value resolved.
+//   - isSensitiveProviderValue: Reports whether a provider configuration value is sensitive. Every value of the
+//     secrets section is sensitive, and so are the provider configuration keys listed in 'sensitive_keys'.
+//
+// Returns:
+//   - The sealed configuration, with the sealed values and the variables that deliver them.
+//   - An error if two sealed values would be delivered through the same variable.
+func SealEnvConfig(compiled *EnvConfig, isSensitiveProviderValue func(provider, key, value string) bool) (*SealedEnvConfig, error) {
+	sealedCfg := *compiled
+	sealed := &SealedEnvConfig{Config: &sealedCfg}
+	paths := map[string]string{}
+
+	seal := func(valuePath, envVar, value string) (string, error) {
+		if other, taken := paths[envVar]; taken {
+			return "", fmt.Errorf("sensitive values %s and %s would both be delivered through %s; rename one of them", other, valuePath, envVar)
+		}
+		paths[envVar] = valuePath
+		sealed.Values = append(sealed.Values, SealedValue{Path: valuePath, EnvVar: envVar, Value: value})
+
+		return SecretPlaceholder(envVar), nil
+	}
+
+	sealedCfg.Secrets = make(Secrets, len(compiled.Secrets))
+	for groupName, secretGroup := range compiled.Secrets {
+		sealedGroup := make(map[string]string, len(secretGroup))
+		for secretKey, secretValue := range secretGroup {
+			placeholder, err := seal("secrets."+groupName+"."+secretKey, envVarName(SecretEnvVarPrefix, groupName, secretKey), secretValue)
+			if err != nil {
+				return nil, err
+			}
+			sealedGroup[secretKey] = placeholder
+		}
+		sealedCfg.Secrets[groupName] = sealedGroup
+	}
+
+	sealedCfg.Providers = make(Providers, len(compiled.Providers))
+	for providerName, providerConfig := range compiled.Providers {
+		sealedConfig := make(map[string]interface{}, len(providerConfig.Config))
+		for key, value := range providerConfig.Config {
+			sealedConfig[key] = value
+
+			strValue, isString := value.(string)
+			if !isString || !(providerConfig.IsSensitiveKey(key) || isSensitiveProviderValue(providerName, key, strValue)) {
+				continue
+			}
+
+			placeholder, err := seal("providers."+providerName+".config."+key, envVarName(ProviderSecretEnvVarPrefix, providerName, key), strValue)
+			if err != nil {
+				return nil, err
+			}
+			sealedConfig[key] = placeholder
+		}
+
+		providerConfig.Config = sealedConfig
+		sealedCfg.Providers[providerName] = providerConfig
+	}
+
+	sort.Slice(sealed.Values, func(i, j int) bool {
+		return sealed.Values[i].Path < sealed.Values[j].Path
+	})
+
+	return sealed, nil
+}
+
+// Env returns the sealed values nested under any of the given paths, in the KEY=VALUE form expected by
+// exec.Cmd.Env, so a terragrunt process only receives the values it needs.
+//
+// Parameters:
+//   - scopes: Value paths, e.g. providers.aws for every sensitive value of the aws provider configuration.
+//
+// Returns:
+//   - The variables delivering the sealed values in scope, sorted by path.
+func (s *SealedEnvConfig) Env(scopes ...string) []string {
+	var env []string
+
+	for _, value := range s.Values {
+		for _, scope := range scopes {
+			if IsValuePathUnder(value.Path, scope) {
+				env = append(env, value.EnvVar+"="+value.Value)
+				break
+			}
+		}
+	}
+
+	return env
+}
+
+// Scoped returns what a terragrunt process running components that use the given providers may see of the sealed
+// configuration: only those providers, the secret groups they read (ProviderSecretGroups) or that are named after
+// them, and the sealed values of both. Everything else of the configuration is kept as-is.
+//
+// Parameters:
+//   - providers: The providers used by the components the terragrunt process runs.
+//
+// Returns:
+//   - A sealed configuration holding only the providers and secret groups in scope.
+func (s *SealedEnvConfig) Scoped(providers []string) *SealedEnvConfig {
+	scopedCfg := *s.Config
+	scoped := &SealedEnvConfig{Config: &scopedCfg, ProviderSecretGroups: map[string][]string{}, SensitiveEnvVars: s.SensitiveEnvVars}
+
+	scopedCfg.Providers = make(Providers, len(providers))
+	scopedCfg.Secrets = make(Secrets)
+	var scopes []string
+
+	for _, providerName := range providers {
+		providerConfig, declared := s.Config.Providers[providerName]
+		if !declared {
+			continue
+		}
+		scopedCfg.Providers[providerName] = providerConfig
+		scopes = append(scopes, "providers."+providerName)
+
+		groups := append([]string{providerName}, s.ProviderSecretGroups[providerName]...)
+		for _, groupName := range groups {
+			secretGroup, declared := s.Config.Secrets[groupName]
+			if !declared {
+				continue
+			}
+			if _, added := scopedCfg.Secrets[groupName]; !added {
+				scopedCfg.Secrets[groupName] = secretGroup
+				scopes = append(scopes, "secrets."+groupName)
+			}
+		}
+		scoped.ProviderSecretGroups[providerName] = s.ProviderSecretGroups[providerName]
+	}
+
+	for _, value := range s.Values {
+		for _, scope := range scopes {
+			if IsValuePathUnder(value.Path, scope) {
+				scoped.Values = append(scoped.Values, value)
+				break
+			}
+		}
+	}
+
+	return scoped
+}
+
+// SensitiveValues returns the resolved values of every sealed value, e.g. to mask them in the output.
+func (s *SealedEnvConfig) SensitiveValues() []string {
+	values := make([]string, 0, len(s.Values))
+	for _, value := range s.Values {
+		values = append(values, value.Value)
+	}
+
+	return values
+}
+
+// envVarName builds the name of the variable delivering a sealed value, e.g. INFRACTL_SECRET_AWS_ACCESS_KEY
+func envVarName(prefix string, parts ...string) string {
+	name := envVarNameUnsafeChars.ReplaceAllString(strings.ToUpper(strings.Join(parts, "_")), "_")
+
+	return prefix + strings.Trim(name, "_")
+}
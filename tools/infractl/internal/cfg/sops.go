@@ -0,0 +1,675 @@
+package cfg
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment configuration files can be committed encrypted, in the sops format (https://github.com/getsops/sops),
+// with age keys: every value is encrypted with AES256-GCM under a data key, which is itself encrypted for every
+// age recipient of the file, in the 'sops' metadata block at the end of the file. Keys stay in clear text, so the
+// structure (and the line of every value) is the same once decrypted. infractl decrypts and encrypts these files
+// in-process, so they're compatible with the sops CLI without requiring it.
+
+const (
+	// EncryptedEnvFileExtension is the extension of encrypted environment configuration files, e.g. _ENVS/prod.enc.yaml
+	EncryptedEnvFileExtension = ".enc.yaml"
+
+	// SopsMetadataKey is the top-level key holding the sops metadata of an encrypted file.
+	SopsMetadataKey = "sops"
+
+	// AgeKeyFileEnvVar is the variable pointing to the file holding the age identities (private keys), shared
+	// with the sops CLI.
+	AgeKeyFileEnvVar = "SOPS_AGE_KEY_FILE"
+	// AgeKeyEnvVar holds age identities inline, e.g. in CI, shared with the sops CLI.
+	AgeKeyEnvVar = "SOPS_AGE_KEY"
+
+	// sopsUnencryptedSuffix is the suffix of the keys whose values are left in clear text, the sops default.
+	sopsUnencryptedSuffix = "_unencrypted"
+	// sopsFormatVersion is the version of the sops file format written.
+	sopsFormatVersion = "3.9.0"
+	// sopsNonceSize is the size of the AES256-GCM nonces used by sops.
+	sopsNonceSize = 32
+	// sopsDataKeySize is the size of the AES256 data key.
+	sopsDataKeySize = 32
+)
+
+// sopsEncryptedValue matches a value encrypted by sops, e.g. ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]
+var sopsEncryptedValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:([^,]*),iv:([^,]+),tag:([^,]+),type:([a-z]+)\]$`)
+
+// SopsAgeKey is the data key of an encrypted file, encrypted for an age recipient.
+type SopsAgeKey struct {
+	Recipient string `yaml:"recipient"`
+	// Enc is the data key, encrypted for the recipient and ASCII armored.
+	Enc string `yaml:"enc"`
+}
+
+// SopsMetadata is the 'sops' block of an encrypted file. Only age keys are supported.
+type SopsMetadata struct {
+	KMS               []interface{} `yaml:"kms,omitempty"`
+	GCPKMS            []interface{} `yaml:"gcp_kms,omitempty"`
+	AzureKV           []interface{} `yaml:"azure_kv,omitempty"`
+	HCVault           []interface{} `yaml:"hc_vault,omitempty"`
+	PGP               []interface{} `yaml:"pgp,omitempty"`
+	KeyGroups         []interface{} `yaml:"key_groups,omitempty"`
+	Age               []SopsAgeKey  `yaml:"age,omitempty"`
+	LastModified      string        `yaml:"lastmodified"`
+	MAC               string        `yaml:"mac"`
+	MACOnlyEncrypted  bool          `yaml:"mac_only_encrypted,omitempty"`
+	UnencryptedSuffix string        `yaml:"unencrypted_suffix,omitempty"`
+	EncryptedSuffix   string        `yaml:"encrypted_suffix,omitempty"`
+	UnencryptedRegex  string        `yaml:"unencrypted_regex,omitempty"`
+	EncryptedRegex    string        `yaml:"encrypted_regex,omitempty"`
+	Version           string        `yaml:"version"`
+}
+
+// Recipients returns the age recipients the file is encrypted for.
+func (m *SopsMetadata) Recipients() []string {
+	recipients := make([]string, 0, len(m.Age))
+	for _, key := range m.Age {
+		recipients = append(recipients, key.Recipient)
+	}
+
+	return recipients
+}
+
+// encryptedPathMatcher returns the function reporting whether the value at a path is encrypted, following the
+// rule of the file, as sops does: the keys of the path are matched against the one (un)encrypted suffix or
+// regular expression set. Without any, every value is encrypted.
+func (m *SopsMetadata) encryptedPathMatcher() (func(path []string) bool, error) {
+	var unencryptedRegex, encryptedRegex *regexp.Regexp
+	var err error
+	if m.UnencryptedRegex != "" {
+		if unencryptedRegex, err = regexp.Compile(m.UnencryptedRegex); err != nil {
+			return nil, fmt.Errorf("invalid unencrypted_regex: %w", err)
+		}
+	}
+	if m.EncryptedRegex != "" {
+		if encryptedRegex, err = regexp.Compile(m.EncryptedRegex); err != nil {
+			return nil, fmt.Errorf("invalid encrypted_regex: %w", err)
+		}
+	}
+
+	return func(path []string) bool {
+		anyKey := func(match func(key string) bool) bool {
+			for _, key := range path {
+				if match(key) {
+					return true
+				}
+			}
+			return false
+		}
+
+		switch {
+		case m.UnencryptedSuffix != "":
+			return !anyKey(func(key string) bool { return strings.HasSuffix(key, m.UnencryptedSuffix) })
+		case m.EncryptedSuffix != "":
+			return anyKey(func(key string) bool { return strings.HasSuffix(key, m.EncryptedSuffix) })
+		case unencryptedRegex != nil:
+			return !anyKey(unencryptedRegex.MatchString)
+		case encryptedRegex != nil:
+			return anyKey(encryptedRegex.MatchString)
+		}
+
+		return true
+	}, nil
+}
+
+// IsSopsEncryptedNode reports whether a parsed YAML file is encrypted with sops, i.e. has a top-level 'sops' block.
+func IsSopsEncryptedNode(root *yaml.Node) bool {
+	return sopsMetadataIndex(root) >= 0
+}
+
+// AgeKeyFilePath returns the path of the age key file: SOPS_AGE_KEY_FILE, or the sops default,
+// <user config dir>/sops/age/keys.txt
+func AgeKeyFilePath() string {
+	if keyFile := os.Getenv(AgeKeyFileEnvVar); keyFile != "" {
+		return keyFile
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		userConfigDir, err := os.UserConfigDir()
+		if err != nil {
+			return ""
+		}
+		configDir = userConfigDir
+	}
+
+	return filepath.Join(configDir, "sops", "age", "keys.txt")
+}
+
+// LoadAgeIdentities loads the age identities (private keys) that decrypt the encrypted files: the ones of
+// SOPS_AGE_KEY, and the ones of the age key file (see AgeKeyFilePath).
+//
+// Returns:
+//   - The identities found.
+//   - An error if an identity cannot be parsed, or there is none.
+func LoadAgeIdentities() ([]age.Identity, error) {
+	var identities []age.Identity
+
+	if inline := os.Getenv(AgeKeyEnvVar); inline != "" {
+		parsed, err := age.ParseIdentities(strings.NewReader(inline))
+		if err != nil {
+			return nil, fmt.Errorf("parsing the age identities of %s: %w", AgeKeyEnvVar, err)
+		}
+		identities = append(identities, parsed...)
+	}
+
+	keyFile := AgeKeyFilePath()
+	content, err := os.ReadFile(keyFile)
+	switch {
+	case err == nil:
+		parsed, err := age.ParseIdentities(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("parsing the age key file %s: %w", keyFile, err)
+		}
+		identities = append(identities, parsed...)
+	case !os.IsNotExist(err) || len(identities) == 0:
+		return nil, fmt.Errorf("reading the age key file %s (set %s, or pass --age-key-file): %w", keyFile, AgeKeyFileEnvVar, err)
+	}
+
+	return identities, nil
+}
+
+// AgeRecipientsOf returns the recipients (public keys) of age identities, e.g. to encrypt a new file for the
+// keys at hand.
+func AgeRecipientsOf(identities []age.Identity) []string {
+	var recipients []string
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			recipients = append(recipients, x25519.Recipient().String())
+		}
+	}
+
+	return recipients
+}
+
+// DecryptSopsNode decrypts a parsed sops encrypted file in place, and removes its 'sops' block, so it can be
+// read as if it was never encrypted. The message authentication code of the file is verified, so a value
+// tampered with (or reverted to an older encrypted value) is reported instead of being used. As with the sops
+// CLI, a value in clear text where the rule of the file says it's encrypted is rejected: it would be left out
+// of the message authentication code of files with mac_only_encrypted set.
+//
+// Parameters:
+//   - file: The path to the file, used in the errors.
+//   - root: The parsed file, as a YAML document node.
+//   - identities: The age identities to decrypt the data key with.
+//
+// Returns:
+//   - The sops metadata of the file.
+//   - An error if the metadata is invalid, no identity decrypts the data key, a value cannot be decrypted or is
+//     in clear text where it should be encrypted, or the message authentication code doesn't match.
+func DecryptSopsNode(file string, root *yaml.Node, identities []age.Identity) (*SopsMetadata, error) {
+	metadataIndex := sopsMetadataIndex(root)
+	if metadataIndex < 0 {
+		return nil, fmt.Errorf("%s is not encrypted: it has no '%s' block", file, SopsMetadataKey)
+	}
+
+	document := root.Content[0]
+	metadata := &SopsMetadata{}
+	if err := document.Content[metadataIndex+1].Decode(metadata); err != nil {
+		return nil, fmt.Errorf("invalid '%s' block in %s: %w", SopsMetadataKey, file, err)
+	}
+
+	isEncrypted, err := metadata.encryptedPathMatcher()
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s' block in %s: %w", SopsMetadataKey, file, err)
+	}
+
+	dataKey, err := decryptSopsDataKey(file, metadata, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	document.Content = append(document.Content[:metadataIndex], document.Content[metadataIndex+2:]...)
+
+	hash := sha512.New()
+	var walkErr error
+	walkSopsValues(root, func(node *yaml.Node, path []string) {
+		if walkErr != nil {
+			return
+		}
+
+		if node.Kind != yaml.ScalarNode {
+			return
+		}
+
+		// Nulls are left as they are, encrypted or not
+		encrypted := isEncrypted(path) && node.ShortTag() != "!!null"
+		matches := sopsEncryptedValue.FindStringSubmatch(node.Value)
+		if matches == nil {
+			if encrypted {
+				walkErr = fmt.Errorf("the value of '%s' at %s:%d is in clear text, but should be encrypted: the file was tampered with", strings.Join(path, "."), file, node.Line)
+				return
+			}
+			if !metadata.MACOnlyEncrypted {
+				hash.Write([]byte(sopsMACValue(node)))
+			}
+			return
+		}
+
+		plaintext, err := sopsDecrypt(matches, dataKey, sopsAdditionalData(path))
+		if err != nil {
+			walkErr = fmt.Errorf("failed to decrypt the value of '%s' at %s:%d: %w", strings.Join(path, "."), file, node.Line, err)
+			return
+		}
+
+		node.Value = plaintext
+		node.Tag = sopsValueTags[matches[4]]
+		node.Style = 0
+		hash.Write([]byte(sopsMACValue(node)))
+	}, func(node *yaml.Node, collectionPath []string) {
+		decryptSopsComments(node, dataKey, sopsAdditionalData(collectionPath))
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	macMatches := sopsEncryptedValue.FindStringSubmatch(metadata.MAC)
+	if macMatches == nil {
+		return nil, fmt.Errorf("invalid '%s' block in %s: the message authentication code is missing", SopsMetadataKey, file)
+	}
+
+	expectedMAC, err := sopsDecrypt(macMatches, dataKey, metadata.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the message authentication code of %s: %w", file, err)
+	}
+
+	if actualMAC := strings.ToUpper(hex.EncodeToString(hash.Sum(nil))); actualMAC != expectedMAC {
+		return nil, fmt.Errorf("the message authentication code of %s doesn't match its content: the file was tampered with", file)
+	}
+
+	return metadata, nil
+}
+
+// EncryptSopsNode encrypts a parsed file in place, for the given age recipients, and appends its 'sops' block.
+// Every value is encrypted under a new data key, except the values of keys ending with '_unencrypted'; comments
+// are encrypted too.
+//
+// Parameters:
+//   - root: The parsed file, as a YAML document node, without a 'sops' block.
+//   - recipients: The age recipients (public keys, age1...) to encrypt the file for.
+//
+// Returns:
+//   - An error if there is no recipient, a recipient is invalid, or the encryption fails.
+func EncryptSopsNode(root *yaml.Node, recipients []string) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("at least one age recipient is required to encrypt the file")
+	}
+
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("only YAML mappings can be encrypted")
+	}
+
+	if IsSopsEncryptedNode(root) {
+		return fmt.Errorf("the file is already encrypted: it has a '%s' block", SopsMetadataKey)
+	}
+
+	dataKey := make([]byte, sopsDataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("generating the data key: %w", err)
+	}
+
+	metadata := &SopsMetadata{
+		LastModified:      time.Now().UTC().Format(time.RFC3339),
+		UnencryptedSuffix: sopsUnencryptedSuffix,
+		Version:           sopsFormatVersion,
+	}
+
+	for _, recipient := range recipients {
+		enc, err := encryptSopsDataKey(dataKey, recipient)
+		if err != nil {
+			return err
+		}
+		metadata.Age = append(metadata.Age, SopsAgeKey{Recipient: recipient, Enc: enc})
+	}
+
+	isEncrypted, err := metadata.encryptedPathMatcher()
+	if err != nil {
+		return err
+	}
+
+	hash := sha512.New()
+	var walkErr error
+	walkSopsValues(root, func(node *yaml.Node, path []string) {
+		if walkErr != nil || node.Kind != yaml.ScalarNode {
+			return
+		}
+
+		hash.Write([]byte(sopsMACValue(node)))
+
+		// Nulls keep the values they're merged over, there is nothing to encrypt
+		if node.ShortTag() == "!!null" {
+			return
+		}
+
+		if !isEncrypted(path) {
+			return
+		}
+
+		valueType, ok := sopsValueTypes[node.ShortTag()]
+		if !ok {
+			walkErr = fmt.Errorf("the value of '%s' at line %d cannot be encrypted: unsupported type %s", strings.Join(path, "."), node.Line, node.ShortTag())
+			return
+		}
+
+		encrypted, err := sopsEncrypt(node.Value, valueType, dataKey, sopsAdditionalData(path))
+		if err != nil {
+			walkErr = fmt.Errorf("failed to encrypt the value of '%s': %w", strings.Join(path, "."), err)
+			return
+		}
+
+		node.Value = encrypted
+		node.Tag = "!!str"
+		node.Style = 0
+	}, func(node *yaml.Node, collectionPath []string) {
+		if walkErr == nil {
+			walkErr = encryptSopsComments(node, dataKey, sopsAdditionalData(collectionPath))
+		}
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+
+	mac, err := sopsEncrypt(strings.ToUpper(hex.EncodeToString(hash.Sum(nil))), "str", dataKey, metadata.LastModified)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt the message authentication code: %w", err)
+	}
+	metadata.MAC = mac
+
+	var metadataNode yaml.Node
+	if err := metadataNode.Encode(metadata); err != nil {
+		return fmt.Errorf("encoding the '%s' block: %w", SopsMetadataKey, err)
+	}
+
+	document := root.Content[0]
+	document.Content = append(document.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: SopsMetadataKey}, &metadataNode)
+
+	return nil
+}
+
+// sopsValueTypes maps the YAML tags of the values sops can encrypt to their sops type.
+var sopsValueTypes = map[string]string{"!!str": "str", "!!timestamp": "str", "!!int": "int", "!!float": "float", "!!bool": "bool"}
+
+// sopsValueTags maps the sops types to the YAML tags of the decrypted values.
+var sopsValueTags = map[string]string{"str": "!!str", "int": "!!int", "float": "!!float", "bool": "!!bool", "comment": "!!str"}
+
+// sopsMetadataIndex returns the index of the 'sops' key in the top-level mapping of a file, or -1.
+func sopsMetadataIndex(root *yaml.Node) int {
+	if root == nil || root.Kind != yaml.DocumentNode || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return -1
+	}
+
+	document := root.Content[0]
+	for i := 0; i+1 < len(document.Content); i += 2 {
+		if document.Content[i].Value == SopsMetadataKey && document.Content[i+1].Kind == yaml.MappingNode {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// walkSopsValues walks the values of a file, in document order, with the path of mapping keys leading to them
+// (sequence elements don't add to the path, as in sops). Comments are visited with the path of the mapping or
+// sequence holding them, including the line comment of a value (e.g. 'key: value # comment'), which sops reads
+// as a comment of the mapping holding the key.
+func walkSopsValues(root *yaml.Node, onValue func(node *yaml.Node, path []string), onComments func(node *yaml.Node, collectionPath []string)) {
+	var walk func(node *yaml.Node, path, collectionPath []string)
+	walk = func(node *yaml.Node, path, collectionPath []string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			onComments(node, path)
+			for _, child := range node.Content {
+				walk(child, path, path)
+			}
+		case yaml.MappingNode:
+			onComments(node, path)
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				onComments(key, path)
+				walk(value, append(append([]string{}, path...), key.Value), path)
+			}
+		case yaml.SequenceNode:
+			onComments(node, path)
+			for _, element := range node.Content {
+				walk(element, path, path)
+			}
+		case yaml.ScalarNode:
+			onComments(node, collectionPath)
+			onValue(node, path)
+		}
+	}
+
+	walk(root, nil, nil)
+}
+
+// sopsAdditionalData returns the additional authenticated data of a value: the path leading to it, so an
+// encrypted value cannot be moved to another key.
+func sopsAdditionalData(path []string) string {
+	return strings.Join(path, ":") + ":"
+}
+
+// sopsMACValue renders a value as sops does when computing the message authentication code of a file.
+func sopsMACValue(node *yaml.Node) string {
+	switch node.ShortTag() {
+	case "!!null":
+		return ""
+	case "!!bool":
+		var value bool
+		if err := node.Decode(&value); err == nil && value {
+			return "True"
+		} else if err == nil {
+			return "False"
+		}
+	case "!!int":
+		var value int
+		if err := node.Decode(&value); err == nil {
+			return strconv.Itoa(value)
+		}
+	case "!!float":
+		var value float64
+		if err := node.Decode(&value); err == nil {
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+
+	return node.Value
+}
+
+// sopsEncrypt encrypts a value with the data key, in the sops ENC[...] format.
+func sopsEncrypt(plaintext, valueType string, dataKey []byte, additionalData string) (string, error) {
+	gcm, err := sopsCipher(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, sopsNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating a nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nil, nonce, []byte(plaintext), []byte(additionalData))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(data), base64.StdEncoding.EncodeToString(nonce),
+		base64.StdEncoding.EncodeToString(tag), valueType), nil
+}
+
+// sopsDecrypt decrypts a value matched by sopsEncryptedValue with the data key.
+func sopsDecrypt(matches []string, dataKey []byte, additionalData string) (string, error) {
+	var parts [3][]byte
+	for i := range parts {
+		decoded, err := base64.StdEncoding.DecodeString(matches[i+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid encrypted value: %w", err)
+		}
+		parts[i] = decoded
+	}
+	data, nonce, tag := parts[0], parts[1], parts[2]
+
+	if _, known := sopsValueTags[matches[4]]; !known {
+		return "", fmt.Errorf("unsupported value type '%s'", matches[4])
+	}
+
+	gcm, err := sopsCipher(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value: nonce of %d bytes instead of %d", len(nonce), gcm.NonceSize())
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return "", fmt.Errorf("authentication failed, the value was tampered with or moved")
+	}
+
+	return string(plaintext), nil
+}
+
+func sopsCipher(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+
+	return cipher.NewGCMWithNonceSize(block, sopsNonceSize)
+}
+
+// decryptSopsComments decrypts the comments of a node that sops encrypted, e.g. #ENC[...,type:comment]. Comments
+// carry no configuration, so the ones that cannot be decrypted are dropped rather than failing the whole file.
+func decryptSopsComments(node *yaml.Node, dataKey []byte, additionalData string) {
+	for _, comment := range []*string{&node.HeadComment, &node.LineComment, &node.FootComment} {
+		if !strings.Contains(*comment, "ENC[") {
+			continue
+		}
+
+		var lines []string
+		for _, line := range strings.Split(*comment, "\n") {
+			matches := sopsEncryptedValue.FindStringSubmatch(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#")))
+			if matches == nil {
+				lines = append(lines, line)
+				continue
+			}
+
+			if plaintext, err := sopsDecrypt(matches, dataKey, additionalData); err == nil {
+				lines = append(lines, "#"+plaintext)
+			}
+		}
+		*comment = strings.Join(lines, "\n")
+	}
+}
+
+// encryptSopsComments encrypts the comments of a node, line by line, as sops does.
+func encryptSopsComments(node *yaml.Node, dataKey []byte, additionalData string) error {
+	for _, comment := range []*string{&node.HeadComment, &node.LineComment, &node.FootComment} {
+		if *comment == "" {
+			continue
+		}
+
+		lines := strings.Split(*comment, "\n")
+		for i, line := range lines {
+			text := strings.TrimPrefix(strings.TrimSpace(line), "#")
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+
+			encrypted, err := sopsEncrypt(text, "comment", dataKey, additionalData)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt a comment: %w", err)
+			}
+			lines[i] = "#" + encrypted
+		}
+		*comment = strings.Join(lines, "\n")
+	}
+
+	return nil
+}
+
+// decryptSopsDataKey decrypts the data key of a file with the first age identity it's encrypted for.
+func decryptSopsDataKey(file string, metadata *SopsMetadata, identities []age.Identity) ([]byte, error) {
+	if len(metadata.Age) == 0 {
+		return nil, fmt.Errorf("%s is not encrypted for any age recipient: only age keys are supported", file)
+	}
+
+	for _, key := range metadata.Age {
+		reader, err := age.Decrypt(armor.NewReader(strings.NewReader(key.Enc)), identities...)
+		if err != nil {
+			var noMatch *age.NoIdentityMatchError
+			if errors.As(err, &noMatch) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to decrypt the data key of %s for %s: %w", file, key.Recipient, err)
+		}
+
+		dataKey, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt the data key of %s for %s: %w", file, key.Recipient, err)
+		}
+
+		return dataKey, nil
+	}
+
+	return nil, fmt.Errorf("none of the age identities of %s decrypts %s, which is encrypted for %s",
+		AgeKeyFilePath(), file, strings.Join(metadata.Recipients(), ", "))
+}
+
+// encryptSopsDataKey encrypts the data key for an age recipient, ASCII armored.
+func encryptSopsDataKey(dataKey []byte, recipient string) (string, error) {
+	parsed, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return "", fmt.Errorf("invalid age recipient '%s': %w", recipient, err)
+	}
+
+	var buffer bytes.Buffer
+	armored := armor.NewWriter(&buffer)
+	writer, err := age.Encrypt(armored, parsed)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt the data key for %s: %w", recipient, err)
+	}
+
+	if _, err := writer.Write(dataKey); err != nil {
+		return "", fmt.Errorf("failed to encrypt the data key for %s: %w", recipient, err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt the data key for %s: %w", recipient, err)
+	}
+	if err := armored.Close(); err != nil {
+		return "", fmt.Errorf("failed to encrypt the data key for %s: %w", recipient, err)
+	}
+
+	return buffer.String(), nil
+}
+
+// ValidateAgeRecipients checks that every recipient is a valid age public key (age1...).
+func ValidateAgeRecipients(recipients []string) error {
+	for _, recipient := range recipients {
+		if _, err := age.ParseX25519Recipient(recipient); err != nil {
+			return fmt.Errorf("invalid age recipient '%s': %w", recipient, err)
+		}
+	}
+
+	return nil
+}
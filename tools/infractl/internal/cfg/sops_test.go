@@ -0,0 +1,333 @@
+package cfg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// The fixtures of testdata/sops are encrypted by the sops CLI (3.7.3) for the age key of testdata/sops/keys.txt:
+//
+//	sops --encrypt --age <recipient> --input-type yaml --output-type yaml local.yaml > local.enc.yaml
+//
+// with local.yaml holding sopsFixturePlaintext, and secrets.enc.json (read by the sops:// secret backend tests)
+// from {"github":{"token":"ghp_fixture"},"port":8080}.
+const sopsFixturePlaintext = `# Environment of the sops fixture
+product:
+  name: ref-arch
+  replicas: 3
+  ratio: 0.5
+  enabled: true
+  disabled: false
+  nothing: null
+secrets:
+  aws:
+    access_key: AKIAFIXTURE # the access key
+    secret_key: s3cr3t/with+chars=
+  region_unencrypted: eu-west-1
+stacks:
+  - name: stack-datastore
+    tags:
+      - data
+      - store
+`
+
+func loadTestAgeIdentities(t *testing.T) []age.Identity {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", "sops", "keys.txt"))
+	if err != nil {
+		t.Fatalf("reading the age key file: %v", err)
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(string(content)))
+	if err != nil {
+		t.Fatalf("parsing the age key file: %v", err)
+	}
+
+	return identities
+}
+
+func parseTestNode(t *testing.T, content string) *yaml.Node {
+	t.Helper()
+
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		t.Fatalf("parsing the document: %v", err)
+	}
+
+	return &root
+}
+
+func decodeTestNode(t *testing.T, root *yaml.Node) map[string]interface{} {
+	t.Helper()
+
+	var document map[string]interface{}
+	if err := root.Decode(&document); err != nil {
+		t.Fatalf("decoding the document: %v", err)
+	}
+
+	return document
+}
+
+func readSopsFixture(t *testing.T) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join("testdata", "sops", "local.enc.yaml"))
+	if err != nil {
+		t.Fatalf("reading the sops fixture: %v", err)
+	}
+
+	return string(content)
+}
+
+func TestDecryptSopsNodeFixture(t *testing.T) {
+	root := parseTestNode(t, readSopsFixture(t))
+	if !IsSopsEncryptedNode(root) {
+		t.Fatal("IsSopsEncryptedNode() = false, want true")
+	}
+
+	metadata, err := DecryptSopsNode("local.enc.yaml", root, loadTestAgeIdentities(t))
+	if err != nil {
+		t.Fatalf("DecryptSopsNode() unexpected error: %v", err)
+	}
+
+	if metadata.Version != "3.7.3" || len(metadata.Recipients()) != 1 {
+		t.Errorf("metadata = version %s, recipients %v, want version 3.7.3 and one recipient", metadata.Version, metadata.Recipients())
+	}
+
+	if IsSopsEncryptedNode(root) {
+		t.Error("the 'sops' block is left in the decrypted document")
+	}
+
+	if got, want := decodeTestNode(t, root), decodeTestNode(t, parseTestNode(t, sopsFixturePlaintext)); !reflect.DeepEqual(got, want) {
+		t.Errorf("decrypted document = %v, want %v", got, want)
+	}
+
+	content, err := yaml.Marshal(root)
+	if err != nil {
+		t.Fatalf("marshalling the decrypted document: %v", err)
+	}
+	for _, comment := range []string{"# Environment of the sops fixture", "# the access key"} {
+		if !strings.Contains(string(content), comment) {
+			t.Errorf("decrypted document lacks the comment %q:\n%s", comment, content)
+		}
+	}
+}
+
+func TestSopsRoundTrip(t *testing.T) {
+	identities := loadTestAgeIdentities(t)
+
+	root := parseTestNode(t, sopsFixturePlaintext)
+	if err := EncryptSopsNode(root, AgeRecipientsOf(identities)); err != nil {
+		t.Fatalf("EncryptSopsNode() unexpected error: %v", err)
+	}
+
+	encrypted, err := yaml.Marshal(root)
+	if err != nil {
+		t.Fatalf("marshalling the encrypted document: %v", err)
+	}
+
+	for _, plaintext := range []string{"ref-arch", "AKIAFIXTURE", "s3cr3t", "stack-datastore", "the access key"} {
+		if strings.Contains(string(encrypted), plaintext) {
+			t.Errorf("the encrypted document holds %q in clear text", plaintext)
+		}
+	}
+	if !strings.Contains(string(encrypted), "region_unencrypted: eu-west-1") {
+		t.Error("the value of region_unencrypted is encrypted, want it left in clear text")
+	}
+
+	decrypted := parseTestNode(t, string(encrypted))
+	if _, err := DecryptSopsNode("local.enc.yaml", decrypted, identities); err != nil {
+		t.Fatalf("DecryptSopsNode() unexpected error: %v", err)
+	}
+
+	if got, want := decodeTestNode(t, decrypted), decodeTestNode(t, parseTestNode(t, sopsFixturePlaintext)); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+
+	if err := EncryptSopsNode(parseTestNode(t, string(encrypted)), AgeRecipientsOf(identities)); err == nil {
+		t.Error("EncryptSopsNode() of an encrypted document succeeded, want an error")
+	}
+}
+
+func TestEncryptSopsNodeCommentsAsSops(t *testing.T) {
+	identities := loadTestAgeIdentities(t)
+
+	root := parseTestNode(t, sopsFixturePlaintext)
+	if err := EncryptSopsNode(root, AgeRecipientsOf(identities)); err != nil {
+		t.Fatalf("EncryptSopsNode() unexpected error: %v", err)
+	}
+
+	document := root.Content[0]
+	metadata := &SopsMetadata{}
+	if err := document.Content[sopsMetadataIndex(root)+1].Decode(metadata); err != nil {
+		t.Fatalf("decoding the 'sops' block: %v", err)
+	}
+	dataKey, err := decryptSopsDataKey("local.enc.yaml", metadata, identities)
+	if err != nil {
+		t.Fatalf("decrypting the data key: %v", err)
+	}
+
+	// sops reads the line comment of a value as a comment of the mapping holding its key, and authenticates it
+	// with the path of that mapping
+	aws := document.Content[3].Content[1]
+	comment := strings.TrimSpace(strings.TrimPrefix(aws.Content[1].LineComment, "#"))
+	matches := sopsEncryptedValue.FindStringSubmatch(comment)
+	if matches == nil {
+		t.Fatalf("line comment = %q, want it encrypted", aws.Content[1].LineComment)
+	}
+
+	plaintext, err := sopsDecrypt(matches, dataKey, sopsAdditionalData([]string{"secrets", "aws"}))
+	if err != nil {
+		t.Fatalf("decrypting the line comment with the path of its mapping: %v", err)
+	}
+	if plaintext != " the access key" {
+		t.Errorf("line comment = %q, want %q", plaintext, " the access key")
+	}
+}
+
+func TestDecryptSopsNodeErrors(t *testing.T) {
+	fixture := readSopsFixture(t)
+
+	otherIdentity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generating an age identity: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		content    string
+		identities []age.Identity
+		wantErr    string
+	}{
+		{
+			name:    "unencrypted value changed",
+			content: strings.Replace(fixture, "region_unencrypted: eu-west-1", "region_unencrypted: us-east-1", 1),
+			wantErr: "message authentication code of local.enc.yaml doesn't match",
+		},
+		{
+			name:    "value removed",
+			content: removeLine(fixture, "secret_key: ENC["),
+			wantErr: "message authentication code of local.enc.yaml doesn't match",
+		},
+		{
+			name:    "value added",
+			content: strings.Replace(fixture, "    region_unencrypted:", "    extra_unencrypted: x\n    region_unencrypted:", 1),
+			wantErr: "message authentication code of local.enc.yaml doesn't match",
+		},
+		{
+			name:    "value in clear text",
+			content: strings.Replace(fixture, "    - name: ENC[", "    - name: stack-injected\n      was: ENC[", 1),
+			wantErr: "the value of 'stacks.name' at local.enc.yaml:16 is in clear text, but should be encrypted",
+		},
+		{
+			name:    "encrypted value moved to another key",
+			content: swapValues(fixture, "access_key: ", "secret_key: "),
+			wantErr: "failed to decrypt the value of 'secrets.aws.access_key'",
+		},
+		{
+			name:    "message authentication code missing",
+			content: removeLine(fixture, "mac: ENC["),
+			wantErr: "the message authentication code is missing",
+		},
+		{
+			name:       "identity the file is not encrypted for",
+			content:    fixture,
+			identities: []age.Identity{otherIdentity},
+			wantErr:    "none of the age identities",
+		},
+		{
+			name:    "not encrypted",
+			content: sopsFixturePlaintext,
+			wantErr: "is not encrypted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identities := tt.identities
+			if identities == nil {
+				identities = loadTestAgeIdentities(t)
+			}
+
+			_, err := DecryptSopsNode("local.enc.yaml", parseTestNode(t, tt.content), identities)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("DecryptSopsNode() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecryptSopsNodeMACOnlyEncrypted(t *testing.T) {
+	identities := loadTestAgeIdentities(t)
+
+	// Every value is encrypted, so the message authentication code covers the same values with
+	// mac_only_encrypted set.
+	root := parseTestNode(t, "product:\n  name: ref-arch\nsecrets:\n  token: s3cr3t\n")
+	if err := EncryptSopsNode(root, AgeRecipientsOf(identities)); err != nil {
+		t.Fatalf("EncryptSopsNode() unexpected error: %v", err)
+	}
+	encrypted, err := yaml.Marshal(root)
+	if err != nil {
+		t.Fatalf("marshalling the encrypted document: %v", err)
+	}
+	macOnly := strings.Replace(string(encrypted), "    unencrypted_suffix:", "    mac_only_encrypted: true\n    unencrypted_suffix:", 1)
+
+	if _, err := DecryptSopsNode("local.enc.yaml", parseTestNode(t, macOnly), identities); err != nil {
+		t.Fatalf("DecryptSopsNode() unexpected error: %v", err)
+	}
+
+	// A value injected in clear text is left out of the message authentication code: it's rejected anyway
+	injected := strings.Replace(macOnly, "secrets:\n", "secrets:\n    password: injected\n", 1)
+	_, err = DecryptSopsNode("local.enc.yaml", parseTestNode(t, injected), identities)
+	if err == nil || !strings.Contains(err.Error(), "the value of 'secrets.password' at local.enc.yaml:4 is in clear text") {
+		t.Fatalf("DecryptSopsNode() error = %v, want the value in clear text rejected", err)
+	}
+
+	// Unless its key has the unencrypted suffix of the file
+	unencrypted := strings.Replace(macOnly, "secrets:\n", "secrets:\n    region_unencrypted: eu-west-1\n", 1)
+	if _, err := DecryptSopsNode("local.enc.yaml", parseTestNode(t, unencrypted), identities); err != nil {
+		t.Fatalf("DecryptSopsNode() of a value with the unencrypted suffix: unexpected error: %v", err)
+	}
+}
+
+// removeLine removes the first line of content holding substr.
+func removeLine(content, substr string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, substr) {
+			return strings.Join(append(lines[:i], lines[i+1:]...), "\n")
+		}
+	}
+
+	return content
+}
+
+// swapValues swaps the values of the first lines of content holding the keys a and b.
+func swapValues(content, a, b string) string {
+	lines := strings.Split(content, "\n")
+	ia, ib := -1, -1
+	for i, line := range lines {
+		if ia < 0 && strings.Contains(line, a) {
+			ia = i
+		}
+		if ib < 0 && strings.Contains(line, b) {
+			ib = i
+		}
+	}
+	if ia < 0 || ib < 0 {
+		return content
+	}
+
+	prefixA, valueA, _ := strings.Cut(lines[ia], a)
+	prefixB, valueB, _ := strings.Cut(lines[ib], b)
+	lines[ia], lines[ib] = prefixA+a+valueB, prefixB+b+valueA
+
+	return strings.Join(lines, "\n")
+}
@@ -1,23 +1,72 @@
 package cfg
 
-import (
-	"os"
-)
+// The transport contract describes how the compiled configuration travels from infractl to Terragrunt:
+//
+//   - infractl writes the compiled configuration as a JSON document (TransportEnvelope), stamped with
+//     TransportSchemaVersion, in the infra cache directory.
+//   - The path of that document is passed to the terragrunt process, and only to it, through the single
+//     canonical variable InfractlConfigFilePathEnvVar.
+//   - The HCL entrypoint (TransportEntrypointFilename) reads that variable, without falling back to any
+//     default file, and declares the schema version it supports in the TransportSchemaVersionLocal local.
+//   - The document never holds secrets (see SealEnvConfig): the values of the secrets section, and the
+//     sensitive provider configuration values, are ${<VAR>} placeholders. The values of the providers a
+//     component uses are passed to its terragrunt process through those variables, and the HCL entrypoint
+//     resolves the provider configuration placeholders from them.
+//   - Each terragrunt process reads a document scoped to the components it runs (see SealedEnvConfig.Scoped):
+//     only the providers they use, and the secret groups those providers read, are in it.
+//   - The document is written with TransportFileMode, and removed once the terragrunt run is over.
+//
+// Both sides must change together: RunSanityCheck refuses to run when the entrypoint does not honour it.
 
 const (
-	// INFRACTL_CONFIG_FILE_PATH is the path to the file that will be used to store the compiled configuration.
+	// InfractlConfigFilePathEnvVar is the canonical variable holding the path to the compiled configuration.
 	InfractlConfigFilePathEnvVar = "INFRACTL_CONFIG_FILE_PATH"
+
+	// TransportSchemaVersion is the version of the compiled configuration document. Bump it on any breaking
+	// change of the document shape, together with the version declared by the HCL entrypoint.
+	TransportSchemaVersion = 2
+
+	// TransportFileMode is the mode of the compiled configuration document: only readable by its owner.
+	TransportFileMode = 0600
+
+	// TransportEntrypointFilename is the Terragrunt file, in the Terragrunt directory, that reads the
+	// compiled configuration.
+	TransportEntrypointFilename = "config.hcl"
+
+	// TransportSchemaVersionLocal is the local, in the HCL entrypoint, declaring the supported schema version.
+	TransportSchemaVersionLocal = "supported_schema_version"
 )
 
+// TransportEnvelope is the document handed over to Terragrunt: the compiled configuration, with the
+// version of the schema it follows as a top-level 'schema_version' field.
+type TransportEnvelope struct {
+	SchemaVersion int `json:"schema_version"`
+	*EnvConfig
+}
+
+// NewTransportEnvelope wraps a compiled configuration into the document handed over to Terragrunt.
+func NewTransportEnvelope(envConfig *EnvConfig) TransportEnvelope {
+	return TransportEnvelope{
+		SchemaVersion: TransportSchemaVersion,
+		EnvConfig:     envConfig,
+	}
+}
+
 type TransmitterEnvVar struct {
 	Key   string
 	Value string
 }
 
+// String renders the variable in the KEY=VALUE form expected by exec.Cmd.Env.
+func (e TransmitterEnvVar) String() string {
+	return e.Key + "=" + e.Value
+}
+
 // GetTransmitterEnvVar converts a file path into an environment variable for the configuration file path.
 //
 // This function prepares the INFRACTL_CONFIG_FILE_PATH environment variable by taking a file path.
-// It creates a FileTransmitterEnvVar struct that can be used to set the environment variable.
+// The variable is meant to be passed to the terragrunt process (exec.Cmd.Env), not set on infractl's own
+// process, so concurrent runs with different configurations don't interfere with each other.
 //
 // Args:
 //
@@ -25,25 +74,10 @@ type TransmitterEnvVar struct {
 //
 // Returns:
 //
-//	A FileTransmitterEnvVar representing the configuration file path environment variable
+//	A TransmitterEnvVar representing the configuration file path environment variable
 func GetTransmitterEnvVar(value string) TransmitterEnvVar {
 	return TransmitterEnvVar{
 		Key:   InfractlConfigFilePathEnvVar,
 		Value: value,
 	}
 }
-
-// SetTransmitterTgEnvVar sets an environment variable for Terragrunt configuration.
-//
-// This function takes a FileTransmitterEnvVar pointer and sets the environment variable
-// using the Key and Value fields. Note: The current implementation appears to have
-// a duplicate os.Setenv call which may be unintentional.
-//
-// Args:
-//
-//	envVarsToSet: A pointer to a FileTransmitterEnvVar containing the key and value
-//	              to be set as an environment variable
-func SetTransmitterTgEnvVar(value string) {
-	envVar := GetTransmitterEnvVar(value)
-	os.Setenv(envVar.Key, envVar.Value)
-}
@@ -2,44 +2,42 @@
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
 )
 
-// buildBaseEnvConfig constructs the base environment configuration by retrieving
-// the path to the base environment configuration file and loading its contents.
+// loadEnvDocument loads the raw configuration document of an environment, by resolving the path of its
+// configuration file in the ENVS directory and reading it. It's the loader used to resolve inheritance chains.
 //
-// This function utilizes the GetBaseEnvFilePath function to obtain the path
-// of the base configuration file and then calls GetInfraEnvConfigFromFile
-// to read and parse the configuration from that file. If any errors occur
-// during this process, an error is returned with a detailed message indicating
-// the failure reason, including the path that was attempted to be read.
+// Parameters:
+//   - envName: The name of the environment (e.g. 'base' or 'local').
 //
 // Returns:
-//   - A pointer to the base EnvConfig structure, which contains the loaded
-//     environment configuration.
-//   - An error if the loading process fails, providing details about the
-//     specific failure. If successful, the error will be nil.
-func (c *Client) buildBaseEnvConfig() (*cfg.EnvConfig, error) {
-	baseCfgPath, err := cfg.GetBaseEnvFilePathAbsolute()
+//   - The absolute path to the environment configuration file.
+//   - The raw document of the environment configuration.
+//   - An error if the path cannot be resolved, or the file does not exist or cannot be read.
+func (c *Client) loadEnvDocument(envName string) (string, map[string]interface{}, error) {
+	envCfgPath, err := c.ResolveEnvConfigFilepathByEnvName(envName)
 	if err != nil {
-		return nil, fmt.Errorf("unable to retrieve the absolute path for the base environment configuration file: %w", err)
+		return "", nil, fmt.Errorf("failed to resolve the environment configuration path: %w", err)
 	}
 
-	baseCfg, err := cfg.GetInfraEnvConfigFromFile(baseCfgPath)
+	if _, err := os.Stat(envCfgPath); os.IsNotExist(err) {
+		return envCfgPath, nil, fmt.Errorf("environment configuration file %s does not exist", envCfgPath)
+	}
 
+	document, err := cfg.ReadEnvConfigDocument(envCfgPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build base environment configuration from path %s: %w", baseCfgPath, err)
+		return envCfgPath, nil, fmt.Errorf("failed to load environment configuration from path %s: %w", envCfgPath, err)
 	}
 
-	return baseCfg, nil
+	return envCfgPath, document, nil
 }
 
-// BuildTargetEnvConfig constructs the target environment configuration by resolving
-// the configuration file path for the specified target environment and loading its
-// contents from the file. This function is a part of the Client struct and is
-// responsible for ensuring that the target environment configuration is correctly
-// retrieved and parsed.
+// BuildEnvInheritanceChain resolves the environments the target environment inherits from, following the
+// 'extends' key of every environment configuration file. Environments without 'extends' inherit from the base
+// environment (base.yaml), so a target environment without it is merged over base.yaml alone.
 //
 // Parameters:
 //   - targetEnv: A string representing the name of the target environment for which
@@ -47,27 +45,14 @@ func (c *Client) buildBaseEnvConfig() (*cfg.EnvConfig, error) {
 //     name that has an associated configuration file.
 //
 // Returns:
-//   - A pointer to the EnvConfig structure containing the loaded target environment
-//     configuration.
-//   - An error if the loading process fails, providing details about the specific
-//     failure. If successful, the error will be nil.
-//
-// The function first attempts to resolve the file path of the target environment
-// configuration using the ResolveEnvConfigFilepathByEnvName method. If this fails,
-// it returns an error indicating the failure reason along with the attempted path.
-// If the path is successfully resolved, it then attempts to load the configuration
-// from the file using GetInfraEnvConfigFromFile. If this operation fails, it returns
-// an error indicating the failure to load the configuration.
-func (c *Client) BuildTargetEnvConfig(targetEnv string) (*cfg.EnvConfig, error) {
-	targetEnvCfgPath, err := c.ResolveEnvConfigFilepathByEnvName(targetEnv)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build target environment configuration from path %s: %w", targetEnvCfgPath, err)
-	}
-
-	targetCfg, err := cfg.GetInfraEnvConfigFromFile(targetEnvCfgPath)
+//   - The environments to merge, from the most generic one to the target environment.
+//   - An error if an environment cannot be loaded, or the inheritance chain is invalid
+//     or has a cycle.
+func (c *Client) BuildEnvInheritanceChain(targetEnv string) ([]cfg.EnvLayer, error) {
+	chain, err := cfg.ResolveInheritanceChain(targetEnv, c.loadEnvDocument)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load target environment configuration: %w", err)
+		return nil, fmt.Errorf("failed to resolve the inheritance chain of environment '%s': %w", targetEnv, err)
 	}
 
-	return targetCfg, nil
+	return chain, nil
 }
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/graph"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
+)
+
+// ComponentChange is a component affected by the changes of the working tree since a git ref
+type ComponentChange struct {
+	// ID is the ID of the component, <stack>/<layer>/<component>
+	ID string `json:"id"`
+	// Reasons explain why the component is affected, e.g. a changed file of its directory or of its Terraform module
+	Reasons []string `json:"reasons"`
+}
+
+// ChangedComponents finds the components of the target environment affected by the changes of the working tree
+// since a git ref, so only those run (e.g. on pull requests). A component is affected when any of these changed:
+//   - a file of its directory;
+//   - a file its terragrunt.hcl includes, e.g. its shared configuration under _shared/_components;
+//   - a Terragrunt configuration file (*.hcl) of a parent directory, e.g. layer.hcl, stack.hcl or root.hcl;
+//   - a file of the local Terraform module it sources, under infra/terraform/<module>;
+//   - the part of the compiled configuration it sees (its stack, layer and own settings, and its providers), when
+//     an environment configuration file (_ENVS) changed;
+//   - a component it depends on, directly or not.
+//
+// Parameters:
+//   - targetEnv: The name of the target environment, compiled at the ref to compare with when _ENVS changed.
+//   - ref: The git ref to diff the working tree against, e.g. origin/main.
+//   - sealed: The sealed compiled configuration of the target environment, from the working tree.
+//
+// Returns:
+//   - The affected components, sorted by ID, with the reasons why.
+//   - An error if git fails, or the Terragrunt files of a component cannot be parsed.
+func (c *Client) ChangedComponents(targetEnv, ref string, sealed *cfg.SealedEnvConfig) ([]ComponentChange, error) {
+	changedFiles, err := utils.GetGitChangedFiles(c.Paths.GitRepoRoot, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	depGraph, err := c.BuildDependencyGraph(sealed.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	reasons := map[string][]string{}
+	addReason := func(id, reason string) {
+		for _, existing := range reasons[id] {
+			if existing == reason {
+				return
+			}
+		}
+		reasons[id] = append(reasons[id], reason)
+	}
+
+	envsChanged := false
+	for _, file := range changedFiles {
+		if isPathWithin(filepath.Join(c.Paths.GitRepoRoot, file), c.Paths.EnvsConfig) {
+			envsChanged = true
+		}
+	}
+
+	for _, node := range depGraph.Nodes() {
+		if !node.Declared {
+			continue
+		}
+
+		// Components missing on disk are reported by the stack validations
+		if _, err := os.Stat(filepath.Join(node.Dir, graph.TerragruntConfigFilename)); err != nil {
+			continue
+		}
+
+		includedFiles, err := graph.IncludedFiles(node.Dir, c.Paths.GitRepoRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the files included by %s: %w", node.ID, err)
+		}
+
+		moduleDir, err := graph.ModuleDir(node.Dir, c.Paths.GitRepoRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the Terraform module of %s: %w", node.ID, err)
+		}
+
+		for _, file := range changedFiles {
+			path := filepath.Join(c.Paths.GitRepoRoot, file)
+
+			switch {
+			case isPathWithin(path, node.Dir):
+				addReason(node.ID, fmt.Sprintf("%s changed", file))
+			case containsName(includedFiles, path):
+				addReason(node.ID, fmt.Sprintf("%s changed, included by its terragrunt.hcl", file))
+			case moduleDir != "" && isPathWithin(path, moduleDir):
+				addReason(node.ID, fmt.Sprintf("%s changed, in its Terraform module", file))
+			case filepath.Ext(path) == ".hcl" && isPathWithin(path, c.Paths.Terragrunt) && isPathWithin(node.Dir, filepath.Dir(path)):
+				addReason(node.ID, fmt.Sprintf("%s changed, in a parent directory", file))
+			}
+		}
+	}
+
+	if envsChanged {
+		if err := c.compareComponentViews(targetEnv, ref, sealed, addReason); err != nil {
+			return nil, err
+		}
+	}
+
+	// Dependents run against the outputs of the components they depend on: they're affected too
+	changedIDs := make([]string, 0, len(reasons))
+	for id := range reasons {
+		changedIDs = append(changedIDs, id)
+	}
+	sort.Strings(changedIDs)
+
+	for _, changedID := range changedIDs {
+		visited := map[string]bool{}
+		pending := depGraph.Dependents(changedID)
+		for len(pending) > 0 {
+			dependent := pending[0]
+			pending = pending[1:]
+
+			if visited[dependent] {
+				continue
+			}
+			visited[dependent] = true
+
+			if node, ok := depGraph.Node(dependent); ok && node.Declared {
+				addReason(dependent, fmt.Sprintf("depends on %s, which changed", changedID))
+			}
+			pending = append(pending, depGraph.Dependents(dependent)...)
+		}
+	}
+
+	changes := make([]ComponentChange, 0, len(reasons))
+	for id, componentReasons := range reasons {
+		changes = append(changes, ComponentChange{ID: id, Reasons: componentReasons})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+
+	return changes, nil
+}
+
+// compareComponentViews compiles the target environment from the environment configuration files at a git ref,
+// and reports the components whose view of the compiled configuration differs from the working tree one. When
+// the target environment cannot be compiled at the ref (e.g. it's new), every component is reported.
+func (c *Client) compareComponentViews(targetEnv, ref string, sealed *cfg.SealedEnvConfig, addReason func(id, reason string)) error {
+	currentViews, err := componentViews(sealed)
+	if err != nil {
+		return err
+	}
+
+	refSealed, refErr := c.compileSealedAtRef(targetEnv, ref)
+
+	var refViews map[string]string
+	if refErr == nil {
+		if refViews, err = componentViews(refSealed); err != nil {
+			return err
+		}
+	}
+
+	for id, view := range currentViews {
+		switch {
+		case refErr != nil:
+			addReason(id, fmt.Sprintf("the configuration of %s cannot be compiled at %s to compare with (%v)", targetEnv, ref, refErr))
+		case refViews[id] != view:
+			addReason(id, fmt.Sprintf("its compiled configuration changed since %s", ref))
+		}
+	}
+
+	return nil
+}
+
+// compileSealedAtRef compiles and seals the target environment from the environment configuration files as they
+// are at a git ref, checked out in a temporary directory.
+func (c *Client) compileSealedAtRef(targetEnv, ref string) (*cfg.SealedEnvConfig, error) {
+	envsDir, err := filepath.Rel(c.Paths.GitRepoRoot, c.Paths.EnvsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the environment configuration directory: %w", err)
+	}
+
+	files, err := utils.GetGitFilesAtRef(c.Paths.GitRepoRoot, ref, envsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	refEnvsDir, err := os.MkdirTemp("", "infractl-envs-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temporary directory for the environment configuration files at '%s': %w", ref, err)
+	}
+	defer os.RemoveAll(refEnvsDir)
+
+	for file, content := range files {
+		rel, err := filepath.Rel(envsDir, filepath.FromSlash(file))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", file, err)
+		}
+
+		path := filepath.Join(refEnvsDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to check out %s at '%s': %w", file, ref, err)
+		}
+		if err := os.WriteFile(path, content, cfg.TransportFileMode); err != nil {
+			return nil, fmt.Errorf("failed to check out %s at '%s': %w", file, ref, err)
+		}
+	}
+
+	// References are compared as they resolve today: strict mode is left to the run itself
+	refClient := *c
+	refClient.Paths.EnvsConfig = refEnvsDir
+	refClient.Strict = false
+
+	result, err := refClient.compile(targetEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealCompilation(result)
+}
+
+// componentViews renders, by component ID, the part of a sealed compiled configuration a component sees: the
+// shared settings, its providers (and their secrets), and its stack, layer and own settings.
+func componentViews(sealed *cfg.SealedEnvConfig) (map[string]string, error) {
+	views := map[string]string{}
+
+	for _, stack := range sealed.Config.Stacks {
+		for _, layer := range stack.Layers {
+			for _, component := range layer.Components {
+				componentID := stack.Name + "/" + layer.Name + "/" + component.Name
+
+				stackView, layerView := stack, layer
+				layerView.Components = []cfg.ComponentConfig{component}
+				stackView.Layers = []cfg.LayerConfig{layerView}
+
+				view := sealed.Scoped(component.Providers).Config
+				view.Stacks = []cfg.StackConfig{stackView}
+
+				content, err := json.Marshal(view)
+				if err != nil {
+					return nil, fmt.Errorf("failed to render the compiled configuration of %s: %w", componentID, err)
+				}
+				views[componentID] = string(content)
+			}
+		}
+	}
+
+	return views, nil
+}
+
+// isPathWithin reports whether a path is a directory or inside it.
+func isPathWithin(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
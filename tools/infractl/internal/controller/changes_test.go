@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/testutil"
+)
+
+// changesTestBase is the base environment of the git repository created by newChangesTestClient: table reads
+// the aws provider, id-generator and app the random one.
+const changesTestBase = `config:
+  version: "1.0.0"
+git:
+  base_url: "git::git@github.com:"
+product:
+  name: ref-arch
+  version: "0.0.1"
+stacks:
+  - name: stack-test
+    layers:
+      - name: db
+        components:
+          - name: id-generator
+            providers: [random]
+          - name: table
+            providers: [aws]
+          - name: app
+            providers: [random]
+providers:
+  aws:
+    config:
+      region: us-east-1
+    version_constraint:
+      source: hashicorp/aws
+      required_version: "5.80.0"
+      enabled: true
+  random:
+    config: {}
+    version_constraint:
+      source: hashicorp/random
+      required_version: "3.6.0"
+      enabled: true
+iac:
+  versions:
+    terraform_version_default: "1.9.8"
+    terragrunt_version_default: "0.62.1"
+  remote_state:
+    s3:
+      bucket: state
+      lock_table: lock
+      region: us-east-1
+`
+
+// changesTestFiles are the files of the git repository created by newChangesTestClient, by path relative to its
+// root: app depends on table, which depends on id-generator and includes a shared configuration file.
+var changesTestFiles = map[string]string{
+	"infra/terragrunt/_ENVS/base.yaml":                           "# base\n" + changesTestBase,
+	"infra/terragrunt/_ENVS/dev.yaml":                            "product:\n  name: ref-arch-dev\n",
+	"infra/terragrunt/root.hcl":                                  "locals {}\n",
+	"infra/terragrunt/_shared/_components/table.hcl":             "locals {}\n",
+	"infra/terragrunt/stack-test/README.md":                      "# stack-test\n",
+	"infra/terragrunt/stack-test/db/layer.hcl":                   "locals {}\n",
+	"infra/terragrunt/stack-test/db/id-generator/terragrunt.hcl": "include \"root\" {\n  path = find_in_parent_folders(\"root.hcl\")\n}\n",
+	"infra/terragrunt/stack-test/db/table/terragrunt.hcl": "include \"component\" {\n" +
+		"  path = \"${get_repo_root()}/infra/terragrunt/_shared/_components/table.hcl\"\n}\n\n" +
+		"dependency \"ids\" {\n  config_path = \"../id-generator\"\n}\n",
+	"infra/terragrunt/stack-test/db/app/terragrunt.hcl":         "dependencies {\n  paths = [\"../table\"]\n}\n",
+	"infra/terragrunt/stack-test/db/id-generator/component.hcl": "locals {}\n",
+	"infra/terragrunt/stack-test/db/table/component.hcl":        "locals {}\n",
+	"infra/terragrunt/stack-test/db/app/component.hcl":          "locals {}\n",
+	"infra/terraform/id-generator/main.tf":                      "",
+	"infra/terraform/table/main.tf":                             "",
+	"infra/terraform/app/main.tf":                               "",
+}
+
+// newChangesTestClient creates a git repository (see testutil.NewGitRepo) holding changesTestFiles, every file
+// but the uncommitted ones committed, and a client for it.
+func newChangesTestClient(t *testing.T, uncommitted ...string) *Client {
+	t.Helper()
+
+	repoRoot := testutil.NewGitRepo(t, changesTestFiles, uncommitted...)
+
+	return &Client{Paths: RepoPaths{
+		GitRepoRoot: repoRoot,
+		Cache:       cfg.GetInfraCacheDirPathAbsoluteWithGitRepoRoot(repoRoot),
+		Terragrunt:  cfg.GetInfraTerragruntDirPathAbsoluteWithGitRepoRoot(repoRoot),
+		EnvsConfig:  cfg.GetEnvConfigFilesPathAbsoluteWithGitRepoRoot(repoRoot),
+	}}
+}
+
+// changedComponents compiles the dev environment from the working tree, and returns the reasons of the
+// components changed since HEAD, joined by '; ', by component name.
+func changedComponents(t *testing.T, client *Client) map[string]string {
+	t.Helper()
+
+	_, sealed, err := client.CompileSealed("dev")
+	if err != nil {
+		t.Fatalf("CompileSealed() unexpected error: %v", err)
+	}
+
+	changes, err := client.ChangedComponents("dev", "HEAD", sealed)
+	if err != nil {
+		t.Fatalf("ChangedComponents() unexpected error: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, change := range changes {
+		got[strings.TrimPrefix(change.ID, testStack+"/"+testLayer+"/")] = strings.Join(change.Reasons, "; ")
+	}
+
+	return got
+}
+
+func TestChangedComponents(t *testing.T) {
+	const componentsDir = "infra/terragrunt/stack-test/db/"
+
+	tests := []struct {
+		name    string
+		changes map[string]string
+		want    map[string]string
+	}{
+		{
+			name: "nothing changed",
+			want: map[string]string{},
+		},
+		{
+			name:    "file of a component, and its dependents",
+			changes: map[string]string{componentsDir + "id-generator/terragrunt.hcl": "# changed\n" + changesTestFiles[componentsDir+"id-generator/terragrunt.hcl"]},
+			want: map[string]string{
+				"id-generator": componentsDir + "id-generator/terragrunt.hcl changed",
+				"table":        "depends on stack-test/db/id-generator, which changed",
+				"app":          "depends on stack-test/db/id-generator, which changed",
+			},
+		},
+		{
+			name:    "new file of a component",
+			changes: map[string]string{componentsDir + "app/inputs.auto.tfvars": "a = 1\n"},
+			want:    map[string]string{"app": componentsDir + "app/inputs.auto.tfvars changed"},
+		},
+		{
+			name:    "file included by terragrunt.hcl",
+			changes: map[string]string{"infra/terragrunt/_shared/_components/table.hcl": "locals { changed = true }\n"},
+			want: map[string]string{
+				"table": "infra/terragrunt/_shared/_components/table.hcl changed, included by its terragrunt.hcl",
+				"app":   "depends on stack-test/db/table, which changed",
+			},
+		},
+		{
+			name:    "Terraform module",
+			changes: map[string]string{"infra/terraform/app/main.tf": "# changed\n"},
+			want:    map[string]string{"app": "infra/terraform/app/main.tf changed, in its Terraform module"},
+		},
+		{
+			name:    "Terragrunt configuration of a parent directory",
+			changes: map[string]string{componentsDir + "layer.hcl": "locals { changed = true }\n"},
+			want: map[string]string{
+				"id-generator": componentsDir + "layer.hcl changed, in a parent directory",
+				"table":        componentsDir + "layer.hcl changed, in a parent directory; depends on stack-test/db/id-generator, which changed",
+				"app":          componentsDir + "layer.hcl changed, in a parent directory; depends on stack-test/db/id-generator, which changed; depends on stack-test/db/table, which changed",
+			},
+		},
+		{
+			name: "files of parent directories that are not Terragrunt configuration",
+			changes: map[string]string{
+				"infra/terragrunt/stack-test/README.md": "# changed\n",
+				"infra/terraform/README.md":             "# new\n",
+			},
+			want: map[string]string{},
+		},
+		{
+			name:    "environment configuration a single component sees",
+			changes: map[string]string{"infra/terragrunt/_ENVS/dev.yaml": changesTestFiles["infra/terragrunt/_ENVS/dev.yaml"] + "stacks:\n  - name: stack-test\n    layers:\n      - name: db\n        components:\n          - name: app\n            tags: {team: app}\n"},
+			want:    map[string]string{"app": "its compiled configuration changed since HEAD"},
+		},
+		{
+			name:    "provider configuration",
+			changes: map[string]string{"infra/terragrunt/_ENVS/base.yaml": strings.Replace(changesTestBase, "region: us-east-1\n    version_constraint", "region: eu-west-1\n    version_constraint", 1)},
+			want: map[string]string{
+				"table": "its compiled configuration changed since HEAD",
+				"app":   "depends on stack-test/db/table, which changed",
+			},
+		},
+		{
+			name:    "environment configuration every component sees",
+			changes: map[string]string{"infra/terragrunt/_ENVS/dev.yaml": "product:\n  name: ref-arch-staging\n"},
+			want: map[string]string{
+				"id-generator": "its compiled configuration changed since HEAD",
+				"table":        "its compiled configuration changed since HEAD; depends on stack-test/db/id-generator, which changed",
+				"app":          "its compiled configuration changed since HEAD; depends on stack-test/db/id-generator, which changed; depends on stack-test/db/table, which changed",
+			},
+		},
+		{
+			name: "environment configuration that compiles the same",
+			changes: map[string]string{
+				"infra/terragrunt/_ENVS/base.yaml":    changesTestBase,
+				"infra/terragrunt/_ENVS/staging.yaml": "product:\n  name: ref-arch-staging\n",
+			},
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newChangesTestClient(t)
+			for path, content := range tt.changes {
+				testutil.WriteFile(t, client.Paths.GitRepoRoot, path, content)
+			}
+
+			if got := changedComponents(t, client); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChangedComponents() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedComponentsEnvironmentNotCompiledAtRef(t *testing.T) {
+	// dev.yaml doesn't exist at HEAD: every component is affected
+	client := newChangesTestClient(t, "infra/terragrunt/_ENVS/dev.yaml")
+
+	got := changedComponents(t, client)
+
+	for _, component := range []string{"id-generator", "table", "app"} {
+		reasons := got[component]
+		if !strings.HasPrefix(reasons, "the configuration of dev cannot be compiled at HEAD to compare with (") || !strings.Contains(reasons, "dev.yaml") {
+			t.Errorf("reasons of %s = %q, want the configuration not compiled at HEAD", component, reasons)
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("ChangedComponents() = %q, want every component", got)
+	}
+}
+
+func TestChangedComponentsUnknownRef(t *testing.T) {
+	client := newChangesTestClient(t)
+
+	_, sealed, err := client.CompileSealed("dev")
+	if err != nil {
+		t.Fatalf("CompileSealed() unexpected error: %v", err)
+	}
+
+	if _, err := client.ChangedComponents("dev", "nope", sealed); err == nil || !strings.Contains(err.Error(), "git ref 'nope' cannot be resolved") {
+		t.Fatalf("ChangedComponents() error = %v, want the ref to be unknown", err)
+	}
+}
+
+func TestCompileSealedAtRef(t *testing.T) {
+	client := newChangesTestClient(t)
+
+	// At HEAD, dev reads a variable that is not set: it only compiles outside of strict mode
+	writeTestFile(t, filepath.Join(client.Paths.EnvsConfig, "dev.yaml"), "product:\n  name: ref-arch-dev\n  description: ${INFRACTL_CHANGES_TEST_UNSET}\n")
+	testutil.RunGit(t, client.Paths.GitRepoRoot, "commit", "--quiet", "--all", "--message", "unset variable")
+
+	// The working tree differs from HEAD: the environment is compiled from the files at HEAD
+	writeTestFile(t, filepath.Join(client.Paths.EnvsConfig, "base.yaml"), strings.Replace(changesTestBase, "region: us-east-1\n    version_constraint", "region: eu-west-1\n    version_constraint", 1))
+	writeTestFile(t, filepath.Join(client.Paths.EnvsConfig, "dev.yaml"), "product:\n  name: ref-arch-changed\n")
+
+	client.Strict = true
+	sealed, err := client.compileSealedAtRef("dev", "HEAD")
+	if err != nil {
+		t.Fatalf("compileSealedAtRef() unexpected error: %v", err)
+	}
+
+	if got := sealed.Config.Product.Name; got != "ref-arch-dev" {
+		t.Errorf("product name = %q, want ref-arch-dev, as at HEAD", got)
+	}
+	if got := sealed.Config.Providers["aws"].Config["region"]; got != "us-east-1" {
+		t.Errorf("aws region = %v, want us-east-1, as at HEAD", got)
+	}
+	if !client.Strict || client.Paths.EnvsConfig != cfg.GetEnvConfigFilesPathAbsoluteWithGitRepoRoot(client.Paths.GitRepoRoot) {
+		t.Errorf("compileSealedAtRef() changed the client: %+v", client)
+	}
+
+	if _, err := client.compileSealedAtRef("prod", "HEAD"); err == nil {
+		t.Errorf("compileSealedAtRef() of an environment missing at HEAD: want an error")
+	}
+	if _, err := client.compileSealedAtRef("dev", "nope"); err == nil || !strings.Contains(err.Error(), "at 'nope'") {
+		t.Errorf("compileSealedAtRef() of an unknown ref: error = %v, want the files not to be read", err)
+	}
+}
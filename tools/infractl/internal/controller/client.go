@@ -2,10 +2,13 @@
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/envars"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
 )
 
@@ -18,6 +21,11 @@ type RepoPaths struct {
 
 type Client struct {
 	Paths RepoPaths
+	// Strict makes the compilation fail, listing every unresolved reference, when a ${VAR} reference of the
+	// configuration cannot be resolved (see CheckReferences).
+	Strict bool
+	// Executor runs terragrunt; the sanity check looks terragrunt up through it.
+	Executor tg.Executor
 }
 
 // NewClient creates and initializes a new InfraController client with the specified base and override environment configuration file paths.
@@ -61,6 +69,7 @@ func NewClient(baseFilePath, targetEnvFilePath string) (*Client, error) {
 			Terragrunt:  terragruntDirPath,
 			EnvsConfig:  envsFilesPath,
 		},
+		Executor: tg.NewExecutor(),
 	}
 
 	return client, nil
@@ -68,15 +77,17 @@ func NewClient(baseFilePath, targetEnvFilePath string) (*Client, error) {
 
 // ResolveEnvConfigFilepathByEnvName constructs the absolute file path for the environment configuration file
 // based on the provided environment name. It ensures that the environment name is valid and appends the
-// appropriate file extension before resolving the full path.
+// appropriate file extension before resolving the full path. An encrypted configuration file (<env>.enc.yaml)
+// takes the place of the <env>.yaml one; having both is an error.
 //
 // Parameters:
 //   - envName: A string representing the name of the environment for which the configuration file path is to be resolved.
 //     This should be a valid environment name and cannot be empty.
 //
 // Returns:
-//   - A string containing the absolute path to the environment configuration file with the ".yaml" extension.
-//   - An error if the environment name is empty or if any other issues arise during path resolution.
+//   - A string containing the absolute path to the environment configuration file, with the ".enc.yaml" extension
+//     if the environment is encrypted, or the ".yaml" extension otherwise.
+//   - An error if the environment name is empty, both files exist, or if any other issues arise during path resolution.
 //
 // Example usage:
 //
@@ -95,13 +106,34 @@ func (c *Client) ResolveEnvConfigFilepathByEnvName(envName string) (string, erro
 	// Construct the full path to the environment configuration file
 	envFilePathResolved := filepath.Join(c.Paths.EnvsConfig, envFileWithExtension)
 
-	return envFilePathResolved, nil
+	encryptedEnvFilePath := c.EncryptedEnvConfigFilepath(envName)
+	if _, err := os.Stat(encryptedEnvFilePath); err != nil {
+		return envFilePathResolved, nil
+	}
+
+	if envFilePathResolved != encryptedEnvFilePath {
+		if _, err := os.Stat(envFilePathResolved); err == nil {
+			return "", fmt.Errorf("environment '%s' has two configuration files, %s and %s; keep only one of them",
+				envName, envFilePathResolved, encryptedEnvFilePath)
+		}
+	}
+
+	return encryptedEnvFilePath, nil
+}
+
+// EncryptedEnvConfigFilepath returns the absolute path of the encrypted configuration file of an environment,
+// e.g. _ENVS/prod.enc.yaml for 'prod', whether it exists or not.
+func (c *Client) EncryptedEnvConfigFilepath(envName string) string {
+	envName = strings.TrimSuffix(strings.TrimSuffix(envName, cfg.EncryptedEnvFileExtension), ".yaml")
+
+	return filepath.Join(c.Paths.EnvsConfig, envName+cfg.EncryptedEnvFileExtension)
 }
 
 // RunSanityCheck performs a series of validation checks to ensure that the environment
 // is properly set up for operation. This method checks for the installation of Terragrunt,
-// the existence of environment configuration files, and the validity of both the base
-// and target environment configuration files.
+// the existence of environment configuration files, the validity of both the base
+// and target environment configuration files, and that the Terragrunt entrypoint reads
+// the compiled configuration through the transport contract.
 //
 // Parameters:
 //   - targetEnv: A string representing the name of the target environment. This should
@@ -119,7 +151,7 @@ func (c *Client) ResolveEnvConfigFilepathByEnvName(envName string) (string, erro
 //	}
 func (c *Client) RunSanityCheck(targetEnv string) error {
 	// Check 1: Terragrunt is installed
-	if err := isTerragruntInstalled(); err != nil {
+	if err := isTerragruntInstalled(c.Executor); err != nil {
 		return fmt.Errorf("terragrunt installation check failed: %w", err)
 	}
 
@@ -144,6 +176,11 @@ func (c *Client) RunSanityCheck(targetEnv string) error {
 		return fmt.Errorf("failed to validate target environment file: %w", err)
 	}
 
+	// Check 5: The HCL entrypoint consumes the compiled configuration as infractl hands it over
+	if err := isTransportEntrypointConsistent(c.Paths.Terragrunt); err != nil {
+		return fmt.Errorf("transport contract check failed: %w", err)
+	}
+
 	return nil
 }
 
@@ -185,11 +222,9 @@ func (c *Client) Initialise() error {
 	return nil
 }
 
-// CleanTransmitterEnvVars removes environment variables associated with the transmitter
-// by utilizing the keys defined in the InfraCtlGitIgnoreEntries configuration. This
-// function is particularly useful for ensuring that any sensitive or unnecessary
-// environment variables are cleared from the environment, thereby maintaining a clean
-// state for subsequent operations.
+// CleanTransmitterEnvVars removes the transport variable (INFRACTL_CONFIG_FILE_PATH) from the
+// environment, so a value inherited from the shell or left by a previous run can never be mistaken
+// for the configuration compiled by this run. The terragrunt process always receives it explicitly.
 //
 // Returns:
 //   - An error if the cleaning process fails, providing details about the specific
@@ -200,9 +235,8 @@ func (c *Client) Initialise() error {
 //
 //	client.CleanTransmitterEnvVars()
 func (c *Client) CleanTransmitterEnvVars() {
-	// Attempt to clean environment variables by keys defined in the InfraCtlGitIgnoreEntries.
-	// If an error occurs during this process, we can ignore it as it means the env vars weren't set.
-	_ = envars.CleanEnvVarsByKeys(cfg.InfraCtlGitIgnoreEntries)
+	// If an error occurs during this process, we can ignore it as it means the env var wasn't set.
+	_ = envars.CleanEnvVarsByKeys([]string{cfg.InfractlConfigFilePathEnvVar})
 }
 
 // CreateCachedEnvCfgJSONFile generates a unique filename for the specified target environment
@@ -250,3 +284,19 @@ func (c *Client) CreateCachedEnvCfgJSONFile(targetEnv, jsonCfg, overrideJSONName
 
 	return envCfgJSONFilepath, nil
 }
+
+// RemoveCachedEnvCfgJSONFile removes a compiled configuration JSON file created by CreateCachedEnvCfgJSONFile,
+// once the terragrunt run that reads it is over, so no compiled configuration outlives its run.
+//
+// Parameters:
+//   - envCfgJSONFilepath: The path to the cached JSON configuration file.
+//
+// Returns:
+//   - An error if the file exists but cannot be removed.
+func (c *Client) RemoveCachedEnvCfgJSONFile(envCfgJSONFilepath string) error {
+	if err := os.Remove(envCfgJSONFilepath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cached environment configuration JSON file %s: %w", envCfgJSONFilepath, err)
+	}
+
+	return nil
+}
@@ -2,15 +2,17 @@
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/transformers"
 )
 
 // Compile constructs the environment configuration for a specified target environment.
-// It first builds the base environment configuration and then the target environment configuration.
-// After that, it merges both configurations and applies transformations to generate the final compiled configuration.
+// It first resolves the inheritance chain of the target environment (base.yaml, and any environment listed in
+// 'extends'). After that, it merges the chain and applies transformations to generate the final compiled configuration.
 //
 // Parameters:
 //   - targetEnv: A string representing the name of the target environment for which the configuration is to be compiled.
@@ -19,43 +21,333 @@
 //   - A pointer to the compiled environment configuration (*cfg.EnvConfig) if successful.
 //   - An error if any step in the process fails, providing context about the failure.
 func (c *Client) Compile(targetEnv string) (*cfg.EnvConfig, error) {
-	// Build the base environment configuration.
-	baseEnvCfgBuilt, err := c.buildBaseEnvConfig()
+	result, err := c.compileAndValidateStacks(targetEnv)
 	if err != nil {
-		return nil, fmt.Errorf("error building base environment configuration: %w; ensure that the base configuration is correctly defined and accessible", err)
+		return nil, err
 	}
 
-	// Build the target environment configuration.
-	targetEnvCfgBuilt, err := c.BuildTargetEnvConfig(targetEnv)
+	// Return the successfully compiled configuration.
+	return result.compiled, nil
+}
+
+// CompileSealed compiles the target environment like Compile, and seals the compiled configuration: every value
+// of the secrets section, and every provider configuration value that is (or reads) a secret, is replaced by a
+// placeholder. The sealed configuration is what's written to disk and handed over to Terragrunt; the sealed
+// values are delivered through the environment of the terragrunt process instead.
+//
+// Parameters:
+//   - targetEnv: A string representing the name of the target environment for which the configuration is to be compiled.
+//
+// Returns:
+//   - A pointer to the compiled environment configuration (*cfg.EnvConfig), with every value resolved.
+//   - A pointer to the sealed configuration (*cfg.SealedEnvConfig).
+//   - An error if the compilation fails, or the sensitive values cannot be sealed.
+func (c *Client) CompileSealed(targetEnv string) (*cfg.EnvConfig, *cfg.SealedEnvConfig, error) {
+	result, err := c.compileAndValidateStacks(targetEnv)
 	if err != nil {
-		return nil, fmt.Errorf("error building target environment configuration for '%s': %w; please check the target environment name and its associated settings", targetEnv, err)
+		return nil, nil, err
 	}
 
-	// Merge the base and target environment configurations.
-	mergedCfg, err := cfg.MergeConfigs(baseEnvCfgBuilt, targetEnvCfgBuilt)
+	sealed, err := sealCompilation(result)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile target environment %s: error occurred during the merging of base and target environment configurations", targetEnv)
+		return nil, nil, fmt.Errorf("failed to seal the secrets of the compiled configuration: %w", err)
 	}
 
-	// Create a new transformer for environment variables based on the merged configuration.
-	envVarsTransformer := transformers.NewEnvVarsTransformer(mergedCfg)
+	return result.compiled, sealed, nil
+}
 
-	// Get the updated configuration after applying environment variable transformations.
-	compiledConfig, err := envVarsTransformer.GetUpdatedConfig()
+// compileAndValidateStacks compiles the target environment, and checks its stacks against the filesystem.
+func (c *Client) compileAndValidateStacks(targetEnv string) (*compilation, error) {
+	result, err := c.compile(targetEnv)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile configuration: %w", err)
+		return nil, err
 	}
 
 	// Create a new stacks transformer for validating the stacks in the compiled configuration.
-	stacksTransformer := transformers.NewStacksTransformer(compiledConfig, c.Paths.Terragrunt)
+	stacksTransformer := transformers.NewStacksTransformer(result.compiled, c.Paths.Terragrunt)
 
 	// Validate the stacks to ensure they are correctly configured.
 	if err := stacksTransformer.ValidateStacks(); err != nil {
 		return nil, fmt.Errorf("failed to compile stacks in %s: %w", c.Paths.Terragrunt, err)
 	}
 
-	// Return the successfully compiled configuration.
-	return compiledConfig, nil
+	return result, nil
+}
+
+// sealCompilation seals the compiled configuration. A provider configuration value is sensitive when its
+// expression reads a secret (${VAR:-secrets.group.key}), whichever source resolved it, or when it's equal to
+// the resolved value of a secret.
+func sealCompilation(result *compilation) (*cfg.SealedEnvConfig, error) {
+	secretValues := map[string]bool{}
+	for _, secretGroup := range result.compiled.Secrets {
+		for _, secretValue := range secretGroup {
+			if secretValue != "" {
+				secretValues[secretValue] = true
+			}
+		}
+	}
+
+	rawValues := cfg.LeafValues(result.document)
+
+	sealed, err := cfg.SealEnvConfig(result.compiled, func(provider, key, value string) bool {
+		if secretValues[value] {
+			return true
+		}
+
+		expression, isString := rawValues["providers."+provider+".config."+key].(string)
+		if !isString {
+			return false
+		}
+
+		for _, reference := range result.envVarsTransformer.ExplainValue(expression) {
+			if reference.Secret != "" {
+				return true
+			}
+		}
+
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sealed.ProviderSecretGroups, err = providerSecretGroups(result)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed.SensitiveEnvVars = sensitiveEnvVars(result, rawValues)
+
+	return sealed, nil
+}
+
+// sensitiveEnvVars returns the environment variables the values of the secrets section and of the provider
+// configurations reference, directly or through the secrets they read, sorted.
+func sensitiveEnvVars(result *compilation, rawValues map[string]interface{}) []string {
+	names := map[string]bool{}
+
+	var collect func(references []transformers.ValueReference)
+	collect = func(references []transformers.ValueReference) {
+		for _, reference := range references {
+			names[reference.EnvVar] = true
+			collect(reference.SecretReferences)
+		}
+	}
+
+	for valuePath, value := range rawValues {
+		expression, isString := value.(string)
+		if !isString || !(cfg.IsValuePathUnder(valuePath, "secrets") || cfg.IsValuePathUnder(valuePath, "providers")) {
+			continue
+		}
+		collect(result.envVarsTransformer.ExplainValue(expression))
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// providerSecretGroups maps every provider to the secret groups its configuration reads, through
+// ${VAR:-secrets.group.key} defaults, whether the variables are set or not.
+func providerSecretGroups(result *compilation) (map[string][]string, error) {
+	mergedCfg, err := cfg.EnvConfigFromDocument(result.document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the secrets the providers use: %w", err)
+	}
+
+	audit, err := transformers.AuditSecrets(mergedCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]string{}
+	for _, usage := range audit.Secrets {
+		for _, providerName := range usage.Providers {
+			if !containsName(groups[providerName], usage.Group) {
+				groups[providerName] = append(groups[providerName], usage.Group)
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CompileWithoutStackValidation constructs the environment configuration for a specified target environment,
+// like Compile, but without checking the stacks, layers and components against the filesystem. It's meant for
+// commands that report on the stacks themselves, such as the dependency graph, rather than run them.
+//
+// Parameters:
+//   - targetEnv: A string representing the name of the target environment for which the configuration is to be compiled.
+//
+// Returns:
+//   - A pointer to the compiled environment configuration (*cfg.EnvConfig) if successful.
+//   - An error if any step in the process fails, providing context about the failure.
+func (c *Client) CompileWithoutStackValidation(targetEnv string) (*cfg.EnvConfig, error) {
+	result, err := c.compile(targetEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.compiled, nil
+}
+
+// compilation holds every stage of the compilation of a target environment, for the commands that report on
+// how the configuration was compiled rather than only use it.
+type compilation struct {
+	// chain is the inheritance chain of the target environment, from the most generic environment.
+	chain []cfg.EnvLayer
+	// document is the raw document merged from the chain.
+	document map[string]interface{}
+	// envVarsTransformer expanded the merged configuration into the compiled one.
+	envVarsTransformer *transformers.EnvVarsTransformer
+	// compiled is the compiled configuration.
+	compiled *cfg.EnvConfig
+}
+
+// compile resolves the inheritance chain of a target environment, merges it, and expands the environment
+// variables and secrets of the merged configuration.
+func (c *Client) compile(targetEnv string) (*compilation, error) {
+	// Resolve the environments the target environment inherits from, base.yaml included.
+	chain, err := c.BuildEnvInheritanceChain(targetEnv)
+	if err != nil {
+		return nil, fmt.Errorf("error building target environment configuration for '%s': %w; please check the target environment name and the environments it extends", targetEnv, err)
+	}
+
+	// Deep merge the environments of the inheritance chain, from the most generic one to the target.
+	mergedDocument, err := cfg.MergeInheritanceChain(chain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile target environment %s: error occurred during the merging of its inheritance chain: %w", targetEnv, err)
+	}
+
+	mergedCfg, err := cfg.EnvConfigFromDocument(mergedDocument)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile target environment %s: the merged configuration is invalid: %w", targetEnv, err)
+	}
+
+	// Create a new transformer for environment variables based on the merged configuration. Secret references
+	// (sops://, file://, exec://, vault://) are resolved from the root of the git repository.
+	secretProviders := transformers.DefaultSecretProviders(c.Paths.GitRepoRoot)
+	envVarsTransformer := transformers.NewEnvVarsTransformerWithSecretProviders(mergedCfg, secretProviders)
+
+	// In strict mode, unresolved references fail the compilation instead of being left in the compiled configuration.
+	if c.Strict {
+		if _, err := c.checkReferences(chain, mergedCfg, secretProviders); err != nil {
+			return nil, fmt.Errorf("failed to compile target environment %s in strict mode: %w", targetEnv, err)
+		}
+	}
+
+	// Get the updated configuration after applying environment variable transformations.
+	compiledConfig, err := envVarsTransformer.GetUpdatedConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile configuration: %w", err)
+	}
+
+	return &compilation{
+		chain:              chain,
+		document:           mergedDocument,
+		envVarsTransformer: envVarsTransformer,
+		compiled:           compiledConfig,
+	}, nil
+}
+
+// CheckReferences checks that every ${VAR} reference of the target environment configuration resolves, the
+// secrets section included, without compiling it.
+//
+// Parameters:
+//   - targetEnv: A string representing the name of the target environment to check.
+//
+// Returns:
+//   - Every unresolved reference, required and optional, with the file, line and column that set its value.
+//   - A *transformers.UnresolvedReferencesError listing them if any is required, or an error if the target
+//     environment configuration cannot be loaded.
+func (c *Client) CheckReferences(targetEnv string) ([]transformers.UnresolvedReference, error) {
+	chain, mergedCfg, err := c.mergeTargetEnv(targetEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.checkReferences(chain, mergedCfg, transformers.DefaultSecretProviders(c.Paths.GitRepoRoot))
+}
+
+// mergeTargetEnv resolves the inheritance chain of a target environment and merges it, without expanding the
+// merged configuration, for the checks that work on the configuration as written.
+func (c *Client) mergeTargetEnv(targetEnv string) ([]cfg.EnvLayer, *cfg.EnvConfig, error) {
+	chain, err := c.BuildEnvInheritanceChain(targetEnv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building target environment configuration for '%s': %w; please check the target environment name and the environments it extends", targetEnv, err)
+	}
+
+	mergedDocument, err := cfg.MergeInheritanceChain(chain)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check target environment %s: error occurred during the merging of its inheritance chain: %w", targetEnv, err)
+	}
+
+	mergedCfg, err := cfg.EnvConfigFromDocument(mergedDocument)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check target environment %s: the merged configuration is invalid: %w", targetEnv, err)
+	}
+
+	return chain, mergedCfg, nil
+}
+
+// checkReferences runs the environment variables and secrets validations on a merged configuration, and
+// locates the value of every unresolved reference in the environment configuration file that won the merge.
+func (c *Client) checkReferences(chain []cfg.EnvLayer, mergedCfg *cfg.EnvConfig, secretProviders *transformers.SecretProviders) ([]transformers.UnresolvedReference, error) {
+	unresolved, err := transformers.NewEnvVarsTransformerWithSecretProviders(mergedCfg, secretProviders).ValidateEnvironmentVariables()
+	if err != nil && !isUnresolvedReferencesError(err) {
+		return nil, err
+	}
+
+	unresolvedSecrets, err := transformers.NewSecretsTransformerWithSecretProviders(mergedCfg, secretProviders).ValidateSecrets()
+	if err != nil && !isUnresolvedReferencesError(err) {
+		return nil, err
+	}
+	unresolved = append(unresolved, unresolvedSecrets...)
+	sort.SliceStable(unresolved, func(i, j int) bool {
+		return unresolved[i].Path < unresolved[j].Path
+	})
+
+	locations, err := c.locateChainValues(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	required := false
+	for i := range unresolved {
+		required = required || unresolved[i].Required
+		for _, layerLocations := range locations {
+			if location, ok := layerLocations[unresolved[i].Path]; ok {
+				unresolved[i].Source = &location
+				break
+			}
+		}
+	}
+
+	if required {
+		return unresolved, &transformers.UnresolvedReferencesError{References: unresolved}
+	}
+
+	return unresolved, nil
+}
+
+// isUnresolvedReferencesError reports whether an error is a *transformers.UnresolvedReferencesError.
+func isUnresolvedReferencesError(err error) bool {
+	var unresolvedErr *transformers.UnresolvedReferencesError
+	return errors.As(err, &unresolvedErr)
 }
 
 // EnvCfgCompiledToJSON converts the provided compiled environment configuration into a JSON string format.
@@ -70,8 +362,9 @@ func (c *Client) Compile(targetEnv string) (*cfg.EnvConfig, error) {
 //
 // This function is useful for logging, debugging, or exporting the configuration in a human-readable format.
 func (c *Client) EnvCfgCompiledToJSON(compiledCfg *cfg.EnvConfig) (string, error) {
-	// Marshal the compiled configuration to JSON with indentation for better readability.
-	jsonConfig, err := json.MarshalIndent(compiledCfg, "", "  ")
+	// Marshal the compiled configuration, wrapped in the transport envelope that carries the schema version,
+	// to JSON with indentation for better readability.
+	jsonConfig, err := json.MarshalIndent(cfg.NewTransportEnvelope(compiledCfg), "", "  ")
 
 	if err != nil {
 		return "", fmt.Errorf("error marshaling the compiled environment configuration to JSON: %w; ensure the configuration is valid and properly structured", err)
@@ -131,3 +424,28 @@ func (c *Client) ValidateInfrastructureHierarchy(compiledCfg *cfg.EnvConfig, sta
 
 	return nil
 }
+
+// ComponentValidationErrors runs the stack validations on every component declared in the compiled
+// configuration, and collects the failures instead of stopping at the first one.
+//
+// Parameters:
+//   - compiledCfg: A pointer to the compiled environment configuration (*cfg.EnvConfig).
+//
+// Returns:
+//   - A map from component ID (<stack>/<layer>/<component>) to the validation error, empty if every component is valid.
+func (c *Client) ComponentValidationErrors(compiledCfg *cfg.EnvConfig) map[string]string {
+	stacksTransformer := transformers.NewStacksTransformer(compiledCfg, c.Paths.Terragrunt)
+	invalid := map[string]string{}
+
+	for _, stack := range compiledCfg.Stacks {
+		for _, layer := range stack.Layers {
+			for _, component := range layer.Components {
+				if err := stacksTransformer.ValidateRequestedComponent(stack.Name, layer.Name, component.Name); err != nil {
+					invalid[stack.Name+"/"+layer.Name+"/"+component.Name] = err.Error()
+				}
+			}
+		}
+	}
+
+	return invalid
+}
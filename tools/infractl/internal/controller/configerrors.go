@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/transformers"
+)
+
+// Stages of the configuration errors reported by the validations of an environment configuration
+const (
+	StageSchema     = "schema"
+	StageReferences = "references"
+	StageInputs     = "inputs"
+)
+
+// InputIssueError describes a component input issue as a configuration error.
+func InputIssueError(issue transformers.InputIssue) *cfg.ConfigurationError {
+	fieldPath := issue.Path
+	if fieldPath == "" {
+		// Missing variables have no value: point at the input that should set them
+		if parts := strings.SplitN(issue.Component, "/", 3); len(parts) == 3 {
+			fieldPath = fmt.Sprintf("stacks[%s].layers[%s].components[%s].inputs.%s", parts[0], parts[1], parts[2], issue.Input)
+		}
+	}
+
+	reason := fmt.Sprintf("%s: input '%s': %s", issue.Component, issue.Input, issue.Reason)
+	if issue.Variable != "" {
+		reason += fmt.Sprintf(" (variable declared at %s)", issue.Variable)
+	}
+
+	return &cfg.ConfigurationError{
+		Stage:     StageInputs,
+		FieldPath: fieldPath,
+		Reason:    reason,
+		Source:    issue.Source,
+	}
+}
+
+// UnresolvedReferenceError describes an unresolved ${VAR} reference as a configuration error.
+func UnresolvedReferenceError(reference transformers.UnresolvedReference) *cfg.ConfigurationError {
+	return &cfg.ConfigurationError{
+		Stage:       StageReferences,
+		FieldPath:   reference.Path,
+		ActualValue: reference.Expression,
+		Reason:      reference.Reason,
+		Source:      reference.Source,
+	}
+}
+
+// ConfigurationErrors returns the configuration errors an error is made of: every schema violation of an
+// environment configuration file, every required reference that cannot be resolved, or the configuration
+// error itself.
+//
+// Returns:
+//   - The configuration errors, or nil if the error is not a configuration error.
+func ConfigurationErrors(err error) []*cfg.ConfigurationError {
+	var configErrors []*cfg.ConfigurationError
+
+	var schemaErr *cfg.SchemaValidationError
+	var referencesErr *transformers.UnresolvedReferencesError
+	var configErr *cfg.ConfigurationError
+
+	switch {
+	case errors.As(err, &schemaErr):
+		for _, violation := range schemaErr.Violations {
+			configErrors = append(configErrors, &cfg.ConfigurationError{
+				Stage:     StageSchema,
+				FieldPath: violation.Path,
+				Reason:    violation.Message,
+				Source:    &cfg.ValueLocation{File: violation.File, Line: violation.Line, Column: violation.Column},
+			})
+		}
+	case errors.As(err, &referencesErr):
+		for _, reference := range referencesErr.References {
+			if reference.Required {
+				configErrors = append(configErrors, UnresolvedReferenceError(reference))
+			}
+		}
+	case errors.As(err, &configErr):
+		configErrors = append(configErrors, configErr)
+	}
+
+	return configErrors
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"gopkg.in/yaml.v3"
+)
+
+// newEnvConfigTemplate is the content a new encrypted environment starts from.
+const newEnvConfigTemplate = `# Environment '%s'. It's deep merged over the environments it extends, and encrypted with age when saved.
+extends: [base]
+`
+
+// EnvEditOptions controls how an environment configuration file is edited.
+type EnvEditOptions struct {
+	// Recipients are the age recipients (age1...) to encrypt the file for. Defaults to the recipients the file is
+	// already encrypted for, or to the recipients of the age identities of the age key file.
+	Recipients []string
+	// Edit opens the decrypted file, and returns once it has been edited.
+	Edit func(path string) error
+	// Retry is called when the edited file is invalid, and reports whether to edit it again. The changes are
+	// discarded otherwise.
+	Retry func(err error) bool
+}
+
+// EnvEditResult is the outcome of editing an environment configuration file.
+type EnvEditResult struct {
+	// Path is the path to the encrypted environment configuration file.
+	Path string
+	// Changed reports whether the file was written; it's not when an encrypted file is left unchanged.
+	Changed bool
+	// Recipients are the age recipients the file is encrypted for.
+	Recipients []string
+}
+
+// EditEnvConfig edits the configuration file of an environment in clear text, and saves it encrypted.
+//
+// The file is decrypted into a temporary file (readable only by the current user, and removed afterwards) that
+// is handed over to the editor. Once edited, it's validated against the environment configuration schema, and
+// encrypted with a new data key in place of the original file. A clear text file (<env>.yaml) is encrypted in
+// place, and an environment without configuration file is created as <env>.enc.yaml.
+//
+// Parameters:
+//   - envName: The name of the environment (e.g. 'prod').
+//   - opts: The recipients to encrypt the file for, and how to edit it.
+//
+// Returns:
+//   - The path to the encrypted file, whether it was written, and the recipients it's encrypted for.
+//   - An error if the file cannot be decrypted, there is no recipient to encrypt it for, the editor fails, the
+//     edited file is invalid and not edited again, or the file cannot be encrypted or written.
+func (c *Client) EditEnvConfig(envName string, opts EnvEditOptions) (*EnvEditResult, error) {
+	envPath, err := c.ResolveEnvConfigFilepathByEnvName(envName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the configuration file of environment '%s': %w", envName, err)
+	}
+
+	recipients := opts.Recipients
+	fileMode := os.FileMode(0644)
+	var plaintext []byte
+	encrypted := false
+
+	info, err := os.Stat(envPath)
+	switch {
+	case os.IsNotExist(err):
+		envPath = c.EncryptedEnvConfigFilepath(envName)
+		plaintext = []byte(fmt.Sprintf(newEnvConfigTemplate, envName))
+	case err != nil:
+		return nil, fmt.Errorf("failed to read the configuration file of environment '%s': %w", envName, err)
+	default:
+		fileMode = info.Mode().Perm()
+
+		root, metadata, err := cfg.ReadEnvConfigNode(envPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if metadata == nil {
+			// Keep the file as written, since it doesn't go through a decryption
+			plaintext, err = os.ReadFile(envPath)
+		} else {
+			encrypted = true
+			plaintext, err = marshalEnvConfigNode(root)
+			if len(recipients) == 0 {
+				recipients = metadata.Recipients()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the configuration file of environment '%s': %w", envName, err)
+		}
+	}
+
+	if len(recipients) == 0 {
+		identities, err := cfg.LoadAgeIdentities()
+		if err != nil {
+			return nil, fmt.Errorf("no age recipient to encrypt environment '%s' for, pass --age-recipient: %w", envName, err)
+		}
+		recipients = cfg.AgeRecipientsOf(identities)
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no age recipient to encrypt environment '%s' for, pass --age-recipient", envName)
+	}
+
+	if err := cfg.ValidateAgeRecipients(recipients); err != nil {
+		return nil, err
+	}
+
+	// os.CreateTemp creates the file with mode 0600
+	tempFile, err := os.CreateTemp("", fmt.Sprintf("infractl-%s-*.yaml", envName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the file to edit environment '%s' in: %w", envName, err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(plaintext); err != nil {
+		tempFile.Close()
+		return nil, fmt.Errorf("failed to write the file to edit environment '%s' in: %w", envName, err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write the file to edit environment '%s' in: %w", envName, err)
+	}
+
+	var edited *yaml.Node
+	for edited == nil {
+		if err := opts.Edit(tempFile.Name()); err != nil {
+			return nil, fmt.Errorf("failed to edit environment '%s': %w", envName, err)
+		}
+
+		content, err := os.ReadFile(tempFile.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the edited configuration of environment '%s': %w", envName, err)
+		}
+
+		// Nothing to save, unless a clear text file is being encrypted
+		if bytes.Equal(content, plaintext) && (encrypted || info == nil) {
+			return &EnvEditResult{Path: envPath, Changed: false, Recipients: recipients}, nil
+		}
+
+		edited, err = parseEditedEnvConfig(tempFile.Name(), content)
+		if err != nil && !opts.Retry(err) {
+			return nil, fmt.Errorf("the edited configuration of environment '%s' is invalid, changes discarded: %w", envName, err)
+		}
+	}
+
+	if err := cfg.EncryptSopsNode(edited, recipients); err != nil {
+		return nil, fmt.Errorf("failed to encrypt environment '%s': %w", envName, err)
+	}
+
+	content, err := marshalEnvConfigNode(edited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt environment '%s': %w", envName, err)
+	}
+
+	// Write next to the file, then rename, so an interrupted write never leaves a truncated file behind
+	pendingPath := envPath + ".tmp"
+	if err := os.WriteFile(pendingPath, content, fileMode); err != nil {
+		return nil, fmt.Errorf("failed to write the encrypted configuration of environment '%s': %w", envName, err)
+	}
+	if err := os.Rename(pendingPath, envPath); err != nil {
+		os.Remove(pendingPath)
+		return nil, fmt.Errorf("failed to write the encrypted configuration of environment '%s': %w", envName, err)
+	}
+
+	return &EnvEditResult{Path: envPath, Changed: true, Recipients: recipients}, nil
+}
+
+// parseEditedEnvConfig parses an edited environment configuration, and validates it against the schema.
+func parseEditedEnvConfig(path string, content []byte) (*yaml.Node, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s holds no configuration", path)
+	}
+
+	if cfg.IsSopsEncryptedNode(&root) {
+		return nil, fmt.Errorf("%s has a '%s' block, remove it: the file is encrypted when saved", path, cfg.SopsMetadataKey)
+	}
+
+	if err := cfg.ValidateEnvConfigNode(path, &root); err != nil {
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+// marshalEnvConfigNode renders a parsed environment configuration file, with the indentation of the
+// configuration files of the repository.
+func marshalEnvConfigNode(root *yaml.Node) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(root); err != nil {
+		return nil, fmt.Errorf("encoding the configuration: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("encoding the configuration: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
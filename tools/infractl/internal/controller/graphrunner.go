@@ -0,0 +1,315 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/graph"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
+)
+
+// defaultGraphConcurrency is the number of components run at once on stack or layer wide runs,
+// when no parallelism is requested.
+const defaultGraphConcurrency = 4
+
+// BuildDependencyGraph builds the dependency graph of every component declared in the compiled
+// environment configuration, from the 'dependency' and 'dependencies' blocks of their Terragrunt files.
+func (c *Client) BuildDependencyGraph(compiledCfg *cfg.EnvConfig) (*graph.Graph, error) {
+	g, err := graph.Build(compiledCfg, c.Paths.Terragrunt, c.Paths.GitRepoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the component dependency graph: %w", err)
+	}
+
+	return g, nil
+}
+
+// runGraph runs a Terragrunt command on every component of a stack or layer, in dependency order.
+// Components run as soon as their dependencies succeeded, with bounded concurrency, and in reverse order
+// for destroy. When a component fails its dependents are skipped. Progress is recorded in a run state
+// file, so the run can be resumed with stackOpts.ResumeRunID.
+//
+// When the context is done, the running components are interrupted and the ones left are skipped, so the run
+// can be resumed.
+//
+// Parameters:
+//   - ctx: The context of the run; the terragrunt processes are interrupted when it's done.
+//   - workdir: The stack or layer directory, which relative include and exclude directories are resolved against.
+//   - stackOpts: The stack and layer to run, with the execution controls.
+//   - baseOpts: The Terragrunt options applied to every component; the working directory is set per component.
+//
+// Returns:
+//   - The summary of the plan of every component that was planned, in execution order, for plan runs.
+//   - An error if the graph cannot be built, the run cannot be resumed, or any component failed or was skipped.
+func (t *Tg) runGraph(ctx context.Context, workdir string, stackOpts TgRunnerStackOptions, baseOpts tg.TerragruntOptions) ([]tg.PlanSummary, error) {
+	command := baseOpts.Command
+
+	if command != "plan" && !stackOpts.AutoApprove {
+		return nil, fmt.Errorf("stack or layer wide %s runs components concurrently and cannot ask for approval: pass --auto-approve, or --run-all to let Terragrunt ask for it", command)
+	}
+
+	terragruntDir, err := cfg.GetInfraTerragruntDirPathAbsolute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the absolute path to the infrastructure Terragrunt directory: %w", err)
+	}
+
+	repoRoot, err := cfg.GetGitRepoRoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine the git repository root: %w", err)
+	}
+
+	g, err := graph.Build(t.cfgCompiled, terragruntDir, repoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the component dependency graph: %w", err)
+	}
+
+	ids := filterNodesByDirs(g, g.Scope(stackOpts.StackName, stackOpts.LayerName, ""), workdir, stackOpts.IncludeDirs, stackOpts.ExcludeDirs)
+	if len(stackOpts.Components) > 0 {
+		ids = filterNodesByIDs(ids, stackOpts.Components)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no components declared in the configuration match stack '%s' and layer '%s'", stackOpts.StackName, stackOpts.LayerName)
+	}
+
+	scoped := g.Subgraph(ids)
+
+	order, err := scoped.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	reverse := command == "destroy"
+	if reverse {
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	}
+
+	state, completed, err := loadOrCreateRunState(command, stackOpts, order)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(stackOpts.outWriter(), "Run %s: terragrunt %s on %d component(s) in dependency order: %s\n", state.ID, command, len(order), strings.Join(order, " -> "))
+
+	concurrency := stackOpts.Parallelism
+	if concurrency <= 0 {
+		concurrency = defaultGraphConcurrency
+	}
+
+	stdout := utils.NewLockedWriter(stackOpts.outWriter())
+	stderr := utils.NewLockedWriter(os.Stderr)
+
+	scheduler := &graph.Scheduler{
+		Concurrency: concurrency,
+		Reverse:     reverse,
+		Completed:   completed,
+		OnStart: func(node *graph.Node) {
+			fmt.Fprintf(stdout, "[%s] ▶ terragrunt %s started\n", node.ID, command)
+		},
+		OnFinish: func(result graph.NodeResult) {
+			nodeState := cfg.RunNodeState{Status: string(result.Status)}
+			switch {
+			case result.Resumed:
+				fmt.Fprintf(stdout, "[%s] ⏭ already succeeded in run %s, not run again\n", result.ID, state.ID)
+			case result.Status == graph.StatusSucceeded:
+				fmt.Fprintf(stdout, "[%s] ✅ terragrunt %s succeeded in %s\n", result.ID, command, result.Duration.Round(time.Second))
+			case result.Status == graph.StatusFailed:
+				nodeState.Error = result.Err.Error()
+				fmt.Fprintf(stderr, "[%s] ❌ terragrunt %s failed: %v\n", result.ID, command, result.Err)
+			case result.Status == graph.StatusSkipped:
+				nodeState.Error = result.Err.Error()
+				fmt.Fprintf(stderr, "[%s] ⏸ skipped: %v\n", result.ID, result.Err)
+			}
+
+			state.Components[result.ID] = nodeState
+			state.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+			if _, err := cfg.WriteRunState(state); err != nil {
+				fmt.Fprintf(stderr, "[%s] failed to record the run state: %v\n", result.ID, err)
+			}
+		},
+	}
+
+	var summariesMu sync.Mutex
+	summaries := map[string]*tg.PlanSummary{}
+
+	results, runErr := scheduler.Run(ctx, scoped, func(node *graph.Node) error {
+		outWriter := utils.NewPrefixWriter(stdout, "["+node.ID+"] ")
+		errWriter := utils.NewPrefixWriter(stderr, "["+node.ID+"] ")
+		defer outWriter.Flush()
+		defer errWriter.Flush()
+
+		opts := baseOpts
+		opts.WorkingDir = node.Dir
+		opts.NonInteractive = true
+
+		env, cleanup, err := t.scopedTransport(node.Stack, node.Layer, node.Component)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		opts.Env = env
+		opts.DeniedEnv = t.cfgSealed.SensitiveEnvVars
+
+		summary, err := t.execute(ctx, tg.StreamOptions{
+			TerragruntOptions: opts,
+			OutWriter:         outWriter,
+			ErrWriter:         errWriter,
+		}, node.ID)
+		if summary != nil {
+			fmt.Fprintf(outWriter, "📋 plan: %s\n", summary)
+			summariesMu.Lock()
+			summaries[node.ID] = summary
+			summariesMu.Unlock()
+		}
+		return err
+	})
+
+	var planSummaries []tg.PlanSummary
+	for _, result := range results {
+		if summary, ok := summaries[result.ID]; ok {
+			planSummaries = append(planSummaries, *summary)
+		}
+	}
+
+	if runErr != nil {
+		return planSummaries, fmt.Errorf("run %s did not complete, resume it with --resume %s: %w", state.ID, state.ID, runErr)
+	}
+
+	fmt.Fprintf(stackOpts.outWriter(), "Run %s: terragrunt %s succeeded on every component\n", state.ID, command)
+
+	return planSummaries, nil
+}
+
+// loadOrCreateRunState starts the state of a new run, or loads the state of the run being resumed.
+// A run can only be resumed with the same command, on the same stack, layer and components.
+//
+// Returns:
+//   - The run state
+//   - The components that already succeeded, and must not run again
+//   - An error if the run to resume cannot be loaded, or does not match
+func loadOrCreateRunState(command string, stackOpts TgRunnerStackOptions, order []string) (*cfg.RunState, map[string]bool, error) {
+	completed := map[string]bool{}
+
+	if stackOpts.ResumeRunID == "" {
+		runID, err := cfg.GenerateRunID()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		state := &cfg.RunState{
+			ID:         runID,
+			Command:    command,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+			StackName:  stackOpts.StackName,
+			LayerName:  stackOpts.LayerName,
+			Order:      order,
+			Components: map[string]cfg.RunNodeState{},
+		}
+
+		for _, id := range order {
+			state.Components[id] = cfg.RunNodeState{Status: string(graph.StatusPending)}
+		}
+
+		if _, err := cfg.WriteRunState(state); err != nil {
+			return nil, nil, err
+		}
+
+		return state, completed, nil
+	}
+
+	state, err := cfg.ReadRunState(stackOpts.ResumeRunID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var mismatches []string
+	if state.Command != command {
+		mismatches = append(mismatches, fmt.Sprintf("command (run %s, now %s)", state.Command, command))
+	}
+	if state.StackName != stackOpts.StackName || state.LayerName != stackOpts.LayerName {
+		mismatches = append(mismatches, fmt.Sprintf("stack and layer (run %s/%s, now %s/%s)", state.StackName, state.LayerName, stackOpts.StackName, stackOpts.LayerName))
+	}
+	if strings.Join(sortedCopy(state.Order), ",") != strings.Join(sortedCopy(order), ",") {
+		mismatches = append(mismatches, "components")
+	}
+
+	if len(mismatches) > 0 {
+		return nil, nil, fmt.Errorf("run %s cannot be resumed, it differs in: %s", state.ID, strings.Join(mismatches, "; "))
+	}
+
+	for id, nodeState := range state.Components {
+		if nodeState.Status == string(graph.StatusSucceeded) {
+			completed[id] = true
+		}
+	}
+
+	return state, completed, nil
+}
+
+// filterNodesByDirs keeps the components inside any of the include directories (all of them when there are
+// none), and outside every exclude directory. Relative directories are resolved against the working directory.
+func filterNodesByDirs(g *graph.Graph, ids []string, workdir string, includeDirs, excludeDirs []string) []string {
+	resolve := func(dirs []string) []string {
+		resolved := make([]string, 0, len(dirs))
+		for _, dir := range dirs {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(workdir, dir)
+			}
+			resolved = append(resolved, filepath.Clean(dir))
+		}
+		return resolved
+	}
+
+	within := func(dir string, parents []string) bool {
+		for _, parent := range parents {
+			if dir == parent || strings.HasPrefix(dir, parent+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	includes, excludes := resolve(includeDirs), resolve(excludeDirs)
+
+	var filtered []string
+	for _, id := range ids {
+		node, _ := g.Node(id)
+		if len(includes) > 0 && !within(node.Dir, includes) {
+			continue
+		}
+		if within(node.Dir, excludes) {
+			continue
+		}
+		filtered = append(filtered, id)
+	}
+
+	return filtered
+}
+
+// filterNodesByIDs keeps the components whose ID is among the given ones.
+func filterNodesByIDs(ids, keep []string) []string {
+	var filtered []string
+	for _, id := range ids {
+		if containsName(keep, id) {
+			filtered = append(filtered, id)
+		}
+	}
+
+	return filtered
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,250 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
+)
+
+// testStack and testLayer hold the components of the test repository: id-generator, table (depending on
+// id-generator) and app (depending on table).
+const (
+	testStack = "stack-test"
+	testLayer = "db"
+)
+
+// testComponents maps the components of the test repository to their terragrunt.hcl.
+var testComponents = map[string]string{
+	"id-generator": "locals {}\n",
+	"table":        "dependency \"ids\" {\n  config_path = \"../id-generator\"\n}\n",
+	"app":          "dependencies {\n  paths = [\"../table\"]\n}\n",
+}
+
+// newTestRepo creates a git repository (a .git directory is all infractl looks for) holding the components of
+// testComponents, and makes it the working directory for the duration of the test.
+//
+// Returns:
+//   - The root of the repository.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+
+	repoRoot := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repoRoot, ".git"), 0o755); err != nil {
+		t.Fatalf("creating the test repository: %v", err)
+	}
+
+	for component, content := range testComponents {
+		writeTestFile(t, filepath.Join(repoRoot, cfg.InfraDir, cfg.TerragruntDir, testStack, testLayer, component, "terragrunt.hcl"), content)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getting the working directory: %v", err)
+	}
+	if err := os.Chdir(repoRoot); err != nil {
+		t.Fatalf("changing to the test repository: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Errorf("restoring the working directory: %v", err)
+		}
+	})
+
+	return repoRoot
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("creating %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+// newTestRunner creates a runner for the components of the test repository, running terragrunt through the
+// given executor.
+func newTestRunner(t *testing.T, executor tg.Executor) *Tg {
+	t.Helper()
+
+	repoRoot := newTestRepo(t)
+
+	compiled := &cfg.EnvConfig{Stacks: []cfg.StackConfig{{
+		Name: testStack,
+		Layers: []cfg.LayerConfig{{
+			Name: testLayer,
+			Components: []cfg.ComponentConfig{
+				{Name: "id-generator"},
+				{Name: "table"},
+				{Name: "app"},
+			},
+		}},
+	}}}
+
+	compiledPath := filepath.Join(repoRoot, cfg.CacheDirPathRelative, "config-compiled-test.json")
+	writeTestFile(t, compiledPath, "{}")
+
+	runner, err := NewTgRunnerWithExecutor(compiled, compiledPath, &cfg.SealedEnvConfig{Config: compiled}, executor)
+	if err != nil {
+		t.Fatalf("NewTgRunnerWithExecutor() unexpected error: %v", err)
+	}
+
+	return runner
+}
+
+// invokedComponents returns the components of the recorded invocations of a command, in the order they ran.
+func invokedComponents(executor *tg.FakeExecutor, command string) []string {
+	var components []string
+	for _, invocation := range executor.Invocations() {
+		if invocation.Options.Command == command {
+			components = append(components, filepath.Base(invocation.Options.WorkingDir))
+		}
+	}
+
+	return components
+}
+
+func TestRunGraphRequiresApproval(t *testing.T) {
+	for _, command := range []string{"apply", "destroy"} {
+		t.Run(command, func(t *testing.T) {
+			executor := tg.NewFakeExecutor()
+			runner := newTestRunner(t, executor)
+			stackOpts := TgRunnerStackOptions{StackName: testStack, LayerName: testLayer, OutWriter: &strings.Builder{}}
+
+			run := runner.Apply
+			if command == "destroy" {
+				run = runner.Destroy
+			}
+
+			err := run(context.Background(), stackOpts)
+			if err == nil || !strings.Contains(err.Error(), "cannot ask for approval: pass --auto-approve") {
+				t.Fatalf("%s without --auto-approve: error = %v, want approval to be required", command, err)
+			}
+			if invocations := executor.Invocations(); len(invocations) != 0 {
+				t.Fatalf("%s without --auto-approve ran terragrunt %d time(s), want none", command, len(invocations))
+			}
+
+			stackOpts.AutoApprove = true
+			if err := run(context.Background(), stackOpts); err != nil {
+				t.Fatalf("%s with --auto-approve: unexpected error: %v", command, err)
+			}
+
+			want := "id-generator,table,app"
+			if command == "destroy" {
+				want = "app,table,id-generator"
+			}
+			if got := strings.Join(invokedComponents(executor, command), ","); got != want {
+				t.Errorf("%s ran %s, want %s", command, got, want)
+			}
+
+			for _, invocation := range executor.Invocations() {
+				if !containsName(invocation.Args, "-auto-approve") || !invocation.Options.NonInteractive {
+					t.Errorf("%s of %s ran with %v, want it non-interactive and auto-approved", command, invocation.Options.WorkingDir, invocation.Args)
+				}
+			}
+		})
+	}
+}
+
+func TestRunGraphSkipsDependentsOfFailures(t *testing.T) {
+	executor := tg.NewFakeExecutor(tg.FakeResponse{Command: "apply", WorkingDir: "table", ExitCode: 1, Stderr: "Error: table\n"})
+	runner := newTestRunner(t, executor)
+
+	err := runner.Apply(context.Background(), TgRunnerStackOptions{StackName: testStack, LayerName: testLayer, AutoApprove: true, OutWriter: &strings.Builder{}})
+	if err == nil || !strings.Contains(err.Error(), "did not complete, resume it with --resume") {
+		t.Fatalf("Apply() error = %v, want the run to be resumable", err)
+	}
+
+	if got := strings.Join(invokedComponents(executor, "apply"), ","); got != "id-generator,table" {
+		t.Errorf("apply ran %s, want id-generator,table (app depends on the failed table)", got)
+	}
+
+	state := readOnlyRunState(t)
+	want := map[string]string{"id-generator": "succeeded", "table": "failed", "app": "skipped"}
+	for component, status := range want {
+		if got := state.Components[testStack+"/"+testLayer+"/"+component].Status; got != status {
+			t.Errorf("run state of %s = %s, want %s", component, got, status)
+		}
+	}
+}
+
+func TestRunGraphCancellation(t *testing.T) {
+	executor := tg.NewFakeExecutor(tg.FakeResponse{Command: "plan", WorkingDir: "id-generator", Delay: time.Minute})
+	runner := newTestRunner(t, executor)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	time.AfterFunc(100*time.Millisecond, func() { cancel(&tg.InterruptedError{Signal: os.Interrupt}) })
+
+	start := time.Now()
+	summaries, err := runner.Plan(ctx, TgRunnerStackOptions{StackName: testStack, LayerName: testLayer, OutWriter: &strings.Builder{}})
+	if err == nil || !strings.Contains(err.Error(), "interrupted by SIGINT") {
+		t.Fatalf("Plan() error = %v, want the run to be interrupted by SIGINT", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Plan() returned after %s, want it interrupted right away", elapsed)
+	}
+	if len(summaries) != 0 {
+		t.Errorf("Plan() summaries = %v, want none", summaries)
+	}
+
+	if got := strings.Join(invokedComponents(executor, "plan"), ","); got != "id-generator" {
+		t.Errorf("plan ran %s, want only id-generator, the components left skipped", got)
+	}
+	if got := invokedComponents(executor, "show"); len(got) != 0 {
+		t.Errorf("the interrupted plan was summarised: show ran on %v", got)
+	}
+
+	state := readOnlyRunState(t)
+	for _, component := range []string{"table", "app"} {
+		if got := state.Components[testStack+"/"+testLayer+"/"+component].Status; got != "skipped" {
+			t.Errorf("run state of %s = %s, want skipped", component, got)
+		}
+	}
+}
+
+func TestRunComponentCancelled(t *testing.T) {
+	executor := tg.NewFakeExecutor()
+	runner := newTestRunner(t, executor)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(&tg.InterruptedError{Signal: os.Interrupt})
+
+	err := runner.Apply(ctx, TgRunnerStackOptions{StackName: testStack, LayerName: testLayer, ComponentName: "table", AutoApprove: true, OutWriter: &strings.Builder{}})
+
+	var interrupted *tg.InterruptedError
+	if err == nil || !errors.As(err, &interrupted) {
+		t.Fatalf("Apply() error = %v, want it interrupted", err)
+	}
+}
+
+// readOnlyRunState reads the state of the single run recorded in the test repository.
+func readOnlyRunState(t *testing.T) *cfg.RunState {
+	t.Helper()
+
+	cacheDir, err := cfg.GetInfraCacheDirPathAbsolute()
+	if err != nil {
+		t.Fatalf("resolving the cache directory: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(cacheDir, cfg.RunsDir, "*.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("run state files = %v (%v), want one", files, err)
+	}
+
+	state, err := cfg.ReadRunState(strings.TrimSuffix(filepath.Base(files[0]), ".json"))
+	if err != nil {
+		t.Fatalf("reading the run state: %v", err)
+	}
+
+	return state
+}
@@ -1,8 +1,14 @@
 package controller
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
@@ -12,19 +18,73 @@
 type Tg struct {
 	cfgCompiled         *cfg.EnvConfig
 	cfgCompiledJSONPath string
+	// cfgSealed holds the sensitive values left out of the compiled JSON, delivered through the environment.
+	cfgSealed *cfg.SealedEnvConfig
+	// redactor masks the sensitive values in the output of every terragrunt process.
+	redactor *utils.Redactor
+	// executor runs the terragrunt processes.
+	executor tg.Executor
 }
 
 type TgRunnerStackOptions struct {
 	StackName     string
 	LayerName     string
 	ComponentName string
+	// AutoApprove skips the interactive approval on commands that mutate infrastructure (apply, destroy).
+	AutoApprove bool
+
+	// Options for stack or layer wide runs, which infractl runs component by component in dependency order.
+	// IncludeDirs and ExcludeDirs are resolved relative to the stack or layer directory.
+	Parallelism int
+	IncludeDirs []string
+	ExcludeDirs []string
+	// UseRunAll dispatches stack or layer wide runs through 'terragrunt run-all' instead.
+	UseRunAll bool
+	// ResumeRunID resumes a previous stack or layer wide run, running only the components that did not succeed.
+	ResumeRunID string
+	// Components, when set, restricts stack or layer wide runs to these components (IDs, <stack>/<layer>/<component>),
+	// e.g. the ones affected by the changes since a git ref (see Client.ChangedComponents).
+	Components []string
+
+	// LogWriter, when set, receives a copy of the output of single component runs, with sensitive values masked.
+	LogWriter io.Writer
+	// OutWriter, when set, receives the output of terragrunt and the progress of the run instead of the standard
+	// output, e.g. the standard error when the standard output is kept for a machine-readable document.
+	OutWriter io.Writer
+}
+
+// outWriter returns where the output of terragrunt and the progress of the run are written to.
+func (o TgRunnerStackOptions) outWriter() io.Writer {
+	if o.OutWriter != nil {
+		return o.OutWriter
+	}
+
+	return os.Stdout
 }
 
+// IsSingleComponent reports whether the options target a single component, rather than a whole stack or layer.
+func (o TgRunnerStackOptions) IsSingleComponent() bool {
+	return o.ComponentName != ""
+}
+
+// TgRunner runs Terragrunt commands on a stack, layer or component. The terragrunt processes are interrupted
+// when the context is done.
 type TgRunner interface {
-	Plan(stackOpts TgRunnerStackOptions, tgArgs ...string) error
+	Plan(ctx context.Context, stackOpts TgRunnerStackOptions, tgArgs ...string) ([]tg.PlanSummary, error)
+	Apply(ctx context.Context, stackOpts TgRunnerStackOptions, tgArgs ...string) error
+	Destroy(ctx context.Context, stackOpts TgRunnerStackOptions, tgArgs ...string) error
+}
+
+// NewTgRunner creates a Terragrunt runner for a compiled configuration, handed over to Terragrunt through the
+// sealed JSON document at cfgCompiledJSONPath. cfgSealed holds the sensitive values left out of that document;
+// each terragrunt process receives the ones of the providers its components use.
+func NewTgRunner(cfgCompiled *cfg.EnvConfig, cfgCompiledJSONPath string, cfgSealed *cfg.SealedEnvConfig) (*Tg, error) {
+	return NewTgRunnerWithExecutor(cfgCompiled, cfgCompiledJSONPath, cfgSealed, tg.NewExecutor())
 }
 
-func NewTgRunner(cfgCompiled *cfg.EnvConfig, cfgCompiledJSONPath string) (*Tg, error) {
+// NewTgRunnerWithExecutor creates a Terragrunt runner, like NewTgRunner, running the terragrunt processes through
+// the given executor (e.g. a tg.FakeExecutor, to run without terragrunt installed).
+func NewTgRunnerWithExecutor(cfgCompiled *cfg.EnvConfig, cfgCompiledJSONPath string, cfgSealed *cfg.SealedEnvConfig, executor tg.Executor) (*Tg, error) {
 	if cfgCompiled == nil {
 		return nil, fmt.Errorf("configuration for the target environment (cfgCompiled) must not be nil; ensure that the environment is properly initialized")
 	}
@@ -33,16 +93,99 @@ func NewTgRunner(cfgCompiled *cfg.EnvConfig, cfgCompiledJSONPath string) (*Tg, e
 		return nil, fmt.Errorf("the path to the compiled JSON configuration (cfgCompiledJSONPath) cannot be empty; please provide a valid file path")
 	}
 
+	if cfgSealed == nil {
+		return nil, fmt.Errorf("the sealed configuration (cfgSealed) must not be nil; compile the target environment with CompileSealed")
+	}
+
+	if executor == nil {
+		return nil, fmt.Errorf("the terragrunt executor must not be nil")
+	}
+
 	return &Tg{
 		cfgCompiled:         cfgCompiled,
 		cfgCompiledJSONPath: cfgCompiledJSONPath,
+		cfgSealed:           cfgSealed,
+		redactor:            utils.NewRedactor(cfgSealed.SensitiveValues()...),
+		executor:            executor,
 	}, nil
 }
 
-func (t *Tg) setTgEnvVar() error {
-	cfg.SetTransmitterTgEnvVar(t.cfgCompiledJSONPath)
+// scopedProviders returns the providers used by the components a terragrunt process runs: the given component,
+// or every component of the stack or layer when the component (or the layer) is empty.
+func (t *Tg) scopedProviders(stackName, layerName, componentName string) []string {
+	var providers []string
+	for _, stack := range t.cfgCompiled.Stacks {
+		if stack.Name != stackName {
+			continue
+		}
+		for _, layer := range stack.Layers {
+			if layerName != "" && layer.Name != layerName {
+				continue
+			}
+			for _, component := range layer.Components {
+				if componentName != "" && component.Name != componentName {
+					continue
+				}
+				for _, provider := range component.Providers {
+					if !containsName(providers, provider) {
+						providers = append(providers, provider)
+					}
+				}
+			}
+		}
+	}
+
+	sort.Strings(providers)
+
+	return providers
+}
+
+// scopedTransport prepares the hand over of the compiled configuration to a terragrunt process, scoped to the
+// providers of the components it runs (see cfg.SealedEnvConfig.Scoped), so a component cannot read the
+// credentials of providers it doesn't use. The scoped document is written next to the compiled configuration,
+// with the transport file mode.
+//
+// Returns:
+//   - The environment passed to the terragrunt process: the path to the scoped document, as defined by the
+//     transport contract, and the sealed values in scope.
+//   - A cleanup function removing the scoped document once the run is over.
+//   - An error if the scoped document cannot be written.
+func (t *Tg) scopedTransport(stackName, layerName, componentName string) ([]string, func(), error) {
+	label := scopeLabel(stackName, layerName, componentName)
+	scoped := t.cfgSealed.Scoped(t.scopedProviders(stackName, layerName, componentName))
+
+	content, err := json.MarshalIndent(cfg.NewTransportEnvelope(scoped.Config), "", "  ")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal the compiled configuration scoped to %s: %w", label, err)
+	}
+
+	scopedPath := strings.TrimSuffix(t.cfgCompiledJSONPath, ".json") + "." + label + ".json"
+	if err := os.WriteFile(scopedPath, content, cfg.TransportFileMode); err != nil {
+		return nil, nil, fmt.Errorf("failed to write the compiled configuration scoped to %s: %w", label, err)
+	}
+
+	cleanup := func() {
+		if err := os.Remove(scopedPath); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "failed to remove the scoped compiled configuration %s: %v\n", scopedPath, err)
+		}
+	}
+
+	env := []string{cfg.GetTransmitterEnvVar(scopedPath).String()}
+	env = append(env, scoped.Env("providers", "secrets")...)
+
+	return env, cleanup, nil
+}
+
+// scopeLabel names the stack, layer or component a terragrunt process runs, e.g. stack-datastore.db.id-generator
+func scopeLabel(stackName, layerName, componentName string) string {
+	parts := []string{stackName}
+	for _, part := range []string{layerName, componentName} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
 
-	return nil
+	return strings.Join(parts, ".")
 }
 
 // getWorkdir constructs the working directory path for the specified stack, layer, and component.
@@ -100,29 +243,189 @@ func (t *Tg) getWorkdir(stackOpts TgRunnerStackOptions) (string, error) {
 	return workdirPath, nil
 }
 
-// Plan wraps the Terragrunt plan command with hierarchical validation
-func (t *Tg) Plan(stackOpts TgRunnerStackOptions, tgArgs ...string) error {
-	// Set Terragrunt environment variable before execution
-	if err := t.setTgEnvVar(); err != nil {
-		return fmt.Errorf("failed to set Terragrunt environment variable: %w", err)
+// prepareRun resolves the working directory for the given stack options. It's the common preamble of
+// every Terragrunt command run through the Tg runner.
+func (t *Tg) prepareRun(command string, stackOpts TgRunnerStackOptions) (string, error) {
+	if stackOpts.IsSingleComponent() && (stackOpts.UseRunAll || stackOpts.ResumeRunID != "") {
+		return "", fmt.Errorf("run-all and resuming a run only apply to stack or layer wide runs, not to component '%s'", stackOpts.ComponentName)
+	}
+
+	if len(stackOpts.Components) > 0 && (stackOpts.IsSingleComponent() || stackOpts.UseRunAll) {
+		return "", fmt.Errorf("a selection of components only applies to stack or layer wide runs in dependency order, not to a single component or run-all")
 	}
 
 	// Get the workdir for the stack, layer, or component
 	workdir, workdirErr := t.getWorkdir(stackOpts)
 	if workdirErr != nil {
-		return fmt.Errorf("failed to get workdir: %w", workdirErr)
+		return "", fmt.Errorf("failed to get workdir: %w", workdirErr)
+	}
+
+	fmt.Fprintf(stackOpts.outWriter(), "Running Terragrunt %s command in workdir: %s\n", command, workdir)
+
+	return workdir, nil
+}
+
+// runComponent runs a Terragrunt command on a single component, streaming its output to the terminal, and to
+// stackOpts.LogWriter when set. Plans are summarised (see execute).
+func (t *Tg) runComponent(ctx context.Context, opts tg.TerragruntOptions, stackOpts TgRunnerStackOptions) (*tg.PlanSummary, error) {
+	env, cleanup, err := t.scopedTransport(stackOpts.StackName, stackOpts.LayerName, stackOpts.ComponentName)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	opts.Env = env
+	opts.DeniedEnv = t.cfgSealed.SensitiveEnvVars
+	streamOpts := tg.StreamOptions{TerragruntOptions: opts, OutWriter: stackOpts.outWriter()}
+
+	if stackOpts.LogWriter != nil {
+		streamOpts.OutWriter = io.MultiWriter(stackOpts.outWriter(), stackOpts.LogWriter)
+		streamOpts.ErrWriter = io.MultiWriter(os.Stderr, stackOpts.LogWriter)
 	}
 
-	fmt.Println("Running Terragrunt plan command in workdir:", workdir)
+	return t.execute(ctx, streamOpts, stackOpts.StackName+"/"+stackOpts.LayerName+"/"+stackOpts.ComponentName)
+}
+
+// runAllScoped dispatches a stack or layer wide run through 'terragrunt run-all'. A single terragrunt process
+// runs every component, so it's given the providers of all of them.
+func (t *Tg) runAllScoped(ctx context.Context, opts tg.TerragruntOptions, stackOpts TgRunnerStackOptions) error {
+	env, cleanup, err := t.scopedTransport(stackOpts.StackName, stackOpts.LayerName, "")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	opts.Env = env
+	opts.DeniedEnv = t.cfgSealed.SensitiveEnvVars
+
+	streamOpts := tg.StreamOptions{TerragruntOptions: withRunAllOptions(opts, stackOpts), OutWriter: stackOpts.outWriter()}
+	streamOpts.Command = "run-all " + opts.Command
+	_, err = t.executor.Execute(ctx, streamOpts)
+	return err
+}
+
+// withRunAllOptions adds the run-all execution controls to the Terragrunt options of a stack or layer
+// wide run. Relative include and exclude directories are resolved against the working directory, which
+// is where Terragrunt discovers the components from.
+func withRunAllOptions(opts tg.TerragruntOptions, stackOpts TgRunnerStackOptions) tg.TerragruntOptions {
+	resolve := func(dirs []string) []string {
+		resolved := make([]string, 0, len(dirs))
+		for _, dir := range dirs {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(opts.WorkingDir, dir)
+			}
+			resolved = append(resolved, dir)
+		}
+		return resolved
+	}
+
+	opts.Parallelism = stackOpts.Parallelism
+	opts.IncludeDirs = resolve(stackOpts.IncludeDirs)
+	opts.ExcludeDirs = resolve(stackOpts.ExcludeDirs)
+
+	return opts
+}
+
+// Plan wraps the Terragrunt plan command with hierarchical validation. Every component's plan is saved to a
+// plan file, temporary unless one is passed with -out, and summarised from its 'terragrunt show -json'
+// representation; -detailed-exitcode tells plans without changes apart.
+//
+// Returns:
+//   - The summary of the plan of every component that was planned, in execution order. Stack or layer wide
+//     plans run through run-all are not summarised.
+//   - An error if any component failed to plan, or its plan cannot be summarised.
+func (t *Tg) Plan(ctx context.Context, stackOpts TgRunnerStackOptions, tgArgs ...string) ([]tg.PlanSummary, error) {
+	workdir, err := t.prepareRun("plan", stackOpts)
+	if err != nil {
+		return nil, err
+	}
 
 	// Prepare Terragrunt options
 	planOpts := tg.TerragruntOptions{
 		WorkingDir:     workdir,
+		Redactor:       t.redactor,
 		Command:        "plan",
 		NonInteractive: true,
 		AdditionalArgs: tgArgs,
 	}
 
+	// Stack or layer wide plans run every component in dependency order, or through run-all if requested
+	if !stackOpts.IsSingleComponent() {
+		if stackOpts.UseRunAll {
+			return nil, t.runAllScoped(ctx, planOpts, stackOpts)
+		}
+		planOpts.AdditionalArgs = append(planOpts.AdditionalArgs, "-detailed-exitcode")
+		return t.runGraph(ctx, workdir, stackOpts, planOpts)
+	}
+
 	// Execute Terragrunt plan with streaming output
-	return tg.Plan(planOpts)
+	planOpts.AdditionalArgs = append(planOpts.AdditionalArgs, "-detailed-exitcode")
+	summary, err := t.runComponent(ctx, planOpts, stackOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return []tg.PlanSummary{*summary}, nil
+}
+
+// Apply wraps the Terragrunt apply command with hierarchical validation.
+// Unless AutoApprove is set, Terraform asks for confirmation through the terminal before applying.
+func (t *Tg) Apply(ctx context.Context, stackOpts TgRunnerStackOptions, tgArgs ...string) error {
+	workdir, err := t.prepareRun("apply", stackOpts)
+	if err != nil {
+		return err
+	}
+
+	applyOpts := tg.TerragruntOptions{
+		WorkingDir:     workdir,
+		Redactor:       t.redactor,
+		Command:        "apply",
+		NonInteractive: stackOpts.AutoApprove,
+		AutoApprove:    stackOpts.AutoApprove,
+		AdditionalArgs: tgArgs,
+	}
+
+	// Stack or layer wide applies run every component in dependency order, or through run-all if requested
+	if !stackOpts.IsSingleComponent() {
+		if stackOpts.UseRunAll {
+			return t.runAllScoped(ctx, applyOpts, stackOpts)
+		}
+		_, err := t.runGraph(ctx, workdir, stackOpts, applyOpts)
+		return err
+	}
+
+	// Execute Terragrunt apply with streaming output
+	_, err = t.runComponent(ctx, applyOpts, stackOpts)
+	return err
+}
+
+// Destroy wraps the Terragrunt destroy command with hierarchical validation.
+// Unless AutoApprove is set, Terraform asks for confirmation through the terminal before destroying.
+func (t *Tg) Destroy(ctx context.Context, stackOpts TgRunnerStackOptions, tgArgs ...string) error {
+	workdir, err := t.prepareRun("destroy", stackOpts)
+	if err != nil {
+		return err
+	}
+
+	destroyOpts := tg.TerragruntOptions{
+		WorkingDir:     workdir,
+		Redactor:       t.redactor,
+		Command:        "destroy",
+		NonInteractive: stackOpts.AutoApprove,
+		AutoApprove:    stackOpts.AutoApprove,
+		AdditionalArgs: tgArgs,
+	}
+
+	// Stack or layer wide destroys run every component in dependency order, or through run-all if requested
+	if !stackOpts.IsSingleComponent() {
+		if stackOpts.UseRunAll {
+			return t.runAllScoped(ctx, destroyOpts, stackOpts)
+		}
+		_, err := t.runGraph(ctx, workdir, stackOpts, destroyOpts)
+		return err
+	}
+
+	// Execute Terragrunt destroy with streaming output
+	_, err = t.runComponent(ctx, destroyOpts, stackOpts)
+	return err
 }
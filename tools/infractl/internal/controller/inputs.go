@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/graph"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/transformers"
+)
+
+// CheckComponentInputs compiles the target environment, like Compile, and checks the effective inputs of every
+// component (its stack's, then its layer's, then its own) against the 'variable' blocks of the Terraform module
+// it sources: unknown inputs, variables without default that no input sets, and values whose type doesn't match.
+// Components sourcing a remote module are not checked.
+//
+// Parameters:
+//   - targetEnv: A string representing the name of the target environment to check.
+//
+// Returns:
+//   - Every issue found, by component, with the file, line and column that set the value of the input.
+//   - An error if the compilation fails, or the Terraform module of a component cannot be found or parsed.
+func (c *Client) CheckComponentInputs(targetEnv string) ([]transformers.InputIssue, error) {
+	result, err := c.compileAndValidateStacks(targetEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	locations, err := c.locateChainValues(result.chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []transformers.InputIssue
+	for _, stack := range result.compiled.Stacks {
+		for _, layer := range stack.Layers {
+			for _, component := range layer.Components {
+				componentID := stack.Name + "/" + layer.Name + "/" + component.Name
+				componentDir := filepath.Join(c.Paths.Terragrunt, stack.Name, layer.Name, component.Name)
+
+				moduleDir, err := graph.ModuleDir(componentDir, c.Paths.GitRepoRoot)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check the inputs of %s: %w", componentID, err)
+				}
+				if moduleDir == "" {
+					continue
+				}
+
+				variables, err := graph.ParseTerraformVariables(moduleDir)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check the inputs of %s: %w", componentID, err)
+				}
+
+				inputs := transformers.EffectiveInputs(stack, layer, component)
+				issues = append(issues, transformers.CheckInputs(componentID, inputs, variables)...)
+			}
+		}
+	}
+
+	for i := range issues {
+		issues[i].Source = locateValueOrChildren(locations, issues[i].Path)
+		issues[i].Variable = c.relativeToRepoRoot(issues[i].Variable)
+	}
+
+	return issues, nil
+}
+
+// locateValueOrChildren locates a value in the environment configuration file that won the merge. Non-empty
+// mappings and lists have no location of their own: the location of their first value is used.
+func locateValueOrChildren(locations []map[string]cfg.ValueLocation, valuePath string) *cfg.ValueLocation {
+	if valuePath == "" {
+		return nil
+	}
+
+	for _, layerLocations := range locations {
+		if location, ok := layerLocations[valuePath]; ok {
+			return &location
+		}
+
+		for _, nestedPath := range cfg.SortedValuePaths(layerLocations) {
+			if cfg.IsValuePathUnder(nestedPath, valuePath) {
+				location := layerLocations[nestedPath]
+				return &location
+			}
+		}
+	}
+
+	return nil
+}
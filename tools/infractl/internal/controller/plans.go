@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
+)
+
+// terragruntCacheDir is the directory where Terragrunt downloads modules; it's excluded from component hashes.
+const terragruntCacheDir = ".terragrunt-cache"
+
+// NewPlanManifest prepares the artifacts of a saved plan for a single component. It stores the compiled
+// environment configuration in the plan directory, and records the hashes of that configuration and of the
+// component directory, together with the git commit the plan is being made against.
+//
+// The manifest is not persisted; call SavePlanManifest once the plan has been produced successfully.
+//
+// Parameters:
+//   - baseEnv: Name of the base environment configuration.
+//   - targetEnv: Name of the target environment.
+//   - stackOpts: The stack, layer and component being planned. A component is required.
+//   - compiledJSON: The sealed compiled environment configuration, in JSON format.
+//
+// Returns:
+//   - A pointer to the plan manifest, with the paths to the binary plan, the compiled configuration and the log
+//     the plan output is to be saved to.
+//   - An error if any of the artifacts cannot be created or hashed.
+func (c *Client) NewPlanManifest(baseEnv, targetEnv string, stackOpts TgRunnerStackOptions, compiledJSON string) (*cfg.PlanManifest, error) {
+	if stackOpts.ComponentName == "" {
+		return nil, fmt.Errorf("saved plans are made for a single component, please specify the stack, layer and component")
+	}
+
+	planID, err := cfg.GeneratePlanID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan manifest: %w", err)
+	}
+
+	planDir, err := cfg.CreatePlanDir(planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan manifest: %w", err)
+	}
+
+	configFilePath := filepath.Join(planDir, cfg.PlanConfigFilename)
+	if err := os.WriteFile(configFilePath, []byte(compiledJSON), cfg.TransportFileMode); err != nil {
+		return nil, fmt.Errorf("failed to store the compiled configuration of plan %s: %w", planID, err)
+	}
+
+	configHash, err := utils.GenerateHashFileWithSHA256(configFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash the compiled configuration of plan %s: %w", planID, err)
+	}
+
+	componentDirHash, err := c.componentDirHash(stackOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan manifest: %w", err)
+	}
+
+	gitSHA, err := utils.GetGitHeadSHA(c.Paths.GitRepoRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan manifest: %w", err)
+	}
+
+	return &cfg.PlanManifest{
+		ID:               planID,
+		CreatedAt:        time.Now().UTC().Format(time.RFC3339),
+		BaseEnv:          baseEnv,
+		TargetEnv:        targetEnv,
+		StackName:        stackOpts.StackName,
+		LayerName:        stackOpts.LayerName,
+		ComponentName:    stackOpts.ComponentName,
+		PlanFilePath:     filepath.Join(planDir, cfg.PlanBinaryFilename),
+		ConfigFilePath:   configFilePath,
+		LogFilePath:      filepath.Join(planDir, cfg.PlanLogFilename),
+		ConfigHash:       configHash,
+		ComponentDirHash: componentDirHash,
+		GitSHA:           gitSHA,
+	}, nil
+}
+
+// SavePlanManifest persists the manifest of a saved plan, after checking that the binary plan exists.
+func (c *Client) SavePlanManifest(manifest *cfg.PlanManifest) (string, error) {
+	if err := utils.FileExists(manifest.PlanFilePath); err != nil {
+		return "", fmt.Errorf("binary plan for plan %s was not produced: %w", manifest.ID, err)
+	}
+
+	manifestPath, err := cfg.WritePlanManifest(manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to save plan manifest: %w", err)
+	}
+
+	return manifestPath, nil
+}
+
+// VerifyPlanManifest ensures a saved plan can still be applied as it was reviewed. It refuses the plan
+// when the freshly compiled configuration, the component directory or the git commit differ from the
+// ones recorded when the plan was made.
+//
+// Parameters:
+//   - manifest: The manifest of the saved plan.
+//   - compiledJSONPath: Path to the configuration compiled now for the plan's target environment.
+//
+// Returns:
+//   - An error listing every difference found, or nil if the plan is still valid.
+func (c *Client) VerifyPlanManifest(manifest *cfg.PlanManifest, compiledJSONPath string) error {
+	if err := utils.FileExists(manifest.PlanFilePath); err != nil {
+		return fmt.Errorf("binary plan for plan %s is missing: %w", manifest.ID, err)
+	}
+
+	var mismatches []string
+
+	configHash, err := utils.GenerateHashFileWithSHA256(compiledJSONPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash the compiled configuration: %w", err)
+	}
+
+	if configHash != manifest.ConfigHash {
+		mismatches = append(mismatches, fmt.Sprintf("compiled configuration hash changed (planned %s, now %s)", manifest.ConfigHash, configHash))
+	}
+
+	componentDirHash, err := c.componentDirHash(TgRunnerStackOptions{
+		StackName:     manifest.StackName,
+		LayerName:     manifest.LayerName,
+		ComponentName: manifest.ComponentName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if componentDirHash != manifest.ComponentDirHash {
+		mismatches = append(mismatches, fmt.Sprintf("component directory hash changed (planned %s, now %s)", manifest.ComponentDirHash, componentDirHash))
+	}
+
+	gitSHA, err := utils.GetGitHeadSHA(c.Paths.GitRepoRoot)
+	if err != nil {
+		return err
+	}
+
+	if gitSHA != manifest.GitSHA {
+		mismatches = append(mismatches, fmt.Sprintf("git commit changed (planned %s, now %s)", manifest.GitSHA, gitSHA))
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("plan %s no longer matches the repository: %s", manifest.ID, strings.Join(mismatches, "; "))
+	}
+
+	return nil
+}
+
+// componentDirHash hashes the contents of a component directory, ignoring the Terragrunt cache.
+func (c *Client) componentDirHash(stackOpts TgRunnerStackOptions) (string, error) {
+	componentDir := filepath.Join(c.Paths.Terragrunt, stackOpts.StackName, stackOpts.LayerName, stackOpts.ComponentName)
+
+	hash, err := utils.GenerateHashDirWithSHA256(componentDir, terragruntCacheDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash component directory %s: %w", componentDir, err)
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
+)
+
+// planOutArgPrefix is the prefix of the argument saving a plan to a file
+const planOutArgPrefix = "-out="
+
+// execute runs a Terragrunt command on a component, whose scoped transport is set in the options. Plans are
+// saved to a plan file (the one passed with -out, or a temporary one next to the compiled configuration) and
+// summarised from its 'terragrunt show -json' representation, while the transport is still in place.
+//
+// Parameters:
+//   - ctx: The context of the run; the terragrunt processes are interrupted when it's done.
+//   - streamOpts: The options of the terragrunt command, with the environment of the scoped transport.
+//   - componentID: The ID of the component, <stack>/<layer>/<component>.
+//
+// Returns:
+//   - The summary of the plan, for plan commands; nil otherwise.
+//   - An error if the command fails, or the plan cannot be summarised.
+func (t *Tg) execute(ctx context.Context, streamOpts tg.StreamOptions, componentID string) (*tg.PlanSummary, error) {
+	if streamOpts.Command != "plan" {
+		_, err := t.executor.Execute(ctx, streamOpts)
+		return nil, err
+	}
+
+	planFile := planFileArg(streamOpts.AdditionalArgs)
+	if planFile == "" {
+		planFile = strings.TrimSuffix(t.cfgCompiledJSONPath, ".json") + "." + strings.ReplaceAll(componentID, "/", ".") + ".tfplan"
+		defer removePlanFile(planFile)
+
+		streamOpts.AdditionalArgs = append(append([]string{}, streamOpts.AdditionalArgs...), planOutArgPrefix+planFile)
+	}
+
+	// With -detailed-exitcode, terraform exits with 2 when the plan succeeded with changes
+	result, err := t.executor.Execute(ctx, streamOpts)
+	hasChanges := result != nil && result.ExitCode == tg.PlanChangesExitCode && ctx.Err() == nil
+	if err != nil && !hasChanges {
+		return nil, err
+	}
+
+	summary, err := t.summarisePlan(ctx, streamOpts.TerragruntOptions, componentID, planFile)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.HasChanges = summary.HasChanges || hasChanges
+
+	return summary, nil
+}
+
+// summarisePlan summarises a plan file from its 'terragrunt show -json' representation, run in the directory
+// of the planned component. The output is captured rather than streamed.
+func (t *Tg) summarisePlan(ctx context.Context, planOpts tg.TerragruntOptions, componentID, planFile string) (*tg.PlanSummary, error) {
+	showOpts := tg.TerragruntOptions{
+		WorkingDir:     planOpts.WorkingDir,
+		Redactor:       planOpts.Redactor,
+		Env:            planOpts.Env,
+		DeniedEnv:      planOpts.DeniedEnv,
+		Command:        "show",
+		NonInteractive: true,
+		AdditionalArgs: []string{"-json", planFile},
+	}
+
+	result, err := t.executor.Execute(ctx, tg.StreamOptions{
+		TerragruntOptions: showOpts,
+		OutWriter:         io.Discard,
+		ErrWriter:         io.Discard,
+	})
+	if err != nil {
+		if result != nil && strings.TrimSpace(result.Stderr) != "" {
+			return nil, fmt.Errorf("failed to show the plan of %s: %w\n%s", componentID, err, strings.TrimSpace(result.Stderr))
+		}
+		return nil, fmt.Errorf("failed to show the plan of %s: %w", componentID, err)
+	}
+
+	return tg.ParsePlanJSON(componentID, []byte(result.Stdout))
+}
+
+// planFileArg returns the plan file set with -out in the given arguments, or an empty string if there is none.
+func planFileArg(args []string) string {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, planOutArgPrefix) {
+			return strings.TrimPrefix(arg, planOutArgPrefix)
+		}
+	}
+
+	return ""
+}
+
+// removePlanFile removes a temporary plan file once it's summarised. Plan files can hold sensitive values.
+func removePlanFile(planFile string) {
+	if err := os.Remove(planFile); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "failed to remove the plan file %s: %v\n", planFile, err)
+	}
+}
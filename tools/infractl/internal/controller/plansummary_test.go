@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
+)
+
+// testPlanJSON is the 'terraform show -json' representation of a plan creating a resource and replacing another.
+const testPlanJSON = `{
+  "resource_changes": [
+    {"address": "random_id.this", "change": {"actions": ["create"]}},
+    {"address": "aws_dynamodb_table.this", "change": {"actions": ["delete", "create"]}},
+    {"address": "data.aws_region.current", "change": {"actions": ["read"]}}
+  ]
+}`
+
+func TestPlanComponent(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []tg.FakeResponse
+		want      tg.PlanSummary
+		wantErr   string
+		wantShow  bool
+	}{
+		{
+			name: "changes, exit code 2",
+			responses: []tg.FakeResponse{
+				{Command: "plan", ExitCode: tg.PlanChangesExitCode},
+				{Command: "show", Stdout: testPlanJSON},
+			},
+			want:     tg.PlanSummary{Component: testStack + "/" + testLayer + "/table", HasChanges: true, Create: 1, Replace: 1},
+			wantShow: true,
+		},
+		{
+			name: "output changes only, exit code 2",
+			responses: []tg.FakeResponse{
+				{Command: "plan", ExitCode: tg.PlanChangesExitCode},
+				{Command: "show", Stdout: `{"resource_changes": []}`},
+			},
+			want:     tg.PlanSummary{Component: testStack + "/" + testLayer + "/table", HasChanges: true},
+			wantShow: true,
+		},
+		{
+			name: "no changes, exit code 0",
+			responses: []tg.FakeResponse{
+				{Command: "show", Stdout: `{}`},
+			},
+			want:     tg.PlanSummary{Component: testStack + "/" + testLayer + "/table"},
+			wantShow: true,
+		},
+		{
+			name: "plan failed, exit code 1",
+			responses: []tg.FakeResponse{
+				{Command: "plan", ExitCode: 1, Stderr: "Error: invalid provider\n"},
+			},
+			wantErr: "plan command failed: exit status 1",
+		},
+		{
+			name: "show failed",
+			responses: []tg.FakeResponse{
+				{Command: "plan", ExitCode: tg.PlanChangesExitCode},
+				{Command: "show", ExitCode: 1, Stderr: "Error: the plan file is corrupt\n"},
+			},
+			wantErr:  "failed to show the plan of stack-test/db/table: show command failed: exit status 1\nError: the plan file is corrupt",
+			wantShow: true,
+		},
+		{
+			name: "show printed no plan",
+			responses: []tg.FakeResponse{
+				{Command: "plan", ExitCode: tg.PlanChangesExitCode},
+				{Command: "show", Stdout: "Acquiring state lock..."},
+			},
+			wantErr:  "failed to parse the JSON representation of the plan of stack-test/db/table",
+			wantShow: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := tg.NewFakeExecutor(tt.responses...)
+			runner := newTestRunner(t, executor)
+
+			summaries, err := runner.Plan(context.Background(), TgRunnerStackOptions{
+				StackName: testStack, LayerName: testLayer, ComponentName: "table", OutWriter: &strings.Builder{},
+			})
+
+			invocations := executor.Invocations()
+			if len(invocations) == 0 || invocations[0].Options.Command != "plan" || !containsName(invocations[0].Args, "-detailed-exitcode") {
+				t.Fatalf("invocations = %+v, want a plan with -detailed-exitcode first", invocations)
+			}
+
+			planFile := planFileArg(invocations[0].Args)
+			if planFile == "" {
+				t.Fatalf("plan args = %v, want the plan saved with -out", invocations[0].Args)
+			}
+			if _, statErr := os.Stat(planFile); !os.IsNotExist(statErr) {
+				t.Errorf("the temporary plan file %s is left behind (%v)", planFile, statErr)
+			}
+
+			showed := len(invocations) == 2 && invocations[1].Options.Command == "show"
+			if showed != tt.wantShow {
+				t.Fatalf("invocations = %+v, want the plan shown: %v", invocations, tt.wantShow)
+			}
+			if showed && strings.Join(invocations[1].Args, " ") != "show --terragrunt-non-interactive -json "+planFile {
+				t.Errorf("show args = %v, want the plan file %s shown as JSON", invocations[1].Args, planFile)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Plan() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Plan() unexpected error: %v", err)
+			}
+
+			if len(summaries) != 1 {
+				t.Fatalf("Plan() = %+v, want one summary", summaries)
+			}
+			got := summaries[0]
+			if got.Component != tt.want.Component || got.HasChanges != tt.want.HasChanges || got.Create != tt.want.Create ||
+				got.Update != tt.want.Update || got.Replace != tt.want.Replace || got.Delete != tt.want.Delete {
+				t.Errorf("Plan() summary = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanKeepsPlanFilePassedWithOut(t *testing.T) {
+	executor := tg.NewFakeExecutor(
+		tg.FakeResponse{Command: "plan", ExitCode: tg.PlanChangesExitCode},
+		tg.FakeResponse{Command: "show", Stdout: testPlanJSON},
+	)
+	runner := newTestRunner(t, executor)
+
+	planFile := t.TempDir() + "/table.tfplan"
+	if err := os.WriteFile(planFile, []byte("plan"), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", planFile, err)
+	}
+
+	if _, err := runner.Plan(context.Background(), TgRunnerStackOptions{
+		StackName: testStack, LayerName: testLayer, ComponentName: "table", OutWriter: &strings.Builder{},
+	}, "-out="+planFile); err != nil {
+		t.Fatalf("Plan() unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(planFile); err != nil {
+		t.Errorf("the plan file passed with -out was removed: %v", err)
+	}
+
+	invocations := executor.Invocations()
+	if got := planFileArg(invocations[len(invocations)-1].Args[1:]); got != "" {
+		t.Errorf("show args = %v, want no -out", invocations[len(invocations)-1].Args)
+	}
+	if got := planFileArg(invocations[0].Args); got != planFile {
+		t.Errorf("plan saved to %s, want %s", got, planFile)
+	}
+}
+
+func TestPlanGraphSummarisesEveryComponent(t *testing.T) {
+	executor := tg.NewFakeExecutor(
+		tg.FakeResponse{Command: "plan", WorkingDir: "table", ExitCode: tg.PlanChangesExitCode},
+		tg.FakeResponse{Command: "show", WorkingDir: "table", Stdout: testPlanJSON},
+		tg.FakeResponse{Command: "show", Stdout: `{}`},
+	)
+	runner := newTestRunner(t, executor)
+
+	summaries, err := runner.Plan(context.Background(), TgRunnerStackOptions{StackName: testStack, LayerName: testLayer, OutWriter: &strings.Builder{}})
+	if err != nil {
+		t.Fatalf("Plan() unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, summary := range summaries {
+		got = append(got, summary.Component+": "+summary.String())
+	}
+	want := []string{
+		"stack-test/db/id-generator: no changes",
+		"stack-test/db/table: 1 to create, 0 to update, 1 to replace, 0 to delete",
+		"stack-test/db/app: no changes",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Plan() summaries =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
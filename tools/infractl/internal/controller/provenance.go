@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/transformers"
+)
+
+const (
+	// ValueOriginLiteral is a value written as-is in the environment configuration file that sets it.
+	ValueOriginLiteral = "literal"
+	// ValueOriginMixed is a value made of several references resolved from different sources.
+	ValueOriginMixed = "mixed"
+	// ValueOriginExpression is a value holding expressions, e.g. ${lower(product.name)}, evaluated by the compilation.
+	ValueOriginExpression = "expression"
+	// ValueOriginNotExpanded is a value holding references that the compilation doesn't expand.
+	ValueOriginNotExpanded = "not-expanded"
+	// ValueOriginInfractlDefault is a value no environment configuration file sets; it's infractl's default.
+	ValueOriginInfractlDefault = "infractl-default"
+
+	// sensitiveValuePlaceholder replaces the values that come from secrets in provenance reports.
+	sensitiveValuePlaceholder = "(sensitive)"
+)
+
+// ValueProvenance explains where a value of the compiled configuration came from.
+type ValueProvenance struct {
+	// Path is the path of the value, e.g. providers.aws.config.region
+	Path string `json:"path"`
+	// Value is the compiled value, or a placeholder if it's sensitive.
+	Value interface{} `json:"value"`
+	// Sensitive reports whether the value is a secret, or comes from one.
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Origin is how the value was obtained: a ValueOrigin* constant, or the transformers.ValueSource of its
+	// references when they all come from the same source (env, secret, default, missing-secret or unresolved).
+	Origin string `json:"origin"`
+	// Expression is the value as written in the environment configuration file, when it holds references.
+	Expression string `json:"expression,omitempty"`
+	// References explains how every reference of the expression was resolved.
+	References []transformers.ValueReference `json:"references,omitempty"`
+	// Source is where the value is set in the environment configuration file that won the merge.
+	Source *cfg.ValueLocation `json:"source,omitempty"`
+	// Overrides lists where the value is also set in more generic environments, overridden by the Source.
+	Overrides []cfg.ValueLocation `json:"overrides,omitempty"`
+}
+
+// ExplainCompilation compiles the target environment, like CompileWithoutStackValidation, and explains where
+// every value of the compiled configuration came from: the environment configuration file, line and column
+// that set it, which environment of the inheritance chain won the merge, and whether it was resolved from an
+// environment variable, a ${VAR:-default} default or a 'secrets.' reference.
+//
+// Parameters:
+//   - targetEnv: A string representing the name of the target environment to compile.
+//
+// Returns:
+//   - A pointer to the compiled environment configuration (*cfg.EnvConfig).
+//   - The provenance of every leaf value of the compiled configuration, sorted by path. Values that come from
+//     secrets are replaced by a placeholder.
+//   - An error if the compilation fails, or an environment configuration file cannot be parsed.
+func (c *Client) ExplainCompilation(targetEnv string) (*cfg.EnvConfig, []ValueProvenance, error) {
+	result, err := c.compile(targetEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locations, err := c.locateChainValues(result.chain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	compiledValues, err := compiledLeafValues(result.compiled)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawValues := cfg.LeafValues(result.document)
+
+	provenance := make([]ValueProvenance, 0, len(compiledValues))
+	for _, valuePath := range cfg.SortedValuePaths(compiledValues) {
+		entry := ValueProvenance{Path: valuePath, Value: compiledValues[valuePath], Origin: ValueOriginLiteral}
+
+		for _, layerLocations := range locations {
+			location, ok := layerLocations[valuePath]
+			if !ok {
+				continue
+			}
+			if entry.Source == nil {
+				entry.Source = &location
+			} else {
+				entry.Overrides = append(entry.Overrides, location)
+			}
+		}
+
+		rawValue, isSet := rawValues[valuePath]
+		expression, isString := rawValue.(string)
+
+		switch {
+		case !isSet || entry.Source == nil:
+			entry.Origin = ValueOriginInfractlDefault
+		case isString:
+			entry.References = result.envVarsTransformer.ExplainValue(expression)
+			if len(entry.References) > 0 {
+				entry.Expression = expression
+				entry.Origin = referencesOrigin(entry.References)
+				if entry.Origin != string(transformers.ValueSourceUnresolved) && fmt.Sprint(entry.Value) == expression {
+					entry.Origin = ValueOriginNotExpanded
+				}
+			}
+			if transformers.HasExpressions(expression) {
+				entry.Expression = expression
+				entry.Origin = ValueOriginExpression
+			}
+		}
+
+		entry.Sensitive = cfg.IsValuePathUnder(valuePath, "secrets") || referencesSecret(entry.References) || isSensitiveProviderKey(result.compiled, valuePath)
+		if entry.Sensitive {
+			entry.Value = sensitiveValuePlaceholder
+		}
+
+		provenance = append(provenance, entry)
+	}
+
+	return result.compiled, provenance, nil
+}
+
+// locateChainValues locates the values of every environment of an inheritance chain, from the most specific
+// one, which wins the merge, to the most generic one. Files are relative to the root of the repository.
+func (c *Client) locateChainValues(chain []cfg.EnvLayer) ([]map[string]cfg.ValueLocation, error) {
+	locations := make([]map[string]cfg.ValueLocation, len(chain))
+	for i, layer := range chain {
+		layerLocations, err := cfg.LocateDocumentValues(layer.Name, layer.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate the values of environment '%s': %w", layer.Name, err)
+		}
+
+		for valuePath, location := range layerLocations {
+			location.File = c.relativeToRepoRoot(location.File)
+			layerLocations[valuePath] = location
+		}
+		locations[len(chain)-1-i] = layerLocations
+	}
+
+	return locations, nil
+}
+
+// FilterProvenance keeps the provenance of the values at, or nested under, the given path.
+//
+// Parameters:
+//   - provenance: The provenance of the compiled configuration, as returned by ExplainCompilation.
+//   - valuePath: The path to explain, e.g. providers.aws.config.region, or providers.aws for every value under it.
+//
+// Returns:
+//   - The provenance of the matching values.
+//   - An error if no value of the compiled configuration matches the path.
+func FilterProvenance(provenance []ValueProvenance, valuePath string) ([]ValueProvenance, error) {
+	var matching []ValueProvenance
+	for _, entry := range provenance {
+		if cfg.IsValuePathUnder(entry.Path, valuePath) {
+			matching = append(matching, entry)
+		}
+	}
+
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("no value at path '%s' in the compiled configuration; paths look like providers.aws.config.region or stacks[<stack>].layers[<layer>].components[<component>].inputs", valuePath)
+	}
+
+	return matching, nil
+}
+
+// FormatProvenance renders the provenance of a set of values as human readable text.
+func FormatProvenance(provenance []ValueProvenance) string {
+	var sb strings.Builder
+
+	for i, entry := range provenance {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+
+		value, _ := json.Marshal(entry.Value)
+		fmt.Fprintf(&sb, "%s = %s\n", entry.Path, value)
+		fmt.Fprintf(&sb, "  origin:     %s\n", entry.Origin)
+
+		if entry.Source != nil {
+			fmt.Fprintf(&sb, "  set in:     %s (%s), which won the merge\n", entry.Source.Env, entry.Source)
+		} else {
+			sb.WriteString("  set in:     no environment configuration file\n")
+		}
+
+		for _, override := range entry.Overrides {
+			fmt.Fprintf(&sb, "  overrides:  %s (%s)\n", override.Env, override)
+		}
+
+		if entry.Expression != "" {
+			fmt.Fprintf(&sb, "  expression: %s\n", entry.Expression)
+		}
+
+		writeReferences(&sb, entry.References, "    ")
+	}
+
+	return sb.String()
+}
+
+func writeReferences(sb *strings.Builder, references []transformers.ValueReference, indent string) {
+	for _, reference := range references {
+		fmt.Fprintf(sb, "%s%s -> %s", indent, reference.Expression, reference.Source)
+		switch reference.Source {
+		case transformers.ValueSourceEnvVar:
+			fmt.Fprintf(sb, " (%s is set)", reference.EnvVar)
+		case transformers.ValueSourceSecret:
+			fmt.Fprintf(sb, " (%s is not set, read from %s)", reference.EnvVar, reference.Secret)
+			if reference.SecretURI != "" {
+				fmt.Fprintf(sb, " <- %s", reference.SecretURI)
+			}
+		case transformers.ValueSourceMissingSecret:
+			fmt.Fprintf(sb, " (%s is not set, and %s is not declared)", reference.EnvVar, reference.Secret)
+		case transformers.ValueSourceDefault, transformers.ValueSourceUnresolved:
+			fmt.Fprintf(sb, " (%s is not set)", reference.EnvVar)
+		}
+		sb.WriteString("\n")
+
+		writeReferences(sb, reference.SecretReferences, indent+"  ")
+	}
+}
+
+// compiledLeafValues flattens the compiled configuration, as it's handed over to Terragrunt, into its leaf values.
+func compiledLeafValues(compiled *cfg.EnvConfig) (map[string]interface{}, error) {
+	content, err := json.Marshal(compiled)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling the compiled environment configuration to JSON: %w", err)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("error unmarshaling the compiled environment configuration: %w", err)
+	}
+
+	return cfg.LeafValues(document), nil
+}
+
+// referencesOrigin returns the source shared by every reference, or ValueOriginMixed.
+func referencesOrigin(references []transformers.ValueReference) string {
+	origin := string(references[0].Source)
+	for _, reference := range references[1:] {
+		if string(reference.Source) != origin {
+			return ValueOriginMixed
+		}
+	}
+
+	return origin
+}
+
+// referencesSecret reports whether any of the references is resolved from a secret.
+func referencesSecret(references []transformers.ValueReference) bool {
+	for _, reference := range references {
+		if reference.Source == transformers.ValueSourceSecret {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSensitiveProviderKey reports whether a value path is a provider configuration key marked sensitive.
+func isSensitiveProviderKey(compiled *cfg.EnvConfig, valuePath string) bool {
+	for providerName, providerConfig := range compiled.Providers {
+		for _, key := range providerConfig.SensitiveKeys {
+			if cfg.IsValuePathUnder(valuePath, "providers."+providerName+".config."+key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// relativeToRepoRoot makes a path relative to the root of the git repository, when it's inside it.
+func (c *Client) relativeToRepoRoot(path string) string {
+	rel, err := filepath.Rel(c.Paths.GitRepoRoot, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return rel
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/transformers"
+)
+
+// AuditSecrets analyses which components of the target environment can see which secrets, through the
+// providers they list, and reports the secrets no component can see and the references to undeclared secrets.
+// Nothing is resolved: neither the environment variables nor the secret backends are read.
+//
+// Parameters:
+//   - targetEnv: A string representing the name of the target environment to audit.
+//
+// Returns:
+//   - The secrets audit, with the file, line and column that declare every secret and set every reference.
+//   - An error if the target environment configuration cannot be loaded.
+func (c *Client) AuditSecrets(targetEnv string) (*transformers.SecretAudit, error) {
+	chain, mergedCfg, err := c.mergeTargetEnv(targetEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := transformers.AuditSecrets(mergedCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	locations, err := c.locateChainValues(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	locate := func(valuePath string) *cfg.ValueLocation {
+		for _, layerLocations := range locations {
+			if location, ok := layerLocations[valuePath]; ok {
+				return &location
+			}
+		}
+
+		return nil
+	}
+
+	for i := range audit.Secrets {
+		audit.Secrets[i].Source = locate(audit.Secrets[i].Secret)
+		for j := range audit.Secrets[i].References {
+			audit.Secrets[i].References[j].Source = locate(audit.Secrets[i].References[j].Path)
+		}
+	}
+
+	for i := range audit.Dangling {
+		audit.Dangling[i].Source = locate(audit.Dangling[i].Path)
+	}
+
+	return audit, nil
+}
+
+// FormatSecretAudit renders a secrets audit as human readable text: every secret with the providers that read
+// it and the components that can see it, then the references to undeclared secrets.
+func FormatSecretAudit(audit *transformers.SecretAudit) string {
+	var sb strings.Builder
+
+	for i, usage := range audit.Secrets {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString(usage.Secret)
+		if usage.Source != nil {
+			fmt.Fprintf(&sb, " (%s)", usage.Source)
+		}
+		if usage.Unused {
+			sb.WriteString(" [unused]")
+		}
+		sb.WriteString("\n")
+
+		fmt.Fprintf(&sb, "  providers:  %s\n", listOrNone(usage.Providers))
+		fmt.Fprintf(&sb, "  components: %s\n", listOrNone(usage.Components))
+		for _, reference := range usage.References {
+			fmt.Fprintf(&sb, "  read by:    %s\n", reference)
+		}
+	}
+
+	if len(audit.Dangling) > 0 {
+		if len(audit.Secrets) > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("dangling references:\n")
+		for _, reference := range audit.Dangling {
+			fmt.Fprintf(&sb, "  %s\n", reference)
+		}
+	}
+
+	return sb.String()
+}
+
+func listOrNone(values []string) string {
+	if len(values) == 0 {
+		return "(none)"
+	}
+
+	return strings.Join(values, ", ")
+}
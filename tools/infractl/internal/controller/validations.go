@@ -2,23 +2,26 @@
 
 import (
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/graph"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
 )
 
-// isTerragruntInstalled verifies Terragrunt is installed and accessible
-func isTerragruntInstalled() error {
-	// Simple check using 'which' command to verify Terragrunt installation
-	output, err := utils.ExecuteCommand("which", "terragrunt")
+// isTerragruntInstalled verifies Terragrunt is installed and accessible through the executor
+func isTerragruntInstalled(executor tg.Executor) error {
+	terragruntPath, err := executor.LookPath()
 	if err != nil {
-		return fmt.Errorf("terragrunt is not installed or not in PATH")
+		return err
 	}
 
-	// Trim any whitespace and verify the output is not empty
-	terragruntPath := strings.TrimSpace(output)
-	if terragruntPath == "" {
+	if strings.TrimSpace(terragruntPath) == "" {
 		return fmt.Errorf("terragrunt executable path is empty")
 	}
 
@@ -145,3 +148,69 @@ func IsStackHierarchyConsistent(stack, layer, component string) error {
 
 	return nil
 }
+
+// getEnvCallPattern matches the get_env() calls of an HCL expression, capturing the variable name and,
+// when present, the comma that introduces a fallback value.
+var getEnvCallPattern = regexp.MustCompile(`get_env\(\s*"([A-Za-z0-9_]+)"\s*(,)?`)
+
+// isTransportEntrypointConsistent checks that the HCL entrypoint (config.hcl) honours the transport contract:
+// it reads the compiled configuration path from the canonical variable without falling back to a default
+// file, it doesn't read any other INFRACTL_CONFIG_* variable, and it supports the schema version infractl emits.
+//
+// Parameters:
+//   - terragruntDirPath: Absolute path to the Terragrunt directory that holds the entrypoint.
+//
+// Returns:
+//   - An error describing every breach of the contract, or nil if the entrypoint honours it.
+func isTransportEntrypointConsistent(terragruntDirPath string) error {
+	entrypointPath := filepath.Join(terragruntDirPath, cfg.TransportEntrypointFilename)
+
+	entrypoint, err := graph.ParseHCLFile(entrypointPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse the Terragrunt entrypoint: %w", err)
+	}
+
+	locals := graph.Locals(entrypoint.Body)
+	names := make([]string, 0, len(locals))
+	for name := range locals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	readsCanonicalVar := false
+
+	for _, name := range names {
+		for _, match := range getEnvCallPattern.FindAllStringSubmatch(locals[name], -1) {
+			envVar, hasFallback := match[1], match[2] != ""
+
+			switch {
+			case envVar == cfg.InfractlConfigFilePathEnvVar:
+				readsCanonicalVar = true
+				if hasFallback {
+					problems = append(problems, fmt.Sprintf("local.%s falls back to a default file when %s is not set, which can silently read a stale configuration", name, envVar))
+				}
+			case strings.HasPrefix(envVar, "INFRACTL_CONFIG_"):
+				problems = append(problems, fmt.Sprintf("local.%s reads %s, but infractl hands the configuration over through %s", name, envVar, cfg.InfractlConfigFilePathEnvVar))
+			}
+		}
+	}
+
+	if !readsCanonicalVar {
+		problems = append(problems, fmt.Sprintf("no local reads the compiled configuration path from %s", cfg.InfractlConfigFilePathEnvVar))
+	}
+
+	supportedVersion, ok := locals[cfg.TransportSchemaVersionLocal]
+	switch {
+	case !ok:
+		problems = append(problems, fmt.Sprintf("local.%s is not declared", cfg.TransportSchemaVersionLocal))
+	case strings.Trim(supportedVersion, `"`) != strconv.Itoa(cfg.TransportSchemaVersion):
+		problems = append(problems, fmt.Sprintf("local.%s is %s, but infractl emits schema version %d", cfg.TransportSchemaVersionLocal, supportedVersion, cfg.TransportSchemaVersion))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s does not honour the transport contract: %s", entrypointPath, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Dependency is a component directory another component depends on.
+type Dependency struct {
+	// Name is the label of the 'dependency' block, empty for entries of a 'dependencies' block.
+	Name string
+	// Dir is the absolute path of the component depended on.
+	Dir string
+	// Source is the file and line that declares the dependency.
+	Source string
+}
+
+// DiscoverDependencies finds the dependencies of a component, declared in the 'dependency' and
+// 'dependencies' blocks of its terragrunt.hcl and component.hcl, and of the files included by terragrunt.hcl.
+//
+// Parameters:
+//   - componentDir: Absolute path to the component directory.
+//   - repoRoot: Absolute path to the root of the git repository, used to resolve get_repo_root().
+//
+// Returns:
+//   - The dependencies, sorted by directory and without duplicates
+//   - An error if a file cannot be parsed, or a dependency path cannot be resolved
+func DiscoverDependencies(componentDir, repoRoot string) ([]Dependency, error) {
+	ctx := EvalContext{TerragruntDir: componentDir, RepoRoot: repoRoot}
+
+	terragruntFile, err := ParseHCLFile(filepath.Join(componentDir, TerragruntConfigFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*HCLFile{terragruntFile}
+
+	componentFilePath := filepath.Join(componentDir, ComponentConfigFilename)
+	if _, err := os.Stat(componentFilePath); err == nil {
+		componentFile, err := ParseHCLFile(componentFilePath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, componentFile)
+	}
+
+	includes, err := resolveIncludes(terragruntFile, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, includePath := range includes {
+		includedFile, err := ParseHCLFile(includePath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, includedFile)
+	}
+
+	seen := map[string]bool{}
+	var deps []Dependency
+
+	for _, file := range files {
+		fileDeps, err := dependenciesInFile(file, ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dep := range fileDeps {
+			if seen[dep.Dir] {
+				continue
+			}
+			seen[dep.Dir] = true
+			deps = append(deps, dep)
+		}
+	}
+
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Dir < deps[j].Dir })
+
+	return deps, nil
+}
+
+// IncludedFiles returns the absolute paths of the files included by the terragrunt.hcl of a component, e.g. the
+// root configuration and the shared component configuration under _shared/_components.
+func IncludedFiles(componentDir, repoRoot string) ([]string, error) {
+	terragruntFile, err := ParseHCLFile(filepath.Join(componentDir, TerragruntConfigFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveIncludes(terragruntFile, EvalContext{TerragruntDir: componentDir, RepoRoot: repoRoot})
+}
+
+// resolveIncludes returns the absolute paths of the files included by a Terragrunt configuration.
+func resolveIncludes(file *HCLFile, ctx EvalContext) ([]string, error) {
+	ctx.Locals = Locals(file.Body)
+
+	var paths []string
+	for _, include := range file.Body.BlocksOfType("include") {
+		attr, ok := include.Body.Attributes["path"]
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: include block without a path", file.Path, include.Line)
+		}
+
+		path, err := EvalString(attr.Expr, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", file.Path, attr.Line, err)
+		}
+
+		paths = append(paths, absPath(path, ctx.TerragruntDir))
+	}
+
+	return paths, nil
+}
+
+// dependenciesInFile resolves the 'dependency' and 'dependencies' blocks declared in a file.
+func dependenciesInFile(file *HCLFile, ctx EvalContext) ([]Dependency, error) {
+	ctx.Locals = Locals(file.Body)
+
+	var deps []Dependency
+
+	for _, block := range file.Body.BlocksOfType("dependency") {
+		source := fmt.Sprintf("%s:%d", file.Path, block.Line)
+
+		attr, ok := block.Body.Attributes["config_path"]
+		if !ok {
+			return nil, fmt.Errorf("%s: dependency block without a config_path", source)
+		}
+
+		path, err := EvalString(attr.Expr, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+
+		name := ""
+		if len(block.Labels) > 0 {
+			name = block.Labels[0]
+		}
+
+		deps = append(deps, Dependency{Name: name, Dir: absPath(path, ctx.TerragruntDir), Source: source})
+	}
+
+	for _, block := range file.Body.BlocksOfType("dependencies") {
+		source := fmt.Sprintf("%s:%d", file.Path, block.Line)
+
+		attr, ok := block.Body.Attributes["paths"]
+		if !ok {
+			continue
+		}
+
+		paths, err := EvalStringList(attr.Expr, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+
+		for _, path := range paths {
+			deps = append(deps, Dependency{Dir: absPath(path, ctx.TerragruntDir), Source: source})
+		}
+	}
+
+	return deps, nil
+}
+
+// Locals collects the raw expressions of the locals declared in a body.
+func Locals(body *HCLBody) map[string]string {
+	locals := map[string]string{}
+	for _, block := range body.BlocksOfType("locals") {
+		for name, attr := range block.Body.Attributes {
+			locals[name] = attr.Expr
+		}
+	}
+
+	return locals
+}
+
+// absPath resolves a path relative to the Terragrunt directory, as Terragrunt does with config paths.
+func absPath(path, terragruntDir string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(terragruntDir, path)
+	}
+
+	return filepath.Clean(path)
+}
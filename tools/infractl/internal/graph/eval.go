@@ -0,0 +1,277 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EvalContext is what's needed to evaluate the path expressions used in Terragrunt configurations.
+// Terragrunt evaluates included files in the context of the including configuration, so TerragruntDir
+// is always the directory of the component, even when evaluating a shared configuration file.
+type EvalContext struct {
+	// TerragruntDir is the directory of the terragrunt.hcl being evaluated (get_terragrunt_dir()).
+	TerragruntDir string
+	// RepoRoot is the root of the git repository (get_repo_root()).
+	RepoRoot string
+	// Locals are the raw expressions of the locals available to the expression (local.<name>).
+	Locals map[string]string
+}
+
+// EvalString evaluates an expression that yields a string.
+//
+// Supported expressions are string literals and templates, local references, and the Terragrunt
+// functions that are commonly used to build paths: get_repo_root(), get_terragrunt_dir(),
+// get_parent_terragrunt_dir() and find_in_parent_folders(). Anything else is reported as unsupported.
+func EvalString(expr string, ctx EvalContext) (string, error) {
+	e := &evaluator{src: expr, ctx: ctx}
+
+	value, err := e.parseExpr()
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate expression %q: %w", expr, err)
+	}
+
+	e.skipSpace()
+	if !e.eof() {
+		return "", fmt.Errorf("failed to evaluate expression %q: unsupported expression", expr)
+	}
+
+	return value, nil
+}
+
+// EvalStringList evaluates a list expression ([a, b, ...]) where every element yields a string.
+func EvalStringList(expr string, ctx EvalContext) ([]string, error) {
+	e := &evaluator{src: expr, ctx: ctx}
+	e.skipSpace()
+
+	if !e.consume('[') {
+		return nil, fmt.Errorf("failed to evaluate expression %q: expected a list", expr)
+	}
+
+	var values []string
+	for {
+		e.skipSpace()
+		if e.consume(']') {
+			break
+		}
+
+		value, err := e.parseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate expression %q: %w", expr, err)
+		}
+		values = append(values, value)
+
+		e.skipSpace()
+		if e.consume(',') {
+			continue
+		}
+		if !e.consume(']') {
+			return nil, fmt.Errorf("failed to evaluate expression %q: expected ',' or ']'", expr)
+		}
+		break
+	}
+
+	e.skipSpace()
+	if !e.eof() {
+		return nil, fmt.Errorf("failed to evaluate expression %q: unsupported expression", expr)
+	}
+
+	return values, nil
+}
+
+// maxLocalDepth bounds the resolution of locals referencing other locals, to stop on cycles.
+const maxLocalDepth = 16
+
+type evaluator struct {
+	src   string
+	pos   int
+	ctx   EvalContext
+	depth int
+}
+
+func (e *evaluator) eof() bool {
+	return e.pos >= len(e.src)
+}
+
+func (e *evaluator) skipSpace() {
+	for !e.eof() && strings.ContainsRune(" \t\r\n", rune(e.src[e.pos])) {
+		e.pos++
+	}
+}
+
+func (e *evaluator) consume(c byte) bool {
+	if !e.eof() && e.src[e.pos] == c {
+		e.pos++
+		return true
+	}
+	return false
+}
+
+func (e *evaluator) parseExpr() (string, error) {
+	e.skipSpace()
+	if e.eof() {
+		return "", fmt.Errorf("unexpected end of expression")
+	}
+
+	if e.src[e.pos] == '"' {
+		return e.parseTemplate()
+	}
+
+	if !isIdentStart(e.src[e.pos]) {
+		return "", fmt.Errorf("unsupported expression at %q", e.src[e.pos:])
+	}
+
+	start := e.pos
+	for !e.eof() && (isIdentChar(e.src[e.pos]) || e.src[e.pos] == '.') {
+		e.pos++
+	}
+	name := e.src[start:e.pos]
+
+	e.skipSpace()
+	if e.consume('(') {
+		return e.parseCall(name)
+	}
+
+	if local, ok := strings.CutPrefix(name, "local."); ok {
+		return e.resolveLocal(local)
+	}
+
+	return "", fmt.Errorf("unsupported reference %q", name)
+}
+
+func (e *evaluator) parseTemplate() (string, error) {
+	e.pos++ // opening quote
+
+	var sb strings.Builder
+	for !e.eof() {
+		c := e.src[e.pos]
+		switch {
+		case c == '"':
+			e.pos++
+			return sb.String(), nil
+		case c == '\\' && e.pos+1 < len(e.src):
+			sb.WriteString(unescape(e.src[e.pos+1]))
+			e.pos += 2
+		case c == '$' && strings.HasPrefix(e.src[e.pos:], "${"):
+			e.pos += 2
+			value, err := e.parseExpr()
+			if err != nil {
+				return "", err
+			}
+			e.skipSpace()
+			if !e.consume('}') {
+				return "", fmt.Errorf("unsupported template interpolation")
+			}
+			sb.WriteString(value)
+		case c == '%' && strings.HasPrefix(e.src[e.pos:], "%{"):
+			return "", fmt.Errorf("template directives are not supported")
+		default:
+			sb.WriteByte(c)
+			e.pos++
+		}
+	}
+
+	return "", fmt.Errorf("unterminated string")
+}
+
+func unescape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	default:
+		return string(c)
+	}
+}
+
+func (e *evaluator) parseCall(name string) (string, error) {
+	var args []string
+	for {
+		e.skipSpace()
+		if e.consume(')') {
+			break
+		}
+
+		arg, err := e.parseExpr()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+
+		e.skipSpace()
+		if e.consume(',') {
+			continue
+		}
+		if !e.consume(')') {
+			return "", fmt.Errorf("expected ',' or ')' in call to %s", name)
+		}
+		break
+	}
+
+	switch name {
+	case "get_repo_root":
+		if e.ctx.RepoRoot == "" {
+			return "", fmt.Errorf("get_repo_root() is not available")
+		}
+		return e.ctx.RepoRoot, nil
+	case "get_terragrunt_dir", "get_parent_terragrunt_dir", "get_original_terragrunt_dir":
+		return e.ctx.TerragruntDir, nil
+	case "find_in_parent_folders":
+		return findInParentFolders(e.ctx.TerragruntDir, args)
+	default:
+		return "", fmt.Errorf("unsupported function %s()", name)
+	}
+}
+
+func (e *evaluator) resolveLocal(name string) (string, error) {
+	expr, ok := e.ctx.Locals[name]
+	if !ok {
+		return "", fmt.Errorf("local.%s is not defined", name)
+	}
+
+	if e.depth >= maxLocalDepth {
+		return "", fmt.Errorf("local.%s is too deeply nested, or references itself", name)
+	}
+
+	nested := &evaluator{src: expr, ctx: e.ctx, depth: e.depth + 1}
+	value, err := nested.parseExpr()
+	if err != nil {
+		return "", fmt.Errorf("local.%s: %w", name, err)
+	}
+
+	nested.skipSpace()
+	if !nested.eof() {
+		return "", fmt.Errorf("local.%s: unsupported expression", name)
+	}
+
+	return value, nil
+}
+
+// findInParentFolders mirrors Terragrunt's find_in_parent_folders(name, [fallback]): it walks up from the
+// parent of the Terragrunt directory looking for the given path, and returns the fallback (if any) when
+// nothing is found.
+func findInParentFolders(terragruntDir string, args []string) (string, error) {
+	name := "terragrunt.hcl"
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	for dir := filepath.Dir(terragruntDir); ; dir = filepath.Dir(dir) {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	if len(args) > 1 {
+		return args[1], nil
+	}
+
+	return "", fmt.Errorf("find_in_parent_folders(%q) found nothing above %s", name, terragruntDir)
+}
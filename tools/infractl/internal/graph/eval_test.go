@@ -0,0 +1,145 @@
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestEvalContext creates a repository with a root.hcl in the Terragrunt directory and a terragrunt.hcl in
+// the stack directory, and returns the context of a component of that stack.
+func newTestEvalContext(t *testing.T) EvalContext {
+	t.Helper()
+
+	repoRoot := t.TempDir()
+	terragruntDir := filepath.Join(repoRoot, "infra", "terragrunt")
+	componentDir := filepath.Join(terragruntDir, "stack-test", "db", "table")
+
+	if err := os.MkdirAll(componentDir, 0o755); err != nil {
+		t.Fatalf("creating %s: %v", componentDir, err)
+	}
+	for _, path := range []string{
+		filepath.Join(terragruntDir, "root.hcl"),
+		filepath.Join(terragruntDir, "stack-test", "terragrunt.hcl"),
+		filepath.Join(componentDir, "terragrunt.hcl"),
+	} {
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+	}
+
+	return EvalContext{
+		TerragruntDir: componentDir,
+		RepoRoot:      repoRoot,
+		Locals: map[string]string{
+			"root":        `get_repo_root()`,
+			"modules":     `"${local.root}/infra/terraform/modules"`,
+			"self":        `local.self`,
+			"unsupported": `var.x`,
+		},
+	}
+}
+
+func TestEvalString(t *testing.T) {
+	ctx := newTestEvalContext(t)
+	terragruntDir := filepath.Join(ctx.RepoRoot, "infra", "terragrunt")
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    string
+		wantErr string
+	}{
+		{name: "string", expr: `"../id-generator"`, want: "../id-generator"},
+		{name: "escapes", expr: `"a\tb\"c\\d\ne"`, want: "a\tb\"c\\d\ne"},
+		{name: "surrounding spaces", expr: "  \"a\"\n", want: "a"},
+		{name: "get_repo_root", expr: `get_repo_root()`, want: ctx.RepoRoot},
+		{name: "get_terragrunt_dir", expr: `get_terragrunt_dir()`, want: ctx.TerragruntDir},
+		{name: "get_parent_terragrunt_dir", expr: `get_parent_terragrunt_dir()`, want: ctx.TerragruntDir},
+		{name: "template", expr: `"${get_repo_root()}/infra/${ "terraform" }"`, want: ctx.RepoRoot + "/infra/terraform"},
+		{name: "local", expr: `local.root`, want: ctx.RepoRoot},
+		{name: "nested locals", expr: `"${local.modules}/dynamodb-table"`, want: ctx.RepoRoot + "/infra/terraform/modules/dynamodb-table"},
+		{name: "find_in_parent_folders", expr: `find_in_parent_folders("root.hcl")`, want: filepath.Join(terragruntDir, "root.hcl")},
+		{name: "find_in_parent_folders default", expr: `find_in_parent_folders()`, want: filepath.Join(terragruntDir, "stack-test", "terragrunt.hcl")},
+		{name: "find_in_parent_folders fallback", expr: `find_in_parent_folders("nope.hcl", "fallback.hcl")`, want: "fallback.hcl"},
+		{name: "find_in_parent_folders nothing", expr: `find_in_parent_folders("nope.hcl")`, wantErr: `find_in_parent_folders("nope.hcl") found nothing above`},
+		{name: "undefined local", expr: `local.nope`, wantErr: "local.nope is not defined"},
+		{name: "local referencing itself", expr: `local.self`, wantErr: "local.self is too deeply nested, or references itself"},
+		{name: "unsupported local", expr: `local.unsupported`, wantErr: `local.unsupported: unsupported reference "var.x"`},
+		{name: "unsupported reference", expr: `dependency.ids.outputs.id`, wantErr: `unsupported reference "dependency.ids.outputs.id"`},
+		{name: "unsupported function", expr: `format("%s", "a")`, wantErr: "unsupported function format()"},
+		{name: "unsupported operator", expr: `"a" + "b"`, wantErr: "unsupported expression"},
+		{name: "number", expr: `1`, wantErr: `unsupported expression at "1"`},
+		{name: "template directive", expr: `"%{ if true }a%{ endif }"`, wantErr: "template directives are not supported"},
+		{name: "unterminated string", expr: `"abc`, wantErr: "unterminated string"},
+		{name: "unterminated interpolation", expr: `"${local.root"`, wantErr: "unsupported template interpolation"},
+		{name: "unterminated call", expr: `find_in_parent_folders("a"`, wantErr: "expected ',' or ')' in call to find_in_parent_folders"},
+		{name: "empty", expr: ` `, wantErr: "unexpected end of expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvalString(tt.expr, ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("EvalString(%s) error = %v, want it to contain %q", tt.expr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalString(%s) unexpected error: %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalString(%s) = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalStringWithoutRepoRoot(t *testing.T) {
+	_, err := EvalString(`get_repo_root()`, EvalContext{TerragruntDir: t.TempDir()})
+	if err == nil || !strings.Contains(err.Error(), "get_repo_root() is not available") {
+		t.Fatalf("EvalString() error = %v, want get_repo_root() to be unavailable", err)
+	}
+}
+
+func TestEvalStringList(t *testing.T) {
+	ctx := newTestEvalContext(t)
+
+	tests := []struct {
+		name    string
+		expr    string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty", expr: `[]`, want: nil},
+		{name: "strings", expr: `["../a", "../b"]`, want: []string{"../a", "../b"}},
+		{name: "spanning lines with a trailing comma", expr: "[\n  \"../a\",\n  local.root,\n]", want: []string{"../a", ctx.RepoRoot}},
+		{name: "templates", expr: `["${get_terragrunt_dir()}/../a"]`, want: []string{ctx.TerragruntDir + "/../a"}},
+		{name: "not a list", expr: `"../a"`, wantErr: "expected a list"},
+		{name: "missing comma", expr: `["../a" "../b"]`, wantErr: "expected ',' or ']'"},
+		{name: "unterminated", expr: `["../a"`, wantErr: "expected ',' or ']'"},
+		{name: "unsupported element", expr: `[dependency.a.outputs]`, wantErr: `unsupported reference "dependency.a.outputs"`},
+		{name: "concatenation", expr: `["../a"] + ["../b"]`, wantErr: "unsupported expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvalStringList(tt.expr, ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("EvalStringList(%s) error = %v, want it to contain %q", tt.expr, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalStringList(%s) unexpected error: %v", tt.expr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvalStringList(%s) = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
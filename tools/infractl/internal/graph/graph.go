@@ -0,0 +1,355 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+)
+
+const (
+	// TerragruntConfigFilename is the Terragrunt configuration file of a component.
+	TerragruntConfigFilename = "terragrunt.hcl"
+	// ComponentConfigFilename is the component-level configuration file read by terragrunt.hcl.
+	ComponentConfigFilename = "component.hcl"
+)
+
+// Node is a component in the dependency graph, identified by its stack, layer and component names.
+type Node struct {
+	// ID is the path of the component relative to the Terragrunt directory: <stack>/<layer>/<component>
+	ID        string
+	Stack     string
+	Layer     string
+	Component string
+	// Dir is the absolute path to the component directory.
+	Dir string
+	// Declared reports whether the component is declared in the environment configuration. Components that
+	// are only known because another component depends on them are not declared.
+	Declared bool
+}
+
+// Edge is a dependency between two components: From depends on To.
+type Edge struct {
+	From string
+	To   string
+	// Source is the file and line that declares the dependency.
+	Source string
+}
+
+// Graph is a directed acyclic graph of components and their dependencies.
+type Graph struct {
+	nodes        map[string]*Node
+	dependencies map[string]map[string]Edge
+	dependents   map[string]map[string]struct{}
+}
+
+// New creates an empty dependency graph.
+func New() *Graph {
+	return &Graph{
+		nodes:        map[string]*Node{},
+		dependencies: map[string]map[string]Edge{},
+		dependents:   map[string]map[string]struct{}{},
+	}
+}
+
+// AddNode adds a component to the graph. Adding an existing node updates it.
+func (g *Graph) AddNode(node *Node) {
+	if existing, ok := g.nodes[node.ID]; ok {
+		existing.Declared = existing.Declared || node.Declared
+		return
+	}
+
+	g.nodes[node.ID] = node
+	g.dependencies[node.ID] = map[string]Edge{}
+	g.dependents[node.ID] = map[string]struct{}{}
+}
+
+// AddEdge records that the component 'from' depends on the component 'to'. Both nodes must exist.
+func (g *Graph) AddEdge(edge Edge) error {
+	if _, ok := g.nodes[edge.From]; !ok {
+		return fmt.Errorf("cannot add dependency from unknown component %s", edge.From)
+	}
+
+	if _, ok := g.nodes[edge.To]; !ok {
+		return fmt.Errorf("cannot add dependency to unknown component %s", edge.To)
+	}
+
+	if edge.From == edge.To {
+		return fmt.Errorf("component %s depends on itself (%s)", edge.From, edge.Source)
+	}
+
+	g.dependencies[edge.From][edge.To] = edge
+	g.dependents[edge.To][edge.From] = struct{}{}
+
+	return nil
+}
+
+// Node returns the node with the given ID, if any.
+func (g *Graph) Node(id string) (*Node, bool) {
+	node, ok := g.nodes[id]
+	return node, ok
+}
+
+// Nodes returns every node in the graph, sorted by ID.
+func (g *Graph) Nodes() []*Node {
+	nodes := make([]*Node, 0, len(g.nodes))
+	for _, node := range g.nodes {
+		nodes = append(nodes, node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	return nodes
+}
+
+// Edges returns every dependency in the graph, sorted by their source and target IDs.
+func (g *Graph) Edges() []Edge {
+	var edges []Edge
+	for _, deps := range g.dependencies {
+		for _, edge := range deps {
+			edges = append(edges, edge)
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+
+	return edges
+}
+
+// Dependencies returns the IDs of the components the given component depends on, sorted.
+func (g *Graph) Dependencies(id string) []string {
+	return sortedKeys(g.dependencies[id])
+}
+
+// Dependents returns the IDs of the components that depend on the given component, sorted.
+func (g *Graph) Dependents(id string) []string {
+	return sortedKeys(g.dependents[id])
+}
+
+// TopologicalOrder returns the IDs of every node so that each component comes after all of its dependencies.
+// Ties are broken by ID, so the order is stable between runs.
+//
+// Returns:
+//   - The ordered node IDs
+//   - An error naming the components involved if the graph contains a cycle
+func (g *Graph) TopologicalOrder() ([]string, error) {
+	pending := map[string]int{}
+	var ready []string
+
+	for id := range g.nodes {
+		pending[id] = len(g.dependencies[id])
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	var order []string
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+
+		for dependent := range g.dependents[id] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) != len(g.nodes) {
+		var cyclic []string
+		for id, count := range pending {
+			if count > 0 {
+				cyclic = append(cyclic, id)
+			}
+		}
+		sort.Strings(cyclic)
+
+		return nil, fmt.Errorf("dependency cycle detected between components: %s", strings.Join(cyclic, ", "))
+	}
+
+	return order, nil
+}
+
+// Subgraph returns a graph made only of the given nodes. Dependencies that go through nodes left out
+// of the subgraph are preserved: if A depends on B, and B on C, the subgraph of A and C keeps A depending on C.
+func (g *Graph) Subgraph(ids []string) *Graph {
+	sub := New()
+	keep := map[string]bool{}
+
+	for _, id := range ids {
+		if node, ok := g.nodes[id]; ok {
+			sub.AddNode(node)
+			keep[id] = true
+		}
+	}
+
+	for id := range keep {
+		visited := map[string]bool{}
+		stack := g.Dependencies(id)
+		for len(stack) > 0 {
+			dep := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+
+			if keep[dep] {
+				edge, direct := g.dependencies[id][dep]
+				if !direct {
+					edge = Edge{From: id, To: dep, Source: "transitive"}
+				}
+				_ = sub.AddEdge(edge)
+				continue
+			}
+
+			stack = append(stack, g.Dependencies(dep)...)
+		}
+	}
+
+	return sub
+}
+
+// Scope returns the IDs of the declared components that belong to a stack, a layer and a component, sorted.
+// Empty names match everything.
+func (g *Graph) Scope(stackName, layerName, componentName string) []string {
+	var ids []string
+	for _, node := range g.Nodes() {
+		if !node.Declared {
+			continue
+		}
+		if stackName != "" && node.Stack != stackName {
+			continue
+		}
+		if layerName != "" && node.Layer != layerName {
+			continue
+		}
+		if componentName != "" && node.Component != componentName {
+			continue
+		}
+		ids = append(ids, node.ID)
+	}
+
+	return ids
+}
+
+// Build creates the dependency graph of every component declared in the environment configuration.
+//
+// The dependencies of each component are discovered from the 'dependency' and 'dependencies' blocks of its
+// terragrunt.hcl and component.hcl files, and of the files they include (e.g. shared component configurations).
+// Components that are depended on but not declared in the environment configuration are added to the graph
+// as undeclared nodes.
+//
+// Parameters:
+//   - envConfig: The compiled environment configuration.
+//   - terragruntDir: Absolute path to the Terragrunt directory (infra/terragrunt).
+//   - repoRoot: Absolute path to the root of the git repository.
+//
+// Returns:
+//   - The dependency graph
+//   - An error if a configuration cannot be parsed, a dependency cannot be resolved, or there is a cycle
+func Build(envConfig *cfg.EnvConfig, terragruntDir, repoRoot string) (*Graph, error) {
+	if envConfig == nil {
+		return nil, fmt.Errorf("environment configuration cannot be nil")
+	}
+
+	g := New()
+
+	for _, stack := range envConfig.Stacks {
+		for _, layer := range stack.Layers {
+			for _, component := range layer.Components {
+				g.AddNode(&Node{
+					ID:        strings.Join([]string{stack.Name, layer.Name, component.Name}, "/"),
+					Stack:     stack.Name,
+					Layer:     layer.Name,
+					Component: component.Name,
+					Dir:       filepath.Join(terragruntDir, stack.Name, layer.Name, component.Name),
+					Declared:  true,
+				})
+			}
+		}
+	}
+
+	for _, node := range g.Nodes() {
+		if !node.Declared {
+			continue
+		}
+
+		// Components missing on disk are kept in the graph without dependencies; reporting them is
+		// up to the stack validations.
+		if _, err := os.Stat(filepath.Join(node.Dir, TerragruntConfigFilename)); err != nil {
+			continue
+		}
+
+		deps, err := DiscoverDependencies(node.Dir, repoRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover the dependencies of component %s: %w", node.ID, err)
+		}
+
+		for _, dep := range deps {
+			depNode, err := nodeFromDir(dep.Dir, terragruntDir)
+			if err != nil {
+				return nil, fmt.Errorf("component %s has an invalid dependency (%s): %w", node.ID, dep.Source, err)
+			}
+
+			g.AddNode(depNode)
+			if err := g.AddEdge(Edge{From: node.ID, To: depNode.ID, Source: dep.Source}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if _, err := g.TopologicalOrder(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// nodeFromDir creates a node for a component directory, which must be a <stack>/<layer>/<component>
+// directory inside the Terragrunt directory.
+func nodeFromDir(dir, terragruntDir string) (*Node, error) {
+	rel, err := filepath.Rel(terragruntDir, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%s is outside of the Terragrunt directory %s", dir, terragruntDir)
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%s is not a <stack>/<layer>/<component> directory", rel)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, TerragruntConfigFilename)); err != nil {
+		return nil, fmt.Errorf("%s has no %s", rel, TerragruntConfigFilename)
+	}
+
+	return &Node{
+		ID:        strings.Join(parts, "/"),
+		Stack:     parts[0],
+		Layer:     parts[1],
+		Component: parts[2],
+		Dir:       dir,
+	}, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
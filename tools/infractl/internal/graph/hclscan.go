@@ -0,0 +1,390 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HCLAttribute is an attribute found while scanning an HCL body. The expression is kept as raw text,
+// it's only evaluated on demand, and only for the small subset of expressions infractl understands.
+type HCLAttribute struct {
+	Name string
+	Expr string
+	Line int
+}
+
+// HCLBlock is a block found while scanning an HCL body, e.g.: dependency "vpc" { ... }
+type HCLBlock struct {
+	Type   string
+	Labels []string
+	Body   *HCLBody
+	Line   int
+}
+
+// HCLBody holds the attributes and nested blocks of an HCL file or block.
+type HCLBody struct {
+	Attributes map[string]*HCLAttribute
+	Blocks     []*HCLBlock
+}
+
+// HCLFile is a scanned HCL file.
+type HCLFile struct {
+	Path string
+	Body *HCLBody
+}
+
+// BlocksOfType returns the blocks of the given type declared directly in the body.
+func (b *HCLBody) BlocksOfType(blockType string) []*HCLBlock {
+	var blocks []*HCLBlock
+	for _, block := range b.Blocks {
+		if block.Type == blockType {
+			blocks = append(blocks, block)
+		}
+	}
+
+	return blocks
+}
+
+// ParseHCLFile scans an HCL file into its structure of blocks and attributes.
+//
+// This is not a full HCL parser: it understands the structure of the file (blocks, labels, attributes,
+// strings, templates, heredocs and comments) without evaluating it, which is all infractl needs to
+// discover dependencies, includes and variables in Terragrunt and Terraform files.
+func ParseHCLFile(path string) (*HCLFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HCL file %s: %w", path, err)
+	}
+
+	return ParseHCL(path, content)
+}
+
+// ParseHCL scans HCL content. The filename is only used to report errors.
+func ParseHCL(filename string, content []byte) (*HCLFile, error) {
+	s := &hclScanner{src: content, line: 1, filename: filename}
+
+	body, err := s.scanBody(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HCLFile{Path: filename, Body: body}, nil
+}
+
+type hclScanner struct {
+	src      []byte
+	pos      int
+	line     int
+	filename string
+}
+
+func (s *hclScanner) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", s.filename, s.line, fmt.Sprintf(format, args...))
+}
+
+func (s *hclScanner) eof() bool {
+	return s.pos >= len(s.src)
+}
+
+func (s *hclScanner) peek() byte {
+	if s.eof() {
+		return 0
+	}
+	return s.src[s.pos]
+}
+
+func (s *hclScanner) peekAt(offset int) byte {
+	if s.pos+offset >= len(s.src) {
+		return 0
+	}
+	return s.src[s.pos+offset]
+}
+
+func (s *hclScanner) advance() byte {
+	c := s.src[s.pos]
+	s.pos++
+	if c == '\n' {
+		s.line++
+	}
+	return c
+}
+
+// skipSpace skips blanks and comments. Newlines are skipped too when skipNewlines is set.
+func (s *hclScanner) skipSpace(skipNewlines bool) error {
+	for !s.eof() {
+		c := s.peek()
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			s.advance()
+		case c == '\n' && skipNewlines:
+			s.advance()
+		case c == '#' || (c == '/' && s.peekAt(1) == '/'):
+			for !s.eof() && s.peek() != '\n' {
+				s.advance()
+			}
+		case c == '/' && s.peekAt(1) == '*':
+			s.advance()
+			s.advance()
+			for !s.eof() && !(s.peek() == '*' && s.peekAt(1) == '/') {
+				s.advance()
+			}
+			if s.eof() {
+				return s.errorf("unterminated block comment")
+			}
+			s.advance()
+			s.advance()
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '-' || (c >= '0' && c <= '9')
+}
+
+func (s *hclScanner) scanIdent() string {
+	start := s.pos
+	for !s.eof() && isIdentChar(s.peek()) {
+		s.advance()
+	}
+	return string(s.src[start:s.pos])
+}
+
+// scanBody scans attributes and blocks until the end of the input, or until the closing brace of the
+// enclosing block when nested is set.
+func (s *hclScanner) scanBody(nested bool) (*HCLBody, error) {
+	body := &HCLBody{Attributes: map[string]*HCLAttribute{}}
+
+	for {
+		if err := s.skipSpace(true); err != nil {
+			return nil, err
+		}
+
+		if s.eof() {
+			if nested {
+				return nil, s.errorf("unexpected end of file, missing '}'")
+			}
+			return body, nil
+		}
+
+		if s.peek() == '}' {
+			if !nested {
+				return nil, s.errorf("unexpected '}'")
+			}
+			s.advance()
+			return body, nil
+		}
+
+		if !isIdentStart(s.peek()) {
+			return nil, s.errorf("unexpected character %q, expected an attribute or a block", s.peek())
+		}
+
+		line := s.line
+		name := s.scanIdent()
+
+		if err := s.skipSpace(false); err != nil {
+			return nil, err
+		}
+
+		// Attribute: name = expression
+		if s.peek() == '=' && s.peekAt(1) != '=' {
+			s.advance()
+			expr, err := s.scanExpression()
+			if err != nil {
+				return nil, err
+			}
+			body.Attributes[name] = &HCLAttribute{Name: name, Expr: expr, Line: line}
+			continue
+		}
+
+		// Block: type "label" label { ... }
+		block := &HCLBlock{Type: name, Line: line}
+		for {
+			if err := s.skipSpace(false); err != nil {
+				return nil, err
+			}
+
+			c := s.peek()
+			if c == '{' {
+				s.advance()
+				break
+			}
+
+			switch {
+			case c == '"':
+				raw, err := s.scanQuoted()
+				if err != nil {
+					return nil, err
+				}
+				label, err := strconv.Unquote(raw)
+				if err != nil {
+					return nil, s.errorf("invalid label %s: %v", raw, err)
+				}
+				block.Labels = append(block.Labels, label)
+			case isIdentStart(c):
+				block.Labels = append(block.Labels, s.scanIdent())
+			default:
+				return nil, s.errorf("unexpected character %q after %q, expected '=' or '{'", c, name)
+			}
+		}
+
+		nestedBody, err := s.scanBody(true)
+		if err != nil {
+			return nil, err
+		}
+		block.Body = nestedBody
+		body.Blocks = append(body.Blocks, block)
+	}
+}
+
+// scanExpression consumes an expression up to the end of its line, honouring brackets, strings and heredocs
+// that span several lines. A closing brace at depth zero ends the expression without being consumed, to
+// support one-line blocks such as: foo { bar = 1 }
+func (s *hclScanner) scanExpression() (string, error) {
+	start := s.pos
+	depth := 0
+
+	for !s.eof() {
+		c := s.peek()
+		switch {
+		case c == '"':
+			if _, err := s.scanQuoted(); err != nil {
+				return "", err
+			}
+			continue
+		case c == '<' && s.peekAt(1) == '<' && (isIdentStart(s.peekAt(2)) || s.peekAt(2) == '-'):
+			if err := s.scanHeredoc(); err != nil {
+				return "", err
+			}
+			continue
+		case c == '#' || (c == '/' && (s.peekAt(1) == '/' || s.peekAt(1) == '*')):
+			// A line comment after the expression ends it; the newline is consumed by the body scanner.
+			lineComment := c == '#' || s.peekAt(1) == '/'
+			if lineComment && depth == 0 {
+				return strings.TrimSpace(string(s.src[start:s.pos])), nil
+			}
+			if err := s.skipSpace(false); err != nil {
+				return "", err
+			}
+			continue
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			if depth == 0 {
+				return strings.TrimSpace(string(s.src[start:s.pos])), nil
+			}
+			depth--
+		case c == '\n' && depth == 0:
+			expr := strings.TrimSpace(string(s.src[start:s.pos]))
+			s.advance()
+			return expr, nil
+		}
+		s.advance()
+	}
+
+	if depth != 0 {
+		return "", s.errorf("unexpected end of file in expression")
+	}
+
+	return strings.TrimSpace(string(s.src[start:s.pos])), nil
+}
+
+// scanQuoted consumes a quoted string, including nested template interpolations, and returns its raw text.
+func (s *hclScanner) scanQuoted() (string, error) {
+	start := s.pos
+	s.advance() // opening quote
+
+	for !s.eof() {
+		c := s.peek()
+		switch {
+		case c == '\\':
+			s.advance()
+			if !s.eof() {
+				s.advance()
+			}
+			continue
+		case c == '"':
+			s.advance()
+			return string(s.src[start:s.pos]), nil
+		case (c == '$' || c == '%') && s.peekAt(1) == '{':
+			s.advance()
+			s.advance()
+			if err := s.scanTemplateSequence(); err != nil {
+				return "", err
+			}
+			continue
+		case c == '\n':
+			return "", s.errorf("unterminated string")
+		}
+		s.advance()
+	}
+
+	return "", s.errorf("unterminated string")
+}
+
+// scanTemplateSequence consumes the content of a ${ ... } or %{ ... } sequence, up to its closing brace.
+func (s *hclScanner) scanTemplateSequence() error {
+	depth := 0
+	for !s.eof() {
+		c := s.peek()
+		switch c {
+		case '"':
+			if _, err := s.scanQuoted(); err != nil {
+				return err
+			}
+			continue
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				s.advance()
+				return nil
+			}
+			depth--
+		}
+		s.advance()
+	}
+
+	return s.errorf("unterminated template sequence")
+}
+
+// scanHeredoc consumes a heredoc (<<EOT or <<-EOT), up to the line holding its closing marker.
+func (s *hclScanner) scanHeredoc() error {
+	s.advance()
+	s.advance()
+	if s.peek() == '-' {
+		s.advance()
+	}
+
+	marker := s.scanIdent()
+	if marker == "" {
+		return s.errorf("invalid heredoc marker")
+	}
+
+	// Skip the rest of the opening line
+	for !s.eof() && s.peek() != '\n' {
+		s.advance()
+	}
+
+	for !s.eof() {
+		s.advance() // newline
+		lineStart := s.pos
+		for !s.eof() && s.peek() != '\n' {
+			s.advance()
+		}
+		if strings.TrimSpace(string(s.src[lineStart:s.pos])) == marker {
+			return nil
+		}
+	}
+
+	return s.errorf("unterminated heredoc %s", marker)
+}
@@ -0,0 +1,158 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// describeBody renders a scanned body on one line, e.g.: a@1=1 block["x"]@2{b@3=2}
+func describeBody(body *HCLBody) string {
+	var parts []string
+
+	names := make([]string, 0, len(body.Attributes))
+	for name := range body.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		attribute := body.Attributes[name]
+		parts = append(parts, fmt.Sprintf("%s@%d=%s", attribute.Name, attribute.Line, attribute.Expr))
+	}
+
+	for _, block := range body.Blocks {
+		parts = append(parts, fmt.Sprintf("%s%q@%d{%s}", block.Type, block.Labels, block.Line, describeBody(block.Body)))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func TestParseHCL(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "empty",
+			content: "\n\n",
+			want:    "",
+		},
+		{
+			name: "terragrunt configuration",
+			content: `include "root" {
+  path = find_in_parent_folders("root.hcl")
+}
+
+terraform {
+  source = "${get_repo_root()}/infra/terraform/modules/dynamodb-table"
+}
+
+dependency "ids" {
+  config_path = "../id-generator"
+  mock_outputs = {
+    id = "mock"
+  }
+}
+`,
+			want: `include["root"]@1{path@2=find_in_parent_folders("root.hcl")} ` +
+				`terraform[]@5{source@6="${get_repo_root()}/infra/terraform/modules/dynamodb-table"} ` +
+				`dependency["ids"]@9{config_path@10="../id-generator" mock_outputs@11={
+    id = "mock"
+  }}`,
+		},
+		{
+			name:    "identifier labels",
+			content: "variable table_name {\n  type = string\n}\nresource \"aws_dynamodb_table\" this {}\n",
+			want:    `variable["table_name"]@1{type@2=string} resource["aws_dynamodb_table" "this"]@4{}`,
+		},
+		{
+			name:    "one-line blocks",
+			content: "locals { a = 1 }\nnested { inner { b = [1, 2] } }\n",
+			want:    `locals[]@1{a@1=1} nested[]@2{inner[]@2{b@2=[1, 2]}}`,
+		},
+		{
+			name:    "expressions spanning lines",
+			content: "paths = [\n  \"../a\",\n  \"../b\",\n]\nafter = (\n  1 +\n  2\n)\n",
+			want:    "after@5=(\n  1 +\n  2\n) paths@1=[\n  \"../a\",\n  \"../b\",\n]",
+		},
+		{
+			name:    "templates",
+			content: `a = "${format("%s}", "{")}-${local.b}-%{ if true }x%{ endif }"` + "\nb = \"escaped \\\" quote {\"\n",
+			want:    `a@1="${format("%s}", "{")}-${local.b}-%{ if true }x%{ endif }" b@2="escaped \" quote {"`,
+		},
+		{
+			name:    "heredocs",
+			content: "a = <<EOT\n{ \"unbalanced\n[\nEOT\nb = <<-EOT\n    indented }\n    EOT\nc = 1\n",
+			want:    "a@1=<<EOT\n{ \"unbalanced\n[\nEOT b@5=<<-EOT\n    indented }\n    EOT c@8=1",
+		},
+		{
+			name: "comments",
+			content: `# a comment with { braces
+// another "comment
+/* a block
+   comment } */
+a = 1 # trailing
+b = [ # inside a list
+  1, /* inline */ 2,
+]
+c = 2 // trailing
+block /* before the brace */ {
+  d = 3
+}
+`,
+			want: "a@5=1 b@6=[ # inside a list\n  1, /* inline */ 2,\n] c@9=2 block[]@10{d@11=3}",
+		},
+		{
+			name:    "comparison operators",
+			content: "a = 1 == 1\nb = 1 >= 2 ? \"x\" : \"y\"\n",
+			want:    `a@1=1 == 1 b@2=1 >= 2 ? "x" : "y"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := ParseHCL("test.hcl", []byte(tt.content))
+			if err != nil {
+				t.Fatalf("ParseHCL() unexpected error: %v", err)
+			}
+
+			if got := describeBody(file.Body); got != tt.want {
+				t.Errorf("ParseHCL() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHCLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "missing closing brace", content: "block {\n  a = 1\n", wantErr: "test.hcl:3: unexpected end of file, missing '}'"},
+		{name: "stray closing brace", content: "a = 1\n}\n", wantErr: "test.hcl:2: unexpected '}'"},
+		{name: "no name", content: "= 1\n", wantErr: "test.hcl:1: unexpected character '=', expected an attribute or a block"},
+		{name: "no value", content: "a\n", wantErr: "unexpected character '\\n' after \"a\", expected '=' or '{'"},
+		{name: "invalid label", content: "block 1 {}\n", wantErr: "unexpected character '1' after \"block\""},
+		{name: "invalid quoted label", content: "block \"\\q\" {}\n", wantErr: "invalid label \"\\q\""},
+		{name: "unterminated string", content: "a = \"abc\nb = 1\n", wantErr: "test.hcl:1: unterminated string"},
+		{name: "unterminated string at the end of file", content: "a = \"abc", wantErr: "unterminated string"},
+		{name: "unterminated template", content: "a = \"${local.b\n", wantErr: "unterminated"},
+		{name: "unterminated heredoc", content: "a = <<EOT\nline\n", wantErr: "unterminated heredoc EOT"},
+		{name: "heredoc without marker", content: "a = <<-\n", wantErr: "invalid heredoc marker"},
+		{name: "unterminated block comment", content: "/* never closed\na = 1\n", wantErr: "unterminated block comment"},
+		{name: "unbalanced brackets", content: "a = [1,\n  2\n", wantErr: "test.hcl:3: unexpected end of file in expression"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseHCL("test.hcl", []byte(tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseHCL() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// FormatDOT renders the graph as Graphviz DOT.
+	FormatDOT = "dot"
+	// FormatMermaid renders the graph as a Mermaid flowchart.
+	FormatMermaid = "mermaid"
+	// FormatJSON renders the graph as JSON.
+	FormatJSON = "json"
+)
+
+// RenderOptions controls how a graph is rendered.
+type RenderOptions struct {
+	// Invalid maps the IDs of components that failed validation to the reason; they're highlighted.
+	Invalid map[string]string
+	// BaseDir, if set, makes the directories and sources in the output relative to it.
+	BaseDir string
+}
+
+// Render renders the graph in the given format: dot, mermaid or json.
+func Render(g *Graph, format string, opts RenderOptions) (string, error) {
+	switch format {
+	case FormatDOT:
+		return RenderDOT(g, opts), nil
+	case FormatMermaid:
+		return RenderMermaid(g, opts), nil
+	case FormatJSON:
+		return RenderJSON(g, opts)
+	default:
+		return "", fmt.Errorf("unsupported graph format '%s', expected one of: %s, %s, %s", format, FormatDOT, FormatMermaid, FormatJSON)
+	}
+}
+
+// groupedNodes groups the nodes of a graph by stack and layer, every level sorted by name.
+func groupedNodes(g *Graph) (stacks []string, layers map[string][]string, nodes map[string][]*Node) {
+	layers = map[string][]string{}
+	nodes = map[string][]*Node{}
+
+	for _, node := range g.Nodes() {
+		layerKey := node.Stack + "/" + node.Layer
+		if _, ok := layers[node.Stack]; !ok {
+			stacks = append(stacks, node.Stack)
+		}
+		if _, ok := nodes[layerKey]; !ok {
+			layers[node.Stack] = append(layers[node.Stack], node.Layer)
+		}
+		nodes[layerKey] = append(nodes[layerKey], node)
+	}
+
+	sort.Strings(stacks)
+	for _, stackLayers := range layers {
+		sort.Strings(stackLayers)
+	}
+
+	return stacks, layers, nodes
+}
+
+// RenderDOT renders the graph as Graphviz DOT, with a cluster per stack and layer. Edges point from a
+// component to the components it depends on. Invalid components are filled in red, and components that
+// are not declared in the environment configuration are dashed.
+func RenderDOT(g *Graph, opts RenderOptions) string {
+	var sb strings.Builder
+	stacks, layers, nodes := groupedNodes(g)
+
+	sb.WriteString("digraph infractl {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, style=rounded];\n")
+
+	for _, stack := range stacks {
+		fmt.Fprintf(&sb, "  subgraph %q {\n", "cluster_"+stack)
+		fmt.Fprintf(&sb, "    label=%q;\n", "stack: "+stack)
+
+		for _, layer := range layers[stack] {
+			fmt.Fprintf(&sb, "    subgraph %q {\n", "cluster_"+stack+"_"+layer)
+			fmt.Fprintf(&sb, "      label=%q;\n", "layer: "+layer)
+
+			for _, node := range nodes[stack+"/"+layer] {
+				attrs := []string{fmt.Sprintf("label=%q", node.Component)}
+				styles := []string{"rounded"}
+				if !node.Declared {
+					styles = append(styles, "dashed")
+				}
+				if reason, ok := opts.Invalid[node.ID]; ok {
+					styles = append(styles, "filled")
+					attrs = append(attrs, `fillcolor="#f8d7da"`, `color="#c0392b"`, fmt.Sprintf("tooltip=%q", reason))
+				}
+				if len(styles) > 1 {
+					attrs = append(attrs, fmt.Sprintf("style=%q", strings.Join(styles, ",")))
+				}
+				fmt.Fprintf(&sb, "      %q [%s];\n", node.ID, strings.Join(attrs, ", "))
+			}
+
+			sb.WriteString("    }\n")
+		}
+
+		sb.WriteString("  }\n")
+	}
+
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(&sb, "  %q -> %q;\n", edge.From, edge.To)
+	}
+
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// RenderMermaid renders the graph as a Mermaid flowchart, with a subgraph per stack and layer. Edges point
+// from a component to the components it depends on. Invalid components use the 'invalid' class, and
+// components that are not declared in the environment configuration the 'undeclared' class.
+func RenderMermaid(g *Graph, opts RenderOptions) string {
+	var sb strings.Builder
+	stacks, layers, nodes := groupedNodes(g)
+
+	// Mermaid identifiers cannot hold slashes or dashes, so every node gets a positional identifier.
+	ids := map[string]string{}
+	for i, node := range g.Nodes() {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+	}
+
+	sb.WriteString("flowchart LR\n")
+
+	var invalid, undeclared []string
+	for i, stack := range stacks {
+		fmt.Fprintf(&sb, "  subgraph s%d[\"stack: %s\"]\n", i, stack)
+
+		for j, layer := range layers[stack] {
+			fmt.Fprintf(&sb, "    subgraph s%dl%d[\"layer: %s\"]\n", i, j, layer)
+
+			for _, node := range nodes[stack+"/"+layer] {
+				fmt.Fprintf(&sb, "      %s[\"%s\"]\n", ids[node.ID], node.Component)
+				if _, ok := opts.Invalid[node.ID]; ok {
+					invalid = append(invalid, ids[node.ID])
+				}
+				if !node.Declared {
+					undeclared = append(undeclared, ids[node.ID])
+				}
+			}
+
+			sb.WriteString("    end\n")
+		}
+
+		sb.WriteString("  end\n")
+	}
+
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(&sb, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+	}
+
+	if len(invalid) > 0 {
+		sb.WriteString("  classDef invalid fill:#f8d7da,stroke:#c0392b,color:#c0392b\n")
+		fmt.Fprintf(&sb, "  class %s invalid\n", strings.Join(invalid, ","))
+	}
+
+	if len(undeclared) > 0 {
+		sb.WriteString("  classDef undeclared stroke-dasharray:5 5\n")
+		fmt.Fprintf(&sb, "  class %s undeclared\n", strings.Join(undeclared, ","))
+	}
+
+	return sb.String()
+}
+
+type jsonNode struct {
+	ID              string   `json:"id"`
+	Stack           string   `json:"stack"`
+	Layer           string   `json:"layer"`
+	Component       string   `json:"component"`
+	Dir             string   `json:"dir"`
+	Declared        bool     `json:"declared"`
+	Valid           bool     `json:"valid"`
+	ValidationError string   `json:"validation_error,omitempty"`
+	DependsOn       []string `json:"depends_on"`
+}
+
+type jsonEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Source string `json:"source"`
+}
+
+type jsonGraph struct {
+	Nodes []jsonNode `json:"nodes"`
+	Edges []jsonEdge `json:"edges"`
+}
+
+// RenderJSON renders the graph as JSON: a list of nodes, each with the components it depends on, and a list
+// of edges with the file and line that declares them.
+func RenderJSON(g *Graph, opts RenderOptions) (string, error) {
+	out := jsonGraph{Nodes: []jsonNode{}, Edges: []jsonEdge{}}
+
+	for _, node := range g.Nodes() {
+		reason, invalid := opts.Invalid[node.ID]
+		out.Nodes = append(out.Nodes, jsonNode{
+			ID:              node.ID,
+			Stack:           node.Stack,
+			Layer:           node.Layer,
+			Component:       node.Component,
+			Dir:             relativeTo(opts.BaseDir, node.Dir),
+			Declared:        node.Declared,
+			Valid:           !invalid,
+			ValidationError: reason,
+			DependsOn:       append([]string{}, g.Dependencies(node.ID)...),
+		})
+	}
+
+	for _, edge := range g.Edges() {
+		out.Edges = append(out.Edges, jsonEdge{From: edge.From, To: edge.To, Source: relativeTo(opts.BaseDir, edge.Source)})
+	}
+
+	content, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal the dependency graph to JSON: %w", err)
+	}
+
+	return string(content) + "\n", nil
+}
+
+// relativeTo makes a path relative to the base directory, when there's one and the path is inside it.
+func relativeTo(baseDir, path string) string {
+	if baseDir == "" || !filepath.IsAbs(path) {
+		return path
+	}
+
+	rel, err := filepath.Rel(baseDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return rel
+}
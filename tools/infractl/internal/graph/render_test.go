@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderDOTNodeStyles(t *testing.T) {
+	g := New()
+	for _, node := range []*Node{
+		{ID: "s/l/declared", Stack: "s", Layer: "l", Component: "declared", Declared: true},
+		{ID: "s/l/undeclared", Stack: "s", Layer: "l", Component: "undeclared"},
+		{ID: "s/l/invalid", Stack: "s", Layer: "l", Component: "invalid", Declared: true},
+		{ID: "s/l/both", Stack: "s", Layer: "l", Component: "both"},
+	} {
+		g.AddNode(node)
+	}
+
+	dot := RenderDOT(g, RenderOptions{Invalid: map[string]string{
+		"s/l/invalid": "missing component.hcl",
+		"s/l/both":    "missing directory",
+	}})
+
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{id: "s/l/declared", want: `"s/l/declared" [label="declared"];`},
+		{id: "s/l/undeclared", want: `"s/l/undeclared" [label="undeclared", style="rounded,dashed"];`},
+		{id: "s/l/invalid", want: `"s/l/invalid" [label="invalid", fillcolor="#f8d7da", color="#c0392b", tooltip="missing component.hcl", style="rounded,filled"];`},
+		{id: "s/l/both", want: `"s/l/both" [label="both", fillcolor="#f8d7da", color="#c0392b", tooltip="missing directory", style="rounded,dashed,filled"];`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if !strings.Contains(dot, tt.want) {
+				t.Errorf("RenderDOT() lacks %s:\n%s", tt.want, dot)
+			}
+			if count := strings.Count(dot, `"`+tt.id+`" [`); count != 1 {
+				t.Errorf("RenderDOT() declares %s %d times, want once", tt.id, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeStatus is the state of a component in a graph run.
+type NodeStatus string
+
+const (
+	StatusPending   NodeStatus = "pending"
+	StatusSucceeded NodeStatus = "succeeded"
+	StatusFailed    NodeStatus = "failed"
+	// StatusSkipped marks components that were not run because one of their dependencies failed, or because
+	// the run was interrupted before they started.
+	StatusSkipped NodeStatus = "skipped"
+)
+
+// NodeResult is the outcome of running a command on a component.
+type NodeResult struct {
+	ID       string
+	Status   NodeStatus
+	Err      error
+	Duration time.Duration
+	// Resumed reports that the component was not run because it succeeded in the run being resumed.
+	Resumed bool
+}
+
+// RunFunc runs a command on a single component.
+type RunFunc func(node *Node) error
+
+// Scheduler runs a command on every component of a graph, respecting their dependencies.
+//
+// Components run as soon as all of their dependencies succeeded, with at most Concurrency components running
+// at the same time. When a component fails, every component that (transitively) depends on it is skipped,
+// while unrelated branches of the graph keep running. Once the context of the run is done, no other component
+// is started: the ones left are skipped.
+type Scheduler struct {
+	// Concurrency is the maximum number of components running at once. Values below 1 mean 1.
+	Concurrency int
+	// Reverse runs dependents before their dependencies, as needed by destroy.
+	Reverse bool
+	// Completed holds the IDs of components that already succeeded in a previous run; they're not run again.
+	Completed map[string]bool
+	// OnStart, if set, is called before a component runs.
+	OnStart func(node *Node)
+	// OnFinish, if set, is called once the outcome of a component is known, including skipped components.
+	OnFinish func(result NodeResult)
+}
+
+// Run runs the given function on every node of the graph, until the context is done.
+//
+// Returns:
+//   - The result of every node, in execution order (topological, or reverse topological)
+//   - An error listing the failed and skipped components, if any, or the cause of the interruption
+func (s *Scheduler) Run(ctx context.Context, g *Graph, run RunFunc) ([]NodeResult, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	// 'before' holds what must complete before a node can run; 'after' what's waiting on it.
+	before, after := g.Dependencies, g.Dependents
+	if s.Reverse {
+		before, after = g.Dependents, g.Dependencies
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	}
+
+	position := map[string]int{}
+	for i, id := range order {
+		position[id] = i
+	}
+
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := map[string]NodeResult{}
+	pending := map[string]int{}
+	var ready []string
+
+	finish := func(result NodeResult) {
+		results[result.ID] = result
+		if s.OnFinish != nil {
+			s.OnFinish(result)
+		}
+	}
+
+	var skip func(id, cause string)
+	skip = func(id, cause string) {
+		for _, next := range after(id) {
+			if _, done := results[next]; done {
+				continue
+			}
+			finish(NodeResult{ID: next, Status: StatusSkipped, Err: fmt.Errorf("dependency %s did not succeed", cause)})
+			skip(next, cause)
+		}
+	}
+
+	var complete func(id string)
+	complete = func(id string) {
+		for _, next := range after(id) {
+			pending[next]--
+			if pending[next] == 0 {
+				if _, done := results[next]; !done {
+					ready = append(ready, next)
+				}
+			}
+		}
+	}
+
+	for _, id := range order {
+		pending[id] = len(before(id))
+	}
+
+	for _, id := range order {
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	type outcome struct {
+		id       string
+		err      error
+		duration time.Duration
+	}
+	outcomes := make(chan outcome)
+	running := 0
+
+	for len(ready) > 0 || running > 0 {
+		sort.Slice(ready, func(i, j int) bool { return position[ready[i]] < position[ready[j]] })
+
+		for len(ready) > 0 && running < concurrency {
+			id := ready[0]
+			ready = ready[1:]
+
+			if ctx.Err() != nil && !s.Completed[id] {
+				finish(NodeResult{ID: id, Status: StatusSkipped, Err: fmt.Errorf("not run: %w", context.Cause(ctx))})
+				skip(id, id)
+				continue
+			}
+
+			if s.Completed[id] {
+				finish(NodeResult{ID: id, Status: StatusSucceeded, Resumed: true})
+				complete(id)
+				continue
+			}
+
+			node, _ := g.Node(id)
+			if s.OnStart != nil {
+				s.OnStart(node)
+			}
+
+			running++
+			go func() {
+				start := time.Now()
+				err := run(node)
+				outcomes <- outcome{id: id, err: err, duration: time.Since(start)}
+			}()
+		}
+
+		if running == 0 {
+			continue
+		}
+
+		out := <-outcomes
+		running--
+
+		if out.err != nil {
+			finish(NodeResult{ID: out.id, Status: StatusFailed, Err: out.err, Duration: out.duration})
+			skip(out.id, out.id)
+			continue
+		}
+
+		finish(NodeResult{ID: out.id, Status: StatusSucceeded, Duration: out.duration})
+		complete(out.id)
+	}
+
+	ordered := make([]NodeResult, 0, len(order))
+	var failed, skipped []string
+
+	for _, id := range order {
+		result := results[id]
+		ordered = append(ordered, result)
+
+		switch result.Status {
+		case StatusFailed:
+			failed = append(failed, id)
+		case StatusSkipped:
+			skipped = append(skipped, id)
+		}
+	}
+
+	if len(failed) > 0 || len(skipped) > 0 {
+		var parts []string
+		if ctx.Err() != nil {
+			parts = append(parts, context.Cause(ctx).Error())
+		}
+		if len(failed) > 0 {
+			parts = append(parts, fmt.Sprintf("%d component(s) failed: %s", len(failed), strings.Join(failed, ", ")))
+		}
+		if len(skipped) > 0 {
+			parts = append(parts, fmt.Sprintf("%d component(s) skipped: %s", len(skipped), strings.Join(skipped, ", ")))
+		}
+		return ordered, fmt.Errorf("%s", strings.Join(parts, "; "))
+	}
+
+	return ordered, nil
+}
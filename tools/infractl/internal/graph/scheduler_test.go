@@ -0,0 +1,244 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestGraph creates a graph where c depends on b, b depends on a, and d depends on nothing.
+func newTestGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	g := New()
+	for _, id := range []string{"a", "b", "c", "d"} {
+		g.AddNode(&Node{ID: id, Declared: true})
+	}
+	for _, edge := range []Edge{{From: "b", To: "a"}, {From: "c", To: "b"}} {
+		if err := g.AddEdge(edge); err != nil {
+			t.Fatalf("AddEdge() unexpected error: %v", err)
+		}
+	}
+
+	return g
+}
+
+// recorder records the nodes a scheduler ran, and fails the ones listed in failing.
+type recorder struct {
+	mu      sync.Mutex
+	ran     []string
+	failing map[string]bool
+}
+
+func (r *recorder) run(node *Node) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ran = append(r.ran, node.ID)
+	if r.failing[node.ID] {
+		return fmt.Errorf("%s failed", node.ID)
+	}
+
+	return nil
+}
+
+func (r *recorder) order() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return strings.Join(r.ran, ",")
+}
+
+// describeResults renders results as id:status, marking resumed components with a '*'.
+func describeResults(results []NodeResult) string {
+	parts := make([]string, 0, len(results))
+	for _, result := range results {
+		part := result.ID + ":" + string(result.Status)
+		if result.Resumed {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func TestSchedulerRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		scheduler   Scheduler
+		failing     map[string]bool
+		wantRan     string
+		wantResults string
+		wantErr     string
+	}{
+		{
+			name:        "dependencies first",
+			wantRan:     "a,b,c,d",
+			wantResults: "a:succeeded,b:succeeded,c:succeeded,d:succeeded",
+		},
+		{
+			name:        "dependents first when reversed",
+			scheduler:   Scheduler{Reverse: true},
+			wantRan:     "d,c,b,a",
+			wantResults: "d:succeeded,c:succeeded,b:succeeded,a:succeeded",
+		},
+		{
+			name:        "failures skip dependents",
+			failing:     map[string]bool{"a": true},
+			wantRan:     "a,d",
+			wantResults: "a:failed,b:skipped,c:skipped,d:succeeded",
+			wantErr:     "1 component(s) failed: a; 2 component(s) skipped: b, c",
+		},
+		{
+			name:        "failures skip dependencies when reversed",
+			scheduler:   Scheduler{Reverse: true},
+			failing:     map[string]bool{"c": true},
+			wantRan:     "d,c",
+			wantResults: "d:succeeded,c:failed,b:skipped,a:skipped",
+			wantErr:     "1 component(s) failed: c; 2 component(s) skipped: b, a",
+		},
+		{
+			name:        "completed components are not run again",
+			scheduler:   Scheduler{Completed: map[string]bool{"a": true, "b": true}},
+			wantRan:     "d,c",
+			wantResults: "a:succeeded*,b:succeeded*,c:succeeded,d:succeeded",
+		},
+		{
+			name:        "completed components are not run again when reversed",
+			scheduler:   Scheduler{Reverse: true, Completed: map[string]bool{"c": true, "d": true}},
+			wantRan:     "b,a",
+			wantResults: "d:succeeded*,c:succeeded*,b:succeeded,a:succeeded",
+		},
+		{
+			name:        "resumed failures",
+			scheduler:   Scheduler{Completed: map[string]bool{"a": true}},
+			failing:     map[string]bool{"b": true},
+			wantRan:     "d,b",
+			wantResults: "a:succeeded*,b:failed,c:skipped,d:succeeded",
+			wantErr:     "1 component(s) failed: b; 1 component(s) skipped: c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{failing: tt.failing}
+
+			var finished []string
+			var started []string
+			scheduler := tt.scheduler
+			scheduler.OnStart = func(node *Node) { started = append(started, node.ID) }
+			scheduler.OnFinish = func(result NodeResult) { finished = append(finished, result.ID) }
+
+			results, err := scheduler.Run(context.Background(), newTestGraph(t), r.run)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Run() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Run() unexpected error: %v", err)
+			}
+
+			if got := r.order(); got != tt.wantRan {
+				t.Errorf("Run() ran %s, want %s", got, tt.wantRan)
+			}
+			if got := strings.Join(started, ","); got != tt.wantRan {
+				t.Errorf("OnStart() called for %s, want %s", got, tt.wantRan)
+			}
+			if got := describeResults(results); got != tt.wantResults {
+				t.Errorf("Run() results = %s, want %s", got, tt.wantResults)
+			}
+			if len(finished) != len(results) {
+				t.Errorf("OnFinish() called for %v, want every component", finished)
+			}
+
+			for _, result := range results {
+				if result.Status == StatusSkipped && (result.Err == nil || !strings.Contains(result.Err.Error(), "did not succeed")) {
+					t.Errorf("skipped %s with error %v, want the dependency that did not succeed", result.ID, result.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestSchedulerRunConcurrency(t *testing.T) {
+	// a and d are independent: with a concurrency of 2, each waits for the other to start.
+	started := map[string]chan struct{}{"a": make(chan struct{}), "d": make(chan struct{})}
+	run := func(node *Node) error {
+		other := map[string]string{"a": "d", "d": "a"}[node.ID]
+		if other == "" {
+			return nil
+		}
+
+		close(started[node.ID])
+		select {
+		case <-started[other]:
+			return nil
+		case <-time.After(10 * time.Second):
+			return fmt.Errorf("%s never started", other)
+		}
+	}
+
+	scheduler := Scheduler{Concurrency: 2}
+	results, err := scheduler.Run(context.Background(), newTestGraph(t), run)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if got := describeResults(results); got != "a:succeeded,b:succeeded,c:succeeded,d:succeeded" {
+		t.Errorf("Run() results = %s", got)
+	}
+}
+
+func TestSchedulerRunCancellation(t *testing.T) {
+	interrupted := errors.New("interrupted by SIGINT")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	// The run is interrupted while a runs: a completes, nothing else starts.
+	r := &recorder{}
+	run := func(node *Node) error {
+		if node.ID == "a" {
+			cancel(interrupted)
+		}
+		return r.run(node)
+	}
+
+	scheduler := Scheduler{Completed: map[string]bool{"d": true}}
+	results, err := scheduler.Run(ctx, newTestGraph(t), run)
+	if err == nil || err.Error() != "interrupted by SIGINT; 2 component(s) skipped: b, c" {
+		t.Fatalf("Run() error = %v, want the interruption and the skipped components", err)
+	}
+
+	if got := r.order(); got != "a" {
+		t.Errorf("Run() ran %s, want only a", got)
+	}
+	if got := describeResults(results); got != "a:succeeded,b:skipped,c:skipped,d:succeeded*" {
+		t.Errorf("Run() results = %s", got)
+	}
+
+	for _, result := range results {
+		if result.ID == "b" && !errors.Is(result.Err, interrupted) {
+			t.Errorf("b skipped with error %v, want the cause of the interruption", result.Err)
+		}
+	}
+}
+
+func TestSchedulerRunCycle(t *testing.T) {
+	g := newTestGraph(t)
+	if err := g.AddEdge(Edge{From: "a", To: "c"}); err != nil {
+		t.Fatalf("AddEdge() unexpected error: %v", err)
+	}
+
+	r := &recorder{}
+	_, err := (&Scheduler{}).Run(context.Background(), g, r.run)
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle detected between components: a, b, c") {
+		t.Fatalf("Run() error = %v, want the cycle reported", err)
+	}
+	if got := r.order(); got != "" {
+		t.Errorf("Run() ran %s, want nothing", got)
+	}
+}
@@ -0,0 +1,116 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+)
+
+// TerraformVariable is a 'variable' block of a Terraform module.
+type TerraformVariable struct {
+	Name string
+	// Type is the raw type constraint, e.g. map(string); empty when the variable accepts any value.
+	Type string
+	// Required reports whether the variable has no default.
+	Required bool
+	// Source is where the variable is declared, as <file>:<line>
+	Source string
+}
+
+// ParseTerraformVariables reads the 'variable' blocks declared in the .tf files of a Terraform module.
+//
+// Parameters:
+//   - moduleDir: Absolute path to the Terraform module directory.
+//
+// Returns:
+//   - The variables of the module, sorted by name.
+//   - An error if the directory cannot be read, or a file cannot be parsed.
+func ParseTerraformVariables(moduleDir string) ([]TerraformVariable, error) {
+	files, err := filepath.Glob(filepath.Join(moduleDir, "*.tf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the Terraform files of %s: %w", moduleDir, err)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Terraform files found in %s", moduleDir)
+	}
+
+	var variables []TerraformVariable
+	for _, path := range files {
+		file, err := ParseHCLFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, block := range file.Body.BlocksOfType("variable") {
+			if len(block.Labels) == 0 {
+				return nil, fmt.Errorf("%s:%d: variable block without a name", path, block.Line)
+			}
+
+			variable := TerraformVariable{
+				Name:   block.Labels[0],
+				Source: fmt.Sprintf("%s:%d", path, block.Line),
+			}
+			if typeAttr, ok := block.Body.Attributes["type"]; ok {
+				variable.Type = strings.TrimSpace(typeAttr.Expr)
+			}
+			_, hasDefault := block.Body.Attributes["default"]
+			variable.Required = !hasDefault
+
+			variables = append(variables, variable)
+		}
+	}
+
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+
+	return variables, nil
+}
+
+// ModuleDir resolves the directory of the Terraform module a component sources. The 'source' of the terraform
+// block of its terragrunt.hcl is used when it evaluates to a local path; otherwise the module is expected under
+// infra/terraform/, named after the component.
+//
+// Parameters:
+//   - componentDir: Absolute path to the component directory.
+//   - repoRoot: Absolute path to the root of the git repository.
+//
+// Returns:
+//   - The absolute path to the module directory, or an empty string if the component sources a remote module.
+//   - An error if terragrunt.hcl cannot be parsed, or the module directory doesn't exist.
+func ModuleDir(componentDir, repoRoot string) (string, error) {
+	terragruntFile, err := ParseHCLFile(filepath.Join(componentDir, TerragruntConfigFilename))
+	if err != nil {
+		return "", err
+	}
+
+	ctx := EvalContext{TerragruntDir: componentDir, RepoRoot: repoRoot, Locals: Locals(terragruntFile.Body)}
+	moduleDir := filepath.Join(repoRoot, cfg.InfraDir, cfg.TerraformDir, filepath.Base(componentDir))
+
+	for _, block := range terragruntFile.Body.BlocksOfType("terraform") {
+		attr, ok := block.Body.Attributes["source"]
+		if !ok {
+			continue
+		}
+
+		source, err := EvalString(attr.Expr, ctx)
+		if err != nil {
+			// Sources built with conditionals or format() cannot be evaluated: fall back to the convention.
+			break
+		}
+
+		if strings.Contains(source, "::") || strings.Contains(source, "?ref=") || strings.HasPrefix(source, "tfr://") {
+			return "", nil
+		}
+		moduleDir = absPath(strings.SplitN(source, "//", 2)[0], componentDir)
+	}
+
+	if info, err := os.Stat(moduleDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("the Terraform module of %s is not found at %s", componentDir, moduleDir)
+	}
+
+	return moduleDir, nil
+}
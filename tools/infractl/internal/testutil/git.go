@@ -0,0 +1,65 @@
+// Package testutil holds the test fixtures shared by the tests of several packages.
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// NewGitRepo creates a git repository, isolated from the git configuration of the machine, with the given files
+// (by path relative to its root) committed and tagged 'base'. The uncommitted files are written, but left
+// untracked. The test is skipped when git is not installed.
+func NewGitRepo(t testing.TB, files map[string]string, uncommitted ...string) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "infractl")
+	t.Setenv("GIT_AUTHOR_EMAIL", "infractl@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "infractl")
+	t.Setenv("GIT_COMMITTER_EMAIL", "infractl@example.com")
+
+	repoRoot := t.TempDir()
+	RunGit(t, repoRoot, "init", "--quiet")
+	for path, content := range files {
+		WriteFile(t, repoRoot, path, content)
+	}
+	RunGit(t, repoRoot, "add", "--all")
+	for _, path := range uncommitted {
+		RunGit(t, repoRoot, "reset", "--quiet", "--", path)
+	}
+	RunGit(t, repoRoot, "commit", "--quiet", "--message", "base")
+	RunGit(t, repoRoot, "tag", "base")
+
+	return repoRoot
+}
+
+// RunGit runs a git command in a repository, failing the test if it fails.
+func RunGit(t testing.TB, repoRoot string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-C", repoRoot}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+// WriteFile writes a file of a repository, by path relative to its root, creating its directory.
+func WriteFile(t testing.TB, repoRoot, path, content string) {
+	t.Helper()
+
+	path = filepath.Join(repoRoot, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("creating %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
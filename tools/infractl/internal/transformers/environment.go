@@ -1,6 +1,8 @@
 package transformers
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
@@ -12,352 +14,475 @@
 // EnvVarsTransformer handles environment variable expansion
 type EnvVarsTransformer struct {
 	EnvConfig *cfg.EnvConfig
+	// SecretProviders resolves the secrets whose value is a backend reference, e.g. vault://secret/data/infra#token
+	SecretProviders *SecretProviders
 }
 
-// NewEnvVarsTransformer creates a new transformer
+// NewEnvVarsTransformer creates a new transformer, resolving secret references with the built-in backends
+// from the current directory.
 func NewEnvVarsTransformer(envConfig *cfg.EnvConfig) *EnvVarsTransformer {
-	return &EnvVarsTransformer{EnvConfig: envConfig}
+	return NewEnvVarsTransformerWithSecretProviders(envConfig, DefaultSecretProviders(""))
 }
 
-// resolveValue attempts to resolve a value with environment variable and secrets fallback
-func (t *EnvVarsTransformer) resolveValue(value string) (string, error) {
-	re := regexp.MustCompile(`\${([^}:-]+)(?::-([^}]*))?}`)
+// NewEnvVarsTransformerWithSecretProviders creates a new transformer, resolving secret references with the
+// given secret providers.
+func NewEnvVarsTransformerWithSecretProviders(envConfig *cfg.EnvConfig, secretProviders *SecretProviders) *EnvVarsTransformer {
+	return &EnvVarsTransformer{EnvConfig: envConfig, SecretProviders: secretProviders}
+}
+
+// envVarReferencePattern matches the ${VAR} and ${VAR:-default} references of a configuration value
+var envVarReferencePattern = regexp.MustCompile(`\${([^}:-]+)(?::-([^}]*))?}`)
+
+// ValueSource tells where the value of a ${VAR} or ${VAR:-default} reference came from.
+type ValueSource string
+
+const (
+	// ValueSourceEnvVar is a value read from the environment variable.
+	ValueSourceEnvVar ValueSource = "env"
+	// ValueSourceSecret is a value read from the 'secrets' section, through a ${VAR:-secrets.group.key} default.
+	ValueSourceSecret ValueSource = "secret"
+	// ValueSourceMissingSecret is a ${VAR:-secrets.group.key} default whose secret is not declared; the
+	// reference is replaced by the literal default.
+	ValueSourceMissingSecret ValueSource = "missing-secret"
+	// ValueSourceDefault is the literal default of a ${VAR:-default} reference.
+	ValueSourceDefault ValueSource = "default"
+	// ValueSourceUnresolved is a reference left as-is, because neither the variable nor a default is set.
+	ValueSourceUnresolved ValueSource = "unresolved"
+)
+
+// ValueReference explains how a ${VAR} or ${VAR:-default} reference of a configuration value was resolved.
+type ValueReference struct {
+	// Expression is the reference as written in the configuration, e.g. ${AWS_REGION:-us-east-1}
+	Expression string `json:"expression"`
+	// EnvVar is the name of the environment variable the reference reads.
+	EnvVar string `json:"env_var"`
+	// Source is where the value came from.
+	Source ValueSource `json:"source"`
+	// Secret is the secrets reference of the default, if any, e.g. secrets.aws.access_key
+	Secret string `json:"secret,omitempty"`
+	// SecretURI is the backend reference the secret is read from, if any, e.g. sops://secrets/local.enc.yaml#aws.access_key
+	SecretURI string `json:"secret_uri,omitempty"`
+	// SecretReferences explains how the referenced secret value was resolved itself.
+	SecretReferences []ValueReference `json:"secret_references,omitempty"`
+}
+
+// UnresolvedReference is a ${VAR} or ${VAR:-default} reference of the configuration whose variable is not set.
+// A reference is required when nothing else resolves it, so the compiled value would hold the reference itself
+// (or the name of an undeclared secret); it's optional when it falls back to the default it declares.
+type UnresolvedReference struct {
+	// Path is the path of the value holding the reference, e.g. providers.aws.config.region
+	Path string `json:"path"`
+	// Expression is the reference as written in the configuration, e.g. ${AWS_REGION}
+	Expression string `json:"expression"`
+	// EnvVar is the name of the environment variable that is not set.
+	EnvVar string `json:"env_var"`
+	// Required reports whether the reference is left without value.
+	Required bool `json:"required"`
+	// Reason explains why the reference is not resolved.
+	Reason string `json:"reason"`
+	// Source is where the value is set, in the environment configuration file that won the merge, when known.
+	Source *cfg.ValueLocation `json:"source,omitempty"`
+}
 
-	return re.ReplaceAllStringFunc(value, func(match string) string {
-		matches := re.FindStringSubmatch(match)
-		if len(matches) < 2 {
-			return match
+// String renders the reference as [<file>:<line>:<column>: ]<path>: <expression> (<reason>)
+func (r UnresolvedReference) String() string {
+	location := ""
+	if r.Source != nil {
+		location = r.Source.String() + ": "
+	}
+
+	return fmt.Sprintf("%s%s: %s (%s)", location, r.Path, r.Expression, r.Reason)
+}
+
+// UnresolvedReferencesError lists the unresolved references of a configuration, when at least one is required.
+type UnresolvedReferencesError struct {
+	References []UnresolvedReference
+}
+
+func (e *UnresolvedReferencesError) Error() string {
+	var required, optional []string
+	for _, reference := range e.References {
+		if reference.Required {
+			required = append(required, "  - "+reference.String())
+		} else {
+			optional = append(optional, "  - "+reference.String())
 		}
+	}
 
-		envVar := matches[1]
-		defaultVal := ""
-		if len(matches) > 2 {
-			defaultVal = matches[2]
+	message := fmt.Sprintf("%d required reference(s) cannot be resolved, set the variables or give them a default:\n%s",
+		len(required), strings.Join(required, "\n"))
+	if len(optional) > 0 {
+		message += fmt.Sprintf("\n%d optional reference(s) fall back to their default:\n%s", len(optional), strings.Join(optional, "\n"))
+	}
+
+	return message
+}
+
+// unresolvedReferencesError returns an *UnresolvedReferencesError listing the references, or nil if none is required.
+func unresolvedReferencesError(references []UnresolvedReference) error {
+	for _, reference := range references {
+		if reference.Required {
+			return &UnresolvedReferencesError{References: references}
 		}
+	}
+
+	return nil
+}
+
+// unresolvedReferences returns the references of a configuration value whose variable is not set.
+func (t *EnvVarsTransformer) unresolvedReferences(valuePath, value string) []UnresolvedReference {
+	var unresolved []UnresolvedReference
 
-		// First, check direct environment variable
-		envValue := os.Getenv(envVar)
-		if envValue != "" {
-			return envValue
+	for _, reference := range t.ExplainValue(value) {
+		entry := UnresolvedReference{Path: valuePath, Expression: reference.Expression, EnvVar: reference.EnvVar}
+
+		switch reference.Source {
+		case ValueSourceUnresolved:
+			entry.Required = true
+			entry.Reason = fmt.Sprintf("%s is not set and has no default", reference.EnvVar)
+			if reference.Secret != "" {
+				entry.Reason = fmt.Sprintf("%s is not set, and %s cannot be resolved", reference.EnvVar, reference.Secret)
+			}
+		case ValueSourceMissingSecret:
+			entry.Required = true
+			entry.Reason = fmt.Sprintf("%s is not set, and %s is not declared in the secrets section", reference.EnvVar, reference.Secret)
+		case ValueSourceDefault:
+			entry.Reason = fmt.Sprintf("%s is not set, its default is used", reference.EnvVar)
+		default:
+			continue
 		}
 
-		// If no direct env var, check for secrets reference
-		if strings.HasPrefix(defaultVal, "secrets.") {
-			parts := strings.Split(defaultVal, ".")
-			if len(parts) == 3 {
-				secretGroup := parts[1]
-				secretKey := parts[2]
-
-				// Look up in secrets section
-				if secretGroup, exists := t.EnvConfig.Secrets[secretGroup]; exists {
-					if secretValue, exists := secretGroup[secretKey]; exists {
-						// Recursively resolve the secret value
-						resolvedSecret, err := t.resolveValue(secretValue)
-						if err != nil {
-							return match // Return original if resolution fails
-						}
-						return resolvedSecret
+		unresolved = append(unresolved, entry)
+	}
+
+	return unresolved
+}
+
+// secretURI returns the backend reference a secret value holds, once its ${VAR} references are expanded, if any.
+func (t *EnvVarsTransformer) secretURI(value string) string {
+	if t.SecretProviders == nil {
+		return ""
+	}
+
+	expanded, err := t.resolveValue(value)
+	if err != nil {
+		return ""
+	}
+
+	if ref, isRef := t.SecretProviders.ParseRef(expanded); isRef {
+		return ref.URI
+	}
+
+	return ""
+}
+
+// resolveSecret resolves the value of a secret of the secrets section. Its ${VAR} references are expanded
+// first; then, if it's a reference of a registered backend (sops://, file://, exec://, vault://), the secret
+// is read from the backend.
+func (t *EnvVarsTransformer) resolveSecret(group, key, value string) (string, error) {
+	expanded, err := t.resolveValue(value)
+	if err != nil {
+		return "", err
+	}
+
+	if t.SecretProviders == nil {
+		return expanded, nil
+	}
+
+	ref, isRef := t.SecretProviders.ParseRef(expanded)
+	if !isRef {
+		return expanded, nil
+	}
+
+	return t.SecretProviders.Resolve(group+"."+key, ref)
+}
+
+// resolveReference resolves a single ${VAR} or ${VAR:-default} reference: the environment variable wins, then a
+// 'secrets.<group>.<key>' default is looked up in the secrets section (and resolved itself), then the default.
+func (t *EnvVarsTransformer) resolveReference(match, envVar, defaultVal string) (string, ValueReference) {
+	reference := ValueReference{Expression: match, EnvVar: envVar}
+
+	// First, check direct environment variable
+	envValue := os.Getenv(envVar)
+	if envValue != "" {
+		reference.Source = ValueSourceEnvVar
+		return envValue, reference
+	}
+
+	// If no direct env var, check for secrets reference
+	if strings.HasPrefix(defaultVal, "secrets.") {
+		reference.Secret = defaultVal
+		parts := strings.Split(defaultVal, ".")
+		if len(parts) == 3 {
+			secretGroup := parts[1]
+			secretKey := parts[2]
+
+			// Look up in secrets section
+			if secretGroup, exists := t.EnvConfig.Secrets[secretGroup]; exists {
+				if secretValue, exists := secretGroup[secretKey]; exists {
+					// Recursively resolve the secret value, from its backend if it's a reference
+					resolvedSecret, err := t.resolveSecret(parts[1], secretKey, secretValue)
+					if err != nil {
+						reference.Source = ValueSourceUnresolved
+						return match, reference // Return original if resolution fails
 					}
+					reference.Source = ValueSourceSecret
+					reference.SecretReferences = t.ExplainValue(secretValue)
+					reference.SecretURI = t.secretURI(secretValue)
+					return resolvedSecret, reference
 				}
 			}
 		}
 
-		// If no resolution found, return default or original
-		if defaultVal != "" {
-			return defaultVal
-		}
-		return match
-	}), nil
+		reference.Source = ValueSourceMissingSecret
+		return defaultVal, reference
+	}
+
+	// If no resolution found, return default or original. An explicit empty default, ${VAR:-}, makes the
+	// variable optional.
+	if defaultVal != "" || strings.Contains(match, ":-") {
+		reference.Source = ValueSourceDefault
+		return defaultVal, reference
+	}
+
+	reference.Source = ValueSourceUnresolved
+	return match, reference
 }
 
-// expandProviderConfig handles complex provider configuration expansion
-func (t *EnvVarsTransformer) expandProviderConfig(providerName string, providerConfig cfg.ProviderConfig) (cfg.ProviderConfig, error) {
-	// Expand provider config values
-	expandedConfig := make(map[string]interface{})
-	for configKey, configValue := range providerConfig.Config {
-		switch val := configValue.(type) {
-		case string:
-			resolvedValue, err := t.resolveValue(val)
-			if err != nil {
-				return providerConfig, fmt.Errorf("resolving provider %s config key %s: %w", providerName, configKey, err)
-			}
-			expandedConfig[configKey] = resolvedValue
-		default:
-			expandedConfig[configKey] = val
-		}
+// resolveValue attempts to resolve a value with environment variable and secrets fallback. Expressions, such as
+// ${product.name}, are left as-is: they're evaluated once every value is expanded (see evaluateExpressions).
+func (t *EnvVarsTransformer) resolveValue(value string) (string, error) {
+	var sb strings.Builder
+	offset := 0
+
+	for _, reference := range t.envVarReferences(value) {
+		sb.WriteString(value[offset:reference.start])
+		resolved, _ := t.resolveReference(reference.match, reference.envVar, reference.defaultVal)
+		sb.WriteString(resolved)
+		offset = reference.end
 	}
+	sb.WriteString(value[offset:])
 
-	// Expand version constraint source
-	expandedVersionSource, err := t.resolveValue(providerConfig.VersionConstraint.Source)
-	if err != nil {
-		return providerConfig, fmt.Errorf("resolving provider %s version source: %w", providerName, err)
+	return sb.String(), nil
+}
+
+// envVarReference is a ${VAR} or ${VAR:-default} reference of a configuration value.
+type envVarReference struct {
+	start, end int
+	match      string
+	envVar     string
+	defaultVal string
+}
+
+// envVarReferences returns the ${VAR} and ${VAR:-default} references of a value, in order, leaving out its expressions.
+func (t *EnvVarsTransformer) envVarReferences(value string) []envVarReference {
+	var references []envVarReference
+
+	for _, found := range findInterpolations(value) {
+		if found.isExpression {
+			continue
+		}
+
+		match := value[found.start:found.end]
+		matches := envVarReferencePattern.FindStringSubmatch(match)
+		references = append(references, envVarReference{
+			start:      found.start,
+			end:        found.end,
+			match:      match,
+			envVar:     matches[1],
+			defaultVal: matches[2],
+		})
 	}
 
-	return cfg.ProviderConfig{
-		Config: expandedConfig,
-		VersionConstraint: cfg.VersionConstraint{
-			Source:          expandedVersionSource,
-			RequiredVersion: providerConfig.VersionConstraint.RequiredVersion,
-			Enabled:         providerConfig.VersionConstraint.Enabled,
-		},
-	}, nil
+	return references
 }
 
-// expandMapStringInterface expands a map[string]interface{} with environment variables
-func (t *EnvVarsTransformer) expandMapStringInterface(input map[string]interface{}) (map[string]interface{}, error) {
-	expanded := make(map[string]interface{})
+// ExplainValue explains how every ${VAR} or ${VAR:-default} reference of a configuration value is resolved,
+// following the same rules as the expansion of the configuration. Expressions are not explained.
+//
+// Parameters:
+//   - value: The configuration value, as written in the environment configuration files.
+//
+// Returns:
+//   - The references of the value, in order; empty if the value is a literal.
+func (t *EnvVarsTransformer) ExplainValue(value string) []ValueReference {
+	var references []ValueReference
+
+	for _, found := range t.envVarReferences(value) {
+		_, reference := t.resolveReference(found.match, found.envVar, found.defaultVal)
+		references = append(references, reference)
+	}
+
+	return references
+}
 
-	for k, v := range input {
-		switch val := v.(type) {
-		case string:
-			resolvedValue, err := t.resolveValue(val)
+// expandNode returns a copy of a node of the configuration document, with the environment variable and secrets
+// references of every string it holds expanded, however deeply nested in mappings and lists. Values of the secrets
+// section are read from their backend when they're backend references.
+func (t *EnvVarsTransformer) expandNode(node interface{}, valuePath string) (interface{}, error) {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			nested, err := t.expandNode(value, joinValuePath(valuePath, key))
 			if err != nil {
 				return nil, err
 			}
-			expanded[k] = resolvedValue
-		case map[string]interface{}:
-			nestedExpanded, err := t.expandMapStringInterface(val)
+			expanded[key] = nested
+		}
+		return expanded, nil
+
+	case []interface{}:
+		expanded := make([]interface{}, len(typed))
+		for i, element := range typed {
+			nested, err := t.expandNode(element, elementValuePath(valuePath, typed, i))
 			if err != nil {
 				return nil, err
 			}
-			expanded[k] = nestedExpanded
-		default:
-			expanded[k] = val
+			expanded[i] = nested
 		}
-	}
-
-	return expanded, nil
-}
+		return expanded, nil
 
-// GetUpdatedConfig returns a new EnvConfig with environment variables and secrets expanded
-func (t *EnvVarsTransformer) GetUpdatedConfig() (*cfg.EnvConfig, error) {
-	updatedConfig := &cfg.EnvConfig{}
-
-	// Expand Secrets section first (to ensure secrets are resolved)
-	updatedConfig.Secrets = make(cfg.Secrets)
-	for groupName, secretGroup := range t.EnvConfig.Secrets {
-		expandedSecretGroup := make(map[string]string)
-		for secretKey, secretValue := range secretGroup {
-			expandedValue, err := t.resolveValue(secretValue)
+	case string:
+		// Value paths are built from the keys of the document: keys that don't split (e.g. holding brackets) are
+		// not secrets, which are checked by the schema
+		if segments, err := splitValuePath(valuePath); err == nil && len(segments) == 3 && segments[0] == "secrets" {
+			expanded, err := t.resolveSecret(segments[1], segments[2], typed)
 			if err != nil {
-				return nil, fmt.Errorf("expanding secret %s.%s: %w", groupName, secretKey, err)
+				return nil, fmt.Errorf("expanding secret %s.%s: %w", segments[1], segments[2], err)
 			}
-			expandedSecretGroup[secretKey] = expandedValue
+			return expanded, nil
 		}
-		updatedConfig.Secrets[groupName] = expandedSecretGroup
-	}
 
-	// Expand Providers section with secrets resolution
-	updatedConfig.Providers = make(cfg.Providers)
-	for providerName, providerConfig := range t.EnvConfig.Providers {
-		expandedProviderConfig, err := t.expandProviderConfig(providerName, providerConfig)
+		expanded, err := t.resolveValue(typed)
 		if err != nil {
-			return nil, fmt.Errorf("expanding provider %s: %w", providerName, err)
+			return nil, fmt.Errorf("expanding %s: %w", valuePath, err)
 		}
-		updatedConfig.Providers[providerName] = expandedProviderConfig
+		return expanded, nil
+
+	default:
+		return node, nil
 	}
+}
 
-	// Expand Config section
-	configMap, err := t.expandMapStringInterface(map[string]interface{}{
-		"version":      t.EnvConfig.Config.Version,
-		"last_updated": t.EnvConfig.Config.LastUpdated,
-		"description":  t.EnvConfig.Config.Description,
-	})
+// GetUpdatedConfig returns a new EnvConfig with environment variables and secrets expanded, and expressions
+// evaluated. Every string of the configuration is expanded the same way, wherever it is: tags and inputs of
+// stacks, layers and components included, down to the values nested in lists and mappings of inputs.
+func (t *EnvVarsTransformer) GetUpdatedConfig() (*cfg.EnvConfig, error) {
+	document, err := envConfigDocument(t.EnvConfig)
 	if err != nil {
-		return nil, fmt.Errorf("expanding config section: %w", err)
-	}
-	updatedConfig.Config = cfg.RootConfig{
-		Version:     configMap["version"].(string),
-		LastUpdated: configMap["last_updated"].(string),
-		Description: configMap["description"].(string),
+		return nil, fmt.Errorf("reading the configuration to expand it: %w", err)
 	}
 
-	// Expand Git section
-	gitMap, err := t.expandMapStringInterface(map[string]interface{}{
-		"base_url": t.EnvConfig.Git.BaseURL,
-	})
+	expanded, err := t.expandNode(document, "")
 	if err != nil {
-		return nil, fmt.Errorf("expanding git section: %w", err)
-	}
-	updatedConfig.Git = cfg.Git{
-		BaseURL: gitMap["base_url"].(string),
+		return nil, err
 	}
 
-	// Expand Product section
-	productMap, err := t.expandMapStringInterface(map[string]interface{}{
-		"name":        t.EnvConfig.Product.Name,
-		"version":     t.EnvConfig.Product.Version,
-		"description": t.EnvConfig.Product.Description,
-	})
+	// Evaluate the expressions of the expanded configuration, e.g. ${format("%s-%s", product.name, iac.remote_state.s3.region)}
+	evaluated, err := evaluateExpressions(expanded.(map[string]interface{}), t.isSecretValuePath)
 	if err != nil {
-		return nil, fmt.Errorf("expanding product section: %w", err)
-	}
-	updatedConfig.Product = cfg.Product{
-		Name:           productMap["name"].(string),
-		Version:        productMap["version"].(string),
-		Description:    productMap["description"].(string),
-		UseAsStackTags: t.EnvConfig.Product.UseAsStackTags,
+		return nil, fmt.Errorf("evaluating the expressions of the configuration: %w", err)
 	}
 
-	// Expand IAC section
-	iacMap, err := t.expandMapStringInterface(map[string]interface{}{
-		"versions.terraform_version_default":  t.EnvConfig.IAC.Versions.TerraformVersionDefault,
-		"versions.terragrunt_version_default": t.EnvConfig.IAC.Versions.TerragruntVersionDefault,
-		"remote_state.s3.bucket":              t.EnvConfig.IAC.RemoteState.S3.Bucket,
-		"remote_state.s3.lock_table":          t.EnvConfig.IAC.RemoteState.S3.LockTable,
-		"remote_state.s3.region":              t.EnvConfig.IAC.RemoteState.S3.Region,
-	})
+	updatedConfig, err := envConfigFromDocument(evaluated)
 	if err != nil {
-		return nil, fmt.Errorf("expanding iac section: %w", err)
-	}
-	updatedConfig.IAC = cfg.IaC{
-		Versions: cfg.IaCVersions{
-			TerraformVersionDefault:  iacMap["versions.terraform_version_default"].(string),
-			TerragruntVersionDefault: iacMap["versions.terragrunt_version_default"].(string),
-		},
-		RemoteState: cfg.RemoteState{
-			S3: cfg.RemoteStateS3{
-				Bucket:    iacMap["remote_state.s3.bucket"].(string),
-				LockTable: iacMap["remote_state.s3.lock_table"].(string),
-				Region:    iacMap["remote_state.s3.region"].(string),
-			},
-		},
+		return nil, fmt.Errorf("reading the expanded configuration: %w", err)
 	}
 
-	// Expand Stacks section
-	updatedConfig.Stacks = make([]cfg.StackConfig, len(t.EnvConfig.Stacks))
-	for i, stack := range t.EnvConfig.Stacks {
-		// Expand stack name and tags
-		stackNameMap, err := t.expandMapStringInterface(map[string]interface{}{
-			"name": stack.Name,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("expanding stack name at index %d: %w", i, err)
-		}
+	return updatedConfig, nil
+}
 
-		expandedStackTags := make(map[string]string)
-		for tagKey, tagValue := range stack.Tags {
-			expandedTagValue, err := t.resolveValue(tagValue)
-			if err != nil {
-				return nil, fmt.Errorf("expanding stack tag %s at index %d: %w", tagKey, i, err)
-			}
-			expandedStackTags[tagKey] = expandedTagValue
-		}
+// envConfigDocument converts a configuration into a generic document, as it's marshalled to JSON. Numbers are
+// kept as written, as json.Number values.
+func envConfigDocument(envConfig *cfg.EnvConfig) (map[string]interface{}, error) {
+	content, err := json.Marshal(envConfig)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling the configuration: %w", err)
+	}
 
-		updatedConfig.Stacks[i] = cfg.StackConfig{
-			Name:   stackNameMap["name"].(string),
-			Tags:   expandedStackTags,
-			Layers: stack.Layers, // Layers remain unchanged
-		}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("unmarshalling the configuration: %w", err)
 	}
 
-	return updatedConfig, nil
+	return document, nil
 }
 
-// ValidateEnvironmentVariables checks if all referenced environment variables exist
-func (t *EnvVarsTransformer) ValidateEnvironmentVariables() error {
-	var missingVars []string
+// envConfigFromDocument converts a document built by envConfigDocument back into a configuration.
+func envConfigFromDocument(document map[string]interface{}) (*cfg.EnvConfig, error) {
+	content, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling the configuration: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	envConfig := &cfg.EnvConfig{}
+	if err := decoder.Decode(envConfig); err != nil {
+		return nil, fmt.Errorf("unmarshalling the configuration: %w", err)
+	}
 
-	// Helper function to check and track missing variables
-	checkVar := func(value string) {
-		re := regexp.MustCompile(`\${([^}:-]+)(?::-([^}]*))?}`)
-		matches := re.FindAllStringSubmatch(value, -1)
+	return envConfig, nil
+}
 
-		for _, match := range matches {
-			if len(match) < 2 {
+// isSecretValuePath reports whether a value of the configuration is a provider configuration value that is a
+// secret: its key is listed in 'sensitive_keys', or it reads the secrets section.
+func (t *EnvVarsTransformer) isSecretValuePath(valuePath string) bool {
+	for providerName, providerConfig := range t.EnvConfig.Providers {
+		for key, value := range providerConfig.Config {
+			configPath := "providers." + providerName + ".config." + key
+			if !cfg.IsValuePathUnder(configPath, valuePath) {
 				continue
 			}
 
-			envVar := match[1]
-			defaultVal := ""
-			if len(match) > 2 {
-				defaultVal = match[2]
+			if providerConfig.IsSensitiveKey(key) {
+				return true
 			}
 
-			// Check direct environment variable
-			if os.Getenv(envVar) == "" {
-				// If no direct env var, check for secrets reference
-				if strings.HasPrefix(defaultVal, "secrets.") {
-					parts := strings.Split(defaultVal, ".")
-					if len(parts) == 3 {
-						secretGroup := parts[1]
-						secretKey := parts[2]
-
-						// Look up in secrets section
-						if secretGroup, exists := t.EnvConfig.Secrets[secretGroup]; exists {
-							if secretValue, exists := secretGroup[secretKey]; exists {
-								// Recursively check secret value
-								re := regexp.MustCompile(`\${([^}:-]+)(?::-([^}]*))?}`)
-								secretMatches := re.FindAllStringSubmatch(secretValue, -1)
-
-								for _, secretMatch := range secretMatches {
-									if len(secretMatch) < 2 {
-										continue
-									}
-
-									secretEnvVar := secretMatch[1]
-									if os.Getenv(secretEnvVar) == "" {
-										missingVars = append(missingVars, secretEnvVar)
-									}
-								}
-								continue
-							}
-						}
-					}
+			strValue, isString := value.(string)
+			if !isString {
+				continue
+			}
+			for _, reference := range t.ExplainValue(strValue) {
+				if reference.Secret != "" {
+					return true
 				}
-
-				// If no resolution found, add to missing vars
-				missingVars = append(missingVars, envVar)
 			}
 		}
 	}
 
-	// Check all sections for environment variables
-	// Config section
-	checkVar(t.EnvConfig.Config.Version)
-	checkVar(t.EnvConfig.Config.LastUpdated)
-	checkVar(t.EnvConfig.Config.Description)
-
-	// Git section
-	checkVar(t.EnvConfig.Git.BaseURL)
-
-	// Product section
-	checkVar(t.EnvConfig.Product.Name)
-	checkVar(t.EnvConfig.Product.Version)
-	checkVar(t.EnvConfig.Product.Description)
-
-	// Providers section
-	for _, providerConfig := range t.EnvConfig.Providers {
-		// Check provider config values
-		for _, configValue := range providerConfig.Config {
-			if strVal, ok := configValue.(string); ok {
-				checkVar(strVal)
-			}
-		}
+	return false
+}
 
-		// Check version constraint source
-		checkVar(providerConfig.VersionConstraint.Source)
+// ValidateEnvironmentVariables checks that the ${VAR} references of the configuration, outside of the secrets
+// section (see SecretsTransformer.ValidateSecrets), resolve: every value is checked, stacks, layers and
+// components included.
+//
+// Returns:
+//   - Every unresolved reference, required and optional, sorted by path.
+//   - An *UnresolvedReferencesError if any of them is required.
+func (t *EnvVarsTransformer) ValidateEnvironmentVariables() ([]UnresolvedReference, error) {
+	document, err := envConfigDocument(t.EnvConfig)
+	if err != nil {
+		return nil, fmt.Errorf("reading the configuration to check its references: %w", err)
 	}
 
-	// Secrets section
-	for groupName, secretGroup := range t.EnvConfig.Secrets {
-		for secretKey, secretValue := range secretGroup {
-			checkVar(fmt.Sprintf("%s.%s:%s", groupName, secretKey, secretValue))
-		}
-	}
+	values := cfg.LeafValues(document)
 
-	// Stacks section
-	for _, stack := range t.EnvConfig.Stacks {
-		checkVar(stack.Name)
-		for _, tagValue := range stack.Tags {
-			checkVar(tagValue)
+	var unresolved []UnresolvedReference
+	for _, valuePath := range cfg.SortedValuePaths(values) {
+		value, isString := values[valuePath].(string)
+		if !isString || cfg.IsValuePathUnder(valuePath, "secrets") {
+			continue
 		}
-	}
 
-	// Return error if any missing variables found
-	if len(missingVars) > 0 {
-		return fmt.Errorf("missing environment variables: %v", missingVars)
+		unresolved = append(unresolved, t.unresolvedReferences(valuePath, value)...)
 	}
 
-	return nil
+	return unresolved, unresolvedReferencesError(unresolved)
 }
@@ -0,0 +1,783 @@
+package transformers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+)
+
+// Expressions are the ${...} interpolations of a configuration value that are not environment variable references
+// (${VAR} or ${VAR:-default}). They're made of:
+//
+//   - References to other values of the configuration, by path: ${product.name}, ${iac.remote_state.s3.region},
+//     ${stacks[stack-datastore].tags.stack_purpose}. A referenced value is compiled first, its own references and
+//     expressions included; reference cycles are reported as errors. The secrets section, and the provider
+//     configuration values that hold secrets, cannot be referenced, so no secret ends up in a clear text value.
+//   - Literals: "double quoted strings", numbers, true and false.
+//   - Calls to the functions of expressionFunctions, e.g. ${lower(format("%s-%s", product.name, env("ENV")))}
+
+// envVarNamePattern matches the name of an environment variable.
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// interpolation is a ${...} of a configuration value.
+type interpolation struct {
+	// start and end delimit the interpolation in the value, ${ and } included.
+	start, end int
+	// body is what's between ${ and }
+	body string
+	// isExpression reports whether the interpolation is an expression, rather than an environment variable reference.
+	isExpression bool
+}
+
+// findInterpolations returns the ${...} interpolations of a value, in order. Environment variable references are
+// matched first; anything else is an expression, ending at the first } that is not part of a string literal.
+// A ${ without its closing } is left as-is.
+func findInterpolations(value string) []interpolation {
+	var found []interpolation
+
+	for offset := 0; offset < len(value); {
+		start := strings.Index(value[offset:], "${")
+		if start < 0 {
+			break
+		}
+		start += offset
+
+		if loc := envVarReferencePattern.FindStringSubmatchIndex(value[start:]); loc != nil && loc[0] == 0 &&
+			envVarNamePattern.MatchString(value[start+loc[2]:start+loc[3]]) {
+			found = append(found, interpolation{start: start, end: start + loc[1], body: value[start+2 : start+loc[1]-1]})
+			offset = start + loc[1]
+			continue
+		}
+
+		end := expressionEnd(value, start+2)
+		if end < 0 {
+			offset = start + 2
+			continue
+		}
+
+		found = append(found, interpolation{start: start, end: end + 1, body: value[start+2 : end], isExpression: true})
+		offset = end + 1
+	}
+
+	return found
+}
+
+// expressionEnd returns the index of the } closing an expression, skipping string literals, or -1.
+func expressionEnd(value string, from int) int {
+	inString := false
+	for i := from; i < len(value); i++ {
+		switch {
+		case inString && value[i] == '\\':
+			i++
+		case value[i] == '"':
+			inString = !inString
+		case !inString && value[i] == '}':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// exprKind is the kind of a node of a parsed expression.
+type exprKind int
+
+const (
+	exprLiteral exprKind = iota
+	exprReference
+	exprCall
+)
+
+// expr is a node of a parsed expression.
+type expr struct {
+	kind exprKind
+	// value is the value of a literal.
+	value interface{}
+	// name is the path of a reference, or the name of a function.
+	name string
+	// args are the arguments of a call.
+	args []*expr
+}
+
+// exprParser is a recursive descent parser of expressions.
+type exprParser struct {
+	input string
+	pos   int
+}
+
+// parseExpression parses the body of an expression, e.g. lower(product.name)
+func parseExpression(body string) (*expr, error) {
+	p := &exprParser{input: body}
+
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.input[p.pos:], p.pos+1)
+	}
+
+	return node, nil
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) parseExpr() (*expr, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	switch c := p.input[p.pos]; {
+	case c == '"':
+		return p.parseString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case isIdentifierStart(c):
+		return p.parseReferenceOrCall()
+	default:
+		return nil, fmt.Errorf("unexpected '%c' at position %d", c, p.pos+1)
+	}
+}
+
+func (p *exprParser) parseString() (*expr, error) {
+	var sb strings.Builder
+
+	for p.pos++; p.pos < len(p.input); p.pos++ {
+		c := p.input[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return &expr{kind: exprLiteral, value: sb.String()}, nil
+		case c == '\\' && p.pos+1 < len(p.input):
+			p.pos++
+			switch escaped := p.input[p.pos]; escaped {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(escaped)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return nil, fmt.Errorf("unterminated string literal")
+}
+
+func (p *exprParser) parseNumber() (*expr, error) {
+	start := p.pos
+	for p.pos < len(p.input) && strings.ContainsRune("-+.0123456789eE", rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	number, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number '%s'", p.input[start:p.pos])
+	}
+
+	return &expr{kind: exprLiteral, value: number}, nil
+}
+
+// parseReferenceOrCall parses a function call, name(args...), a boolean literal, or a reference: a path such as
+// providers.aws.config.region or stacks[stack-datastore].layers[db].tags.layer_type
+func (p *exprParser) parseReferenceOrCall() (*expr, error) {
+	start := p.pos
+	for p.pos < len(p.input) && isIdentifierChar(p.input[p.pos]) {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+
+	p.skipSpaces()
+	if p.pos < len(p.input) && p.input[p.pos] == '(' {
+		p.pos++
+		return p.parseCall(name)
+	}
+
+	if name == "true" || name == "false" {
+		return &expr{kind: exprLiteral, value: name == "true"}, nil
+	}
+
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '.':
+			segmentStart := p.pos + 1
+			p.pos++
+			for p.pos < len(p.input) && isIdentifierChar(p.input[p.pos]) {
+				p.pos++
+			}
+			if p.pos == segmentStart {
+				return nil, fmt.Errorf("empty path segment after '%s'", p.input[start:segmentStart])
+			}
+		case '[':
+			closing := strings.IndexByte(p.input[p.pos:], ']')
+			if closing <= 1 {
+				return nil, fmt.Errorf("unterminated or empty '[' in '%s'", p.input[start:])
+			}
+			p.pos += closing + 1
+		default:
+			return &expr{kind: exprReference, name: p.input[start:p.pos]}, nil
+		}
+	}
+
+	return &expr{kind: exprReference, name: p.input[start:p.pos]}, nil
+}
+
+func (p *exprParser) parseCall(name string) (*expr, error) {
+	call := &expr{kind: exprCall, name: name}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) && p.input[p.pos] == ')' {
+		p.pos++
+		return call, nil
+	}
+
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, fmt.Errorf("in %s(): %w", name, err)
+		}
+		call.args = append(call.args, arg)
+
+		p.skipSpaces()
+		if p.pos >= len(p.input) {
+			return nil, fmt.Errorf("missing ')' closing %s(", name)
+		}
+
+		switch p.input[p.pos] {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return call, nil
+		default:
+			return nil, fmt.Errorf("unexpected '%c' in the arguments of %s(), expected ',' or ')'", p.input[p.pos], name)
+		}
+	}
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierChar(c byte) bool {
+	return isIdentifierStart(c) || c == '-' || (c >= '0' && c <= '9')
+}
+
+// expressionFunction is a function callable from an expression, with its evaluated arguments.
+type expressionFunction func(args []interface{}) (interface{}, error)
+
+// expressionFunctions are the functions expressions can call.
+var expressionFunctions = map[string]expressionFunction{
+	// lower(string) converts a string to lower case.
+	"lower": func(args []interface{}) (interface{}, error) {
+		s, err := stringArgs("lower", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ToLower(s[0]), nil
+	},
+	// upper(string) converts a string to upper case.
+	"upper": func(args []interface{}) (interface{}, error) {
+		s, err := stringArgs("upper", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ToUpper(s[0]), nil
+	},
+	// replace(string, old, new) replaces every occurrence of old by new.
+	"replace": func(args []interface{}) (interface{}, error) {
+		s, err := stringArgs("replace", args, 3)
+		if err != nil {
+			return nil, err
+		}
+		return strings.ReplaceAll(s[0], s[1], s[2]), nil
+	},
+	// join(separator, values...) joins values, and the elements of lists, with the separator.
+	"join": func(args []interface{}) (interface{}, error) {
+		if len(args) < 2 {
+			return nil, fmt.Errorf("join() expects a separator and at least one value, got %d argument(s)", len(args))
+		}
+		separator, err := stringifyExpressionValue(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("join(): %w", err)
+		}
+
+		var values []string
+		for _, arg := range args[1:] {
+			elements, isList := arg.([]interface{})
+			if !isList {
+				elements = []interface{}{arg}
+			}
+			for _, element := range elements {
+				value, err := stringifyExpressionValue(element)
+				if err != nil {
+					return nil, fmt.Errorf("join(): %w", err)
+				}
+				values = append(values, value)
+			}
+		}
+		return strings.Join(values, separator), nil
+	},
+	// format(spec, values...) formats values like fmt.Sprintf, e.g. format("%s-%s", product.name, "eu")
+	"format": func(args []interface{}) (interface{}, error) {
+		if len(args) < 1 {
+			return nil, fmt.Errorf("format() expects a format specification")
+		}
+		spec, isString := args[0].(string)
+		if !isString {
+			return nil, fmt.Errorf("format() expects a string format specification")
+		}
+
+		values := make([]interface{}, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			if number, isNumber := arg.(json.Number); isNumber {
+				if integer, err := number.Int64(); err == nil {
+					arg = integer
+				} else if float, err := number.Float64(); err == nil {
+					arg = float
+				}
+			}
+			if number, isNumber := arg.(float64); isNumber && number == float64(int64(number)) {
+				arg = int64(number)
+			}
+			values = append(values, arg)
+		}
+
+		formatted := fmt.Sprintf(spec, values...)
+		if strings.Contains(formatted, "%!") {
+			return nil, fmt.Errorf("format(): the specification '%s' does not match its %d value(s): %s", spec, len(values), formatted)
+		}
+		return formatted, nil
+	},
+	// coalesce(values...) returns the first value that is neither null nor an empty string.
+	"coalesce": func(args []interface{}) (interface{}, error) {
+		for _, arg := range args {
+			if arg != nil && arg != "" {
+				return arg, nil
+			}
+		}
+		return nil, fmt.Errorf("coalesce(): every one of its %d value(s) is empty", len(args))
+	},
+	// file(path) returns the content of a file, without its trailing newline. Relative paths resolve from the
+	// root of the repository.
+	"file": func(args []interface{}) (interface{}, error) {
+		s, err := stringArgs("file", args, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		path := s[0]
+		if !filepath.IsAbs(path) {
+			if repoRoot, err := cfg.GetGitRepoRoot(); err == nil {
+				path = filepath.Join(repoRoot, path)
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("file(): %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	},
+	// env(name[, default]) returns the value of an environment variable, or the default when it's not set.
+	"env": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("env() expects a variable name and an optional default, got %d argument(s)", len(args))
+		}
+		s, err := stringArgs("env", args, len(args))
+		if err != nil {
+			return nil, err
+		}
+
+		if value := os.Getenv(s[0]); value != "" {
+			return value, nil
+		}
+		if len(s) == 2 {
+			return s[1], nil
+		}
+		return nil, fmt.Errorf("env(): %s is not set, and no default is given", s[0])
+	},
+}
+
+// stringArgs converts the arguments of a function to strings, checking their number.
+func stringArgs(function string, args []interface{}, expected int) ([]string, error) {
+	if len(args) != expected {
+		return nil, fmt.Errorf("%s() expects %d argument(s), got %d", function, expected, len(args))
+	}
+
+	values := make([]string, len(args))
+	for i, arg := range args {
+		value, err := stringifyExpressionValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s(): %w", function, err)
+		}
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+// stringifyExpressionValue renders a scalar value of an expression as a string.
+func stringifyExpressionValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case []interface{}:
+		return "", fmt.Errorf("a list cannot be used as a string, join its elements with join()")
+	default:
+		return "", fmt.Errorf("a %T cannot be used as a string, reference one of its values instead", value)
+	}
+}
+
+// evaluateExpression evaluates a parsed expression, looking references up with the given function.
+func evaluateExpression(node *expr, lookup func(path string) (interface{}, error)) (interface{}, error) {
+	switch node.kind {
+	case exprLiteral:
+		return node.value, nil
+	case exprReference:
+		return lookup(node.name)
+	}
+
+	function, exists := expressionFunctions[node.name]
+	if !exists {
+		return nil, fmt.Errorf("unknown function %s(), expected one of: coalesce, env, file, format, join, lower, replace, upper", node.name)
+	}
+
+	args := make([]interface{}, 0, len(node.args))
+	for _, arg := range node.args {
+		value, err := evaluateExpression(arg, lookup)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	return function(args)
+}
+
+// HasExpressions reports whether a configuration value holds expressions, rather than only environment variable
+// references or literal text.
+func HasExpressions(value string) bool {
+	for _, found := range findInterpolations(value) {
+		if found.isExpression {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expressionEvaluator evaluates the expressions of a configuration document. Values are evaluated on demand, so a
+// referenced value is always evaluated before the values referencing it, and only once.
+type expressionEvaluator struct {
+	// document is the configuration document, with its environment variable references expanded.
+	document interface{}
+	// isHidden reports whether a value cannot be referenced, by path.
+	isHidden func(valuePath string) bool
+	// evaluated holds the evaluated values, by path.
+	evaluated map[string]string
+	// evaluating is the chain of values being evaluated, to report reference cycles.
+	evaluating []string
+}
+
+// evaluateExpressions evaluates the expressions of every value of a configuration document, the secrets section
+// aside, and returns the evaluated document.
+//
+// Parameters:
+//   - document: The configuration document, with its environment variable references expanded.
+//   - isHidden: Reports whether a value cannot be referenced, by path, because it holds a secret. Values of the
+//     secrets section can never be referenced.
+//
+// Returns:
+//   - A copy of the document, with every expression replaced by its value.
+//   - An error naming the value and the expression that cannot be evaluated, or the values of a reference cycle.
+func evaluateExpressions(document map[string]interface{}, isHidden func(valuePath string) bool) (map[string]interface{}, error) {
+	evaluator := &expressionEvaluator{document: document, isHidden: isHidden, evaluated: map[string]string{}}
+
+	evaluated, err := evaluator.evaluateNode(document, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluated.(map[string]interface{}), nil
+}
+
+// evaluateNode returns a copy of a node of the document, with the expressions of its values evaluated.
+func (e *expressionEvaluator) evaluateNode(node interface{}, valuePath string) (interface{}, error) {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		evaluated := make(map[string]interface{}, len(typed))
+		for key, value := range typed {
+			nestedPath := joinValuePath(valuePath, key)
+			if cfg.IsValuePathUnder(nestedPath, "secrets") {
+				evaluated[key] = value
+				continue
+			}
+
+			nested, err := e.evaluateNode(value, nestedPath)
+			if err != nil {
+				return nil, err
+			}
+			evaluated[key] = nested
+		}
+		return evaluated, nil
+
+	case []interface{}:
+		evaluated := make([]interface{}, len(typed))
+		for i, element := range typed {
+			nested, err := e.evaluateNode(element, elementValuePath(valuePath, typed, i))
+			if err != nil {
+				return nil, err
+			}
+			evaluated[i] = nested
+		}
+		return evaluated, nil
+
+	case string:
+		return e.evaluateValue(valuePath, typed)
+
+	default:
+		return node, nil
+	}
+}
+
+// evaluateValue evaluates the expressions of a value, evaluating the values they reference first.
+func (e *expressionEvaluator) evaluateValue(valuePath, value string) (string, error) {
+	if evaluated, done := e.evaluated[valuePath]; done {
+		return evaluated, nil
+	}
+
+	if !HasExpressions(value) {
+		return value, nil
+	}
+
+	for i, evaluating := range e.evaluating {
+		if evaluating == valuePath {
+			cycle := append(append([]string{}, e.evaluating[i:]...), valuePath)
+			return "", fmt.Errorf("reference cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	e.evaluating = append(e.evaluating, valuePath)
+	defer func() { e.evaluating = e.evaluating[:len(e.evaluating)-1] }()
+
+	var sb strings.Builder
+	offset := 0
+	for _, found := range findInterpolations(value) {
+		if !found.isExpression {
+			continue
+		}
+
+		expression := value[found.start:found.end]
+		node, err := parseExpression(found.body)
+		if err != nil {
+			return "", fmt.Errorf("parsing %s of %s: %w", expression, valuePath, err)
+		}
+
+		result, err := evaluateExpression(node, e.lookup)
+		if err != nil {
+			return "", fmt.Errorf("evaluating %s of %s: %w", expression, valuePath, err)
+		}
+
+		rendered, err := stringifyExpressionValue(result)
+		if err != nil {
+			return "", fmt.Errorf("evaluating %s of %s: %w", expression, valuePath, err)
+		}
+
+		sb.WriteString(value[offset:found.start])
+		sb.WriteString(rendered)
+		offset = found.end
+	}
+	sb.WriteString(value[offset:])
+
+	e.evaluated[valuePath] = sb.String()
+
+	return e.evaluated[valuePath], nil
+}
+
+// lookup returns the evaluated value a reference points to.
+func (e *expressionEvaluator) lookup(reference string) (interface{}, error) {
+	node, valuePath, err := lookupDocumentPath(e.document, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.IsValuePathUnder(valuePath, "secrets") || cfg.IsValuePathUnder("secrets", valuePath) || e.isHidden(valuePath) {
+		return nil, fmt.Errorf("'%s' holds a secret and cannot be referenced; read secrets through ${VAR:-secrets.group.key} references instead", reference)
+	}
+
+	return e.evaluateNode(node, valuePath)
+}
+
+// lookupDocumentPath returns the value at a path of a configuration document, e.g. stacks[stack-datastore].tags,
+// and its canonical path (see cfg.LeafValues). Elements of named lists (stacks, layers, components) are addressed
+// by name, others by index.
+func lookupDocumentPath(document interface{}, path string) (interface{}, string, error) {
+	current := document
+	canonicalPath := ""
+
+	segments, err := splitValuePath(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, exists := node[segment]
+			if !exists {
+				return nil, "", fmt.Errorf("'%s' is not set", path)
+			}
+			current = value
+			canonicalPath = joinValuePath(canonicalPath, segment)
+		case []interface{}:
+			index, found := listElement(node, segment)
+			if !found {
+				return nil, "", fmt.Errorf("'%s' is not set: no element '%s'", path, segment)
+			}
+			current = node[index]
+			canonicalPath = elementValuePath(canonicalPath, node, index)
+		default:
+			return nil, "", fmt.Errorf("'%s' is not set: '%s' is not a mapping or a list", path, segment)
+		}
+	}
+
+	return current, canonicalPath, nil
+}
+
+// joinValuePath returns the path of a key of a mapping.
+func joinValuePath(valuePath, key string) string {
+	if valuePath == "" {
+		return key
+	}
+
+	return valuePath + "." + key
+}
+
+// elementValuePath returns the path of an element of a list, like cfg.LeafValues: by name if every element of
+// the list is named, by index otherwise.
+func elementValuePath(valuePath string, list []interface{}, index int) string {
+	for _, element := range list {
+		if name, isString := elementName(element); !isString || name == "" {
+			return fmt.Sprintf("%s[%d]", valuePath, index)
+		}
+	}
+
+	name, _ := elementName(list[index])
+	return fmt.Sprintf("%s[%s]", valuePath, name)
+}
+
+// elementName returns the name of an element of a list, if it's a mapping with a name.
+func elementName(element interface{}) (string, bool) {
+	named, isMap := element.(map[string]interface{})
+	if !isMap {
+		return "", false
+	}
+
+	name, isString := named["name"].(string)
+	return name, isString
+}
+
+// splitValuePath splits a value path into its segments: stacks[s].tags.x is stacks, s, tags, x. Brackets are
+// tokenised first, so element names may hold dots: stacks[v1.2].name is stacks, v1.2, name.
+func splitValuePath(path string) ([]string, error) {
+	var segments []string
+	var segment strings.Builder
+
+	// flush ends the current segment; empty segments are only allowed after a bracket, e.g. stacks[s].name
+	flush := func(afterBracket bool) error {
+		if segment.Len() == 0 {
+			if afterBracket {
+				return nil
+			}
+			return fmt.Errorf("invalid value path '%s': empty segment", path)
+		}
+		segments = append(segments, segment.String())
+		segment.Reset()
+		return nil
+	}
+
+	afterBracket := false
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '.':
+			if err := flush(afterBracket); err != nil {
+				return nil, err
+			}
+			afterBracket = false
+		case '[':
+			if segment.Len() > 0 {
+				segments = append(segments, segment.String())
+				segment.Reset()
+			} else if i > 0 && !afterBracket {
+				return nil, fmt.Errorf("invalid value path '%s': empty segment before '['", path)
+			}
+
+			closing := strings.IndexByte(path[i+1:], ']')
+			if closing < 0 {
+				return nil, fmt.Errorf("invalid value path '%s': unclosed '['", path)
+			}
+			key := path[i+1 : i+1+closing]
+			if key == "" || strings.ContainsRune(key, '[') {
+				return nil, fmt.Errorf("invalid value path '%s': invalid element '[%s]'", path, key)
+			}
+
+			segments = append(segments, key)
+			i += closing + 1
+			afterBracket = true
+		case ']':
+			return nil, fmt.Errorf("invalid value path '%s': unexpected ']'", path)
+		default:
+			if afterBracket && segment.Len() == 0 && i > 0 && path[i-1] == ']' {
+				return nil, fmt.Errorf("invalid value path '%s': expected '.' or '[' after ']'", path)
+			}
+			segment.WriteByte(path[i])
+			afterBracket = false
+		}
+	}
+
+	if err := flush(afterBracket); err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+// listElement returns the index of the element of a list named as given, or at the given index.
+func listElement(list []interface{}, key string) (int, bool) {
+	for i, element := range list {
+		if name, _ := elementName(element); name == key {
+			return i, true
+		}
+	}
+
+	if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(list) {
+		return index, true
+	}
+
+	return 0, false
+}
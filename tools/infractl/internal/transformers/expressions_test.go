@@ -0,0 +1,239 @@
+package transformers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitValuePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr string
+	}{
+		{path: "product.name", want: []string{"product", "name"}},
+		{path: "stacks[stack-datastore].tags.x", want: []string{"stacks", "stack-datastore", "tags", "x"}},
+		{path: "stacks[v1.2].name", want: []string{"stacks", "v1.2", "name"}},
+		{path: "stacks[s].layers[db].components[0]", want: []string{"stacks", "s", "layers", "db", "components", "0"}},
+		{path: "list[0][1]", want: []string{"list", "0", "1"}},
+		{path: "stacks[s]", want: []string{"stacks", "s"}},
+		{path: "", wantErr: "empty segment"},
+		{path: "product..name", wantErr: "empty segment"},
+		{path: "product.", wantErr: "empty segment"},
+		{path: ".product", wantErr: "empty segment"},
+		{path: "stacks[s", wantErr: "unclosed '['"},
+		{path: "stacks[]", wantErr: "invalid element"},
+		{path: "stacks[a[b]]", wantErr: "invalid element"},
+		{path: "stacks]", wantErr: "unexpected ']'"},
+		{path: "stacks[s]name", wantErr: "expected '.' or '['"},
+		{path: "stacks.[s]", wantErr: "empty segment before '['"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := splitValuePath(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitValuePath(%q) error = %v, want it to contain %q", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitValuePath(%q) unexpected error: %v", tt.path, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitValuePath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindInterpolations(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []interpolation
+	}{
+		{value: "plain", want: nil},
+		{value: "${AWS_REGION}", want: []interpolation{{start: 0, end: 13, body: "AWS_REGION"}}},
+		{value: "${AWS_REGION:-us-east-1}", want: []interpolation{{start: 0, end: 24, body: "AWS_REGION:-us-east-1"}}},
+		{value: "a-${product.name}-b", want: []interpolation{{start: 2, end: 17, body: "product.name", isExpression: true}}},
+		{value: `${format("}%s", x)}`, want: []interpolation{{start: 0, end: 19, body: `format("}%s", x)`, isExpression: true}}},
+		{value: "${unclosed", want: nil},
+		{value: "${A}${lower(b)}", want: []interpolation{
+			{start: 0, end: 4, body: "A"},
+			{start: 4, end: 15, body: "lower(b)", isExpression: true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := findInterpolations(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findInterpolations(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		body    string
+		want    *expr
+		wantErr string
+	}{
+		{body: "product.name", want: &expr{kind: exprReference, name: "product.name"}},
+		{body: " stacks[v1.2].name ", want: &expr{kind: exprReference, name: "stacks[v1.2].name"}},
+		{body: `"a \"quoted\" string"`, want: &expr{kind: exprLiteral, value: `a "quoted" string`}},
+		{body: "true", want: &expr{kind: exprLiteral, value: true}},
+		{body: "lower()", want: &expr{kind: exprCall, name: "lower"}},
+		{body: `format("%s-%s", product.name, "eu")`, want: &expr{kind: exprCall, name: "format", args: []*expr{
+			{kind: exprLiteral, value: "%s-%s"},
+			{kind: exprReference, name: "product.name"},
+			{kind: exprLiteral, value: "eu"},
+		}}},
+		{body: "lower(upper(x))", want: &expr{kind: exprCall, name: "lower", args: []*expr{
+			{kind: exprCall, name: "upper", args: []*expr{{kind: exprReference, name: "x"}}},
+		}}},
+		{body: "", wantErr: ""},
+		{body: "product.", wantErr: "empty path segment"},
+		{body: "stacks[", wantErr: "unterminated or empty '['"},
+		{body: "stacks[]", wantErr: "unterminated or empty '['"},
+		{body: "lower(x", wantErr: "missing ')'"},
+		{body: "lower(x y)", wantErr: "expected ',' or ')'"},
+		{body: `"unterminated`, wantErr: ""},
+		{body: "a b", wantErr: "unexpected 'b'"},
+		{body: "lower(,)", wantErr: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			got, err := parseExpression(tt.body)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("parseExpression(%q) = %+v, want an error", tt.body, got)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseExpression(%q) error = %v, want it to contain %q", tt.body, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseExpression(%q) unexpected error: %v", tt.body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseExpression(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+// expressionsDocument is a configuration document holding expressions, for the evaluator tests.
+func expressionsDocument(values map[string]interface{}) map[string]interface{} {
+	document := map[string]interface{}{
+		"product": map[string]interface{}{"name": "Ref-Arch", "version": "1.2.0"},
+		"providers": map[string]interface{}{
+			"aws": map[string]interface{}{"config": map[string]interface{}{"region": "eu-west-1", "access_key": "AKIA"}},
+		},
+		"secrets": map[string]interface{}{"aws": map[string]interface{}{"secret_key": "hunter2"}},
+		"stacks": []interface{}{
+			map[string]interface{}{"name": "v1.2", "tags": map[string]interface{}{"purpose": "data"}},
+			map[string]interface{}{"name": "stack-datastore", "tags": map[string]interface{}{"purpose": "store"}},
+		},
+	}
+	for key, value := range values {
+		document[key] = value
+	}
+
+	return document
+}
+
+func TestEvaluateExpressions(t *testing.T) {
+	t.Setenv("INFRACTL_TEST_ENV", "staging")
+
+	isHidden := func(valuePath string) bool { return valuePath == "providers.aws.config.access_key" }
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{name: "literal text", value: "no expressions", want: "no expressions"},
+		{name: "reference", value: "${product.name}-app", want: "Ref-Arch-app"},
+		{name: "named list element", value: "${stacks[stack-datastore].tags.purpose}", want: "store"},
+		{name: "named list element with dots", value: "${stacks[v1.2].name}", want: "v1.2"},
+		{name: "list element by index", value: "${stacks[1].name}", want: "stack-datastore"},
+		{name: "functions", value: `${lower(format("%s-%s", product.name, env("INFRACTL_TEST_ENV")))}`, want: "ref-arch-staging"},
+		{name: "replace and upper", value: `${upper(replace(product.version, ".", "_"))}`, want: "1_2_0"},
+		{name: "join list", value: `${join(",", "a", "b")}`, want: "a,b"},
+		{name: "coalesce", value: `${coalesce("", product.name)}`, want: "Ref-Arch"},
+		{name: "env default", value: `${env("INFRACTL_TEST_UNSET", "fallback")}`, want: "fallback"},
+		{name: "chained references", value: map[string]interface{}{"a": "${x.b}", "b": "${product.name}"}, want: map[string]interface{}{"a": "Ref-Arch", "b": "Ref-Arch"}},
+		{name: "unknown path", value: "${product.missing}", wantErr: "'product.missing' is not set"},
+		{name: "unknown element", value: "${stacks[nope].name}", wantErr: "no element 'nope'"},
+		{name: "malformed path", value: "${stacks[v1.2]name}", wantErr: "unexpected 'name'"},
+		{name: "unknown function", value: "${nope(product.name)}", wantErr: "unknown function nope()"},
+		{name: "wrong arity", value: "${lower(product.name, product.name)}", wantErr: "lower() expects 1 argument(s)"},
+		{name: "format mismatch", value: `${format("%s-%s", product.name)}`, wantErr: "does not match"},
+		{name: "unset env", value: `${env("INFRACTL_TEST_UNSET")}`, wantErr: "is not set"},
+		{name: "secret", value: "${secrets.aws.secret_key}", wantErr: "holds a secret"},
+		{name: "hidden provider value", value: "${providers.aws.config.access_key}", wantErr: "holds a secret"},
+		{name: "mapping as a string", value: "${stacks[v1.2].tags}", wantErr: "cannot be used as a string"},
+		{name: "cycle", value: map[string]interface{}{"a": "${x.b}", "b": "${x.a}"}, wantErr: "reference cycle"},
+		{name: "unterminated call", value: "${lower(product.name}", wantErr: "missing ')'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluated, err := evaluateExpressions(expressionsDocument(map[string]interface{}{"x": tt.value}), isHidden)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("evaluateExpressions() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evaluateExpressions() unexpected error: %v", err)
+			}
+			if got := evaluated["x"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evaluateExpressions() x = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpressionsLeavesSecretsAsIs(t *testing.T) {
+	document := expressionsDocument(map[string]interface{}{
+		"secrets": map[string]interface{}{"aws": map[string]interface{}{"secret_key": "${product.name}"}},
+	})
+
+	evaluated, err := evaluateExpressions(document, func(string) bool { return false })
+	if err != nil {
+		t.Fatalf("evaluateExpressions() unexpected error: %v", err)
+	}
+
+	secrets := evaluated["secrets"].(map[string]interface{})["aws"].(map[string]interface{})
+	if secrets["secret_key"] != "${product.name}" {
+		t.Errorf("secret evaluated to %v, want it left as-is", secrets["secret_key"])
+	}
+}
+
+func TestMalformedExpressionsDoNotPanic(t *testing.T) {
+	malformed := []string{
+		"${", "${}", "${.}", "${[}", "${]}", "${[]}", "${a[}", "${a]}", "${a[b}", "${a.[b]}", "${a[b]c}",
+		"${a..b}", `${"}`, `${"\"}`, "${(}", "${)}", "${a(}", "${a(,)}", "${a(b,)}", "${1.2.3}", "${-}",
+		"${stacks[v1.2].}", "${stacks[v1.2]..name}", "${lower(stacks[)}", "${ ${product.name} }",
+	}
+
+	for _, value := range malformed {
+		t.Run(value, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("evaluating %q panicked: %v", value, r)
+				}
+			}()
+
+			_, _ = evaluateExpressions(expressionsDocument(map[string]interface{}{"x": value}), func(string) bool { return false })
+		})
+	}
+}
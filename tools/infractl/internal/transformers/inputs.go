@@ -0,0 +1,494 @@
+package transformers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/graph"
+)
+
+// InputIssueKind is the kind of problem found in the inputs of a component.
+type InputIssueKind string
+
+const (
+	// InputIssueUnknown is an input that no variable of the Terraform module declares, e.g. a typo.
+	InputIssueUnknown InputIssueKind = "unknown"
+	// InputIssueMissing is a variable of the Terraform module without default that no input sets.
+	InputIssueMissing InputIssueKind = "missing"
+	// InputIssueType is an input whose value cannot be converted into the type of its variable.
+	InputIssueType InputIssueKind = "type"
+)
+
+// EffectiveInput is an input of a component, once the inputs of its stack, layer and own are merged.
+type EffectiveInput struct {
+	Value interface{}
+	// Path is the path of the value that won the merge, e.g. stacks[stack-datastore].layers[db].inputs.region
+	Path string
+}
+
+// InputIssue is a problem found in the inputs of a component, against the variables of its Terraform module.
+type InputIssue struct {
+	// Component is the ID of the component, <stack>/<layer>/<component>
+	Component string         `json:"component"`
+	Kind      InputIssueKind `json:"kind"`
+	// Input is the name of the input, or of the missing variable.
+	Input string `json:"input"`
+	// Path is the path of the value of the input, empty for a missing variable.
+	Path string `json:"path,omitempty"`
+	// Variable is where the variable is declared, as <file>:<line>, empty for an unknown input.
+	Variable string `json:"variable,omitempty"`
+	// Reason explains the problem.
+	Reason string `json:"reason"`
+	// Source is where the value of the input is set, in the environment configuration file that won the merge, when known.
+	Source *cfg.ValueLocation `json:"source,omitempty"`
+}
+
+// String renders the issue as [<file>:<line>:<column>: ]<component>: <input> (<reason>)
+func (i InputIssue) String() string {
+	location := ""
+	if i.Source != nil {
+		location = i.Source.String() + ": "
+	}
+
+	return fmt.Sprintf("%s%s: %s (%s)", location, i.Component, i.Input, i.Reason)
+}
+
+// EffectiveInputs merges the inputs of a component over those of its layer, over those of its stack, like the
+// terragrunt.hcl of the component does: an input set at a more specific level replaces it as a whole.
+//
+// Parameters:
+//   - stack, layer, component: The component, and the layer and stack it belongs to.
+//
+// Returns:
+//   - The effective inputs of the component, by name.
+func EffectiveInputs(stack cfg.StackConfig, layer cfg.LayerConfig, component cfg.ComponentConfig) map[string]EffectiveInput {
+	stackPath := fmt.Sprintf("stacks[%s]", stack.Name)
+	layerPath := fmt.Sprintf("%s.layers[%s]", stackPath, layer.Name)
+	componentPath := fmt.Sprintf("%s.components[%s]", layerPath, component.Name)
+
+	effective := map[string]EffectiveInput{}
+	for _, level := range []struct {
+		path   string
+		inputs map[string]interface{}
+	}{
+		{stackPath, stack.Inputs},
+		{layerPath, layer.Inputs},
+		{componentPath, component.Inputs},
+	} {
+		for name, value := range level.inputs {
+			effective[name] = EffectiveInput{Value: value, Path: level.path + ".inputs." + name}
+		}
+	}
+
+	return effective
+}
+
+// CheckInputs checks the effective inputs of a component against the variables of its Terraform module: every
+// input must be declared, every variable without default must be set, and every value must be convertible into
+// the type of its variable, following Terraform's conversion rules (e.g. "10" is a valid number).
+//
+// Parameters:
+//   - componentID: The ID of the component, <stack>/<layer>/<component>
+//   - inputs: The effective inputs of the component (see EffectiveInputs).
+//   - variables: The variables of the Terraform module of the component.
+//
+// Returns:
+//   - The issues found, sorted by input name.
+func CheckInputs(componentID string, inputs map[string]EffectiveInput, variables []graph.TerraformVariable) []InputIssue {
+	var issues []InputIssue
+
+	declared := map[string]graph.TerraformVariable{}
+	for _, variable := range variables {
+		declared[variable.Name] = variable
+
+		if _, isSet := inputs[variable.Name]; !isSet && variable.Required {
+			issues = append(issues, InputIssue{
+				Component: componentID,
+				Kind:      InputIssueMissing,
+				Input:     variable.Name,
+				Variable:  variable.Source,
+				Reason:    "the variable has no default, and no stack, layer or component input sets it",
+			})
+		}
+	}
+
+	for name, input := range inputs {
+		variable, isDeclared := declared[name]
+		if !isDeclared {
+			issues = append(issues, InputIssue{
+				Component: componentID,
+				Kind:      InputIssueUnknown,
+				Input:     name,
+				Path:      input.Path,
+				Reason:    fmt.Sprintf("the Terraform module declares no such variable%s", closestVariableHint(name, variables)),
+			})
+			continue
+		}
+
+		if variable.Type == "" {
+			continue
+		}
+
+		constraint, err := parseTerraformType(variable.Type)
+		if err != nil {
+			// Type constraints infractl doesn't understand are left to terraform.
+			continue
+		}
+
+		if problem := constraint.check(input.Value, name); problem != "" {
+			issues = append(issues, InputIssue{
+				Component: componentID,
+				Kind:      InputIssueType,
+				Input:     name,
+				Path:      input.Path,
+				Variable:  variable.Source,
+				Reason:    fmt.Sprintf("%s, the variable is %s", problem, variable.Type),
+			})
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Input < issues[j].Input
+	})
+
+	return issues
+}
+
+// closestVariableHint suggests the declared variable an unknown input is most likely a typo of.
+func closestVariableHint(name string, variables []graph.TerraformVariable) string {
+	best, bestDistance := "", len(name)/3+1
+	for _, variable := range variables {
+		if distance := editDistance(name, variable.Name); distance < bestDistance {
+			best, bestDistance = variable.Name, distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean '%s'?", best)
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(b)]
+}
+
+// terraformType is a parsed Terraform type constraint.
+type terraformType struct {
+	// kind is any, string, number, bool, list, set, map, tuple or object.
+	kind string
+	// element is the type of the elements of a list, set or map.
+	element *terraformType
+	// elements are the types of the elements of a tuple.
+	elements []*terraformType
+	// attributes are the types of the attributes of an object.
+	attributes map[string]*terraformType
+	// optional lists the optional attributes of an object.
+	optional map[string]bool
+}
+
+// parseTerraformType parses a Terraform type constraint, e.g. list(object({ name = string, size = optional(number) }))
+func parseTerraformType(constraint string) (*terraformType, error) {
+	p := &exprParser{input: constraint}
+
+	parsed, err := p.parseTerraformType()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipTypeSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected '%s' in type %s", p.input[p.pos:], constraint)
+	}
+
+	return parsed, nil
+}
+
+// skipTypeSpaces skips the blanks and new lines of a type constraint.
+func (p *exprParser) skipTypeSpaces() {
+	for p.pos < len(p.input) && strings.ContainsRune(" \t\r\n", rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// expectType consumes a character of a type constraint, or fails.
+func (p *exprParser) expectType(c byte) error {
+	p.skipTypeSpaces()
+	if p.pos >= len(p.input) || p.input[p.pos] != c {
+		return fmt.Errorf("expected '%c' at position %d of type %s", c, p.pos+1, p.input)
+	}
+	p.pos++
+
+	return nil
+}
+
+func (p *exprParser) parseTerraformType() (*terraformType, error) {
+	p.skipTypeSpaces()
+	start := p.pos
+	for p.pos < len(p.input) && isIdentifierChar(p.input[p.pos]) {
+		p.pos++
+	}
+	kind := p.input[start:p.pos]
+
+	switch kind {
+	case "any", "string", "number", "bool":
+		return &terraformType{kind: kind}, nil
+
+	case "list", "set", "map":
+		if err := p.expectType('('); err != nil {
+			return nil, err
+		}
+		element, err := p.parseTerraformType()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectType(')'); err != nil {
+			return nil, err
+		}
+		return &terraformType{kind: kind, element: element}, nil
+
+	case "tuple":
+		parsed := &terraformType{kind: kind}
+		if err := p.expectType('('); err != nil {
+			return nil, err
+		}
+		if err := p.expectType('['); err != nil {
+			return nil, err
+		}
+		for {
+			p.skipTypeSpaces()
+			if p.pos < len(p.input) && p.input[p.pos] == ']' {
+				p.pos++
+				break
+			}
+			element, err := p.parseTerraformType()
+			if err != nil {
+				return nil, err
+			}
+			parsed.elements = append(parsed.elements, element)
+			p.skipTypeSpaces()
+			if p.pos < len(p.input) && p.input[p.pos] == ',' {
+				p.pos++
+			}
+		}
+		return parsed, p.expectType(')')
+
+	case "object":
+		return p.parseObjectType()
+
+	default:
+		return nil, fmt.Errorf("unsupported type '%s' in %s", kind, p.input)
+	}
+}
+
+func (p *exprParser) parseObjectType() (*terraformType, error) {
+	parsed := &terraformType{kind: "object", attributes: map[string]*terraformType{}, optional: map[string]bool{}}
+
+	if err := p.expectType('('); err != nil {
+		return nil, err
+	}
+	if err := p.expectType('{'); err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipTypeSpaces()
+		if p.pos < len(p.input) && p.input[p.pos] == '}' {
+			p.pos++
+			break
+		}
+		if p.pos < len(p.input) && p.input[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+
+		start := p.pos
+		for p.pos < len(p.input) && isIdentifierChar(p.input[p.pos]) {
+			p.pos++
+		}
+		name := p.input[start:p.pos]
+		if name == "" {
+			return nil, fmt.Errorf("expected an attribute name at position %d of type %s", p.pos+1, p.input)
+		}
+
+		p.skipTypeSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '=' && p.input[p.pos] != ':') {
+			return nil, fmt.Errorf("expected '=' after attribute %s of type %s", name, p.input)
+		}
+		p.pos++
+
+		attribute, optional, err := p.parseAttributeType()
+		if err != nil {
+			return nil, err
+		}
+		parsed.attributes[name] = attribute
+		parsed.optional[name] = optional
+	}
+
+	return parsed, p.expectType(')')
+}
+
+// parseAttributeType parses the type of an object attribute, which may be optional(type[, default]).
+func (p *exprParser) parseAttributeType() (*terraformType, bool, error) {
+	p.skipTypeSpaces()
+	if !strings.HasPrefix(p.input[p.pos:], "optional") {
+		attribute, err := p.parseTerraformType()
+		return attribute, false, err
+	}
+
+	p.pos += len("optional")
+	if err := p.expectType('('); err != nil {
+		return nil, false, err
+	}
+	attribute, err := p.parseTerraformType()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Skip the default value, if any.
+	depth := 1
+	for ; p.pos < len(p.input) && depth > 0; p.pos++ {
+		switch p.input[p.pos] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+	}
+	if depth > 0 {
+		return nil, false, fmt.Errorf("missing ')' closing optional( in type %s", p.input)
+	}
+
+	return attribute, true, nil
+}
+
+// check reports why a value cannot be converted into the type, or an empty string if it can.
+func (t *terraformType) check(value interface{}, valuePath string) string {
+	if value == nil || t.kind == "any" {
+		return ""
+	}
+
+	switch t.kind {
+	case "string":
+		switch value.(type) {
+		case string, bool, json.Number, float64, int, int64:
+			return ""
+		}
+	case "number":
+		switch typed := value.(type) {
+		case json.Number, float64, int, int64:
+			return ""
+		case string:
+			if _, err := strconv.ParseFloat(typed, 64); err == nil {
+				return ""
+			}
+		}
+	case "bool":
+		switch typed := value.(type) {
+		case bool:
+			return ""
+		case string:
+			if typed == "true" || typed == "false" {
+				return ""
+			}
+		}
+	case "list", "set", "tuple":
+		elements, isList := value.([]interface{})
+		if !isList {
+			break
+		}
+		if t.kind == "tuple" && len(elements) != len(t.elements) {
+			return fmt.Sprintf("%s has %d element(s), expected %d", valuePath, len(elements), len(t.elements))
+		}
+		for i, element := range elements {
+			elementType := t.element
+			if t.kind == "tuple" {
+				elementType = t.elements[i]
+			}
+			if problem := elementType.check(element, fmt.Sprintf("%s[%d]", valuePath, i)); problem != "" {
+				return problem
+			}
+		}
+		return ""
+	case "map", "object":
+		attributes, isMap := value.(map[string]interface{})
+		if !isMap {
+			break
+		}
+		if t.kind == "map" {
+			for _, key := range sortedMapKeys(attributes) {
+				if problem := t.element.check(attributes[key], valuePath+"."+key); problem != "" {
+					return problem
+				}
+			}
+			return ""
+		}
+		for _, name := range sortedMapKeys(t.attributes) {
+			attribute, isSet := attributes[name]
+			if !isSet {
+				if t.optional[name] {
+					continue
+				}
+				return fmt.Sprintf("%s misses the attribute '%s'", valuePath, name)
+			}
+			if problem := t.attributes[name].check(attribute, valuePath+"."+name); problem != "" {
+				return problem
+			}
+		}
+		return ""
+	}
+
+	return fmt.Sprintf("%s is %s", valuePath, describeValue(value))
+}
+
+// describeValue names the kind of a value, for type mismatch reports.
+func describeValue(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return fmt.Sprintf("the string %q", typed)
+	case bool:
+		return fmt.Sprintf("the bool %t", typed)
+	case json.Number, float64, int, int64:
+		return fmt.Sprintf("the number %v", typed)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a mapping"
+	default:
+		return fmt.Sprintf("a %T", value)
+	}
+}
+
+func sortedMapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,228 @@
+package transformers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+)
+
+// SecretAudit cross-references the secrets of a configuration with the values that read them, through a
+// ${VAR:-secrets.<group>.<key>} default, and with the components that can see them: a component sees the
+// secrets read by the config of the providers it lists, since only those are handed over to its terragrunt run.
+type SecretAudit struct {
+	// Secrets is the usage of every declared secret, sorted by name.
+	Secrets []SecretUsage `json:"secrets"`
+	// Dangling lists the references to secrets that are not declared, sorted by path.
+	Dangling []SecretReferenceUse `json:"dangling"`
+}
+
+// SecretUsage reports who reads a declared secret.
+type SecretUsage struct {
+	// Secret is the name of the secret, e.g. secrets.aws.access_key
+	Secret string `json:"secret"`
+	Group  string `json:"group"`
+	Key    string `json:"key"`
+	// Providers lists the providers whose config reads the secret.
+	Providers []string `json:"providers"`
+	// Components lists the components that can see the secret, as <stack>/<layer>/<component>
+	Components []string `json:"components"`
+	// References lists every value reading the secret, provider config values or not.
+	References []SecretReferenceUse `json:"references"`
+	// Unused reports whether no component can see the secret: nothing reads it, or only providers no component lists.
+	Unused bool `json:"unused"`
+	// Source is where the secret is declared, in the environment configuration file that won the merge, when known.
+	Source *cfg.ValueLocation `json:"source,omitempty"`
+}
+
+// SecretReferenceUse is a value of the configuration reading a secret, e.g. providers.aws.config.region
+type SecretReferenceUse struct {
+	// Path is the path of the value holding the reference.
+	Path string `json:"path"`
+	// Expression is the reference as written in the configuration, e.g. ${AWS_ACCESS_KEY_ID:-secrets.aws.access_key}
+	Expression string `json:"expression"`
+	// Secret is the secret the reference reads, e.g. secrets.aws.access_key
+	Secret string `json:"secret"`
+	// Provider is the provider whose config holds the value, if any.
+	Provider string `json:"provider,omitempty"`
+	// Reason explains why a dangling reference points at nothing.
+	Reason string `json:"reason,omitempty"`
+	// Source is where the value is set, in the environment configuration file that won the merge, when known.
+	Source *cfg.ValueLocation `json:"source,omitempty"`
+}
+
+// String renders the reference as [<file>:<line>:<column>: ]<path>: <expression>[ (<reason>)]
+func (r SecretReferenceUse) String() string {
+	location := ""
+	if r.Source != nil {
+		location = r.Source.String() + ": "
+	}
+
+	if r.Reason == "" {
+		return fmt.Sprintf("%s%s: %s", location, r.Path, r.Expression)
+	}
+
+	return fmt.Sprintf("%s%s: %s (%s)", location, r.Path, r.Expression, r.Reason)
+}
+
+// UnusedSecrets returns the secrets no component can see.
+func (a *SecretAudit) UnusedSecrets() []SecretUsage {
+	var unused []SecretUsage
+	for _, usage := range a.Secrets {
+		if usage.Unused {
+			unused = append(unused, usage)
+		}
+	}
+
+	return unused
+}
+
+// AuditSecrets analyses which values read which secrets of a configuration, and which components can see them.
+// The configuration is audited as written, before its references are expanded; environment variables play no
+// part, since the ${VAR:-secrets.<group>.<key>} defaults are what an unset variable falls back to.
+//
+// Parameters:
+//   - envConfig: The merged environment configuration, not compiled.
+//
+// Returns:
+//   - The usage of every declared secret, and the references to undeclared ones.
+//   - An error if the configuration cannot be walked.
+func AuditSecrets(envConfig *cfg.EnvConfig) (*SecretAudit, error) {
+	content, err := json.Marshal(envConfig)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling the configuration to audit its secrets: %w", err)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("unmarshalling the configuration to audit its secrets: %w", err)
+	}
+
+	usages := map[string]*SecretUsage{}
+	for groupName, secretGroup := range envConfig.Secrets {
+		for secretKey := range secretGroup {
+			secret := "secrets." + groupName + "." + secretKey
+			usages[secret] = &SecretUsage{
+				Secret:     secret,
+				Group:      groupName,
+				Key:        secretKey,
+				Providers:  []string{},
+				Components: []string{},
+				References: []SecretReferenceUse{},
+			}
+		}
+	}
+
+	audit := &SecretAudit{Secrets: []SecretUsage{}, Dangling: []SecretReferenceUse{}}
+	values := cfg.LeafValues(document)
+	for _, valuePath := range cfg.SortedValuePaths(values) {
+		value, isString := values[valuePath].(string)
+		if !isString {
+			continue
+		}
+
+		for _, matches := range envVarReferencePattern.FindAllStringSubmatch(value, -1) {
+			if len(matches) < 3 || !strings.HasPrefix(matches[2], "secrets.") {
+				continue
+			}
+
+			use := SecretReferenceUse{
+				Path:       valuePath,
+				Expression: matches[0],
+				Secret:     matches[2],
+				Provider:   providerOfValuePath(envConfig, valuePath),
+			}
+
+			usage, declared := usages[use.Secret]
+			if !declared {
+				use.Reason = danglingSecretReason(envConfig, use.Secret)
+				audit.Dangling = append(audit.Dangling, use)
+				continue
+			}
+
+			usage.References = append(usage.References, use)
+			if use.Provider != "" && !containsString(usage.Providers, use.Provider) {
+				usage.Providers = append(usage.Providers, use.Provider)
+			}
+		}
+	}
+
+	for _, usage := range usages {
+		sort.Strings(usage.Providers)
+		usage.Components = componentsListingProviders(envConfig, usage.Providers)
+		usage.Unused = len(usage.Components) == 0
+		audit.Secrets = append(audit.Secrets, *usage)
+	}
+
+	sort.Slice(audit.Secrets, func(i, j int) bool {
+		return audit.Secrets[i].Secret < audit.Secrets[j].Secret
+	})
+
+	return audit, nil
+}
+
+// providerOfValuePath returns the provider whose config holds a value, or an empty string.
+func providerOfValuePath(envConfig *cfg.EnvConfig, valuePath string) string {
+	for providerName := range envConfig.Providers {
+		if cfg.IsValuePathUnder(valuePath, "providers."+providerName+".config") {
+			return providerName
+		}
+	}
+
+	return ""
+}
+
+// danglingSecretReason explains why a secret reference points at nothing: a malformed name, a missing group
+// or a missing key.
+func danglingSecretReason(envConfig *cfg.EnvConfig, secret string) string {
+	parts := strings.Split(secret, ".")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return "not a secrets.<group>.<key> reference"
+	}
+
+	secretGroup, exists := envConfig.Secrets[parts[1]]
+	if !exists {
+		return fmt.Sprintf("secret group '%s' is not declared", parts[1])
+	}
+
+	keys := make([]string, 0, len(secretGroup))
+	for key := range secretGroup {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return fmt.Sprintf("secret group '%s' has no key '%s', it declares: %s", parts[1], parts[2], strings.Join(keys, ", "))
+}
+
+// componentsListingProviders returns the components, as <stack>/<layer>/<component>, that list any of the providers.
+func componentsListingProviders(envConfig *cfg.EnvConfig, providers []string) []string {
+	components := []string{}
+	for _, stack := range envConfig.Stacks {
+		for _, layer := range stack.Layers {
+			for _, component := range layer.Components {
+				for _, providerName := range component.Providers {
+					if containsString(providers, providerName) {
+						components = append(components, strings.Join([]string{stack.Name, layer.Name, component.Name}, "/"))
+						break
+					}
+				}
+			}
+		}
+	}
+
+	sort.Strings(components)
+
+	return components
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
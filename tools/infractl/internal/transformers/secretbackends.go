@@ -0,0 +1,291 @@
+package transformers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	sopsSecretScheme  = "sops"
+	fileSecretScheme  = "file"
+	execSecretScheme  = "exec"
+	vaultSecretScheme = "vault"
+
+	// VaultAddrEnvVar and VaultTokenEnvVar configure the Vault server vault:// references are read from.
+	VaultAddrEnvVar  = "VAULT_ADDR"
+	VaultTokenEnvVar = "VAULT_TOKEN"
+	// vaultAddrDefault is the address of a Vault server started in dev mode ('vault server -dev').
+	vaultAddrDefault = "http://127.0.0.1:8200"
+	vaultTimeout     = 10 * time.Second
+)
+
+// documentCache caches the documents a backend reads, so several keys of the same file or path are read once.
+type documentCache struct {
+	mu        sync.Mutex
+	documents map[string]map[string]interface{}
+}
+
+func (c *documentCache) get(path string, load func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if document, ok := c.documents[path]; ok {
+		return document, nil
+	}
+
+	document, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.documents == nil {
+		c.documents = map[string]map[string]interface{}{}
+	}
+	c.documents[path] = document
+
+	return document, nil
+}
+
+// commandError adds what a failed command printed on its standard error, if anything, to its error.
+func commandError(err error, stderr bytes.Buffer) error {
+	if output := strings.TrimSpace(stderr.String()); output != "" {
+		return fmt.Errorf("%w: %s", err, output)
+	}
+
+	return err
+}
+
+// SopsSecretProvider resolves sops://<path>#<key> references, decrypting SOPS files (YAML or JSON, encrypted
+// with age keys) in-process, as the encrypted environment configuration files are. The key is looked up in the
+// decrypted document, e.g. sops://secrets/local.enc.yaml#aws.access_key
+type SopsSecretProvider struct {
+	BaseDir string
+	cache   documentCache
+}
+
+// NewSopsSecretProvider creates a provider for sops:// references, resolving relative paths from baseDir.
+func NewSopsSecretProvider(baseDir string) *SopsSecretProvider {
+	return &SopsSecretProvider{BaseDir: baseDir}
+}
+
+// Scheme returns 'sops'
+func (p *SopsSecretProvider) Scheme() string {
+	return sopsSecretScheme
+}
+
+// Resolve decrypts the SOPS file once, and returns the value of the key.
+func (p *SopsSecretProvider) Resolve(ref SecretRef) (string, error) {
+	if ref.Key == "" {
+		return "", fmt.Errorf("sops references need a key, e.g. sops://%s#group.key", ref.Path)
+	}
+
+	path := resolvePath(p.BaseDir, ref.Path)
+	document, err := p.cache.get(path, func() (map[string]interface{}, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		var root yaml.Node
+		if err := yaml.Unmarshal(content, &root); err != nil {
+			return nil, fmt.Errorf("parsing %s: only YAML and JSON sops files are supported: %w", path, err)
+		}
+
+		identities, err := cfg.LoadAgeIdentities()
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt %s: %w", path, err)
+		}
+
+		if _, err := cfg.DecryptSopsNode(path, &root, identities); err != nil {
+			return nil, err
+		}
+
+		document := map[string]interface{}{}
+		if err := root.Decode(&document); err != nil {
+			return nil, fmt.Errorf("parsing the secrets document: %w", err)
+		}
+
+		return document, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return lookupSecretKey(document, ref.Key)
+}
+
+// FileSecretProvider resolves file://<path> references to the content of the file, without its trailing
+// newline, and file://<path>#<key> references to a key of the YAML or JSON document in the file.
+type FileSecretProvider struct {
+	BaseDir string
+	cache   documentCache
+}
+
+// NewFileSecretProvider creates a provider for file:// references, resolving relative paths from baseDir.
+func NewFileSecretProvider(baseDir string) *FileSecretProvider {
+	return &FileSecretProvider{BaseDir: baseDir}
+}
+
+// Scheme returns 'file'
+func (p *FileSecretProvider) Scheme() string {
+	return fileSecretScheme
+}
+
+// Resolve reads the file, and returns its content or the value of the key.
+func (p *FileSecretProvider) Resolve(ref SecretRef) (string, error) {
+	path := resolvePath(p.BaseDir, ref.Path)
+
+	if ref.Key == "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", path, err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	document, err := p.cache.get(path, func() (map[string]interface{}, error) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		return parseSecretDocument(content)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return lookupSecretKey(document, ref.Key)
+}
+
+// ExecSecretProvider resolves exec://<command> references to the standard output of the command, without
+// its trailing newline, e.g. exec://pass show infra/aws/access_key
+type ExecSecretProvider struct {
+	BaseDir string
+}
+
+// NewExecSecretProvider creates a provider for exec:// references, running the commands in baseDir.
+func NewExecSecretProvider(baseDir string) *ExecSecretProvider {
+	return &ExecSecretProvider{BaseDir: baseDir}
+}
+
+// Scheme returns 'exec'
+func (p *ExecSecretProvider) Scheme() string {
+	return execSecretScheme
+}
+
+// Resolve runs the command through the shell, and returns its output.
+func (p *ExecSecretProvider) Resolve(ref SecretRef) (string, error) {
+	if strings.TrimSpace(ref.Path) == "" {
+		return "", fmt.Errorf("exec references need a command, e.g. exec://pass show infra/token")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", ref.Path)
+	cmd.Dir = p.BaseDir
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("running '%s': %w", ref.Path, commandError(err, stderr))
+	}
+
+	value := strings.TrimRight(string(output), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("'%s' printed nothing", ref.Path)
+	}
+
+	return value, nil
+}
+
+// VaultSecretProvider resolves vault://<path>#<key> references with the Vault HTTP API, reading
+// <VAULT_ADDR>/v1/<path> with VAULT_TOKEN. The address defaults to the one of a dev-mode server
+// ('vault server -dev'). KV version 2 paths include the 'data' segment, e.g. vault://secret/data/infra#token,
+// and KV version 1 paths don't, e.g. vault://kv/infra#token.
+type VaultSecretProvider struct {
+	// Client is the HTTP client used to call Vault.
+	Client *http.Client
+	cache  documentCache
+}
+
+// NewVaultSecretProvider creates a provider for vault:// references.
+func NewVaultSecretProvider() *VaultSecretProvider {
+	return &VaultSecretProvider{Client: &http.Client{Timeout: vaultTimeout}}
+}
+
+// Scheme returns 'vault'
+func (p *VaultSecretProvider) Scheme() string {
+	return vaultSecretScheme
+}
+
+// Resolve reads the Vault path once, and returns the value of the key.
+func (p *VaultSecretProvider) Resolve(ref SecretRef) (string, error) {
+	if ref.Key == "" {
+		return "", fmt.Errorf("vault references need a key, e.g. vault://%s#key", ref.Path)
+	}
+
+	addr := strings.TrimRight(os.Getenv(VaultAddrEnvVar), "/")
+	if addr == "" {
+		addr = vaultAddrDefault
+	}
+
+	token := os.Getenv(VaultTokenEnvVar)
+	if token == "" {
+		return "", fmt.Errorf("%s is not set", VaultTokenEnvVar)
+	}
+
+	url := addr + "/v1/" + strings.TrimLeft(ref.Path, "/")
+	document, err := p.cache.get(url, func() (map[string]interface{}, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating the request to %s: %w", url, err)
+		}
+		req.Header.Set("X-Vault-Token", token)
+
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", url, err)
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading the response of %s: %w", url, err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("reading %s: vault answered %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+		}
+
+		var payload struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("parsing the response of %s: %w", url, err)
+		}
+
+		// KV version 2 nests the secret in data.data, next to data.metadata.
+		if nested, ok := payload.Data["data"].(map[string]interface{}); ok {
+			if _, versioned := payload.Data["metadata"]; versioned {
+				return nested, nil
+			}
+		}
+
+		return payload.Data, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return lookupSecretKey(document, ref.Key)
+}
@@ -0,0 +1,65 @@
+package transformers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
+)
+
+func TestSopsSecretProviderResolve(t *testing.T) {
+	// The fixtures are encrypted by the sops CLI, see internal/cfg/sops_test.go
+	fixtures, err := filepath.Abs(filepath.Join("..", "cfg", "testdata", "sops"))
+	if err != nil {
+		t.Fatalf("resolving the fixtures: %v", err)
+	}
+	t.Setenv(cfg.AgeKeyEnvVar, "")
+	t.Setenv(cfg.AgeKeyFileEnvVar, filepath.Join(fixtures, "keys.txt"))
+
+	plain := filepath.Join(t.TempDir(), "plain.yaml")
+	if err := os.WriteFile(plain, []byte("aws:\n  access_key: AKIA\n"), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", plain, err)
+	}
+
+	tests := []struct {
+		name    string
+		uri     string
+		want    string
+		wantErr string
+	}{
+		{name: "YAML file", uri: "sops://local.enc.yaml#secrets.aws.secret_key", want: "s3cr3t/with+chars="},
+		{name: "JSON file", uri: "sops://secrets.enc.json#github.token", want: "ghp_fixture"},
+		{name: "number", uri: "sops://secrets.enc.json#port", want: "8080"},
+		{name: "unencrypted value", uri: "sops://local.enc.yaml#secrets.region_unencrypted", want: "eu-west-1"},
+		{name: "missing key", uri: "sops://local.enc.yaml#secrets.aws.nope", wantErr: "secrets.aws.nope"},
+		{name: "no key", uri: "sops://local.enc.yaml", wantErr: "sops references need a key"},
+		{name: "missing file", uri: "sops://nope.enc.yaml#a", wantErr: "reading"},
+		{name: "file not encrypted", uri: "sops://" + plain + "#aws.access_key", wantErr: "is not encrypted"},
+	}
+
+	providers := NewSecretProviders(NewSopsSecretProvider(fixtures))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, ok := providers.ParseRef(tt.uri)
+			if !ok {
+				t.Fatalf("ParseRef(%q) = false, want a sops reference", tt.uri)
+			}
+
+			got, err := providers.Resolve("aws.secret", ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve(%q) error = %v, want it to contain %q", tt.uri, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) unexpected error: %v", tt.uri, err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package transformers
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SecretRef is a URI-style reference to a secret held by a secret backend, e.g. sops://secrets/aws.enc.yaml#aws.access_key
+type SecretRef struct {
+	// URI is the reference as written in the configuration.
+	URI string
+	// Scheme selects the backend, e.g. sops, file, exec or vault.
+	Scheme string
+	// Path is what follows the scheme: a file path, a command, or a Vault API path.
+	Path string
+	// Key is the fragment, if any: the key of the secret in the document the path points to.
+	Key string
+}
+
+// SecretProvider resolves the secret references of a backend.
+type SecretProvider interface {
+	// Scheme is the URI scheme the provider resolves, e.g. 'sops'
+	Scheme() string
+	// Resolve returns the value of a secret reference.
+	Resolve(ref SecretRef) (string, error)
+}
+
+// SecretResolutionError reports which secret failed to resolve, from which backend, and why.
+type SecretResolutionError struct {
+	// Secret is the name of the secret, e.g. aws.access_key
+	Secret string
+	// Ref is the reference of the secret.
+	Ref SecretRef
+	Err error
+}
+
+func (e *SecretResolutionError) Error() string {
+	return fmt.Sprintf("failed to resolve secret '%s' from %s (%s backend): %v", e.Secret, e.Ref.URI, e.Ref.Scheme, e.Err)
+}
+
+func (e *SecretResolutionError) Unwrap() error {
+	return e.Err
+}
+
+// SecretProviders resolves secret references with the provider registered for their scheme, caching every
+// resolved value per backend, so a secret referenced several times is only read once.
+type SecretProviders struct {
+	providers map[string]SecretProvider
+
+	mu    sync.Mutex
+	cache map[string]map[string]string
+}
+
+// NewSecretProviders creates a registry of secret providers.
+func NewSecretProviders(providers ...SecretProvider) *SecretProviders {
+	registry := &SecretProviders{
+		providers: map[string]SecretProvider{},
+		cache:     map[string]map[string]string{},
+	}
+
+	for _, provider := range providers {
+		registry.providers[provider.Scheme()] = provider
+	}
+
+	return registry
+}
+
+// DefaultSecretProviders creates a registry with every built-in backend: sops://, file://, exec:// and vault://.
+//
+// Parameters:
+//   - baseDir: The directory relative file paths are resolved from, usually the root of the git repository.
+//     Commands run by exec:// references run in it too.
+//
+// Returns:
+//   - The registry of secret providers.
+func DefaultSecretProviders(baseDir string) *SecretProviders {
+	return NewSecretProviders(
+		NewSopsSecretProvider(baseDir),
+		NewFileSecretProvider(baseDir),
+		NewExecSecretProvider(baseDir),
+		NewVaultSecretProvider(),
+	)
+}
+
+// Schemes returns the schemes of the registered providers, sorted.
+func (r *SecretProviders) Schemes() []string {
+	schemes := make([]string, 0, len(r.providers))
+	for scheme := range r.providers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+
+	return schemes
+}
+
+// ParseRef parses a secret value into a reference, if it's a URI of a registered scheme.
+//
+// Parameters:
+//   - value: The secret value, as written in the secrets section.
+//
+// Returns:
+//   - The reference, and true, if the value is a URI of a registered scheme; false otherwise (e.g. ${ENV_VAR}).
+func (r *SecretProviders) ParseRef(value string) (SecretRef, bool) {
+	scheme, rest, found := strings.Cut(strings.TrimSpace(value), "://")
+	if !found {
+		return SecretRef{}, false
+	}
+
+	if _, registered := r.providers[scheme]; !registered {
+		return SecretRef{}, false
+	}
+
+	ref := SecretRef{URI: value, Scheme: scheme, Path: rest}
+
+	// Commands may hold '#', so exec:// references have no key.
+	if scheme != execSecretScheme {
+		if path, key, hasKey := strings.Cut(rest, "#"); hasKey {
+			ref.Path, ref.Key = path, key
+		}
+	}
+
+	return ref, true
+}
+
+// Resolve resolves a secret reference with the provider of its scheme.
+//
+// Parameters:
+//   - secretName: The name of the secret, e.g. aws.access_key, reported when the resolution fails.
+//   - ref: The reference to resolve.
+//
+// Returns:
+//   - The value of the secret.
+//   - A *SecretResolutionError naming the secret, its reference and the reason if the resolution fails.
+func (r *SecretProviders) Resolve(secretName string, ref SecretRef) (string, error) {
+	provider, ok := r.providers[ref.Scheme]
+	if !ok {
+		return "", &SecretResolutionError{Secret: secretName, Ref: ref, Err: fmt.Errorf("no secret provider for scheme '%s', expected one of: %s", ref.Scheme, strings.Join(r.Schemes(), ", "))}
+	}
+
+	r.mu.Lock()
+	value, cached := r.cache[ref.Scheme][ref.URI]
+	r.mu.Unlock()
+	if cached {
+		return value, nil
+	}
+
+	value, err := provider.Resolve(ref)
+	if err != nil {
+		return "", &SecretResolutionError{Secret: secretName, Ref: ref, Err: err}
+	}
+
+	r.mu.Lock()
+	if r.cache[ref.Scheme] == nil {
+		r.cache[ref.Scheme] = map[string]string{}
+	}
+	r.cache[ref.Scheme][ref.URI] = value
+	r.mu.Unlock()
+
+	return value, nil
+}
+
+// resolvePath makes a relative path absolute, from the base directory.
+func resolvePath(baseDir, path string) string {
+	if path == "" || filepath.IsAbs(path) || baseDir == "" {
+		return path
+	}
+
+	return filepath.Join(baseDir, path)
+}
+
+// lookupSecretKey looks a key up in a structured document (YAML or JSON). The key is first looked up as-is,
+// then as a dot separated path into nested mappings, e.g. aws.access_key
+func lookupSecretKey(document map[string]interface{}, key string) (string, error) {
+	value, found := document[key]
+
+	if !found {
+		var current interface{} = document
+		found = true
+		for _, part := range strings.Split(key, ".") {
+			mapping, ok := current.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if current, ok = mapping[part]; !ok {
+				found = false
+				break
+			}
+		}
+		value = current
+	}
+
+	if !found {
+		return "", fmt.Errorf("key '%s' not found", key)
+	}
+
+	switch typed := value.(type) {
+	case nil:
+		return "", fmt.Errorf("key '%s' is empty", key)
+	case map[string]interface{}, []interface{}:
+		return "", fmt.Errorf("key '%s' holds a %T, not a value", key, typed)
+	default:
+		return fmt.Sprint(typed), nil
+	}
+}
+
+// parseSecretDocument parses a YAML or JSON document holding secrets.
+func parseSecretDocument(content []byte) (map[string]interface{}, error) {
+	document := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("parsing the secrets document: %w", err)
+	}
+
+	return document, nil
+}
@@ -1,9 +1,7 @@
 package transformers
 
 import (
-	"fmt"
-	"regexp"
-	"strings"
+	"sort"
 
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
 )
@@ -11,73 +9,47 @@
 // SecretsTransformer provides methods for managing and validating secrets
 type SecretsTransformer struct {
 	EnvConfig *cfg.EnvConfig
+	// envVarsTransformer resolves the secret values, like the compilation does.
+	envVarsTransformer *EnvVarsTransformer
 }
 
 // NewSecretsTransformer creates a new SecretsTransformer
 func NewSecretsTransformer(envConfig *cfg.EnvConfig) *SecretsTransformer {
+	return NewSecretsTransformerWithSecretProviders(envConfig, DefaultSecretProviders(""))
+}
+
+// NewSecretsTransformerWithSecretProviders creates a new SecretsTransformer, resolving secret references with the
+// given secret providers.
+func NewSecretsTransformerWithSecretProviders(envConfig *cfg.EnvConfig, secretProviders *SecretProviders) *SecretsTransformer {
 	return &SecretsTransformer{
-		EnvConfig: envConfig,
+		EnvConfig:          envConfig,
+		envVarsTransformer: NewEnvVarsTransformerWithSecretProviders(envConfig, secretProviders),
 	}
 }
 
-// ValidateSecrets performs comprehensive validation on secrets
-func (st *SecretsTransformer) ValidateSecrets() error {
-	// Create an environment transformer to leverage its resolution logic
-	envTransformer := NewEnvVarsTransformer(st.EnvConfig)
-	var missingSecretVars []string
+// ValidateSecrets checks that the ${VAR} references of the secrets section resolve.
+//
+// Returns:
+//   - Every unresolved reference, required and optional, sorted by path.
+//   - An *UnresolvedReferencesError if any of them is required.
+func (st *SecretsTransformer) ValidateSecrets() ([]UnresolvedReference, error) {
+	var unresolved []UnresolvedReference
 
-	// Validate secrets section
 	for groupName, secretGroup := range st.EnvConfig.Secrets {
 		for secretKey, secretValue := range secretGroup {
-			// Use environment transformer's resolution logic
-			resolvedValue, err := envTransformer.resolveValue(secretValue)
-
-			// If resolution fails or returns the original value, it means variables are missing
-			if err != nil || resolvedValue == secretValue {
-				missingVar := extractMissingVariable(secretValue)
-				if missingVar != "" {
-					missingSecretVars = append(missingSecretVars, missingVar)
-					fmt.Printf("Missing secret variable in %s.%s: %s\n", groupName, secretKey, missingVar)
-				}
-			}
+			unresolved = append(unresolved, st.envVarsTransformer.unresolvedReferences("secrets."+groupName+"."+secretKey, secretValue)...)
 		}
 	}
 
-	// Return error if any missing secret variables found
-	if len(missingSecretVars) > 0 {
-		return fmt.Errorf("missing secret environment variables: %v", missingSecretVars)
-	}
-
-	return nil
-}
-
-// extractMissingVariable extracts the first missing variable from a secret value
-func extractMissingVariable(secretValue string) string {
-	re := regexp.MustCompile(`\${([^}:-]+)(?::-([^}]*))?}`)
-	matches := re.FindAllStringSubmatch(secretValue, -1)
-
-	for _, match := range matches {
-		if len(match) < 2 {
-			continue
-		}
-
-		envVar := match[1]
-		defaultVal := ""
-		if len(match) > 2 {
-			defaultVal = match[2]
-		}
-
-		// If no default or secrets reference, return the env var
-		if defaultVal == "" || !strings.HasPrefix(defaultVal, "secrets.") {
-			return envVar
-		}
-	}
+	sort.SliceStable(unresolved, func(i, j int) bool {
+		return unresolved[i].Path < unresolved[j].Path
+	})
 
-	return ""
+	return unresolved, unresolvedReferencesError(unresolved)
 }
 
 // ValidateSecrets is a wrapper function for external use
-func ValidateSecrets(envConfig *cfg.EnvConfig) error {
+func ValidateSecrets(envConfig *cfg.EnvConfig) ([]UnresolvedReference, error) {
 	transformer := NewSecretsTransformer(envConfig)
 	return transformer.ValidateSecrets()
 }
@@ -1,12 +1,25 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/cfg"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/controller"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/graph"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/transformers"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/tui"
 	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/logger"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/tg"
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
 	"github.com/alecthomas/kong"
 )
 
@@ -15,6 +28,15 @@
 	Apply    ApplyCmd    `cmd:"" help:"Apply infrastructure changes"`
 	Destroy  DestroyCmd  `cmd:"" help:"Destroy infrastructure"`
 	Validate ValidateCmd `cmd:"" help:"Validate secrets and configurations - It does not compile, just pre-validate the configuration"`
+	Graph    GraphCmd    `cmd:"" help:"Print the component dependency graph of a target environment as Graphviz DOT, Mermaid or JSON"`
+	Compile  CompileCmd  `cmd:"" help:"Compile a target environment configuration and print it as JSON, as it's handed over to Terragrunt"`
+	Explain  ExplainCmd  `cmd:"" help:"Explain where a value of the compiled configuration came from: file, line, winning environment and env var, default or secret"`
+	Schema   SchemaCmd   `cmd:"" help:"Work with the JSON Schema of the environment configuration files (_ENVS/<env>.yaml)"`
+	Env      EnvCmd      `cmd:"" help:"Work with the environment configuration files (_ENVS/<env>.yaml), e.g. edit encrypted ones"`
+	Secrets  SecretsCmd  `cmd:"" help:"Work with the secrets of a target environment configuration, e.g. audit who can see them"`
+
+	Output     string `help:"Output format: 'text' for humans, or 'json' to print a single JSON document per command on the standard output, with the logs as JSON lines on the standard error" enum:"text,json" default:"text"`
+	AgeKeyFile string `help:"Path of the age key file decrypting the encrypted environment configuration files (_ENVS/<env>.enc.yaml). Defaults to the sops default, ~/.config/sops/age/keys.txt" env:"SOPS_AGE_KEY_FILE" optional:"true" type:"path"`
 }
 
 type GenerateCmd struct {
@@ -26,34 +48,491 @@ type GenerateCmd struct {
 	OverrideJSONName string `help:"Optional name of the JSON file to override the default name of the JSON file. E.g.: 'my_custom_name.json'" optional:"true"`
 }
 
-type PlanCmd struct {
-	Stack            string `help:"Name of the stack to execute" required:"true"`
-	Component        string `help:"Optional name of the component to execute" required:"true"`
-	Layer            string `help:"Optional name of the layer to execute" required:"true"`
+// TgTargetFlags groups the flags shared by every command that ends up running Terragrunt against
+// a stack, layer or component of a target environment. --stack and --target-env are required (see Validate).
+type TgTargetFlags struct {
+	Stack            string `help:"Name of the stack to execute. Required" optional:"true"`
+	Component        string `help:"Optional name of the component to execute. Requires --layer. When omitted, every component of the stack or layer runs in dependency order" optional:"true"`
+	Layer            string `help:"Optional name of the layer to execute. When omitted, the whole stack runs in dependency order" optional:"true"`
 	Base             string `help:"Name of the base environment configuration. Defaults to 'base', which corresponds to _ENVS/base.yaml" default:"base" optional:"true"`
-	TargetEnv        string `help:"Name of the target environment. E.g.: local, staging, production. If 'local' is passed, it means that there is a target configuration in _ENVS/local.yaml" required:""`
+	TargetEnv        string `help:"Name of the target environment. E.g.: local, staging, production. If 'local' is passed, it means that there is a target configuration in _ENVS/local.yaml. Required" optional:"true"`
 	OverrideJSONName string `help:"Optional name of the JSON file to override the default name of the JSON file. E.g.: 'my_custom_name.json'" optional:"true"`
+	Strict           bool   `help:"Fail before anything runs when an environment variable reference of the configuration cannot be resolved, reporting every unresolved reference with its path and file, required or optional" optional:"true"`
+
+	// Stack or layer wide runs
+	MultiComponentFlags `embed:""`
+
+	// Timeout and interruption of the terragrunt processes
+	RunControlFlags `embed:""`
+}
+
+// Validate reports the missing --stack and --target-env flags. They're checked here rather than with kong's
+// required tags, so apply can do without them when it applies a saved plan (see ApplyCmd.Validate).
+func (t *TgTargetFlags) Validate() error {
+	var missing []string
+	if t.Stack == "" {
+		missing = append(missing, "--stack")
+	}
+	if t.TargetEnv == "" {
+		missing = append(missing, "--target-env")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing flags: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// RunControlFlags bound how long the Terragrunt backed commands run, and how their terragrunt processes are
+// stopped when they're interrupted (Ctrl-C, SIGTERM or --timeout).
+type RunControlFlags struct {
+	Timeout     time.Duration `help:"Maximum duration of the command, e.g. 45m. Once over, the running terragrunt processes are interrupted as on Ctrl-C" optional:"true"`
+	GracePeriod time.Duration `help:"How long interrupted terragrunt processes are given to exit, e.g. to release their state lock, before they're killed" default:"30s"`
+}
+
+// withTimeout returns the context of a command, done once --timeout is over when it's set.
+func (f RunControlFlags) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeoutCause(ctx, f.Timeout, fmt.Errorf("--timeout of %s exceeded", f.Timeout))
+}
+
+// MultiComponentFlags groups the execution controls of stack or layer wide runs. By default infractl runs
+// the components itself, following their dependency graph; --run-all hands the run over to 'terragrunt run-all'.
+type MultiComponentFlags struct {
+	Parallelism int      `help:"Maximum number of components run in parallel on stack or layer wide runs. Defaults to 4" optional:"true"`
+	IncludeDir  []string `help:"Directory, relative to the stack or layer, to include on stack or layer wide runs. Can be repeated" optional:"true"`
+	ExcludeDir  []string `help:"Directory, relative to the stack or layer, to exclude on stack or layer wide runs. Can be repeated" optional:"true"`
+	RunAll      bool     `help:"Run stack or layer wide runs through 'terragrunt run-all' instead of infractl's dependency ordered execution" optional:"true"`
+	Resume      string   `help:"Identifier of a failed or interrupted stack or layer wide run to resume. Only the components that did not succeed are run" optional:"true"`
+}
+
+type PlanCmd struct {
+	TgTargetFlags    `embed:""`
+	SavePlan         bool   `help:"Save the binary plan, the compiled configuration and a manifest in the cache directory, so the exact plan can be applied later with 'apply --plan <id>'" optional:"true"`
+	DetailedExitcode bool   `help:"Exit with code 2 when the plan succeeded with changes, and 0 when it has none, like 'terraform plan -detailed-exitcode'" optional:"true"`
+	ChangedSince     string `help:"Git ref (e.g. origin/main) to diff the working tree against. Only the components of the stack or layer affected by the changes since then run, with their dependents" optional:"true"`
 }
 
 type ApplyCmd struct {
-	Env              string `help:"Environment configuration file location (ENVS/<environment>.yaml)" required:"true"`
-	Stack            string `help:"Name of the stack to execute" required:"true"`
-	Layer            string `help:"Optional name of the layer to execute" required:"true"`
-	Component        string `help:"Optional name of the component to execute" required:"true"`
-	OverrideJSONName string `help:"Optional name of the JSON file to override the default name of the JSON file. E.g.: 'my_custom_name.json'" optional:"true"`
+	TgTargetFlags `embed:""`
+	AutoApprove   bool   `help:"Skip the interactive approval before applying the changes" optional:"true"`
+	Plan          string `help:"Identifier of a plan saved with 'plan --save-plan'. Applies exactly that plan, refusing it if the configuration, the component or the git commit changed since it was made. The target is the one of the plan: it cannot be combined with --stack, --layer, --component, --target-env or --changed-since" optional:"true"`
+	ChangedSince  string `help:"Git ref (e.g. origin/main) to diff the working tree against. Only the components of the stack or layer affected by the changes since then run, with their dependents" optional:"true"`
+}
+
+// Validate requires the target flags, unless a saved plan is applied: its target is then the one of the
+// plan manifest, and the target flags cannot be passed along.
+func (a *ApplyCmd) Validate() error {
+	if a.Plan == "" {
+		return a.TgTargetFlags.Validate()
+	}
+
+	for _, flag := range []struct{ name, value string }{
+		{"--stack", a.Stack},
+		{"--layer", a.Layer},
+		{"--component", a.Component},
+		{"--target-env", a.TargetEnv},
+		{"--changed-since", a.ChangedSince},
+	} {
+		if flag.value != "" {
+			return fmt.Errorf("--plan and %s can't be used together: a saved plan is applied to the target it was made for", flag.name)
+		}
+	}
+
+	return nil
 }
 
 type DestroyCmd struct {
-	Env              string `help:"Environment configuration file location (ENVS/<environment>.yaml)" required:"true"`
-	Stack            string `help:"Name of the stack to execute" required:"true"`
-	Layer            string `help:"Optional name of the layer to execute" required:"true"`
-	Component        string `help:"Optional name of the component to execute" required:"true"`
-	OverrideJSONName string `help:"Optional name of the JSON file to override the default name of the JSON file. E.g.: 'my_custom_name.json'" optional:"true"`
+	TgTargetFlags `embed:""`
+	AutoApprove   bool `help:"Skip the interactive approval before destroying the infrastructure" optional:"true"`
 }
 
 type ValidateCmd struct {
 	Base      string `help:"Name of the base environment configuration. Defaults to 'base', which corresponds to _ENVS/base.yaml" default:"base" optional:"true"`
 	TargetEnv string `help:"Name of the target environment. E.g.: local, staging, production. If 'local' is passed, it means that there is a target configuration in _ENVS/local.yaml" required:""`
+	Strict    bool   `help:"Fail before anything runs when an environment variable reference of the configuration cannot be resolved, reporting every unresolved reference with its path and file, required or optional" optional:"true"`
+}
+
+type GraphCmd struct {
+	Base             string `help:"Name of the base environment configuration. Defaults to 'base', which corresponds to _ENVS/base.yaml" default:"base" optional:"true"`
+	TargetEnv        string `help:"Name of the target environment. E.g.: local, staging, production. If 'local' is passed, it means that there is a target configuration in _ENVS/local.yaml" required:""`
+	Stack            string `help:"Optional name of a stack, to only graph its components and what they depend on" optional:"true"`
+	Layer            string `help:"Optional name of a layer, to only graph its components and what they depend on. Requires --stack" optional:"true"`
+	Format           string `help:"Output format of the graph" enum:"dot,mermaid,json" default:"dot"`
+	HighlightInvalid bool   `help:"Highlight the components whose directories fail the stack validations (missing directory or component.hcl)" optional:"true"`
+	Out              string `help:"Optional path of a file to write the graph to, instead of the standard output" optional:"true" type:"path"`
+}
+
+func (g *GraphCmd) Run() error {
+	log := logger.DefaultLogger()
+
+	if g.Layer != "" && g.Stack == "" {
+		return fmt.Errorf("❌ Error: --layer requires --stack")
+	}
+
+	log.Info(fmt.Sprintf("🔍 Target Environment: %s", g.TargetEnv))
+
+	// Create and initialize the infractl client
+	log.Info("🔧 Setting up the infrastructure client...")
+	ic, clientErr := controller.NewClient(g.Base, g.TargetEnv)
+	if clientErr != nil {
+		return fmt.Errorf("❌ Error: Unable to create infractl client: %w", clientErr)
+	}
+
+	if err := ic.Initialise(); err != nil {
+		return fmt.Errorf("❌ Error: Failed to initialize infractl client: %w", err)
+	}
+
+	log.Info("🕵️ Conducting initial system sanity check...")
+	if err := ic.RunSanityCheck(g.TargetEnv); err != nil {
+		return fmt.Errorf("❌ Error: Sanity check failed: %w", err)
+	}
+
+	// Invalid components are part of what the graph reports, so the stacks are not validated while compiling
+	log.Info("🔍 Compiling the target environment configuration...")
+	compiledConfig, compileErr := ic.CompileWithoutStackValidation(g.TargetEnv)
+	if compileErr != nil {
+		return fmt.Errorf("❌ Error: Compilation of target environment configuration failed: %w", compileErr)
+	}
+
+	// Build the dependency graph, and narrow it to the requested stack or layer
+	log.Info("🕸️ Building the component dependency graph...")
+	depGraph, err := ic.BuildDependencyGraph(compiledConfig)
+	if err != nil {
+		return fmt.Errorf("❌ Error: %w", err)
+	}
+
+	if g.Stack != "" {
+		scope := depGraph.Scope(g.Stack, g.Layer, "")
+		if len(scope) == 0 {
+			return fmt.Errorf("❌ Error: no components declared in stack '%s' and layer '%s'", g.Stack, g.Layer)
+		}
+
+		for _, id := range append([]string{}, scope...) {
+			scope = append(scope, depGraph.Dependencies(id)...)
+		}
+		depGraph = depGraph.Subgraph(scope)
+	}
+
+	renderOpts := graph.RenderOptions{BaseDir: ic.Paths.GitRepoRoot}
+	if g.HighlightInvalid {
+		renderOpts.Invalid = ic.ComponentValidationErrors(compiledConfig)
+		for _, node := range depGraph.Nodes() {
+			if reason, ok := renderOpts.Invalid[node.ID]; ok {
+				log.Warn(fmt.Sprintf("⚠️ Component %s is invalid: %s", node.ID, reason))
+			}
+		}
+	}
+
+	rendered, err := graph.Render(depGraph, g.Format, renderOpts)
+	if err != nil {
+		return fmt.Errorf("❌ Error: %w", err)
+	}
+
+	if g.Out == "" {
+		var result any = json.RawMessage(rendered)
+		if g.Format != "json" {
+			result = struct {
+				Format string `json:"format"`
+				Graph  string `json:"graph"`
+			}{Format: g.Format, Graph: rendered}
+		}
+
+		printResult(result, rendered)
+		return nil
+	}
+
+	if err := os.WriteFile(g.Out, []byte(rendered), 0644); err != nil {
+		return fmt.Errorf("❌ Error: Unable to write the graph to %s: %w", g.Out, err)
+	}
+
+	log.Info(fmt.Sprintf("✅ Dependency graph written in %s format to: %s", g.Format, g.Out))
+	output.Result = struct {
+		Format string `json:"format"`
+		Path   string `json:"path"`
+	}{Format: g.Format, Path: g.Out}
+
+	return nil
+}
+
+type CompileCmd struct {
+	Base          string `help:"Name of the base environment configuration. Defaults to 'base', which corresponds to _ENVS/base.yaml" default:"base" optional:"true"`
+	TargetEnv     string `help:"Name of the target environment. E.g.: local, staging, production. If 'local' is passed, it means that there is a target configuration in _ENVS/local.yaml" required:""`
+	Provenance    bool   `help:"Also report where every value came from, as a 'provenance' list next to the 'compiled' configuration. Secret values are masked in the report" optional:"true"`
+	RevealSecrets bool   `help:"Print the resolved secret values instead of the INFRACTL_* placeholders that are handed over to Terragrunt" optional:"true"`
+	Strict        bool   `help:"Fail before anything runs when an environment variable reference of the configuration cannot be resolved, reporting every unresolved reference with its path and file, required or optional" optional:"true"`
+}
+
+func (c *CompileCmd) Run() error {
+	log := logger.DefaultLogger()
+
+	ic, err := initialisedClient(log, c.Base, c.TargetEnv)
+	if err != nil {
+		return err
+	}
+	ic.Strict = c.Strict
+
+	log.Info("🔍 Compiling the target environment configuration...")
+	compiledConfig, sealedConfig, err := ic.CompileSealed(c.TargetEnv)
+	if err != nil {
+		return fmt.Errorf("❌ Error: Compilation of target environment configuration failed: %w", err)
+	}
+
+	logger.DefaultRedactor.Add(sealedConfig.SensitiveValues()...)
+
+	if !c.RevealSecrets {
+		compiledConfig = sealedConfig.Config
+	}
+
+	if !c.Provenance {
+		compiledJSON, err := ic.EnvCfgCompiledToJSON(compiledConfig)
+		if err != nil {
+			return fmt.Errorf("❌ Error: Unable to convert compiled configuration to JSON: %w", err)
+		}
+
+		printResult(json.RawMessage(compiledJSON), compiledJSON+"\n")
+		return nil
+	}
+
+	log.Info("🧭 Tracing the provenance of every compiled value...")
+	_, provenance, err := ic.ExplainCompilation(c.TargetEnv)
+	if err != nil {
+		return fmt.Errorf("❌ Error: Unable to trace the provenance of the compiled configuration: %w", err)
+	}
+
+	result := struct {
+		Compiled   cfg.TransportEnvelope        `json:"compiled"`
+		Provenance []controller.ValueProvenance `json:"provenance"`
+	}{
+		Compiled:   cfg.NewTransportEnvelope(compiledConfig),
+		Provenance: provenance,
+	}
+
+	report, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("❌ Error: Unable to convert the provenance report to JSON: %w", err)
+	}
+
+	printResult(result, string(report)+"\n")
+
+	return nil
+}
+
+type ExplainCmd struct {
+	Base      string `help:"Name of the base environment configuration. Defaults to 'base', which corresponds to _ENVS/base.yaml" default:"base" optional:"true"`
+	TargetEnv string `help:"Name of the target environment. E.g.: local, staging, production. If 'local' is passed, it means that there is a target configuration in _ENVS/local.yaml" required:""`
+	Path      string `arg:"" help:"Path of the value to explain, e.g. providers.aws.config.region, or stacks[<stack>].layers[<layer>].components[<component>].inputs for every value under it"`
+}
+
+func (e *ExplainCmd) Run() error {
+	log := logger.DefaultLogger()
+
+	ic, err := initialisedClient(log, e.Base, e.TargetEnv)
+	if err != nil {
+		return err
+	}
+
+	log.Info(fmt.Sprintf("🧭 Explaining '%s'...", e.Path))
+	_, provenance, err := ic.ExplainCompilation(e.TargetEnv)
+	if err != nil {
+		return fmt.Errorf("❌ Error: Unable to trace the provenance of the compiled configuration: %w", err)
+	}
+
+	matching, err := controller.FilterProvenance(provenance, e.Path)
+	if err != nil {
+		return fmt.Errorf("❌ Error: %w", err)
+	}
+
+	printResult(matching, controller.FormatProvenance(matching))
+
+	return nil
+}
+
+type SchemaCmd struct {
+	Export SchemaExportCmd `cmd:"" help:"Export the JSON Schema the environment configuration files are validated against, for editors to offer completion and validation"`
+}
+
+type SchemaExportCmd struct {
+	Out string `help:"Optional path of a file to write the schema to, instead of the standard output" optional:"true" type:"path"`
+}
+
+func (s *SchemaExportCmd) Run() error {
+	log := logger.DefaultLogger()
+
+	schema, err := cfg.ExportEnvConfigSchema()
+	if err != nil {
+		return fmt.Errorf("❌ Error: %w", err)
+	}
+
+	if s.Out == "" {
+		printResult(json.RawMessage(schema), schema)
+		return nil
+	}
+
+	if err := os.WriteFile(s.Out, []byte(schema), 0644); err != nil {
+		return fmt.Errorf("❌ Error: Unable to write the schema to %s: %w", s.Out, err)
+	}
+
+	log.Info(fmt.Sprintf("✅ Environment configuration schema written to: %s", s.Out))
+	output.Result = struct {
+		Path string `json:"path"`
+	}{Path: s.Out}
+
+	return nil
+}
+
+type EnvCmd struct {
+	Edit EnvEditCmd `cmd:"" help:"Decrypt an environment configuration file, open it in $EDITOR, validate it against the schema and save it encrypted with age"`
+}
+
+type EnvEditCmd struct {
+	TargetEnv    string   `help:"Name of the environment to edit. E.g.: prod edits _ENVS/prod.enc.yaml, or encrypts _ENVS/prod.yaml; a new environment is created as _ENVS/prod.enc.yaml" required:""`
+	AgeRecipient []string `help:"Age recipient (age1...) to encrypt the environment for. Can be repeated. Defaults to the recipients the file is already encrypted for, or to the public keys of the age key file" optional:"true"`
+}
+
+func (e *EnvEditCmd) Run() error {
+	log := logger.DefaultLogger()
+
+	log.Info(fmt.Sprintf("🔍 Target Environment: %s", e.TargetEnv))
+
+	ic, err := controller.NewClient(cfg.EnvCfgBaseNameDefault, e.TargetEnv)
+	if err != nil {
+		return fmt.Errorf("❌ Error: Unable to create infractl client: %w", err)
+	}
+
+	log.Info("✏️ Opening the decrypted environment configuration in the editor...")
+	result, err := ic.EditEnvConfig(e.TargetEnv, controller.EnvEditOptions{
+		Recipients: e.AgeRecipient,
+		Edit:       utils.OpenInEditor,
+		Retry: func(err error) bool {
+			log.Error(fmt.Sprintf("❌ %s", err))
+			return confirm("Edit the environment configuration again? Answering no discards the changes")
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("❌ Error: %w", err)
+	}
+
+	output.Result = struct {
+		Path       string   `json:"path"`
+		Changed    bool     `json:"changed"`
+		Recipients []string `json:"recipients"`
+	}{Path: result.Path, Changed: result.Changed, Recipients: result.Recipients}
+
+	if !result.Changed {
+		log.Info(fmt.Sprintf("👌 No changes, %s left as is", result.Path))
+		return nil
+	}
+
+	log.Info(fmt.Sprintf("🔐 Environment configuration encrypted for %s and saved at: %s", strings.Join(result.Recipients, ", "), result.Path))
+
+	return nil
+}
+
+type SecretsCmd struct {
+	Audit SecretsAuditCmd `cmd:"" help:"Report which components can see which secrets, through the providers they list, the secrets no component can see and the references to undeclared secrets"`
+}
+
+type SecretsAuditCmd struct {
+	Base         string `help:"Name of the base environment configuration. Defaults to 'base', which corresponds to _ENVS/base.yaml" default:"base" optional:"true"`
+	TargetEnv    string `help:"Name of the target environment. E.g.: local, staging, production. If 'local' is passed, it means that there is a target configuration in _ENVS/local.yaml" required:""`
+	Format       string `help:"Output format of the report" enum:"text,json" default:"text"`
+	FailOnUnused bool   `help:"Also fail when a secret is not seen by any component, not only when a reference points at an undeclared secret" optional:"true"`
+}
+
+func (s *SecretsAuditCmd) Run() error {
+	log := logger.DefaultLogger()
+
+	ic, err := initialisedClient(log, s.Base, s.TargetEnv)
+	if err != nil {
+		return err
+	}
+
+	log.Info("🔐 Auditing the secrets of the target environment configuration...")
+	audit, err := ic.AuditSecrets(s.TargetEnv)
+	if err != nil {
+		return fmt.Errorf("❌ Error: Unable to audit the secrets of the target environment configuration: %w", err)
+	}
+
+	if outputJSON() {
+		output.Result = audit
+	} else if s.Format == "json" {
+		report, err := json.MarshalIndent(audit, "", "  ")
+		if err != nil {
+			return fmt.Errorf("❌ Error: Unable to convert the secrets audit to JSON: %w", err)
+		}
+		fmt.Println(string(report))
+	} else {
+		fmt.Print(controller.FormatSecretAudit(audit))
+	}
+
+	unused := audit.UnusedSecrets()
+	for _, usage := range unused {
+		log.Warn(fmt.Sprintf("⚠️ Secret %s is not seen by any component", usage.Secret))
+	}
+	for _, reference := range audit.Dangling {
+		log.Error(fmt.Sprintf("❌ Dangling secret reference: %s", reference))
+	}
+
+	if len(audit.Dangling) > 0 {
+		return fmt.Errorf("❌ Error: %d reference(s) point at undeclared secrets", len(audit.Dangling))
+	}
+	if s.FailOnUnused && len(unused) > 0 {
+		return fmt.Errorf("❌ Error: %d secret(s) are not seen by any component", len(unused))
+	}
+
+	log.Info("✅ Secrets audit completed")
+
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to yes.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [Y/n] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// initialisedClient creates and initialises the infractl client of a target environment, and runs the
+// sanity checks, for the commands that only work on the compiled configuration.
+func initialisedClient(log *logger.Logger, base, targetEnv string) (*controller.Client, error) {
+	log.Info(fmt.Sprintf("🔍 Target Environment: %s", targetEnv))
+
+	log.Info("🔧 Setting up the infrastructure client...")
+	ic, err := controller.NewClient(base, targetEnv)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Error: Unable to create infractl client: %w", err)
+	}
+
+	if err := ic.Initialise(); err != nil {
+		return nil, fmt.Errorf("❌ Error: Failed to initialize infractl client: %w", err)
+	}
+
+	log.Info("🕵️ Conducting initial system sanity check...")
+	if err := ic.RunSanityCheck(targetEnv); err != nil {
+		return nil, fmt.Errorf("❌ Error: Sanity check failed: %w", err)
+	}
+
+	return ic, nil
+}
+
+// validateResult is the result of the validate command, with --output json; the failed checks are reported
+// as the errors of the document.
+type validateResult struct {
+	TargetEnv string `json:"target_env"`
+	Base      string `json:"base"`
+	// OptionalReferences are the references left unresolved that fall back to a default (strict mode)
+	OptionalReferences []transformers.UnresolvedReference `json:"optional_references"`
 }
 
 func (v *ValidateCmd) Run() error {
@@ -62,6 +541,9 @@ func (v *ValidateCmd) Run() error {
 	targetEnvParam := v.TargetEnv
 	baseEnvParam := v.Base
 
+	result := &validateResult{TargetEnv: targetEnvParam, Base: baseEnvParam, OptionalReferences: []transformers.UnresolvedReference{}}
+	output.Result = result
+
 	// Log the actual values of Base and TargetEnv for clarity
 	log.Info(fmt.Sprintf("🔍 Target Environment: %s", targetEnvParam))
 	log.Info(fmt.Sprintf("🔍 Base Environment: %s", baseEnvParam))
@@ -87,111 +569,640 @@ func (v *ValidateCmd) Run() error {
 
 	log.Info("✅ Sanity check passed successfully! 🎉")
 
+	// In strict mode, every environment variable reference must resolve
+	if v.Strict {
+		log.Info("🔎 Checking that every environment variable reference resolves (strict mode)...")
+		unresolved, err := ic.CheckReferences(v.TargetEnv)
+		if err != nil && unresolved == nil {
+			return fmt.Errorf("❌ Error: Failed to check the references of the target environment configuration: %w", err)
+		}
+
+		required := 0
+		for _, reference := range unresolved {
+			if reference.Required {
+				required++
+				log.Error(fmt.Sprintf("❌ required: %s", reference))
+				output.Errors = append(output.Errors, controller.UnresolvedReferenceError(reference))
+			} else {
+				log.Warn(fmt.Sprintf("⚠️ optional: %s", reference))
+				result.OptionalReferences = append(result.OptionalReferences, reference)
+			}
+		}
+
+		if required > 0 {
+			return fmt.Errorf("❌ Error: %d required reference(s) of the target environment configuration cannot be resolved (strict mode)", required)
+		}
+		log.Info("✅ Every required reference resolves")
+	}
+
 	// Compile the target environment configuration
 	log.Info("🔍 Compiling the target environment configuration...")
-	if _, err := ic.Compile(v.TargetEnv); err != nil {
+	// and check the inputs of every component against the variables of its Terraform module
+	issues, err := ic.CheckComponentInputs(v.TargetEnv)
+	if err != nil {
 		return fmt.Errorf("❌ Error: Failed to compile target environment configuration: %w", err)
 	}
 
 	log.Info("✅ Target environment configuration compiled successfully!")
+
+	for _, issue := range issues {
+		log.Error(fmt.Sprintf("❌ %s", issue))
+		output.Errors = append(output.Errors, controller.InputIssueError(issue))
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("❌ Error: %d component input issue(s) found against the variables of their Terraform modules", len(issues))
+	}
+	log.Info("✅ Every component input matches the variables of its Terraform module")
+
 	log.Info("🎉 All checks completed successfully! 🎉")
 
 	return nil
 }
 
-func (p *PlanCmd) Run() error {
-	log := logger.DefaultLogger()
+// compiledTarget is the outcome of the pipeline shared by every Terragrunt backed command.
+type compiledTarget struct {
+	client *controller.Client
+	config *cfg.EnvConfig
+	// sealed is the compiled configuration without its secrets, which json and jsonFilePath hold.
+	sealed       *cfg.SealedEnvConfig
+	json         string
+	jsonFilePath string
+}
 
+// cleanup removes the cached compiled configuration once the run is over.
+func (t *compiledTarget) cleanup(log *logger.Logger) {
+	if err := t.client.RemoveCachedEnvCfgJSONFile(t.jsonFilePath); err != nil {
+		log.Warn(fmt.Sprintf("⚠️ %v", err))
+	}
+}
+
+// compileTarget runs the pipeline shared by every Terragrunt backed command: it checks the stack
+// hierarchy, initialises the infractl client, runs the sanity checks, compiles and validates the
+// target environment configuration and caches it as JSON, without its secrets. Callers remove the cached
+// JSON file with cleanup once the run is over.
+func compileTarget(log *logger.Logger, t TgTargetFlags) (*compiledTarget, error) {
 	// Log the input parameters for traceability
-	log.Info(fmt.Sprintf("🌍 Initiating infrastructure planning for environment: %s", p.TargetEnv))
-	log.Info(fmt.Sprintf("🏗️ Targeting stack: %s", p.Stack))
+	log.Info(fmt.Sprintf("🏗️ Targeting stack: %s", t.Stack))
 
-	if p.Component != "" {
-		log.Info(fmt.Sprintf("🧩 Focusing on specific component: %s", p.Component))
+	if t.Component != "" {
+		log.Info(fmt.Sprintf("🧩 Focusing on specific component: %s", t.Component))
 	}
 
 	// Checking the stack hierarchy consistency
-	if err := controller.IsStackHierarchyConsistent(p.Stack, p.Layer, p.Component); err != nil {
-		return fmt.Errorf("❌ Error: Stack hierarchy is inconsistent: %w", err)
+	if err := controller.IsStackHierarchyConsistent(t.Stack, t.Layer, t.Component); err != nil {
+		return nil, fmt.Errorf("❌ Error: Stack hierarchy is inconsistent: %w", err)
 	}
 
 	// Create and initialize the infractl client
 	log.Info("🔧 Setting up the infrastructure client...")
-	ic, clientErr := controller.NewClient(p.Base, p.TargetEnv)
+	ic, clientErr := controller.NewClient(t.Base, t.TargetEnv)
 	if clientErr != nil {
-		return fmt.Errorf("❌ Error: Unable to create infractl client: %w", clientErr)
+		return nil, fmt.Errorf("❌ Error: Unable to create infractl client: %w", clientErr)
 	}
 
+	ic.Strict = t.Strict
+	ic.Executor = tg.NewExecutorWithGracePeriod(t.GracePeriod)
+
 	if err := ic.Initialise(); err != nil {
-		return fmt.Errorf("❌ Error: Failed to initialize infractl client: %w", err)
+		return nil, fmt.Errorf("❌ Error: Failed to initialize infractl client: %w", err)
 	}
 
 	// Run sanity checks to ensure system readiness
 	log.Info("🕵️ Conducting initial system sanity check...")
-	if err := ic.RunSanityCheck(p.TargetEnv); err != nil {
-		return fmt.Errorf("❌ Error: Sanity check failed: %w", err)
+	if err := ic.RunSanityCheck(t.TargetEnv); err != nil {
+		return nil, fmt.Errorf("❌ Error: Sanity check failed: %w", err)
 	}
 
 	log.Info("✅ Sanity check completed successfully!")
 
 	// Compile the target environment configuration
 	log.Info("🔍 Compiling the target environment configuration...")
-	compiledConfig, compileErr := ic.Compile(p.TargetEnv)
+	compiledConfig, sealedConfig, compileErr := ic.CompileSealed(t.TargetEnv)
 	if compileErr != nil {
-		return fmt.Errorf("❌ Error: Compilation of target environment configuration failed: %w", compileErr)
+		return nil, fmt.Errorf("❌ Error: Compilation of target environment configuration failed: %w", compileErr)
 	}
 
+	// From now on, the resolved secrets are masked in every log message
+	logger.DefaultRedactor.Add(sealedConfig.SensitiveValues()...)
+
 	log.Info("✅ Target environment configuration compiled successfully!")
 
 	// Validating the infrastructure hierarchy
 	log.Info("🔍 Validating the infrastructure hierarchy...")
-	if err := ic.ValidateInfrastructureHierarchy(compiledConfig, p.Stack, p.Layer, p.Component); err != nil {
-		return fmt.Errorf("❌ Error: Infrastructure hierarchy validation failed: %w", err)
+	if err := ic.ValidateInfrastructureHierarchy(compiledConfig, t.Stack, t.Layer, t.Component); err != nil {
+		return nil, fmt.Errorf("❌ Error: Infrastructure hierarchy validation failed: %w", err)
 	}
 
 	log.Info("✅ Infrastructure hierarchy validated successfully!")
 
-	// Convert the compiled configuration to JSON format
+	// Convert the compiled configuration to JSON format, with placeholders instead of its secrets
 	log.Info("🔄 Transforming compiled configuration into JSON format...")
-	compiledEnvConfigInJSON, err := ic.EnvCfgCompiledToJSON(compiledConfig)
+	compiledEnvConfigInJSON, err := ic.EnvCfgCompiledToJSON(sealedConfig.Config)
 	if err != nil {
-		return fmt.Errorf("❌ Error: Conversion to JSON format failed: %w", err)
+		return nil, fmt.Errorf("❌ Error: Conversion to JSON format failed: %w", err)
 	}
 
 	log.Info("✅ Compiled environment configuration converted to JSON format successfully!")
 
 	// Store the JSON file in the cache directory
 	log.Info("💾 Storing compiled environment configuration in cache directory...")
-	envConfigFilepathInCacheDir, err := ic.CreateCachedEnvCfgJSONFile(p.TargetEnv, compiledEnvConfigInJSON, p.OverrideJSONName)
+	envConfigFilepathInCacheDir, err := ic.CreateCachedEnvCfgJSONFile(t.TargetEnv, compiledEnvConfigInJSON, t.OverrideJSONName)
 	if err != nil {
-		return fmt.Errorf("❌ Error: Unable to create cached environment configuration file: %w", err)
+		return nil, fmt.Errorf("❌ Error: Unable to create cached environment configuration file: %w", err)
 	}
 
 	log.Info(fmt.Sprintf("💾 Compiled environment configuration saved in JSON format at: %s", envConfigFilepathInCacheDir))
+	log.Info(fmt.Sprintf("🔐 %d secret value(s) left out of the cached configuration, passed to Terragrunt through its environment", len(sealedConfig.Values)))
 
-	// Running Tg using the InfraRunner
-	log.Info("🚀 Running Terragrunt plan command...")
-	tgRunner, tgRunnerErr := controller.NewTgRunner(compiledConfig, envConfigFilepathInCacheDir)
+	return &compiledTarget{
+		client:       ic,
+		config:       compiledConfig,
+		sealed:       sealedConfig,
+		json:         compiledEnvConfigInJSON,
+		jsonFilePath: envConfigFilepathInCacheDir,
+	}, nil
+}
+
+// newTgRunnerForTarget compiles the target environment and returns a TgRunner bound to its cached JSON file,
+// with the compiled target, whose cleanup removes that file once the run is over.
+func newTgRunnerForTarget(log *logger.Logger, t TgTargetFlags) (*controller.Tg, *compiledTarget, error) {
+	target, err := compileTarget(log, t)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tgRunner, tgRunnerErr := controller.NewTgRunnerWithExecutor(target.config, target.jsonFilePath, target.sealed, target.client.Executor)
 	if tgRunnerErr != nil {
-		return fmt.Errorf("❌ Error: Unable to create infractl client: %w", tgRunnerErr)
+		target.cleanup(log)
+		return nil, nil, fmt.Errorf("❌ Error: Unable to create Terragrunt runner: %w", tgRunnerErr)
+	}
+
+	return tgRunner, target, nil
+}
+
+// stackOptions maps the target flags into the options expected by the TgRunner.
+func (t TgTargetFlags) stackOptions() controller.TgRunnerStackOptions {
+	stackOpts := controller.TgRunnerStackOptions{
+		StackName:     t.Stack,
+		LayerName:     t.Layer,
+		ComponentName: t.Component,
+		Parallelism:   t.Parallelism,
+		IncludeDirs:   t.IncludeDir,
+		ExcludeDirs:   t.ExcludeDir,
+		UseRunAll:     t.RunAll,
+		ResumeRunID:   t.Resume,
+	}
+
+	// The standard output is kept for the JSON document of the command
+	if outputJSON() {
+		stackOpts.OutWriter = os.Stderr
+	}
+
+	return stackOpts
+}
+
+// scopeName names the stack or layer targeted by the flags, e.g. stack 'stack-datastore', layer 'db'.
+func (t TgTargetFlags) scopeName() string {
+	if t.Layer == "" {
+		return fmt.Sprintf("stack '%s'", t.Stack)
+	}
+
+	return fmt.Sprintf("stack '%s', layer '%s'", t.Stack, t.Layer)
+}
+
+// selectChangedComponents restricts a stack or layer wide run to the components affected by the changes of the
+// working tree since a git ref, and to their dependents (--changed-since), by setting the components of stackOpts.
+//
+// Returns:
+//   - The affected components of the stack or layer, with the reasons why; none when nothing they use changed.
+//   - An error if a single component or --run-all is targeted, or the changes cannot be found.
+func selectChangedComponents(log *logger.Logger, target *compiledTarget, t TgTargetFlags, ref string, stackOpts *controller.TgRunnerStackOptions) ([]controller.ComponentChange, error) {
+	if t.Component != "" || t.RunAll {
+		return nil, fmt.Errorf("❌ Error: --changed-since selects the components of a stack or layer wide run, it cannot be combined with --component or --run-all")
+	}
+
+	log.Info(fmt.Sprintf("🔀 Finding the components affected by the changes since %s...", ref))
+	changes, err := target.client.ChangedComponents(t.TargetEnv, ref, target.sealed)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Error: Unable to find the components changed since %s: %w", ref, err)
+	}
+
+	scopePrefix := t.Stack + "/"
+	if t.Layer != "" {
+		scopePrefix += t.Layer + "/"
+	}
+
+	selected := []controller.ComponentChange{}
+	for _, change := range changes {
+		if !strings.HasPrefix(change.ID, scopePrefix) {
+			continue
+		}
+
+		log.Info(fmt.Sprintf("🔀 %s: %s", change.ID, strings.Join(change.Reasons, "; ")))
+		selected = append(selected, change)
+		stackOpts.Components = append(stackOpts.Components, change.ID)
+	}
+
+	return selected, nil
+}
+
+func (p *PlanCmd) Run(ctx context.Context) error {
+	log := logger.DefaultLogger()
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	log.Info(fmt.Sprintf("🌍 Initiating infrastructure planning for environment: %s", p.TargetEnv))
+
+	result := &planResult{TargetEnv: p.TargetEnv}
+
+	if p.SavePlan {
+		if p.ChangedSince != "" {
+			return fmt.Errorf("❌ Error: --save-plan plans a single component, it cannot be combined with --changed-since")
+		}
+
+		summaries, err := p.runSavedPlan(ctx, log, result)
+		if err != nil {
+			return err
+		}
+		return p.reportPlan(log, summaries, result)
 	}
 
-	if err := tgRunner.Plan(controller.TgRunnerStackOptions{
-		StackName:     p.Stack,
-		LayerName:     p.Layer,
-		ComponentName: p.Component,
-	}); err != nil {
+	tgRunner, target, err := newTgRunnerForTarget(log, p.TgTargetFlags)
+	if err != nil {
+		return err
+	}
+	defer target.cleanup(log)
+
+	stackOpts := p.stackOptions()
+	if p.ChangedSince != "" {
+		result.ChangedComponents, err = selectChangedComponents(log, target, p.TgTargetFlags, p.ChangedSince, &stackOpts)
+		if err != nil {
+			return err
+		}
+
+		if len(result.ChangedComponents) == 0 {
+			log.Info(fmt.Sprintf("👌 Nothing changed since %s for the components of %s, there's nothing to plan", p.ChangedSince, p.scopeName()))
+			return p.reportPlan(log, nil, result)
+		}
+	}
+
+	// Running Tg using the InfraRunner
+	log.Info("🚀 Running Terragrunt plan command...")
+	summaries, err := tgRunner.Plan(ctx, stackOpts)
+	if err != nil {
 		return fmt.Errorf("❌ Error: Failed to run Terragrunt plan command: %w", err)
 	}
 
 	log.Info("✅ Terragrunt plan command executed successfully!")
 
+	return p.reportPlan(log, summaries, result)
+}
+
+// planResult is the result of the plan command, with --output json
+type planResult struct {
+	TargetEnv  string           `json:"target_env"`
+	HasChanges bool             `json:"has_changes"`
+	Destroys   bool             `json:"destroys"`
+	Plans      []tg.PlanSummary `json:"plans"`
+	// PlanID and PlanManifest are set when the plan is saved with --save-plan
+	PlanID       string `json:"plan_id,omitempty"`
+	PlanManifest string `json:"plan_manifest,omitempty"`
+	// ChangedComponents are the components selected with --changed-since, with the reasons why
+	ChangedComponents []controller.ComponentChange `json:"changed_components,omitempty"`
+}
+
+// reportPlan logs the summary of the plan of every component, with the resources it changes, and records
+// them in the result of the command. With --detailed-exitcode, a plan with changes makes infractl exit with
+// code 2.
+func (p *PlanCmd) reportPlan(log *logger.Logger, summaries []tg.PlanSummary, result *planResult) error {
+	result.Plans = append([]tg.PlanSummary{}, summaries...)
+	output.Result = result
+
+	hasChanges := false
+	for _, summary := range summaries {
+		log.Info(fmt.Sprintf("📋 %s: %s", summary.Component, summary))
+		for _, change := range summary.ResourceChanges {
+			log.Info(fmt.Sprintf("   %s %s", change.Action, change.Address))
+		}
+
+		if summary.Destroys() {
+			log.Warn(fmt.Sprintf("⚠️ The plan of %s destroys %d resource(s), replaced or deleted", summary.Component, summary.Replace+summary.Delete))
+		}
+		hasChanges = hasChanges || summary.HasChanges
+		result.Destroys = result.Destroys || summary.Destroys()
+	}
+
+	result.HasChanges = hasChanges
+
+	if p.DetailedExitcode && hasChanges {
+		return exitCode(tg.PlanChangesExitCode)
+	}
+
 	return nil
 }
 
-func main() {
-	fmt.Println(tui.GetBanner())
+// runSavedPlan plans a single component and stores the binary plan, the compiled configuration it was
+// made with, and a manifest describing both, so it can be applied later with 'apply --plan <id>'.
+func (p *PlanCmd) runSavedPlan(ctx context.Context, log *logger.Logger, result *planResult) ([]tg.PlanSummary, error) {
+	if p.Component == "" {
+		return nil, fmt.Errorf("❌ Error: --save-plan requires a single component, please specify --layer and --component")
+	}
+
+	target, err := compileTarget(log, p.TgTargetFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer target.cleanup(log)
+
+	log.Info("📝 Preparing the saved plan artifacts...")
+	manifest, err := target.client.NewPlanManifest(p.Base, p.TargetEnv, p.stackOptions(), target.json)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Error: Unable to prepare the saved plan: %w", err)
+	}
+
+	// The plan runs against the configuration stored with the plan, which is the one applied later on.
+	tgRunner, err := controller.NewTgRunnerWithExecutor(target.config, manifest.ConfigFilePath, target.sealed, target.client.Executor)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Error: Unable to create Terragrunt runner: %w", err)
+	}
+
+	// The plan output is saved next to the plan, for review; secrets are masked in it as in the terminal.
+	planLog, err := os.OpenFile(manifest.LogFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, cfg.TransportFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Error: Unable to create the plan log: %w", err)
+	}
+	defer planLog.Close()
+
+	stackOpts := p.stackOptions()
+	stackOpts.LogWriter = planLog
+
+	log.Info("🚀 Running Terragrunt plan command...")
+	summaries, err := tgRunner.Plan(ctx, stackOpts, "-out="+manifest.PlanFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Error: Failed to run Terragrunt plan command: %w", err)
+	}
+
+	log.Info(fmt.Sprintf("📝 Plan output saved at: %s", manifest.LogFilePath))
+
+	manifestPath, err := target.client.SavePlanManifest(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("❌ Error: Unable to save the plan: %w", err)
+	}
+
+	log.Info(fmt.Sprintf("💾 Plan manifest saved at: %s", manifestPath))
+	result.PlanID = manifest.ID
+	result.PlanManifest = manifestPath
+	log.Info(fmt.Sprintf("✅ Plan saved with ID %s. Apply it with: infractl apply --plan %s", manifest.ID, manifest.ID))
+
+	return summaries, nil
+}
+
+func (a *ApplyCmd) Run(ctx context.Context) error {
+	log := logger.DefaultLogger()
+
+	ctx, cancel := a.withTimeout(ctx)
+	defer cancel()
+
+	if a.Plan != "" {
+		return a.runSavedPlan(ctx, log)
+	}
+
+	log.Info(fmt.Sprintf("🌍 Initiating infrastructure apply for environment: %s", a.TargetEnv))
+
+	tgRunner, target, err := newTgRunnerForTarget(log, a.TgTargetFlags)
+	if err != nil {
+		return err
+	}
+	defer target.cleanup(log)
+
+	stackOpts := a.TgTargetFlags.stackOptions()
+	stackOpts.AutoApprove = a.AutoApprove
+
+	result := newRunResult(a.TgTargetFlags, "")
+	if a.ChangedSince != "" {
+		result.ChangedComponents, err = selectChangedComponents(log, target, a.TgTargetFlags, a.ChangedSince, &stackOpts)
+		if err != nil {
+			return err
+		}
+
+		if len(result.ChangedComponents) == 0 {
+			log.Info(fmt.Sprintf("👌 Nothing changed since %s for the components of %s, there's nothing to apply", a.ChangedSince, a.TgTargetFlags.scopeName()))
+			output.Result = result
+			return nil
+		}
+	}
+
+	log.Info("🚀 Running Terragrunt apply command...")
+	if err := tgRunner.Apply(ctx, stackOpts); err != nil {
+		return fmt.Errorf("❌ Error: Failed to run Terragrunt apply command: %w", err)
+	}
+
+	log.Info("✅ Terragrunt apply command executed successfully!")
+	output.Result = result
+
+	return nil
+}
+
+// runSavedPlan applies a plan saved with 'plan --save-plan'. The target is taken from the plan manifest,
+// and the plan is refused if anything it was made against changed since.
+func (a *ApplyCmd) runSavedPlan(ctx context.Context, log *logger.Logger) error {
+	log.Info(fmt.Sprintf("📝 Loading saved plan: %s", a.Plan))
+	manifest, err := cfg.ReadPlanManifest(a.Plan)
+	if err != nil {
+		return fmt.Errorf("❌ Error: Unable to load the saved plan: %w", err)
+	}
+
+	planned := TgTargetFlags{
+		Stack:            manifest.StackName,
+		Layer:            manifest.LayerName,
+		Component:        manifest.ComponentName,
+		Base:             manifest.BaseEnv,
+		TargetEnv:        manifest.TargetEnv,
+		OverrideJSONName: a.OverrideJSONName,
+		RunControlFlags:  a.RunControlFlags,
+	}
+
+	log.Info(fmt.Sprintf("🌍 Applying saved plan %s for environment: %s", manifest.ID, manifest.TargetEnv))
+
+	target, err := compileTarget(log, planned)
+	if err != nil {
+		return err
+	}
+	defer target.cleanup(log)
+
+	log.Info("🔐 Verifying the saved plan against the current configuration and repository...")
+	if err := target.client.VerifyPlanManifest(manifest, target.jsonFilePath); err != nil {
+		return fmt.Errorf("❌ Error: Refusing to apply the saved plan: %w", err)
+	}
+
+	log.Info("✅ Saved plan verified successfully!")
+
+	tgRunner, err := controller.NewTgRunnerWithExecutor(target.config, manifest.ConfigFilePath, target.sealed, target.client.Executor)
+	if err != nil {
+		return fmt.Errorf("❌ Error: Unable to create Terragrunt runner: %w", err)
+	}
+
+	// A saved plan is applied as-is by Terraform, without an approval prompt.
+	stackOpts := planned.stackOptions()
+	stackOpts.AutoApprove = true
+
+	log.Info("🚀 Running Terragrunt apply command with the saved plan...")
+	if err := tgRunner.Apply(ctx, stackOpts, manifest.PlanFilePath); err != nil {
+		return fmt.Errorf("❌ Error: Failed to run Terragrunt apply command: %w", err)
+	}
+
+	log.Info("✅ Terragrunt apply command executed successfully!")
+	output.Result = newRunResult(planned, manifest.ID)
+
+	return nil
+}
+
+func (d *DestroyCmd) Run(ctx context.Context) error {
+	log := logger.DefaultLogger()
+
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	log.Info(fmt.Sprintf("🌍 Initiating infrastructure destroy for environment: %s", d.TargetEnv))
+
+	tgRunner, target, err := newTgRunnerForTarget(log, d.TgTargetFlags)
+	if err != nil {
+		return err
+	}
+	defer target.cleanup(log)
+
+	stackOpts := d.stackOptions()
+	stackOpts.AutoApprove = d.AutoApprove
+
+	log.Info("🔥 Running Terragrunt destroy command...")
+	if err := tgRunner.Destroy(ctx, stackOpts); err != nil {
+		return fmt.Errorf("❌ Error: Failed to run Terragrunt destroy command: %w", err)
+	}
+
+	log.Info("✅ Terragrunt destroy command executed successfully!")
+	output.Result = newRunResult(d.TgTargetFlags, "")
+
+	return nil
+}
+
+// runResult is the result of the apply and destroy commands, with --output json
+type runResult struct {
+	TargetEnv string `json:"target_env"`
+	Stack     string `json:"stack"`
+	Layer     string `json:"layer,omitempty"`
+	Component string `json:"component,omitempty"`
+	// PlanID is the ID of the saved plan that was applied, if any
+	PlanID string `json:"plan_id,omitempty"`
+	// ChangedComponents are the components selected with --changed-since, with the reasons why
+	ChangedComponents []controller.ComponentChange `json:"changed_components,omitempty"`
+}
+
+// newRunResult describes the target of a successful apply or destroy.
+func newRunResult(t TgTargetFlags, planID string) runResult {
+	return runResult{TargetEnv: t.TargetEnv, Stack: t.Stack, Layer: t.Layer, Component: t.Component, PlanID: planID}
+}
+
+// commandOutput is the single JSON document a command prints on the standard output with --output json
+type commandOutput struct {
+	Command string `json:"command"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Errors are the configuration errors the command failed with, e.g. schema violations or input issues
+	Errors []*cfg.ConfigurationError `json:"errors,omitempty"`
+	// Result is what the command produced, e.g. the plan summaries or the compiled configuration
+	Result any `json:"result,omitempty"`
+}
+
+// output is the document of the running command, which its Run fills in
+var output = &commandOutput{}
+
+// outputJSON reports whether the commands print a JSON document instead of text (--output json).
+func outputJSON() bool {
+	return CLI.Output == "json"
+}
+
+// printResult records the result of a command for its JSON document, and prints its text otherwise.
+func printResult(result any, text string) {
+	output.Result = result
+
+	if !outputJSON() {
+		fmt.Print(text)
+	}
+}
+
+// printOutput prints the JSON document of a command once it's run, with the configuration errors it failed with.
+// Errors may quote resolved values (e.g. the output of a failed command): the secrets among them are masked.
+func printOutput(command string, err error) error {
+	var code exitCode
+
+	output.Command = command
+	output.Success = err == nil || errors.As(err, &code)
+	if !output.Success {
+		output.Error = logger.StripEmojis(logger.DefaultRedactor.Redact(err.Error()))
+		output.Errors = append(controller.ConfigurationErrors(err), output.Errors...)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+
+	if encodeErr := encoder.Encode(output); encodeErr != nil {
+		return fmt.Errorf("unable to convert the output of %s to JSON: %w", command, encodeErr)
+	}
+
+	return nil
+}
 
+// commandName returns the name of the selected command, with its parent commands, e.g. 'schema export'.
+func commandName(ctx *kong.Context) string {
+	var names []string
+	for _, path := range ctx.Path {
+		if path.Command != nil {
+			names = append(names, path.Command.Name)
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+// exitCode is returned by a command to exit with the given code, without reporting an error.
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
+// interruptibleCommands are the commands running Terragrunt. On SIGINT or SIGTERM, they interrupt the running
+// terragrunt processes and wait for them to exit, so no state lock is left behind, instead of exiting right away.
+var interruptibleCommands = map[string]bool{"plan": true, "apply": true, "destroy": true}
+
+// signalContext returns a context cancelled when infractl receives SIGINT or SIGTERM, with the signal as its
+// cause (a tg.InterruptedError), and a function to stop listening for the signals.
+func signalContext(log *logger.Logger) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for sig := range signals {
+			interrupted := &tg.InterruptedError{Signal: sig}
+			if ctx.Err() == nil {
+				log.Warn(fmt.Sprintf("⚠️ %s, waiting for Terragrunt to exit (it's killed once the grace period is over)...", interrupted))
+			}
+			cancel(interrupted)
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel(nil)
+	}
+}
+
+func main() {
 	ctx := kong.Parse(&CLI,
 		kong.Name("infra"),
 		kong.Description("CLI tool to facilitate the IaaC configuration using Terragrunt"),
@@ -199,11 +1210,57 @@ func main() {
 		kong.ConfigureHelp(kong.HelpOptions{
 			Compact: true,
 		}),
+		kong.Help(func(options kong.HelpOptions, ctx *kong.Context) error {
+			fmt.Println(tui.GetBanner())
+			return kong.DefaultHelpPrinter(options, ctx)
+		}),
 	)
 
+	// With --output json, the standard output only holds the JSON document of the command, and the logs are
+	// JSON lines without emojis. The banner goes to the standard error, so the documents commands print on the
+	// standard output (e.g. graph --format dot) can be piped.
+	if outputJSON() {
+		logger.DefaultFormat = logger.FormatJSON
+	} else {
+		fmt.Fprintln(os.Stderr, tui.GetBanner())
+	}
+
+	// The sops:// secret references and the encrypted environment files are decrypted in-process, with the age
+	// identities of SOPS_AGE_KEY_FILE, the variable the sops CLI reads them from too
+	if CLI.AgeKeyFile != "" {
+		os.Setenv(cfg.AgeKeyFileEnvVar, CLI.AgeKeyFile)
+	}
+
+	// Commands running Terragrunt stop it gracefully on SIGINT and SIGTERM; the others exit right away.
+	runCtx := context.Background()
+	if interruptibleCommands[ctx.Selected().Name] {
+		var stop func()
+		runCtx, stop = signalContext(logger.DefaultLogger())
+		defer stop()
+	}
+	ctx.BindTo(runCtx, (*context.Context)(nil))
+
 	err := ctx.Run()
+
+	if outputJSON() {
+		if outputErr := printOutput(commandName(ctx), err); outputErr != nil {
+			logger.DefaultLogger().Error(outputErr.Error())
+			os.Exit(1)
+		}
+	}
+
+	var code exitCode
+	if errors.As(err, &code) {
+		os.Exit(int(code))
+	}
+
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		// Errors may quote resolved values (e.g. the output of a failed command), mask the secrets among them
+		if outputJSON() {
+			logger.DefaultLogger().Error(err.Error())
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", logger.DefaultRedactor.Redact(err.Error()))
+		}
 		os.Exit(1)
 	}
 }
@@ -3,7 +3,10 @@
 import (
 	"io"
 	"os"
+	"strings"
+	"unicode"
 
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
 	"github.com/charmbracelet/log"
 )
 
@@ -17,10 +20,21 @@
 	LogLevelError
 )
 
+// Format is the format of the logged lines
+type Format int
+
+const (
+	// FormatText logs human readable lines, with emojis
+	FormatText Format = iota
+	// FormatJSON logs a JSON object per line, without emojis, for machines
+	FormatJSON
+)
+
 // Logger provides a structured logging interface with emojis
 type Logger struct {
 	logger *log.Logger
 	level  LogLevel
+	format Format
 }
 
 // LoggerInterface defines the contract for logging methods
@@ -37,6 +51,11 @@ type LoggerInterface interface {
 
 // NewLogger creates a new logger with specified options and emojis
 func NewLogger(output io.Writer, level LogLevel) *Logger {
+	return NewLoggerWithFormat(output, level, FormatText)
+}
+
+// NewLoggerWithFormat creates a new logger with specified options, logging lines in the given format
+func NewLoggerWithFormat(output io.Writer, level LogLevel, format Format) *Logger {
 	if output == nil {
 		output = os.Stderr
 	}
@@ -62,15 +81,29 @@ func NewLogger(output io.Writer, level LogLevel) *Logger {
 	charmLogger.SetFormatter(log.TextFormatter)
 	charmLogger.SetReportTimestamp(false)
 
+	if format == FormatJSON {
+		charmLogger.SetFormatter(log.JSONFormatter)
+		charmLogger.SetReportTimestamp(true)
+	}
+
 	return &Logger{
 		logger: charmLogger,
 		level:  level,
+		format: format,
 	}
 }
 
-// DefaultLogger creates a logger with default settings and emojis
+// DefaultRedactor masks sensitive values in the output of every default logger. Secrets are added to it as
+// soon as they're resolved, so no message logged afterwards can leak them.
+var DefaultRedactor = utils.NewRedactor()
+
+// DefaultFormat is the format of every default logger; infractl sets it from its --output flag
+var DefaultFormat = FormatText
+
+// DefaultLogger creates a logger with default settings and emojis (in DefaultFormat), logging to the standard
+// error and masking the values of DefaultRedactor
 func DefaultLogger() *Logger {
-	return NewLogger(os.Stderr, LogLevelInfo)
+	return NewLoggerWithFormat(utils.NewRedactingWriter(os.Stderr, DefaultRedactor), LogLevelInfo, DefaultFormat)
 }
 
 // WithFields adds structured fields to the logger
@@ -79,25 +112,58 @@ func (l *Logger) WithFields(fields map[string]any) *Logger {
 	return &Logger{
 		logger: newLogger,
 		level:  l.level,
+		format: l.format,
 	}
 }
 
 // Debug logs a debug message
 func (l *Logger) Debug(msg string, args ...any) {
-	l.logger.Debug(msg, args...)
+	l.logger.Debug(l.message(msg), args...)
 }
 
 // Info logs an info message
 func (l *Logger) Info(msg string, args ...any) {
-	l.logger.Info(msg, args...)
+	l.logger.Info(l.message(msg), args...)
 }
 
 // Warn logs a warning message
 func (l *Logger) Warn(msg string, args ...any) {
-	l.logger.Warn(msg, args...)
+	l.logger.Warn(l.message(msg), args...)
 }
 
 // Error logs an error message
 func (l *Logger) Error(msg string, args ...any) {
-	l.logger.Error(msg, args...)
+	l.logger.Error(l.message(msg), args...)
+}
+
+// message returns the message as it's logged: without emojis in JSON lines
+func (l *Logger) message(msg string) string {
+	if l.format == FormatJSON {
+		return StripEmojis(msg)
+	}
+
+	return msg
+}
+
+// StripEmojis removes the emojis (and the spaces they leave around) from a message, e.g. "✅ Done! 🎉"
+// becomes "Done!"
+func StripEmojis(msg string) string {
+	stripped := strings.Map(func(r rune) rune {
+		// Symbols, and the variation selectors and joiners composing emojis
+		if unicode.Is(unicode.So, r) || r == '\uFE0F' || r == '\uFE0E' || r == '\u200D' {
+			return -1
+		}
+		return r
+	}, msg)
+
+	if stripped == msg {
+		return msg
+	}
+
+	lines := strings.Split(stripped, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
 }
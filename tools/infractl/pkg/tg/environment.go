@@ -0,0 +1,111 @@
+package tg
+
+import (
+	"os"
+	"strings"
+)
+
+// InheritEnvVar lists (comma separated) extra variables of the infractl environment passed down to terragrunt,
+// e.g. AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY for the credentials of the remote state backend
+const InheritEnvVar = "INFRACTL_INHERIT_ENV"
+
+// scopedEnvVarPrefix is the prefix of the variables infractl sets per component (the compiled configuration file
+// and the sealed values): they're never inherited from the infractl environment, only set for the process.
+const scopedEnvVarPrefix = "INFRACTL_"
+
+// inheritedEnvVars are the variables of the infractl environment passed down to terragrunt: what terragrunt,
+// terraform and the tools they run (git, ssh) need to work, and the AWS configuration the S3 remote state backend
+// authenticates with. Everything else, e.g. the static credentials loaded from .env that the secrets were resolved
+// from, is left out.
+var inheritedEnvVars = map[string]bool{
+	"PATH": true, "HOME": true, "USER": true, "LOGNAME": true, "SHELL": true, "TERM": true, "LANG": true,
+	"TZ": true, "TMPDIR": true, "TMP": true, "TEMP": true, "SSH_AUTH_SOCK": true,
+	"SSL_CERT_FILE": true, "SSL_CERT_DIR": true,
+	"HTTP_PROXY": true, "HTTPS_PROXY": true, "NO_PROXY": true, "http_proxy": true, "https_proxy": true, "no_proxy": true,
+	// AWS configuration and profiles: the credentials they point to are read by the AWS SDK, not from the environment
+	"AWS_PROFILE": true, "AWS_DEFAULT_PROFILE": true, "AWS_REGION": true, "AWS_DEFAULT_REGION": true,
+	"AWS_CONFIG_FILE": true, "AWS_SHARED_CREDENTIALS_FILE": true, "AWS_SDK_LOAD_CONFIG": true,
+	"AWS_ROLE_ARN": true, "AWS_ROLE_SESSION_NAME": true, "AWS_WEB_IDENTITY_TOKEN_FILE": true,
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": true, "AWS_CONTAINER_CREDENTIALS_FULL_URI": true,
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE": true, "AWS_EC2_METADATA_DISABLED": true,
+	"AWS_STS_REGIONAL_ENDPOINTS": true, "AWS_CA_BUNDLE": true, "AWS_ENDPOINT_URL": true, "AWS_ENDPOINT_URL_S3": true,
+	"AWS_ENDPOINT_URL_DYNAMODB": true, "AWS_ENDPOINT_URL_STS": true,
+	// Windows
+	"SYSTEMROOT": true, "SystemRoot": true, "WINDIR": true, "COMSPEC": true, "PATHEXT": true, "USERPROFILE": true,
+	"APPDATA": true, "LOCALAPPDATA": true, "PROGRAMDATA": true,
+}
+
+// inheritedEnvVarPrefixes are the prefixes of the variables passed down to terragrunt, on top of inheritedEnvVars
+var inheritedEnvVarPrefixes = []string{"TF_", "TG_", "TERRAGRUNT_", "LC_", "XDG_", "GIT_"}
+
+// ChildEnv builds the environment of a terragrunt process from an allowlist of the given environment (e.g.
+// os.Environ()): the variables terragrunt and terraform need (PATH, HOME, TF_*, TG_*...), the AWS configuration
+// and profile variables, and the ones listed in INFRACTL_INHERIT_ENV. The denied variables are left out even when
+// they're allowlisted, unless they're listed in INFRACTL_INHERIT_ENV. The INFRACTL_* variables of the given
+// environment are always left out: env, added last, holds the ones scoped to the process.
+//
+// Parameters:
+//   - environ: The environment to pick the inherited variables from, as KEY=VALUE.
+//   - denied: Names of variables not passed down unless listed in INFRACTL_INHERIT_ENV, e.g. the ones the
+//     secrets are resolved from.
+//   - env: Variables (KEY=VALUE) set for the process, e.g. its scoped INFRACTL_* values.
+//
+// Returns:
+//   - The environment of the terragrunt process, as KEY=VALUE.
+func ChildEnv(environ, denied, env []string) []string {
+	deniedNames := map[string]bool{}
+	for _, name := range denied {
+		deniedNames[name] = true
+	}
+
+	extraNames := map[string]bool{}
+	for _, name := range strings.Split(envValue(environ, InheritEnvVar), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			extraNames[name] = true
+		}
+	}
+
+	childEnv := []string{}
+	for _, variable := range environ {
+		name, _, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, scopedEnvVarPrefix) {
+			continue
+		}
+
+		allowed := extraNames[name] || (!deniedNames[name] && (inheritedEnvVars[name] || hasInheritedPrefix(name)))
+		if !allowed {
+			continue
+		}
+		childEnv = append(childEnv, variable)
+	}
+
+	return append(childEnv, env...)
+}
+
+// hasInheritedPrefix reports whether a variable is passed down to terragrunt for its prefix.
+func hasInheritedPrefix(name string) bool {
+	for _, prefix := range inheritedEnvVarPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// envValue returns the value of a variable of an environment, or an empty string if it's not set.
+func envValue(environ []string, name string) string {
+	for _, variable := range environ {
+		if key, value, found := strings.Cut(variable, "="); found && key == name {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// processEnv builds the environment of a terragrunt process run with the given options, from the environment of
+// infractl (see ChildEnv).
+func processEnv(opts TerragruntOptions) []string {
+	return ChildEnv(os.Environ(), opts.DeniedEnv, opts.Env)
+}
@@ -0,0 +1,144 @@
+package tg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestChildEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/infra",
+		"AWS_ACCESS_KEY_ID=AKIA",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"CLOUDFLARE_API_TOKEN=token",
+		"TF_LOG=debug",
+		"TF_VAR_db_password=hunter2",
+		"TG_NON_INTERACTIVE=true",
+		"INFRACTL_SECRET_AWS_ACCESS_KEY=leaked",
+		"AWS_PROFILE=infra",
+	}
+
+	tests := []struct {
+		name    string
+		environ []string
+		denied  []string
+		env     []string
+		want    []string
+	}{
+		{
+			name:    "allowlisted variables only",
+			environ: environ,
+			want:    []string{"PATH=/usr/bin", "HOME=/home/infra", "TF_LOG=debug", "TF_VAR_db_password=hunter2", "TG_NON_INTERACTIVE=true", "AWS_PROFILE=infra"},
+		},
+		{
+			name:    "denied variables are left out even when allowlisted",
+			environ: environ,
+			denied:  []string{"TF_VAR_db_password", "AWS_ACCESS_KEY_ID"},
+			want:    []string{"PATH=/usr/bin", "HOME=/home/infra", "TF_LOG=debug", "TG_NON_INTERACTIVE=true", "AWS_PROFILE=infra"},
+		},
+		{
+			name:    "scoped variables are added last",
+			environ: []string{"PATH=/usr/bin", "INFRACTL_CONFIG_FILE_PATH=/other.json"},
+			env:     []string{"INFRACTL_CONFIG_FILE_PATH=/scoped.json", "INFRACTL_PROVIDER_AWS_REGION=eu-west-1"},
+			want:    []string{"PATH=/usr/bin", "INFRACTL_CONFIG_FILE_PATH=/scoped.json", "INFRACTL_PROVIDER_AWS_REGION=eu-west-1"},
+		},
+		{
+			name:    "extra variables listed in INFRACTL_INHERIT_ENV, denied or not",
+			environ: append([]string{InheritEnvVar + "=CLOUDFLARE_API_TOKEN, AWS_ACCESS_KEY_ID"}, environ...),
+			denied:  []string{"CLOUDFLARE_API_TOKEN", "TF_VAR_db_password"},
+			want:    []string{"PATH=/usr/bin", "HOME=/home/infra", "AWS_ACCESS_KEY_ID=AKIA", "CLOUDFLARE_API_TOKEN=token", "TF_LOG=debug", "TG_NON_INTERACTIVE=true", "AWS_PROFILE=infra"},
+		},
+		{
+			name:    "INFRACTL_* variables are only set for the process",
+			environ: []string{InheritEnvVar + "=INFRACTL_SECRET_AWS_ACCESS_KEY", "INFRACTL_SECRET_AWS_ACCESS_KEY=leaked", "INFRACTL_CONFIG_FILE_PATH=/other.json"},
+			env:     []string{"INFRACTL_CONFIG_FILE_PATH=/scoped.json"},
+			want:    []string{"INFRACTL_CONFIG_FILE_PATH=/scoped.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ChildEnv(tt.environ, tt.denied, tt.env)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChildEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestChildEnvKeepsBackendCredentials checks that the S3 remote state backend, which root.hcl configures without
+// credentials, can authenticate: with a profile, or with static keys the provider configuration reads too.
+func TestChildEnvKeepsBackendCredentials(t *testing.T) {
+	// The secrets and the aws provider configuration read the static keys: they're denied
+	denied := []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"}
+
+	tests := []struct {
+		name    string
+		environ []string
+		want    []string
+	}{
+		{
+			name: "profile and region",
+			environ: []string{
+				"AWS_PROFILE=infra", "AWS_REGION=eu-west-1", "AWS_DEFAULT_REGION=eu-west-1",
+				"AWS_CONFIG_FILE=/home/infra/.aws/config", "AWS_SHARED_CREDENTIALS_FILE=/home/infra/.aws/credentials",
+				"AWS_ACCESS_KEY_ID=AKIA", "AWS_SECRET_ACCESS_KEY=secret",
+			},
+			want: []string{
+				"AWS_PROFILE=infra", "AWS_REGION=eu-west-1", "AWS_DEFAULT_REGION=eu-west-1",
+				"AWS_CONFIG_FILE=/home/infra/.aws/config", "AWS_SHARED_CREDENTIALS_FILE=/home/infra/.aws/credentials",
+			},
+		},
+		{
+			name: "web identity",
+			environ: []string{
+				"AWS_ROLE_ARN=arn:aws:iam::123456789012:role/ci", "AWS_WEB_IDENTITY_TOKEN_FILE=/var/run/token",
+				"AWS_REGION=eu-west-1",
+			},
+			want: []string{
+				"AWS_ROLE_ARN=arn:aws:iam::123456789012:role/ci", "AWS_WEB_IDENTITY_TOKEN_FILE=/var/run/token",
+				"AWS_REGION=eu-west-1",
+			},
+		},
+		{
+			name: "static keys listed in INFRACTL_INHERIT_ENV",
+			environ: []string{
+				InheritEnvVar + "=AWS_ACCESS_KEY_ID,AWS_SECRET_ACCESS_KEY,AWS_SESSION_TOKEN",
+				"AWS_ACCESS_KEY_ID=AKIA", "AWS_SECRET_ACCESS_KEY=secret", "AWS_SESSION_TOKEN=session", "AWS_REGION=eu-west-1",
+			},
+			want: []string{"AWS_ACCESS_KEY_ID=AKIA", "AWS_SECRET_ACCESS_KEY=secret", "AWS_SESSION_TOKEN=session", "AWS_REGION=eu-west-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ChildEnv(tt.environ, denied, nil)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChildEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTerragruntCommandDoesNotInheritCredentials(t *testing.T) {
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("TF_VAR_token", "token")
+
+	cmd := buildTerragruntCommand(context.Background(), TerragruntBinary, TerragruntOptions{
+		Command:   "plan",
+		Env:       []string{"INFRACTL_CONFIG_FILE_PATH=/scoped.json"},
+		DeniedEnv: []string{"TF_VAR_token"},
+	})
+
+	for _, variable := range cmd.Env {
+		if variable == "AWS_SECRET_ACCESS_KEY=secret" || variable == "TF_VAR_token=token" {
+			t.Errorf("terragrunt inherits %s", variable)
+		}
+	}
+
+	if got := envValue(cmd.Env, "INFRACTL_CONFIG_FILE_PATH"); got != "/scoped.json" {
+		t.Errorf("INFRACTL_CONFIG_FILE_PATH = %q, want /scoped.json", got)
+	}
+}
@@ -0,0 +1,369 @@
+package tg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
+)
+
+// TerragruntBinary is the name of the terragrunt executable, looked up in PATH
+const TerragruntBinary = "terragrunt"
+
+// DefaultGracePeriod is how long an interrupted terragrunt process is given to exit (e.g. to release its
+// state lock) before it's killed
+const DefaultGracePeriod = 30 * time.Second
+
+// InterruptedError is the cause of a context cancelled because infractl received a signal. The running
+// terragrunt processes are interrupted with that signal.
+type InterruptedError struct {
+	Signal os.Signal
+}
+
+func (e *InterruptedError) Error() string {
+	switch e.Signal {
+	case os.Interrupt:
+		return "interrupted by SIGINT"
+	case syscall.SIGTERM:
+		return "interrupted by SIGTERM"
+	}
+
+	return "interrupted by " + e.Signal.String()
+}
+
+// Result is the outcome of a terragrunt invocation
+type Result struct {
+	// Command is the terragrunt command that ran (e.g. plan, run-all apply)
+	Command string
+	// Args are the arguments terragrunt was invoked with
+	Args       []string
+	WorkingDir string
+	// ExitCode is the exit code of the process; -1 when it couldn't be started or was killed by a signal
+	ExitCode int
+	Duration time.Duration
+	// Stdout and Stderr hold the output of the process, as streamed (sensitive values masked)
+	Stdout string
+	Stderr string
+}
+
+// Executor runs terragrunt commands. CommandExecutor runs the terragrunt binary; FakeExecutor replays canned
+// output, so the controller and the CLI can run without terragrunt installed.
+type Executor interface {
+	// Execute runs the terragrunt command set in the options, streaming its output into the given writers.
+	// The command is interrupted when the context is done. The result is returned even when the command fails.
+	Execute(ctx context.Context, opts StreamOptions) (*Result, error)
+	// LookPath returns the path to the terragrunt executable, or an error if it's not installed.
+	LookPath() (string, error)
+}
+
+// CommandExecutor runs the terragrunt binary found in PATH
+type CommandExecutor struct {
+	// GracePeriod is how long an interrupted terragrunt process is given to exit before it's killed
+	GracePeriod time.Duration
+}
+
+// NewExecutor creates an Executor running the terragrunt binary, with the default grace period
+func NewExecutor() *CommandExecutor {
+	return NewExecutorWithGracePeriod(DefaultGracePeriod)
+}
+
+// NewExecutorWithGracePeriod creates an Executor running the terragrunt binary, giving interrupted processes
+// the given grace period to exit before they're killed
+func NewExecutorWithGracePeriod(gracePeriod time.Duration) *CommandExecutor {
+	return &CommandExecutor{GracePeriod: gracePeriod}
+}
+
+// LookPath returns the path to the terragrunt executable found in PATH
+func (e *CommandExecutor) LookPath() (string, error) {
+	path, err := exec.LookPath(TerragruntBinary)
+	if err != nil {
+		return "", fmt.Errorf("terragrunt is not installed or not in PATH")
+	}
+
+	return path, nil
+}
+
+// Execute runs the terragrunt command set in the options, streaming its output into the given writers.
+//
+// When the context is done the process is interrupted (see interrupt), and killed if it's still running once
+// the grace period is over. Non-interactive runs lead their own process group, so terraform and the providers
+// are signalled along with terragrunt, and nothing is left behind holding a state lock.
+func (e *CommandExecutor) Execute(ctx context.Context, opts StreamOptions) (*Result, error) {
+	cmd := buildTerragruntCommand(ctx, TerragruntBinary, opts.TerragruntOptions)
+	result := &Result{Command: opts.Command, Args: cmd.Args[1:], WorkingDir: cmd.Dir, ExitCode: -1}
+
+	if err := ctx.Err(); err != nil {
+		return result, fmt.Errorf("%s command not run: %w", opts.Command, context.Cause(ctx))
+	}
+
+	outWriter, errWriter, flush := resultWriters(opts, result)
+	defer flush()
+
+	// Interactive runs (e.g. apply without auto-approve) need the terminal to answer prompts, so they stay in
+	// the foreground process group of the terminal.
+	if !opts.NonInteractive {
+		cmd.Stdin = opts.InReader
+		if cmd.Stdin == nil {
+			cmd.Stdin = os.Stdin
+		}
+	} else {
+		startInOwnProcessGroup(cmd)
+	}
+
+	exited := make(chan struct{})
+	cmd.Cancel = func() error {
+		return e.interrupt(ctx, cmd, opts.NonInteractive, exited)
+	}
+
+	// Create pipes for stdout and stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return result, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return result, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	// Start the command
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return result, fmt.Errorf("failed to start terragrunt command: %w", err)
+	}
+
+	// Stream output. Both streams must be fully drained before waiting on the command,
+	// otherwise the pipes are closed while there is still output to read.
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		streamPipe(stdout, outWriter, opts.NonInteractive)
+	}()
+
+	go func() {
+		defer wg.Done()
+		streamPipe(stderr, errWriter, opts.NonInteractive)
+	}()
+
+	wg.Wait()
+
+	// Wait for command completion
+	err = cmd.Wait()
+	close(exited)
+	result.Duration = time.Since(start)
+	result.ExitCode = cmd.ProcessState.ExitCode()
+	flush()
+
+	if err != nil && ctx.Err() != nil {
+		return result, fmt.Errorf("%s command interrupted (%v): %w", opts.Command, context.Cause(ctx), err)
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("%s command failed: %w", opts.Command, err)
+	}
+
+	return result, nil
+}
+
+// interrupt stops a terragrunt process whose context is done, the way Ctrl-C does in a terminal: it's sent the
+// signal infractl received (SIGINT on timeouts and any other cancellation), so terraform stops gracefully and
+// releases its state lock. Interactive runs share the terminal's process group, which a Ctrl-C already reached:
+// SIGINT isn't sent again then, as a second one makes terraform exit right away. If the process hasn't exited
+// once the grace period is over, it's killed, along with its process group.
+func (e *CommandExecutor) interrupt(ctx context.Context, cmd *exec.Cmd, ownProcessGroup bool, exited <-chan struct{}) error {
+	var sig os.Signal = os.Interrupt
+	terminalInterrupt := false
+	var interrupted *InterruptedError
+	if errors.As(context.Cause(ctx), &interrupted) {
+		sig = interrupted.Signal
+		terminalInterrupt = sig == os.Interrupt
+	}
+
+	if ownProcessGroup || !terminalInterrupt {
+		if err := signalProcess(cmd, sig); err != nil {
+			return err
+		}
+	}
+
+	time.AfterFunc(e.GracePeriod, func() {
+		select {
+		case <-exited:
+		default:
+			_ = signalProcess(cmd, os.Kill)
+		}
+	})
+
+	return nil
+}
+
+// resultWriters returns the writers the output of a command is streamed into: the writers of the options
+// (os.Stdout and os.Stderr by default), teed into the captured streams of the result. Sensitive values are
+// masked before anything reaches either. The returned function flushes the writers into the result; it can
+// be called more than once.
+func resultWriters(opts StreamOptions, result *Result) (io.Writer, io.Writer, func()) {
+	outWriter := opts.OutWriter
+	if outWriter == nil {
+		outWriter = os.Stdout
+	}
+	errWriter := opts.ErrWriter
+	if errWriter == nil {
+		errWriter = os.Stderr
+	}
+
+	var stdout, stderr bytes.Buffer
+	outWriter = io.MultiWriter(outWriter, &stdout)
+	errWriter = io.MultiWriter(errWriter, &stderr)
+
+	var redactingOut, redactingErr *utils.RedactingWriter
+	if opts.Redactor != nil {
+		redactingOut = utils.NewRedactingWriter(outWriter, opts.Redactor)
+		redactingErr = utils.NewRedactingWriter(errWriter, opts.Redactor)
+		outWriter, errWriter = redactingOut, redactingErr
+	}
+
+	flush := func() {
+		if redactingOut != nil {
+			_ = redactingOut.Flush()
+			_ = redactingErr.Flush()
+		}
+		result.Stdout = stdout.String()
+		result.Stderr = stderr.String()
+	}
+
+	return outWriter, errWriter, flush
+}
+
+// FakeResponse is the canned outcome of the invocations a FakeExecutor matches it with
+type FakeResponse struct {
+	// Command matches the terragrunt command (e.g. plan, run-all apply); empty matches any command
+	Command string
+	// WorkingDir matches the invocations whose working directory ends with it; empty matches any directory
+	WorkingDir string
+
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	// Err is returned as is; otherwise a non-zero ExitCode fails the invocation like a real terragrunt run
+	Err error
+	// Delay is how long the invocation runs, unless its context is done first, which interrupts it
+	Delay time.Duration
+}
+
+// matches reports whether the response is the one to replay for the options
+func (r FakeResponse) matches(opts TerragruntOptions) bool {
+	if r.Command != "" && r.Command != opts.Command {
+		return false
+	}
+
+	return r.WorkingDir == "" || strings.HasSuffix(strings.TrimSuffix(opts.WorkingDir, "/"), strings.TrimSuffix(r.WorkingDir, "/"))
+}
+
+// Invocation is a terragrunt invocation recorded by a FakeExecutor
+type Invocation struct {
+	Options TerragruntOptions
+	Args    []string
+}
+
+// FakeExecutor is a scriptable Executor: it records every invocation and replays the output of the first
+// response that matches it, in the order they were added. Invocations no response matches succeed without
+// output. It's safe for concurrent use.
+type FakeExecutor struct {
+	// NotInstalled makes LookPath report terragrunt as not installed
+	NotInstalled bool
+
+	mu          sync.Mutex
+	responses   []FakeResponse
+	invocations []Invocation
+}
+
+// NewFakeExecutor creates a FakeExecutor replaying the given responses
+func NewFakeExecutor(responses ...FakeResponse) *FakeExecutor {
+	return &FakeExecutor{responses: responses}
+}
+
+// On adds a response to replay, matched after the ones already added
+func (f *FakeExecutor) On(response FakeResponse) *FakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses = append(f.responses, response)
+	return f
+}
+
+// Invocations returns the invocations recorded so far, in the order they were made
+func (f *FakeExecutor) Invocations() []Invocation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Invocation(nil), f.invocations...)
+}
+
+// LookPath returns a fake path to terragrunt, unless NotInstalled is set
+func (f *FakeExecutor) LookPath() (string, error) {
+	if f.NotInstalled {
+		return "", fmt.Errorf("terragrunt is not installed or not in PATH")
+	}
+
+	return "/fake/bin/" + TerragruntBinary, nil
+}
+
+// Execute records the invocation and replays the response it matches into the given writers
+func (f *FakeExecutor) Execute(ctx context.Context, opts StreamOptions) (*Result, error) {
+	args := BuildArgs(opts.TerragruntOptions)
+
+	f.mu.Lock()
+	f.invocations = append(f.invocations, Invocation{Options: opts.TerragruntOptions, Args: args})
+	var response FakeResponse
+	for _, candidate := range f.responses {
+		if candidate.matches(opts.TerragruntOptions) {
+			response = candidate
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	result := &Result{Command: opts.Command, Args: args, WorkingDir: opts.WorkingDir, ExitCode: response.ExitCode}
+
+	if err := ctx.Err(); err != nil {
+		result.ExitCode = -1
+		return result, fmt.Errorf("%s command not run: %w", opts.Command, context.Cause(ctx))
+	}
+
+	outWriter, errWriter, flush := resultWriters(opts, result)
+	_, _ = io.WriteString(outWriter, response.Stdout)
+	_, _ = io.WriteString(errWriter, response.Stderr)
+	flush()
+
+	if response.Delay > 0 {
+		timer := time.NewTimer(response.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			result.Duration = response.Delay
+		case <-ctx.Done():
+			result.ExitCode = -1
+			return result, fmt.Errorf("%s command interrupted (%v): %w", opts.Command, context.Cause(ctx), ctx.Err())
+		}
+	}
+
+	if response.Err != nil {
+		return result, response.Err
+	}
+
+	if response.ExitCode != 0 {
+		return result, fmt.Errorf("%s command failed: exit status %d", opts.Command, response.ExitCode)
+	}
+
+	return result, nil
+}
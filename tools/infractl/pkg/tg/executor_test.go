@@ -0,0 +1,101 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTerragruntScript stands in for terragrunt: it runs until it's interrupted, then exits the way terraform
+// does once it has released its state lock.
+const fakeTerragruntScript = `#!/bin/sh
+trap 'echo "released the state lock"; exit 130' INT
+echo "running"
+while :; do sleep 0.05; done
+`
+
+// installFakeTerragrunt puts fakeTerragruntScript first in PATH, as the terragrunt binary.
+func installFakeTerragrunt(t *testing.T) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake terragrunt is a shell script")
+	}
+
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, TerragruntBinary), []byte(fakeTerragruntScript), 0o755); err != nil {
+		t.Fatalf("writing the fake terragrunt: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCommandExecutorInterrupt(t *testing.T) {
+	installFakeTerragrunt(t)
+
+	tests := []struct {
+		name           string
+		nonInteractive bool
+		cause          error
+		wantExitCode   int
+		wantReleased   bool
+	}{
+		{
+			name:         "timeout of an interactive run",
+			cause:        errors.New("--timeout of 300ms exceeded"),
+			wantExitCode: 130,
+			wantReleased: true,
+		},
+		{
+			name:           "timeout of a non-interactive run",
+			nonInteractive: true,
+			cause:          errors.New("--timeout of 300ms exceeded"),
+			wantExitCode:   130,
+			wantReleased:   true,
+		},
+		{
+			name:           "Ctrl-C of a non-interactive run",
+			nonInteractive: true,
+			cause:          &InterruptedError{Signal: os.Interrupt},
+			wantExitCode:   130,
+			wantReleased:   true,
+		},
+		{
+			// The terminal already sent SIGINT to the whole foreground process group: it isn't sent again, and
+			// the fake terragrunt, which never received it, is killed once the grace period is over.
+			name:         "Ctrl-C of an interactive run",
+			cause:        &InterruptedError{Signal: os.Interrupt},
+			wantExitCode: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeoutCause(context.Background(), 300*time.Millisecond, tt.cause)
+			defer cancel()
+
+			var stdout strings.Builder
+			executor := NewExecutorWithGracePeriod(time.Second)
+			result, err := executor.Execute(ctx, StreamOptions{
+				TerragruntOptions: TerragruntOptions{Command: "apply", WorkingDir: t.TempDir(), NonInteractive: tt.nonInteractive},
+				OutWriter:         &stdout,
+				ErrWriter:         &strings.Builder{},
+				InReader:          strings.NewReader(""),
+			})
+
+			if err == nil || !strings.Contains(err.Error(), "apply command interrupted ("+tt.cause.Error()+")") {
+				t.Fatalf("Execute() error = %v, want the command interrupted by %q", err, tt.cause)
+			}
+			if result.ExitCode != tt.wantExitCode {
+				t.Errorf("Execute() exit code = %d, want %d", result.ExitCode, tt.wantExitCode)
+			}
+			if released := strings.Contains(result.Stdout, "released the state lock"); released != tt.wantReleased {
+				t.Errorf("Execute() output = %q, want the state lock released: %t", result.Stdout, tt.wantReleased)
+			}
+		})
+	}
+}
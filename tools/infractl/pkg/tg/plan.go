@@ -0,0 +1,142 @@
+package tg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PlanChangesExitCode is the exit code of a plan run with -detailed-exitcode that succeeded with changes
+const PlanChangesExitCode = 2
+
+// Actions of the resource changes of a plan, as summarised in a PlanSummary
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionReplace = "replace"
+	ActionDelete  = "delete"
+)
+
+// ResourceChange is a change to a resource in a Terraform plan
+type ResourceChange struct {
+	Address string `json:"address"`
+	// Action summarises the Terraform actions: create, update, replace or delete; other actions (e.g. forget)
+	// are joined with '-'
+	Action string `json:"action"`
+	// Actions are the Terraform actions, e.g. ["delete", "create"] for a replacement destroying first
+	Actions []string `json:"actions"`
+}
+
+// PlanSummary summarises the changes of the Terraform plan of a component
+type PlanSummary struct {
+	// Component is the ID of the planned component, <stack>/<layer>/<component>
+	Component string `json:"component"`
+	// HasChanges reports whether applying the plan would change anything, resources or outputs
+	HasChanges bool `json:"has_changes"`
+
+	Create  int `json:"create"`
+	Update  int `json:"update"`
+	Replace int `json:"replace"`
+	Delete  int `json:"delete"`
+
+	// ResourceChanges are the resources the plan changes, in the order of the plan; no-ops and data source
+	// reads are left out
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+// Destroys reports whether applying the plan would destroy any resource, deleted or replaced
+func (s PlanSummary) Destroys() bool {
+	return s.Delete > 0 || s.Replace > 0
+}
+
+// String summarises the plan the way Terraform does, e.g. "1 to create, 0 to update, 0 to replace, 2 to delete"
+func (s PlanSummary) String() string {
+	if !s.HasChanges {
+		return "no changes"
+	}
+
+	return fmt.Sprintf("%d to create, %d to update, %d to replace, %d to delete", s.Create, s.Update, s.Replace, s.Delete)
+}
+
+// planJSON is the part of the 'terraform show -json' representation of a plan a PlanSummary is made of
+type planJSON struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+	OutputChanges map[string]struct {
+		Actions []string `json:"actions"`
+	} `json:"output_changes"`
+}
+
+// ParsePlanJSON summarises the changes of a plan, from its 'terraform show -json' representation.
+//
+// Parameters:
+//   - component: The ID of the planned component.
+//   - data: The output of 'terraform show -json <plan file>'.
+//
+// Returns:
+//   - The summary of the plan.
+//   - An error if the output is not the JSON representation of a plan.
+func ParsePlanJSON(component string, data []byte) (*PlanSummary, error) {
+	var plan planJSON
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse the JSON representation of the plan of %s: %w", component, err)
+	}
+
+	summary := &PlanSummary{Component: component, ResourceChanges: []ResourceChange{}}
+
+	for _, resource := range plan.ResourceChanges {
+		action := summariseActions(resource.Change.Actions)
+		if action == "" {
+			continue
+		}
+
+		switch action {
+		case ActionCreate:
+			summary.Create++
+		case ActionUpdate:
+			summary.Update++
+		case ActionReplace:
+			summary.Replace++
+		case ActionDelete:
+			summary.Delete++
+		}
+
+		summary.ResourceChanges = append(summary.ResourceChanges, ResourceChange{
+			Address: resource.Address,
+			Action:  action,
+			Actions: resource.Change.Actions,
+		})
+	}
+
+	summary.HasChanges = len(summary.ResourceChanges) > 0
+	for _, output := range plan.OutputChanges {
+		if summariseActions(output.Actions) != "" {
+			summary.HasChanges = true
+		}
+	}
+
+	return summary, nil
+}
+
+// summariseActions maps the Terraform actions of a change to a single action, or to an empty string for the
+// changes that don't change anything (no-op, and data source reads).
+func summariseActions(actions []string) string {
+	switch strings.Join(actions, ",") {
+	case "", "no-op", "read":
+		return ""
+	case "create":
+		return ActionCreate
+	case "update":
+		return ActionUpdate
+	case "delete":
+		return ActionDelete
+	case "delete,create", "create,delete":
+		return ActionReplace
+	}
+
+	return strings.Join(actions, "-")
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package tg
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startInOwnProcessGroup makes the command the leader of a new process group once started, so the processes it
+// spawns (terraform, providers) are signalled with it, and a Ctrl-C in the terminal only reaches infractl.
+func startInOwnProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcess sends a signal to a started command: to its whole process group when it leads one, to the
+// process alone otherwise.
+func signalProcess(cmd *exec.Cmd, sig os.Signal) error {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		if sysSig, ok := sig.(syscall.Signal); ok {
+			return syscall.Kill(-cmd.Process.Pid, sysSig)
+		}
+	}
+
+	return cmd.Process.Signal(sig)
+}
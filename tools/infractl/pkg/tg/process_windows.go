@@ -0,0 +1,16 @@
+//go:build windows
+
+package tg
+
+import (
+	"os"
+	"os/exec"
+)
+
+// startInOwnProcessGroup is a no-op on Windows, where process groups cannot be signalled.
+func startInOwnProcessGroup(_ *exec.Cmd) {}
+
+// signalProcess stops a started command. Windows cannot deliver signals to a process: it's killed right away.
+func signalProcess(cmd *exec.Cmd, _ os.Signal) error {
+	return cmd.Process.Kill()
+}
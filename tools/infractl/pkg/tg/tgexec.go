@@ -2,12 +2,14 @@
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/pkg/utils"
 )
 
 // TerragruntOptions represents comprehensive configuration options for Terragrunt commands
@@ -39,13 +41,23 @@ type TerragruntOptions struct {
 	// Additional arguments for maximum flexibility
 	AdditionalArgs []string
 
+	// Environment variables (KEY=VALUE) passed to the terragrunt process, on top of the allowlisted variables of
+	// the current environment (see ChildEnv)
+	Env []string
+	// DeniedEnv are the names of the variables of the current environment never passed to the terragrunt process,
+	// even when they're allowlisted, e.g. the ones the secrets of the configuration are resolved from
+	DeniedEnv []string
+
 	// Output and logging
 	JsonOutputDir string
 	OutputDir     string
+
+	// Redactor, when set, masks sensitive values (e.g. resolved secrets) in the streamed output
+	Redactor *utils.Redactor
 }
 
-// buildTerragruntCommand constructs a comprehensive Terragrunt command
-func buildTerragruntCommand(opts TerragruntOptions) *exec.Cmd {
+// BuildArgs constructs the arguments of the terragrunt invocation described by the options
+func BuildArgs(opts TerragruntOptions) []string {
 	args := []string{}
 
 	// Add command
@@ -136,14 +148,22 @@ func buildTerragruntCommand(opts TerragruntOptions) *exec.Cmd {
 	// Additional arguments for maximum flexibility
 	args = append(args, opts.AdditionalArgs...)
 
+	return args
+}
+
+// buildTerragruntCommand constructs a comprehensive Terragrunt command, running the given binary until the
+// context is done
+func buildTerragruntCommand(ctx context.Context, binary string, opts TerragruntOptions) *exec.Cmd {
 	workingDir := opts.WorkingDir
 	if workingDir == "" {
 		workingDir = "."
 	}
 
-	cmd := exec.Command("terragrunt", args...)
+	cmd := exec.CommandContext(ctx, binary, BuildArgs(opts)...)
 	cmd.Dir = workingDir
 
+	cmd.Env = processEnv(opts)
+
 	return cmd
 }
 
@@ -155,114 +175,73 @@ type StreamOptions struct {
 	// Optional custom output writers (defaults to os.Stdout and os.Stderr)
 	OutWriter io.Writer
 	ErrWriter io.Writer
-}
-
-// streamCommand is a generic method to stream command output
-func streamCommand(opts StreamOptions) error {
-	// Build the base Terragrunt command
-	cmd := buildTerragruntCommand(opts.TerragruntOptions)
-	if cmd == nil {
-		return fmt.Errorf("failed to build terragrunt command: invalid configuration")
-	}
 
-	// Use default writers if not provided
-	outWriter := opts.OutWriter
-	if outWriter == nil {
-		outWriter = os.Stdout
-	}
-	errWriter := opts.ErrWriter
-	if errWriter == nil {
-		errWriter = os.Stderr
-	}
-
-	// Create pipes for stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
-	}
+	// Optional custom input reader (defaults to os.Stdin), used to answer interactive prompts
+	InReader io.Reader
+}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
+// streamPipe copies a command output pipe into the given writer. Non-interactive runs are streamed
+// line by line; interactive runs are copied as-is so prompts without a trailing newline (e.g. Terraform's
+// "Enter a value:") are shown to the user before they answer.
+func streamPipe(pipe io.Reader, writer io.Writer, lineByLine bool) {
+	if !lineByLine {
+		_, _ = io.Copy(writer, pipe)
+		return
 	}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start terragrunt command: %w", err)
-	}
-
-	// Create scanners
-	stdoutScanner := bufio.NewScanner(stdout)
-	stderrScanner := bufio.NewScanner(stderr)
-
-	// Stream output
-	go func() {
-		for stdoutScanner.Scan() {
-			fmt.Fprintln(outWriter, stdoutScanner.Text())
-		}
-	}()
-
-	go func() {
-		for stderrScanner.Scan() {
-			fmt.Fprintln(errWriter, stderrScanner.Text())
-		}
-	}()
-
-	// Wait for command completion
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("%s command failed: %w", opts.Command, err)
+	scanner := bufio.NewScanner(pipe)
+	for scanner.Scan() {
+		fmt.Fprintln(writer, scanner.Text())
 	}
+}
 
-	return nil
+// Stream runs the terragrunt command set in the options, streaming its output into the given writers.
+// The command is interrupted when the context is done.
+func Stream(ctx context.Context, opts StreamOptions) error {
+	_, err := NewExecutor().Execute(ctx, opts)
+	return err
 }
 
-// Plan runs terragrunt plan with streaming output
-func Plan(opts TerragruntOptions) error {
+// execute runs the terragrunt command of the options with the default executor, streaming its output
+func execute(ctx context.Context, command string, opts TerragruntOptions) error {
 	streamOpts := StreamOptions{
 		TerragruntOptions: opts,
 	}
-	streamOpts.Command = "plan"
-	return streamCommand(streamOpts)
+	streamOpts.Command = command
+	return Stream(ctx, streamOpts)
+}
+
+// Plan runs terragrunt plan with streaming output
+func Plan(ctx context.Context, opts TerragruntOptions) error {
+	return execute(ctx, "plan", opts)
 }
 
 // Apply runs terragrunt apply with streaming output
-func Apply(opts TerragruntOptions) error {
-	streamOpts := StreamOptions{
-		TerragruntOptions: opts,
-	}
-	streamOpts.Command = "apply"
-	return streamCommand(streamOpts)
+func Apply(ctx context.Context, opts TerragruntOptions) error {
+	return execute(ctx, "apply", opts)
 }
 
 // Destroy runs terragrunt destroy with streaming output
-func Destroy(opts TerragruntOptions) error {
-	streamOpts := StreamOptions{
-		TerragruntOptions: opts,
-	}
-	streamOpts.Command = "destroy"
-	return streamCommand(streamOpts)
+func Destroy(ctx context.Context, opts TerragruntOptions) error {
+	return execute(ctx, "destroy", opts)
 }
 
 // RunAll executes terragrunt run-all with specified command and streaming output
-func RunAll(command string, opts TerragruntOptions) error {
-	streamOpts := StreamOptions{
-		TerragruntOptions: opts,
-	}
-	streamOpts.Command = "run-all " + command
-	return streamCommand(streamOpts)
+func RunAll(ctx context.Context, command string, opts TerragruntOptions) error {
+	return execute(ctx, "run-all "+command, opts)
 }
 
 // RunAllPlan is a convenience method for run-all plan
-func RunAllPlan(opts TerragruntOptions) error {
-	return RunAll("plan", opts)
+func RunAllPlan(ctx context.Context, opts TerragruntOptions) error {
+	return RunAll(ctx, "plan", opts)
 }
 
 // RunAllApply is a convenience method for run-all apply
-func RunAllApply(opts TerragruntOptions) error {
-	return RunAll("apply", opts)
+func RunAllApply(ctx context.Context, opts TerragruntOptions) error {
+	return RunAll(ctx, "apply", opts)
 }
 
 // RunAllDestroy is a convenience method for run-all destroy
-func RunAllDestroy(opts TerragruntOptions) error {
-	return RunAll("destroy", opts)
+func RunAllDestroy(ctx context.Context, opts TerragruntOptions) error {
+	return RunAll(ctx, "destroy", opts)
 }
@@ -5,7 +5,10 @@
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 )
 
 // GenerateHashFileWithSHA256 calculates the SHA-256 hash of a file's contents.
@@ -34,3 +37,66 @@ func GenerateHashFileWithSHA256(filePath string) (string, error) {
 
 	return hex.EncodeToString(hash[:]), nil
 }
+
+// GenerateHashDirWithSHA256 calculates a SHA-256 hash that represents the contents of a directory.
+//
+// Every regular file under the directory contributes its path (relative to the directory) and the
+// SHA-256 hash of its contents. Files are processed in lexical order, so the result is stable across
+// runs and only changes when a file is added, removed, renamed or modified.
+//
+// Parameters:
+//   - dirPath: The full path to the directory to be hashed
+//   - excludeDirs: Names of directories to skip at any depth (e.g. ".terragrunt-cache")
+//
+// Returns:
+//   - A string representing the SHA-256 hash of the directory contents
+//   - An error if the directory cannot be walked or any of its files cannot be hashed
+func GenerateHashDirWithSHA256(dirPath string, excludeDirs ...string) (string, error) {
+	excluded := make(map[string]bool, len(excludeDirs))
+	for _, dir := range excludeDirs {
+		excluded[dir] = true
+	}
+
+	var files []string
+	walkErr := filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if path != dirPath && excluded[entry.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.Type().IsRegular() {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	if walkErr != nil {
+		return "", fmt.Errorf("failed to walk directory %s: %w", dirPath, walkErr)
+	}
+
+	sort.Strings(files)
+
+	hasher := sha256.New()
+	for _, file := range files {
+		relPath, err := filepath.Rel(dirPath, file)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve relative path for %s: %w", file, err)
+		}
+
+		fileHash, err := GenerateHashFileWithSHA256(file)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(hasher, "%s:%s\n", filepath.ToSlash(relPath), fileHash)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -68,3 +68,23 @@ func ExecuteBinaryCommand(binaryName string, workingDir string, args ...string)
 
 	return output, nil
 }
+
+// OpenInEditor opens a file in the user's editor ($EDITOR, defaulting to vi), attached to the terminal, and
+// waits for it to be closed. The editor command can hold arguments, e.g. EDITOR="code --wait".
+func OpenInEditor(path string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "editor", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor '%s' failed: %w", editor, err)
+	}
+
+	return nil
+}
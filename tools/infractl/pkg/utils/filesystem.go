@@ -222,16 +222,20 @@ func CreateDirIdempotent(path string) error {
 // Parameters:
 //   - path: The full path where the file should be created
 //   - content: The string content to write to the file
+//   - perm: The mode of the file, also enforced when the file already exists with the same content
 //
 // Returns:
 //   - The full path of the created file
 //   - An error if the file exists or cannot be created
-func CreateFileWithContentIdempotent(filepath string, content string) (string, error) {
+func CreateFileWithContentIdempotent(filepath string, content string, perm os.FileMode) (string, error) {
 	// Check if file exists and has same content
 	existingContent, err := os.ReadFile(filepath)
 	if err == nil {
 		// File exists, check if content matches
 		if string(existingContent) == content {
+			if err := os.Chmod(filepath, perm); err != nil {
+				return "", fmt.Errorf("failed to set the mode of file %s: %w", filepath, err)
+			}
 			return filepath, nil // File exists with same content, return success
 		}
 		return "", fmt.Errorf("file exists with different content at path: %s", filepath)
@@ -246,7 +250,7 @@ func CreateFileWithContentIdempotent(filepath string, content string) (string, e
 	}
 
 	// Create the file
-	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
 	if err != nil {
 		return "", fmt.Errorf("failed to create file: %w", err)
 	}
@@ -2,9 +2,14 @@
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -35,6 +40,146 @@ func FindGitRepoRoot() (string, error) {
 	}
 }
 
+// GetGitHeadSHA returns the full SHA of the commit currently checked out (HEAD) in the given repository.
+func GetGitHeadSHA(gitRepoRootPath string) (string, error) {
+	if gitRepoRootPath == "" {
+		return "", fmt.Errorf("git repository root path cannot be empty")
+	}
+
+	output, err := ExecuteCommand("git", "-C", gitRepoRootPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the git HEAD commit in %s: %w", gitRepoRootPath, err)
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// GetGitChangedFiles returns the files of the working tree that differ from a git ref (a commit, branch or tag):
+// the files changed, added or deleted since the ref, staged or not, and the untracked files that are not ignored.
+// Renamed files are listed under their old and their new path.
+//
+// Parameters:
+//   - gitRepoRootPath: The root path of the git repository
+//   - ref: The git ref to diff the working tree against, e.g. origin/main
+//
+// Returns:
+//   - The changed files, relative to the repository root and sorted, without duplicates
+//   - An error if the ref cannot be resolved, or git fails
+func GetGitChangedFiles(gitRepoRootPath, ref string) ([]string, error) {
+	if gitRepoRootPath == "" {
+		return nil, fmt.Errorf("git repository root path cannot be empty")
+	}
+	if ref == "" {
+		return nil, fmt.Errorf("git ref cannot be empty")
+	}
+
+	if _, err := ExecuteCommand("git", "-C", gitRepoRootPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return nil, fmt.Errorf("git ref '%s' cannot be resolved to a commit in %s", ref, gitRepoRootPath)
+	}
+
+	diffOutput, err := ExecuteCommand("git", "-C", gitRepoRootPath, "diff", "--name-only", "--no-renames", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff the working tree against '%s': %w", ref, err)
+	}
+
+	untrackedOutput, err := ExecuteCommand("git", "-C", gitRepoRootPath, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the untracked files of %s: %w", gitRepoRootPath, err)
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	for _, line := range strings.Split(diffOutput+"\n"+untrackedOutput, "\n") {
+		file := strings.TrimSpace(line)
+		if file == "" || seen[file] {
+			continue
+		}
+		seen[file] = true
+		files = append(files, file)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// GetGitFilesAtRef returns the files of a directory as they are at a git ref, with their content. The files are
+// listed with 'git ls-tree' and read at once with 'git cat-file --batch', so reading a directory runs git twice
+// whatever the number of files.
+//
+// Parameters:
+//   - gitRepoRootPath: The root path of the git repository
+//   - ref: The git ref to read the files from
+//   - dir: The directory, relative to the repository root
+//
+// Returns:
+//   - The content of every file of the directory (recursively) at the ref, by path relative to the repository root
+//   - An error if the ref cannot be resolved, or a file cannot be read
+func GetGitFilesAtRef(gitRepoRootPath, ref, dir string) (map[string][]byte, error) {
+	if gitRepoRootPath == "" {
+		return nil, fmt.Errorf("git repository root path cannot be empty")
+	}
+
+	listOutput, err := ExecuteCommand("git", "-C", gitRepoRootPath, "ls-tree", "-r", "-z", ref, "--", filepath.ToSlash(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the files of %s at '%s': %w", dir, ref, err)
+	}
+
+	// Each entry is '<mode> <type> <object>\t<path>'; submodules (commits) have no content to read
+	var paths, objects []string
+	for _, entry := range strings.Split(listOutput, "\x00") {
+		info, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		paths = append(paths, path)
+		objects = append(objects, fields[2])
+	}
+
+	files := map[string][]byte{}
+	if len(objects) == 0 {
+		return files, nil
+	}
+
+	cmd := exec.Command("git", "-C", gitRepoRootPath, "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(objects, "\n") + "\n")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to read the files of %s at '%s': %w\n%s", dir, ref, err, strings.TrimSpace(stderr.String()))
+	}
+
+	// Each object is printed as '<object> <type> <size>\n<content>\n', in the order they were asked for
+	reader := bufio.NewReader(&stdout)
+	for i, path := range paths {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s at '%s': %w", path, ref, err)
+		}
+
+		fields := strings.Fields(header)
+		if len(fields) != 3 || fields[0] != objects[i] {
+			return nil, fmt.Errorf("failed to read %s at '%s': unexpected object %s", path, ref, strings.TrimSpace(header))
+		}
+
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s at '%s': invalid size in %s", path, ref, strings.TrimSpace(header))
+		}
+
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, fmt.Errorf("failed to read %s at '%s': %w", path, ref, err)
+		}
+		files[path] = content[:size]
+	}
+
+	return files, nil
+}
+
 func AddFolderToGitIgnoreIdempotent(gitRepoRootPath, folderPath string) error {
 	// Validate input paths
 	if gitRepoRootPath == "" {
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Excoriate/terragrunt-ref-arch-v2/tools/infractl/internal/testutil"
+)
+
+func TestGetGitChangedFiles(t *testing.T) {
+	repoRoot := testutil.NewGitRepo(t, map[string]string{
+		".gitignore":         "*.log\n",
+		"modified.txt":       "a\n",
+		"deleted.txt":        "b\n",
+		"renamed/before.txt": "c\n",
+		"staged.txt":         "d\n",
+		"unchanged.txt":      "e\n",
+	})
+
+	// A commit after the ref, then changes left in the working tree
+	testutil.WriteFile(t, repoRoot, "committed.txt", "f\n")
+	testutil.RunGit(t, repoRoot, "add", "committed.txt")
+	testutil.RunGit(t, repoRoot, "commit", "--quiet", "--message", "after base")
+
+	testutil.WriteFile(t, repoRoot, "modified.txt", "a2\n")
+	testutil.WriteFile(t, repoRoot, "staged.txt", "d2\n")
+	testutil.RunGit(t, repoRoot, "add", "staged.txt")
+	testutil.RunGit(t, repoRoot, "rm", "--quiet", "deleted.txt")
+	testutil.RunGit(t, repoRoot, "mv", "renamed/before.txt", "renamed/after.txt")
+	testutil.WriteFile(t, repoRoot, "untracked dir/new file.txt", "g\n")
+	testutil.WriteFile(t, repoRoot, "ignored.log", "h\n")
+
+	got, err := GetGitChangedFiles(repoRoot, "base")
+	if err != nil {
+		t.Fatalf("GetGitChangedFiles() unexpected error: %v", err)
+	}
+
+	want := []string{
+		"committed.txt",
+		"deleted.txt",
+		"modified.txt",
+		"renamed/after.txt",
+		"renamed/before.txt",
+		"staged.txt",
+		"untracked dir/new file.txt",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetGitChangedFiles() = %q, want %q", got, want)
+	}
+
+	if got, err := GetGitChangedFiles(repoRoot, "HEAD~1"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetGitChangedFiles(HEAD~1) = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestGetGitChangedFilesErrors(t *testing.T) {
+	repoRoot := testutil.NewGitRepo(t, map[string]string{"a.txt": "a\n"})
+
+	tests := []struct {
+		name     string
+		repoRoot string
+		ref      string
+		wantErr  string
+	}{
+		{name: "unknown ref", repoRoot: repoRoot, ref: "nope", wantErr: "git ref 'nope' cannot be resolved to a commit"},
+		{name: "no ref", repoRoot: repoRoot, wantErr: "git ref cannot be empty"},
+		{name: "no repository", ref: "base", wantErr: "git repository root path cannot be empty"},
+		{name: "not a repository", repoRoot: t.TempDir(), ref: "base", wantErr: "cannot be resolved to a commit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetGitChangedFiles(tt.repoRoot, tt.ref)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("GetGitChangedFiles() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetGitFilesAtRef(t *testing.T) {
+	repoRoot := testutil.NewGitRepo(t, map[string]string{
+		"envs/base.yaml":            "config:\n  version: \"1.0.0\"\n",
+		"envs/no newline.yaml":      "product: {}",
+		"envs/empty.yaml":           "",
+		"envs/nested/dev.yaml":      "extends: [base]\n\n\n",
+		"envs/binary.bin":           "\x00\x01\n\xff",
+		"other/ignored.yaml":        "a: b\n",
+		"envs-sibling/ignored.yaml": "a: b\n",
+	})
+
+	// Changes after the ref are not read
+	testutil.WriteFile(t, repoRoot, "envs/base.yaml", "config: {}\n")
+	testutil.WriteFile(t, repoRoot, "envs/new.yaml", "a: b\n")
+	testutil.RunGit(t, repoRoot, "add", "--all")
+	testutil.RunGit(t, repoRoot, "commit", "--quiet", "--message", "after base")
+	testutil.WriteFile(t, repoRoot, "envs/nested/dev.yaml", "changed\n")
+
+	got, err := GetGitFilesAtRef(repoRoot, "base", "envs")
+	if err != nil {
+		t.Fatalf("GetGitFilesAtRef() unexpected error: %v", err)
+	}
+
+	want := map[string][]byte{
+		"envs/base.yaml":       []byte("config:\n  version: \"1.0.0\"\n"),
+		"envs/no newline.yaml": []byte("product: {}"),
+		"envs/empty.yaml":      {},
+		"envs/nested/dev.yaml": []byte("extends: [base]\n\n\n"),
+		"envs/binary.bin":      []byte("\x00\x01\n\xff"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetGitFilesAtRef() = %q, want %q", got, want)
+	}
+
+	got, err = GetGitFilesAtRef(repoRoot, "HEAD", filepath.Join("envs", "nested"))
+	if err != nil {
+		t.Fatalf("GetGitFilesAtRef(HEAD) unexpected error: %v", err)
+	}
+	if want := map[string][]byte{"envs/nested/dev.yaml": []byte("extends: [base]\n\n\n")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetGitFilesAtRef(HEAD) = %q, want %q", got, want)
+	}
+
+	got, err = GetGitFilesAtRef(repoRoot, "base", "missing")
+	if err != nil || len(got) != 0 {
+		t.Errorf("GetGitFilesAtRef() of a missing directory = %q, %v, want no files", got, err)
+	}
+
+	if _, err := GetGitFilesAtRef(repoRoot, "nope", "envs"); err == nil || !strings.Contains(err.Error(), "failed to list the files of envs at 'nope'") {
+		t.Errorf("GetGitFilesAtRef() of an unknown ref: error = %v, want the listing to fail", err)
+	}
+}
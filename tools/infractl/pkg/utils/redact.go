@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// RedactedPlaceholder replaces every sensitive value in redacted output.
+	RedactedPlaceholder = "***"
+
+	// minRedactedLength is the length below which values are not redacted: masking every occurrence of a one
+	// or two character value would make the output unreadable, and such values cannot be meaningful secrets.
+	minRedactedLength = 4
+)
+
+// Redactor masks a set of sensitive values in text. Values can be added at any time, e.g. once the secrets
+// are resolved; it's safe for concurrent use.
+type Redactor struct {
+	mu     sync.RWMutex
+	values []string
+}
+
+// NewRedactor creates a redactor masking the given values.
+func NewRedactor(values ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(values...)
+
+	return r
+}
+
+// Add registers more values to mask. Empty values, and values shorter than 4 characters, are ignored.
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	known := make(map[string]bool, len(r.values))
+	for _, value := range r.values {
+		known[value] = true
+	}
+
+	for _, value := range values {
+		if len(value) < minRedactedLength || known[value] {
+			continue
+		}
+		known[value] = true
+		r.values = append(r.values, value)
+	}
+
+	// Longer values first, so a value containing another one is masked as a whole.
+	sort.Slice(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+}
+
+// Redact replaces every sensitive value in s with RedactedPlaceholder.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, value := range r.values {
+		s = strings.ReplaceAll(s, value, RedactedPlaceholder)
+	}
+
+	return s
+}
+
+// pendingPrefixLen returns the length of the longest suffix of s that is the beginning of a sensitive value,
+// which must be held back until the next write tells whether the value is complete.
+func (r *Redactor) pendingPrefixLen(s string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	longest := 0
+	for _, value := range r.values {
+		for n := min(len(value)-1, len(s)); n > longest; n-- {
+			if strings.HasSuffix(s, value[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+
+	return longest
+}
+
+// RedactingWriter masks the values known to a Redactor in everything written to it, before passing it to the
+// underlying writer. Text is passed on as soon as it's written (so prompts without a trailing newline are
+// shown), except for a trailing part that could be the beginning of a sensitive value split across writes,
+// which is held back until the next write, or until Flush is called.
+type RedactingWriter struct {
+	mu       sync.Mutex
+	writer   io.Writer
+	redactor *Redactor
+	pending  string
+}
+
+// NewRedactingWriter creates a writer masking the values known to the redactor.
+func NewRedactingWriter(writer io.Writer, redactor *Redactor) *RedactingWriter {
+	return &RedactingWriter{writer: writer, redactor: redactor}
+}
+
+// Write masks the sensitive values of p, and writes the result to the underlying writer.
+func (w *RedactingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	redacted := w.redactor.Redact(w.pending + string(p))
+	held := w.redactor.pendingPrefixLen(redacted)
+	w.pending = redacted[len(redacted)-held:]
+
+	if out := redacted[:len(redacted)-held]; out != "" {
+		if _, err := io.WriteString(w.writer, out); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the text held back, masked, to the underlying writer.
+func (w *RedactingWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending == "" {
+		return nil
+	}
+
+	_, err := io.WriteString(w.writer, w.redactor.Redact(w.pending))
+	w.pending = ""
+
+	return err
+}
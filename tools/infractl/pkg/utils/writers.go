@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LockedWriter serialises writes to an underlying writer, so several goroutines can share it
+// without interleaving their output in the middle of a write.
+type LockedWriter struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewLockedWriter wraps a writer so it can be shared between goroutines.
+func NewLockedWriter(writer io.Writer) *LockedWriter {
+	return &LockedWriter{writer: writer}
+}
+
+// Write writes p to the underlying writer, holding the lock for the whole write.
+func (w *LockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.writer.Write(p)
+}
+
+// PrefixWriter prefixes every line written to it before passing it to the underlying writer.
+// Partial lines are buffered until they're completed, or until Flush is called.
+type PrefixWriter struct {
+	mu     sync.Mutex
+	writer io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+// NewPrefixWriter creates a writer that prefixes every line with the given prefix.
+func NewPrefixWriter(writer io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{writer: writer, prefix: []byte(prefix)}
+}
+
+// Write buffers p and writes every complete line to the underlying writer, each in a single write.
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		line := make([]byte, 0, len(w.prefix)+idx+1)
+		line = append(line, w.prefix...)
+		line = append(line, w.buf[:idx+1]...)
+		w.buf = w.buf[idx+1:]
+
+		if _, err := w.writer.Write(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line to the underlying writer.
+func (w *PrefixWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	line := append(append([]byte{}, w.prefix...), w.buf...)
+	line = append(line, '\n')
+	w.buf = nil
+
+	_, err := w.writer.Write(line)
+	return err
+}